@@ -142,12 +142,24 @@ func RunMigrations(db *gorm.DB) error {
 		&models.User{},
 		&models.Novel{},
 		&models.Chapter{},
+		&models.ChapterRevision{},
+		&models.ContinuityCheck{},
+		&models.ChapterIssue{},
+		&models.Foreshadowing{},
+		&models.ChapterEntity{},
+		&models.StorySummary{},
+		&models.AutopilotJob{},
+		&models.AutopilotStep{},
 		&models.Character{},
+		&models.CharacterRelationship{},
 		&models.PlotPoint{},
 		&models.Volume{},
 		&models.Storyline{},
 		&models.StoryNode{},
 		&models.NodeConnection{},
+		&models.TimelineCalendar{},
+		&models.TimelineEvent{},
+		&models.TimelineEventCharacter{},
 		&models.NovelSetting{},
 		&models.ChatSession{},
 		&models.ChatMessage{},
@@ -155,5 +167,13 @@ func RunMigrations(db *gorm.DB) error {
 		&models.WritingGoal{},
 		&models.WritingProgress{},
 		&models.Activity{},
+		&models.PromptTemplate{},
+		&models.LLMResponseCache{},
+		&models.LLMUsage{},
+		&models.LLMQuota{},
+		&models.LLMCall{},
+		&models.LLMModelPrice{},
+		&models.LLMCostDaily{},
+		&models.LLMBudgetAlert{},
 	})
 }
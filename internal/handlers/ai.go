@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"github.com/LingByte/LingDialog/internal/models"
 	"github.com/LingByte/LingDialog/pkg/config"
 	"github.com/LingByte/LingDialog/pkg/llm"
 	"github.com/LingByte/LingDialog/pkg/logger"
@@ -13,12 +14,17 @@ import (
 // AIHandler AI 相关的处理器
 type AIHandler struct {
 	db                 *gorm.DB
+	prompts            *dbPromptStore
 	characterGenerator *llm.CharacterGenerator
 	plotGenerator      *llm.PlotGenerator
 	chapterGenerator   *llm.ChapterGenerator
 	styleAnalyzer      *llm.StyleAnalyzer
 	storylineGenerator *llm.StorylineGenerator
 	settingGenerator   *llm.SettingGenerator
+	continuity         *continuityRunner
+	entities           *entityRunner
+	summaries          *summaryRunner
+	autopilot          *autopilotRunner
 }
 
 // NewAIHandler 创建 AI 处理器
@@ -26,7 +32,12 @@ func NewAIHandler(db *gorm.DB) *AIHandler {
 	// 从配置中获取 LLM 设置
 	apiKey, baseURL, model := config.GetLLMConfig()
 
-	if config.IsOllamaProvider() {
+	if config.IsMockProvider() {
+		logger.Info("LLM configured with mock provider",
+			zap.String("fixture_dir", config.GlobalConfig.LLMMockFixtureDir),
+			zap.Bool("record", config.GlobalConfig.LLMMockRecord),
+			zap.String("upstream", config.GlobalConfig.LLMMockUpstream))
+	} else if config.IsOllamaProvider() {
 		logger.Info("LLM configured with Ollama provider",
 			zap.String("llm_base_url", baseURL),
 			zap.String("llm_model", model))
@@ -43,27 +54,59 @@ func NewAIHandler(db *gorm.DB) *AIHandler {
 			zap.Bool("api_key_set", apiKey != ""))
 	}
 
-	characterGenerator := llm.NewCharacterGenerator(apiKey, baseURL, model)
-	plotGenerator := llm.NewPlotGenerator(apiKey, baseURL, model)
-	chapterGenerator := llm.NewChapterGenerator(apiKey, baseURL, model)
-	styleAnalyzer := llm.NewStyleAnalyzer(apiKey, baseURL, model)
-	storylineGenerator := llm.NewStorylineGenerator(apiKey, baseURL, model)
-	settingGenerator := llm.NewSettingGenerator(apiKey, baseURL, model)
+	withCallRecording(db)
+	return newAIHandler(db, withResponseCache(db, llm.NewProviderFromConfig()), model)
+}
+
+// newAIHandler 使用指定的提供商创建 AI 处理器
+func newAIHandler(db *gorm.DB, provider llm.Provider, model string) *AIHandler {
+	// 提示词模板优先使用数据库中的生效版本
+	prompts := &dbPromptStore{db: db}
+	llm.SetPromptStore(prompts)
+	// 按任务路由模型，最外层统计用量，缓存命中同样可见
+	provider = llm.NewMeteredProvider(withModelRouting(db, provider))
+
+	characterGenerator := llm.NewCharacterGenerator(provider, model)
+	plotGenerator := llm.NewPlotGenerator(provider, model)
+	chapterGenerator := llm.NewChapterGenerator(provider, model)
+	styleAnalyzer := llm.NewStyleAnalyzer(provider, model)
+	storylineGenerator := llm.NewStorylineGenerator(provider, model)
+	settingGenerator := llm.NewSettingGenerator(provider, model)
 
-	return &AIHandler{
+	handler := &AIHandler{
 		db:                 db,
+		prompts:            prompts,
 		characterGenerator: characterGenerator,
 		plotGenerator:      plotGenerator,
 		chapterGenerator:   chapterGenerator,
 		styleAnalyzer:      styleAnalyzer,
 		storylineGenerator: storylineGenerator,
 		settingGenerator:   settingGenerator,
+		continuity:         newContinuityRunner(db, provider, model),
+		entities:           newEntityRunner(db, provider, model),
+		summaries:          newSummaryRunner(db, chapterGenerator),
 	}
+	handler.autopilot = newAutopilotRunner(handler)
+	return handler
+}
+
+// ChapterRunners 返回章节保存后续处理使用的后台执行器
+func (h *AIHandler) ChapterRunners() *ChapterRunners {
+	return &ChapterRunners{entities: h.entities, continuity: h.continuity, summaries: h.summaries}
 }
 
-// RegisterAIRoutes 注册 AI 相关路由
-func RegisterAIRoutes(r *gin.RouterGroup, db *gorm.DB) {
+// RegisterAIRoutes 注册 AI 相关路由，返回创建的 AI 处理器
+func RegisterAIRoutes(r *gin.RouterGroup, db *gorm.DB) *AIHandler {
 	handler := NewAIHandler(db)
+	if err := MigrateCharacterProfiles(db); err != nil {
+		logger.Warn("迁移角色结构化档案失败", zap.Error(err))
+	}
+	if err := models.FailInterruptedContinuityChecks(db); err != nil {
+		logger.Warn("结束未完成的连续性检查失败", zap.Error(err))
+	}
+	if err := models.PauseInterruptedAutopilotJobs(db); err != nil {
+		logger.Warn("暂停未执行完的自动写作任务失败", zap.Error(err))
+	}
 
 	ai := r.Group("/ai")
 	ai.Use(middleware.RequireAuth()) // 添加认证中间件
@@ -71,7 +114,7 @@ func RegisterAIRoutes(r *gin.RouterGroup, db *gorm.DB) {
 		// common chat
 		chat := ai.Group("/chat")
 		{
-			chat.POST("", handler.Chat)
+			chat.POST("", handler.meter(llm.TaskChat), handler.Chat)
 			chat.POST("/clear", handler.ClearHistory)
 			chat.GET("/sessions", handler.GetSessions)
 			chat.GET("/sessions/:sessionId/messages", handler.GetSessionMessages)
@@ -84,52 +127,109 @@ func RegisterAIRoutes(r *gin.RouterGroup, db *gorm.DB) {
 		// 小说设定生成
 		novel := ai.Group("/novel")
 		{
-			novel.POST("/generate-setting", handler.GenerateNovelSetting)
+			novel.POST("/generate-setting", handler.meter(featureNovelSetting), handler.GenerateNovelSetting)
+			// 后台执行，用量在汇总结束后计入
+			novel.POST("/refresh-summaries", handler.RefreshStorySummaries)
 		}
 
 		character := ai.Group("/character")
 		{
-			character.POST("/generate", handler.GenerateCharacter)
-			character.POST("/generate-stream", handler.GenerateCharacterStream)
-			character.POST("/enhance", handler.EnhanceDescription)
-			character.POST("/relationships", handler.SuggestRelationships)
+			character.POST("/generate", handler.meter(llm.TaskCharacterGenerate), handler.GenerateCharacter)
+			character.POST("/generate-stream", handler.meter(llm.TaskCharacterGenerate), handler.GenerateCharacterStream)
+			character.POST("/enhance", handler.meter(llm.TaskCharacterEnhance), handler.EnhanceDescription)
+			character.POST("/relationships", handler.meter(llm.TaskCharacterRelationships), handler.SuggestRelationships)
 		}
 
 		plot := ai.Group("/plot")
 		{
-			plot.POST("/generate", handler.GeneratePlot)
-			plot.POST("/enhance", handler.EnhancePlotContent)
+			plot.POST("/generate", handler.meter(llm.TaskPlotGenerate), handler.GeneratePlot)
+			plot.POST("/enhance", handler.meter(llm.TaskPlotEnhance), handler.EnhancePlotContent)
 		}
 
 		chapter := ai.Group("/chapter")
 		{
-			chapter.POST("/generate", handler.GenerateChapter)
-			chapter.POST("/summary", handler.GenerateChapterSummary)
-			chapter.POST("/suggestions", handler.GenerateChapterSuggestions)
-			chapter.POST("/outline", handler.GenerateChapterOutline)
-			chapter.POST("/refine", handler.RefineChapterContent)
-			chapter.POST("/expand", handler.ExpandContent)
+			chapter.POST("/generate", handler.meter(llm.PromptChapterGenerate), handler.GenerateChapter)
+			chapter.POST("/generate-stream", handler.meter(llm.PromptChapterGenerate), handler.GenerateChapterStream)
+			chapter.POST("/continue-stream", handler.meter(llm.PromptChapterContinue), handler.ContinueChapterStream)
+			chapter.POST("/summary", handler.meter(llm.PromptChapterSummary), handler.GenerateChapterSummary)
+			chapter.POST("/suggestions", handler.meter(llm.PromptChapterSuggestions), handler.GenerateChapterSuggestions)
+			chapter.POST("/outline", handler.meter(llm.PromptChapterOutline), handler.GenerateChapterOutline)
+			chapter.POST("/refine", handler.meter(llm.PromptChapterRefine), handler.RefineChapterContent)
+			chapter.POST("/refine-stream", handler.meter(llm.PromptChapterRefine), handler.RefineChapterContentStream)
+			chapter.POST("/expand", handler.meter(llm.PromptChapterExpand), handler.ExpandContent)
+			chapter.POST("/expand-stream", handler.meter(llm.PromptChapterExpand), handler.ExpandContentStream)
+			// 后台执行，用量在检查结束后计入
+			chapter.POST("/continuity-check", handler.CheckChapterContinuity)
+			chapter.POST("/extract-entities", handler.meter(llm.PromptEntityConfirm), handler.ExtractChapterEntities)
+		}
+
+		// 自动写作：后台执行，用量按步骤计入
+		autopilot := ai.Group("/autopilot")
+		{
+			autopilot.POST("", handler.StartAutopilot)
+			autopilot.GET("", handler.ListAutopilotJobs)
+			autopilot.GET("/:id", handler.GetAutopilotJob)
+			autopilot.POST("/:id/pause", handler.PauseAutopilot)
+			autopilot.POST("/:id/resume", handler.ResumeAutopilot)
+			autopilot.POST("/:id/cancel", handler.CancelAutopilot)
 		}
 
 		style := ai.Group("/style")
 		{
-			style.POST("/analyze", handler.AnalyzeStyle)
+			style.POST("/analyze", handler.meter(llm.PromptStyleAnalyze), handler.AnalyzeStyle)
 			style.POST("/extract-samples", handler.ExtractSamples)
 		}
 
 		storyline := ai.Group("/storyline")
 		{
-			storyline.POST("/generate", handler.GenerateStorylines)
-			storyline.POST("/optimize", handler.OptimizeStoryline)
-			storyline.POST("/expand-part", handler.ExpandStorylinePart)
-			storyline.POST("/expand-node", handler.ExpandStoryNode)
-			storyline.POST("/suggest-connections", handler.SuggestNodeConnections)
+			storyline.POST("/generate", handler.meter(llm.PromptStorylineGenerate), handler.GenerateStorylines)
+			storyline.POST("/optimize", handler.meter(llm.PromptStorylineOptimize), handler.OptimizeStoryline)
+			storyline.POST("/expand-part", handler.meter(llm.PromptStorylineExpandPart), handler.ExpandStorylinePart)
+			storyline.POST("/expand-node", handler.meter(llm.PromptStorylineExpandNode), handler.ExpandStoryNode)
+			storyline.POST("/suggest-connections", handler.meter(llm.PromptStorylineConnections), handler.SuggestNodeConnections)
 		}
 
 		setting := ai.Group("/setting")
 		{
-			setting.POST("/generate", handler.GenerateSetting)
-			setting.POST("/enhance", handler.EnhanceSetting)
+			setting.POST("/generate", handler.meter(llm.PromptSettingGenerate), handler.GenerateSetting)
+			setting.POST("/enhance", handler.meter(llm.PromptSettingEnhance), handler.EnhanceSetting)
+		}
+
+		// 提示词模板管理
+		prompts := ai.Group("/prompts")
+		{
+			prompts.GET("", handler.ListPromptTemplates)
+			prompts.GET("/defaults", handler.ListDefaultPrompts)
+			prompts.GET("/:id", handler.GetPromptTemplate)
+			prompts.POST("", middleware.RequireAdmin(), handler.CreatePromptTemplate)
+			prompts.PUT("/:id", middleware.RequireAdmin(), handler.UpdatePromptTemplate)
+			prompts.POST("/:id/activate", middleware.RequireAdmin(), handler.ActivatePromptTemplate)
+			prompts.DELETE("/:id", middleware.RequireAdmin(), handler.DeletePromptTemplate)
+		}
+
+		// 运维管理
+		admin := ai.Group("/admin", middleware.RequireAdmin())
+		{
+			admin.GET("/breakers", handler.ListBreakers)
+			admin.POST("/breakers/reset", handler.ResetBreaker)
+			admin.GET("/quotas", handler.ListQuotas)
+			admin.PUT("/quotas", handler.SaveQuota)
+			admin.DELETE("/quotas/:id", handler.DeleteQuota)
+			admin.GET("/routes", handler.ListModelRoutes)
+			admin.PUT("/routes", handler.SaveModelRoutes)
+			admin.PUT("/routes/:task", handler.SaveModelRoute)
+			admin.DELETE("/routes/:task", handler.DeleteModelRoute)
+			admin.GET("/calls", handler.ListLLMCalls)
+			admin.GET("/calls/stats", handler.GetLLMCallStats)
+			admin.GET("/calls/:id", handler.GetLLMCall)
+			admin.POST("/calls/:id/redact", handler.RedactLLMCall)
+			admin.GET("/prices", handler.ListModelPrices)
+			admin.PUT("/prices", handler.SaveModelPrice)
+			admin.DELETE("/prices/:id", handler.DeleteModelPrice)
+			admin.GET("/costs", handler.GetCostReport)
+			admin.GET("/budget", handler.GetBudget)
+			admin.PUT("/budget", handler.SaveBudget)
 		}
 	}
+	return handler
 }
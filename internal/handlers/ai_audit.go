@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/config"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 审计记录保留任务
+const (
+	llmCallRetentionInterval  = 24 * time.Hour
+	llmCallRetentionBatchSize = 1000
+)
+
+// dbCallRecorder 基于数据库的 LLM 调用记录：按模型价格计算费用计入每日汇总，开启审计时保存调用明细
+type dbCallRecorder struct {
+	db     *gorm.DB
+	audit  bool           // 是否保存调用明细
+	redact bool           // 只保存消息角色和长度
+	budget *budgetAlerter // 月度预算告警，可为空
+}
+
+func (r *dbCallRecorder) RecordCall(ctx context.Context, record *llm.CallRecord) {
+	db := r.db.WithContext(ctx)
+	cost, currency := r.recordCost(db, record)
+	if !r.audit {
+		return
+	}
+
+	messages, response, toolCalls := record.Messages, record.Response, record.ToolCalls
+	if r.redact {
+		messages, response = llm.RedactMessages(messages), llm.RedactedContent(response)
+		toolCalls = llm.RedactToolCalls(toolCalls)
+	}
+
+	call := models.LLMCall{
+		UserID:           record.Info.UserID,
+		NovelID:          record.Info.NovelID,
+		Feature:          record.Info.Feature,
+		Task:             record.Task,
+		Provider:         record.Provider,
+		Model:            record.Model,
+		PromptVersion:    record.PromptVersion,
+		Stream:           record.Stream,
+		Temperature:      record.Temperature,
+		MaxTokens:        record.MaxTokens,
+		Messages:         marshalAuditJSON(messages),
+		Response:         response,
+		ToolCalls:        marshalAuditJSON(toolCalls),
+		Redacted:         r.redact,
+		PromptTokens:     record.Usage.PromptTokens,
+		CompletionTokens: record.Usage.CompletionTokens,
+		TotalTokens:      record.Usage.TotalTokens,
+		Estimated:        record.Estimated,
+		Cached:           record.Cached,
+		LatencyMs:        record.Latency.Milliseconds(),
+		Cost:             cost,
+		Currency:         currency,
+		Status:           models.LLMCallStatusSuccess,
+	}
+	if record.Info.UserID > 0 {
+		call.CreateBy = strconv.FormatUint(uint64(record.Info.UserID), 10)
+	}
+	switch {
+	case record.Cancelled:
+		call.Status = models.LLMCallStatusCancelled
+		call.Error = record.Err.Error()
+	case record.Err != nil:
+		call.Status = models.LLMCallStatusError
+		call.Error = record.Err.Error()
+	}
+
+	if err := db.Create(&call).Error; err != nil {
+		logger.Error("记录 LLM 调用失败",
+			zap.String("task", record.Task),
+			zap.String("model", record.Model),
+			zap.Error(err))
+		return
+	}
+	record.ID = call.ID
+}
+
+// recordCost 按调用时生效的模型价格计算费用并计入每日汇总，返回费用和币种
+// 命中缓存或没有消耗 token 的调用不计费；模型未配置价格时只累计 token，币种为空
+func (r *dbCallRecorder) recordCost(db *gorm.DB, record *llm.CallRecord) (float64, string) {
+	if record.Cached || record.Usage.TotalTokens == 0 {
+		return 0, ""
+	}
+
+	now := time.Now()
+	var cost float64
+	var currency string
+	price, err := models.GetLLMModelPrice(db, record.Model, now)
+	if err != nil {
+		logger.Warn("查询模型价格失败", zap.String("model", record.Model), zap.Error(err))
+	} else if price != nil {
+		cost, currency = price.Cost(record.Usage.PromptTokens, record.Usage.CompletionTokens), price.Currency
+	}
+
+	entry := models.LLMCostDaily{
+		Date:             now.Format("2006-01-02"),
+		UserID:           record.Info.UserID,
+		NovelID:          record.Info.NovelID,
+		Task:             record.Task,
+		Model:            record.Model,
+		Currency:         currency,
+		PromptTokens:     record.Usage.PromptTokens,
+		CompletionTokens: record.Usage.CompletionTokens,
+		Cost:             cost,
+	}
+	if err := models.AddLLMCostDaily(db, &entry); err != nil {
+		logger.Error("记录 LLM 费用失败", zap.String("model", record.Model), zap.Float64("cost", cost), zap.Error(err))
+		return cost, currency
+	}
+	if cost > 0 && r.budget != nil {
+		r.budget.check(db, currency, now)
+	}
+	return cost, currency
+}
+
+func (r *dbCallRecorder) RecordParse(ctx context.Context, record *llm.CallRecord, problems []string) {
+	parsed := len(problems) == 0
+	updates := map[string]interface{}{"parsed": parsed}
+	if !parsed {
+		updates["parse_problems"] = marshalAuditJSON(problems)
+	}
+	if err := r.db.WithContext(ctx).Model(&models.LLMCall{}).Where("id = ?", record.ID).Updates(updates).Error; err != nil {
+		logger.Error("记录结构化输出解析结果失败", zap.Uint("callId", record.ID), zap.Error(err))
+	}
+}
+
+// marshalAuditJSON 序列化审计字段，空值保存为空字符串
+func marshalAuditJSON[T any](value []T) string {
+	if len(value) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// withCallRecording 开启 LLM 调用的费用统计，按配置开启调用审计并启动过期记录清理任务
+func withCallRecording(db *gorm.DB) {
+	cfg := config.GlobalConfig
+	llm.SetCallRecorder(&dbCallRecorder{
+		db:     db,
+		audit:  cfg.LLMAuditEnabled,
+		redact: cfg.LLMAuditRedact,
+		budget: newBudgetAlerter(db),
+	})
+	if !cfg.LLMAuditEnabled {
+		return
+	}
+	logger.Info("LLM call audit enabled",
+		zap.Int("retention_days", cfg.LLMAuditRetentionDays),
+		zap.Bool("redact", cfg.LLMAuditRedact))
+
+	if cfg.LLMAuditRetentionDays > 0 {
+		go runLLMCallRetention(db, cfg.LLMAuditRetentionDays)
+	}
+}
+
+// runLLMCallRetention 启动时及之后每天删除超过保留天数的审计记录
+func runLLMCallRetention(db *gorm.DB, days int) {
+	ticker := time.NewTicker(llmCallRetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		purgeLLMCalls(db, time.Now().AddDate(0, 0, -days))
+		<-ticker.C
+	}
+}
+
+// purgeLLMCalls 删除指定时间之前的审计记录
+func purgeLLMCalls(db *gorm.DB, before time.Time) {
+	removed, err := models.DeleteLLMCallsBefore(db, before, llmCallRetentionBatchSize)
+	if err != nil {
+		logger.Warn("清理过期 LLM 调用记录失败", zap.Error(err))
+	} else if removed > 0 {
+		logger.Info("已清理过期 LLM 调用记录", zap.Int64("removed", removed), zap.Time("before", before))
+	}
+}
+
+// setCallNovel 记录本次请求关联的小说，之后的 LLM 调用审计记录会带上小说ID
+func setCallNovel(c *gin.Context, novelID uint) {
+	if info := llm.CallInfoFrom(c.Request.Context()); info != nil {
+		info.NovelID = novelID
+	}
+}
+
+// LLMCallListResponse 审计记录列表响应
+type LLMCallListResponse struct {
+	Calls    []models.LLMCall `json:"calls"`
+	Total    int64            `json:"total"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"pageSize"`
+}
+
+// bindLLMCallFilter 解析审计记录查询条件
+func bindLLMCallFilter(c *gin.Context) (models.LLMCallFilter, bool) {
+	var filter models.LLMCallFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return filter, false
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 || filter.PageSize > 100 {
+		filter.PageSize = 20
+	}
+	return filter, true
+}
+
+// ListLLMCalls 查询 LLM 调用记录
+// @Summary 查询 LLM 调用记录
+// @Description 按用户、小说、功能、任务、模型、状态、解析结果和日期范围分页查询调用审计记录，列表不含消息和响应正文（仅管理员）
+// @Tags AI
+// @Produce json
+// @Param userId query int false "用户ID"
+// @Param novelId query int false "小说ID"
+// @Param feature query string false "功能标识"
+// @Param task query string false "任务标识"
+// @Param model query string false "模型"
+// @Param status query string false "状态(success/error/cancelled)"
+// @Param parsed query bool false "结构化输出是否解析成功"
+// @Param since query string false "开始日期(YYYY-MM-DD)"
+// @Param until query string false "结束日期(YYYY-MM-DD，含当天)"
+// @Param page query int false "页码" default(1)
+// @Param pageSize query int false "每页数量" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/calls [get]
+func (h *AIHandler) ListLLMCalls(c *gin.Context) {
+	filter, ok := bindLLMCallFilter(c)
+	if !ok {
+		return
+	}
+
+	calls, total, err := models.ListLLMCalls(h.db, filter)
+	if err != nil {
+		logger.Error("查询 LLM 调用记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询调用记录失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": LLMCallListResponse{
+			Calls:    calls,
+			Total:    total,
+			Page:     filter.Page,
+			PageSize: filter.PageSize,
+		},
+	})
+}
+
+// GetLLMCallStats 按模型和任务汇总 LLM 调用
+// @Summary LLM 调用统计
+// @Description 按模型和任务汇总调用次数、错误率、解析失败数、平均耗时和 token，用于对比模型（仅管理员）
+// @Tags AI
+// @Produce json
+// @Param task query string false "任务标识"
+// @Param model query string false "模型"
+// @Param since query string false "开始日期(YYYY-MM-DD)"
+// @Param until query string false "结束日期(YYYY-MM-DD，含当天)"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/calls/stats [get]
+func (h *AIHandler) GetLLMCallStats(c *gin.Context) {
+	filter, ok := bindLLMCallFilter(c)
+	if !ok {
+		return
+	}
+
+	stats, err := models.GetLLMCallStats(h.db, filter)
+	if err != nil {
+		logger.Error("统计 LLM 调用记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "统计调用记录失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": stats,
+	})
+}
+
+// GetLLMCall 获取 LLM 调用详情
+// @Summary 获取 LLM 调用详情
+// @Description 返回单条调用审计记录，包括请求消息和原始响应（仅管理员）
+// @Tags AI
+// @Produce json
+// @Param id path int true "记录ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/calls/{id} [get]
+func (h *AIHandler) GetLLMCall(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的记录ID",
+		})
+		return
+	}
+
+	var call models.LLMCall
+	if err := h.db.First(&call, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "调用记录不存在",
+			})
+			return
+		}
+		logger.Error("获取 LLM 调用记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取调用记录失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": call,
+	})
+}
+
+// RedactLLMCall 脱敏 LLM 调用记录
+// @Summary 脱敏 LLM 调用记录
+// @Description 将单条记录的请求消息、响应和工具调用参数替换为长度占位，不可恢复（仅管理员）
+// @Tags AI
+// @Produce json
+// @Param id path int true "记录ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/calls/{id}/redact [post]
+func (h *AIHandler) RedactLLMCall(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的记录ID",
+		})
+		return
+	}
+
+	var call models.LLMCall
+	if err := h.db.Select("id", "messages", "response", "tool_calls", "redacted").First(&call, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"msg":  "调用记录不存在",
+		})
+		return
+	}
+	if call.Redacted {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 200,
+			"msg":  "记录已脱敏",
+		})
+		return
+	}
+
+	var messages []llm.Message
+	var toolCalls []openai.ToolCall
+	_ = json.Unmarshal([]byte(call.Messages), &messages)
+	_ = json.Unmarshal([]byte(call.ToolCalls), &toolCalls)
+
+	if err := models.RedactLLMCall(h.db, call.ID,
+		marshalAuditJSON(llm.RedactMessages(messages)),
+		llm.RedactedContent(call.Response),
+		marshalAuditJSON(llm.RedactToolCalls(toolCalls))); err != nil {
+		logger.Error("脱敏 LLM 调用记录失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "脱敏失败",
+		})
+		return
+	}
+	if user := middleware.GetCurrentUser(c); user != nil {
+		logger.Info("LLM 调用记录已脱敏", zap.Uint("callId", call.ID), zap.Uint("userId", user.ID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "脱敏成功",
+	})
+}
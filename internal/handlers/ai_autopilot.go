@@ -0,0 +1,843 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	autopilotMaxChapters    = 100 // 单个任务最多生成的章节数
+	autopilotPlanContext    = 5   // 规划后续节点时参考的此前已规划章节数
+	autopilotPlanTimeout    = 5 * time.Minute
+	autopilotChapterTimeout = 10 * time.Minute
+)
+
+// autopilotRunner 在后台执行自动写作任务：先按故事节点规划章节大纲，再逐章生成
+// 每生成一章前检查任务状态，暂停在当前章节生成完成后生效，取消会中断正在生成的章节
+type autopilotRunner struct {
+	ai *AIHandler
+	wg sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc // 正在执行的任务
+}
+
+// newAutopilotRunner 创建自动写作执行器
+func newAutopilotRunner(ai *AIHandler) *autopilotRunner {
+	return &autopilotRunner{
+		ai:      ai,
+		running: map[uint]context.CancelFunc{},
+	}
+}
+
+// start 在后台执行任务，任务已在执行时不重复启动
+func (r *autopilotRunner) start(jobID uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running[jobID] != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.running[jobID] = cancel
+	r.wg.Add(1)
+	go r.run(ctx, jobID)
+}
+
+// cancel 中断正在执行的任务
+func (r *autopilotRunner) cancel(jobID uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cancel := r.running[jobID]; cancel != nil {
+		cancel()
+	}
+}
+
+// wait 等待所有后台任务结束
+func (r *autopilotRunner) wait() {
+	r.wg.Wait()
+}
+
+// stop 任务停止执行前再次确认状态：停止期间任务被继续时返回 false，由当前协程继续执行
+func (r *autopilotRunner) stop(ctx context.Context, jobID uint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var job models.AutopilotJob
+	if ctx.Err() == nil && r.ai.db.Select("status").First(&job, jobID).Error == nil && job.Status == models.AutopilotPending {
+		return false
+	}
+	if cancel := r.running[jobID]; cancel != nil {
+		cancel()
+	}
+	delete(r.running, jobID)
+	return true
+}
+
+// fail 将任务标记为失败
+func (r *autopilotRunner) fail(jobID uint, err error) {
+	logger.Warn("自动写作任务失败", zap.Uint("jobId", jobID), zap.Error(err))
+	now := time.Now()
+	if _, dbErr := models.TransitionAutopilotJob(r.ai.db, jobID, models.AutopilotActiveStatuses, models.AutopilotFailed,
+		map[string]interface{}{"error": err.Error(), "finished_at": &now}); dbErr != nil {
+		logger.Error("更新自动写作任务状态失败", zap.Uint("jobId", jobID), zap.Error(dbErr))
+	}
+}
+
+// run 逐步执行任务，直到完成、失败、暂停或取消
+func (r *autopilotRunner) run(ctx context.Context, jobID uint) {
+	defer r.wg.Done()
+	defer func() {
+		if p := recover(); p != nil {
+			r.fail(jobID, fmt.Errorf("panic: %v", p))
+			r.mu.Lock()
+			delete(r.running, jobID)
+			r.mu.Unlock()
+		}
+	}()
+
+	for {
+		if !r.advance(ctx, jobID) && r.stop(ctx, jobID) {
+			return
+		}
+	}
+}
+
+// advance 执行任务的下一步：尚未规划时规划章节，否则生成下一章；返回是否继续执行
+func (r *autopilotRunner) advance(ctx context.Context, jobID uint) bool {
+	db := r.ai.db
+	job, err := models.GetAutopilotJob(db, jobID)
+	if err != nil {
+		// 没有协程继续执行，任务不能停留在执行状态
+		r.fail(jobID, fmt.Errorf("获取自动写作任务失败: %w", err))
+		return false
+	}
+	switch job.Status {
+	case models.AutopilotPending, models.AutopilotPlanning, models.AutopilotRunning:
+	default:
+		return false
+	}
+	if usageQuotaExceeded(db, job.UserID) {
+		if _, err := models.TransitionAutopilotJob(db, job.ID, models.AutopilotActiveStatuses, models.AutopilotPaused,
+			map[string]interface{}{"error": "AI用量已达上限"}); err != nil {
+			r.fail(job.ID, fmt.Errorf("暂停自动写作任务失败: %w", err))
+		}
+		return false
+	}
+
+	if len(job.Steps) == 0 {
+		if _, err := models.TransitionAutopilotJob(db, job.ID, []string{models.AutopilotPending, models.AutopilotPlanning},
+			models.AutopilotPlanning, nil); err != nil {
+			r.fail(job.ID, err)
+			return false
+		}
+		if err := r.plan(ctx, job); err != nil {
+			if ctx.Err() == nil {
+				r.fail(job.ID, fmt.Errorf("规划章节失败: %w", err))
+			}
+			return false
+		}
+		return true
+	}
+
+	var step *models.AutopilotStep
+	for i := range job.Steps {
+		if job.Steps[i].Status != models.AutopilotStepCompleted {
+			step = &job.Steps[i]
+			break
+		}
+	}
+	if step == nil {
+		now := time.Now()
+		if _, err := models.TransitionAutopilotJob(db, job.ID, models.AutopilotActiveStatuses, models.AutopilotCompleted,
+			map[string]interface{}{"finished_at": &now}); err != nil {
+			r.fail(job.ID, fmt.Errorf("更新自动写作任务状态失败: %w", err))
+		}
+		return false
+	}
+
+	if _, err := models.TransitionAutopilotJob(db, job.ID, []string{models.AutopilotPending, models.AutopilotPlanning},
+		models.AutopilotRunning, nil); err != nil {
+		r.fail(job.ID, err)
+		return false
+	}
+	if err := r.generate(ctx, job, step); err != nil {
+		if ctx.Err() != nil {
+			// 任务已取消，未完成的章节不保存
+			db.Model(step).Update("status", models.AutopilotStepPending)
+			return false
+		}
+		db.Model(step).Updates(map[string]interface{}{"status": models.AutopilotStepFailed, "error": err.Error()})
+		r.fail(job.ID, fmt.Errorf("第 %d 章生成失败: %w", step.ChapterOrder, err))
+		return false
+	}
+	r.finishNode(job, step.NodeID)
+	return true
+}
+
+// plan 按故事节点规划各章的标题、大纲和重点，所有节点规划完成后一并保存
+func (r *autopilotRunner) plan(ctx context.Context, job *models.AutopilotJob) error {
+	db := r.ai.db
+	ctx, cancel := context.WithTimeout(ctx, autopilotPlanTimeout)
+	defer cancel()
+	ctx, scope := llm.WithUsageScope(ctx)
+	ctx = llm.WithCallInfo(ctx, &llm.CallInfo{UserID: job.UserID, NovelID: job.NovelID, Feature: llm.PromptChapterPlan})
+	defer recordLLMUsage(db, job.UserID, llm.PromptChapterPlan, scope)
+
+	var novel models.Novel
+	if err := db.First(&novel, job.NovelID).Error; err != nil {
+		return fmt.Errorf("获取小说失败: %w", err)
+	}
+	var storyline models.Storyline
+	if err := db.First(&storyline, job.StorylineID).Error; err != nil {
+		return fmt.Errorf("获取故事线失败: %w", err)
+	}
+	nodes, err := autopilotNodes(db, job)
+	if err != nil {
+		return err
+	}
+	counts := allocateNodeChapters(nodes, job.ChapterCount)
+
+	// 第一个节点参考已有章节，之后的节点参考此前已规划的章节
+	previous := GenerateChapterRequest{NovelID: job.NovelID, ChapterNumber: job.StartOrder}
+	r.ai.applyPreviousChapter(&previous)
+	var planned []string
+	var steps []models.AutopilotStep
+	order := job.StartOrder
+	for i, node := range nodes {
+		if counts[i] == 0 {
+			continue
+		}
+		req := llm.ChapterPlanRequest{
+			NovelTitle:      novel.Title,
+			NovelGenre:      novel.Genre,
+			Storyline:       storyline.Title,
+			NodeTitle:       node.Title,
+			NodeDescription: node.Description,
+			Characters:      nodeCharacters(db, node),
+			PreviousSummary: previous.PreviousSummary,
+			StartNumber:     order,
+			Count:           counts[i],
+		}
+		if len(planned) > 0 {
+			recent := planned
+			if len(recent) > autopilotPlanContext {
+				recent = recent[len(recent)-autopilotPlanContext:]
+			}
+			req.PreviousSummary = strings.Join(recent, "\n")
+		}
+		if i+1 < len(nodes) {
+			req.NextNode = nodes[i+1].Title
+			if nodes[i+1].Description != "" {
+				req.NextNode += "：" + nodes[i+1].Description
+			}
+		}
+		chapters, err := r.ai.chapterGenerator.PlanChapters(ctx, req)
+		if err != nil {
+			return err
+		}
+		for _, ch := range chapters {
+			title := strings.TrimSpace(ch.Title)
+			if title == "" {
+				title = fmt.Sprintf("第%d章", order)
+			}
+			steps = append(steps, models.AutopilotStep{
+				NodeID:       node.ID,
+				ChapterOrder: order,
+				Title:        title,
+				Outline:      strings.TrimSpace(ch.Outline),
+				FocusPoints:  ch.FocusPoints,
+			})
+			planned = append(planned, fmt.Sprintf("第 %d 章 %s：%s", order, title, strings.TrimSpace(ch.Outline)))
+			order++
+		}
+	}
+	if len(steps) == 0 {
+		return errors.New("没有规划出章节")
+	}
+	return models.SaveAutopilotPlan(db, job, steps)
+}
+
+// generate 生成一章并以草稿保存：上一章的摘要和下章提示作为前文，保存后记录版本、元数据和伏笔，并执行 onChapterSaved
+func (r *autopilotRunner) generate(ctx context.Context, job *models.AutopilotJob, step *models.AutopilotStep) error {
+	db := r.ai.db
+	ctx, cancel := context.WithTimeout(ctx, autopilotChapterTimeout)
+	defer cancel()
+	ctx, scope := llm.WithUsageScope(ctx)
+	ctx = llm.WithCallInfo(ctx, &llm.CallInfo{UserID: job.UserID, NovelID: job.NovelID, Feature: llm.PromptChapterGenerate})
+	defer recordLLMUsage(db, job.UserID, llm.PromptChapterGenerate, scope)
+
+	var novel models.Novel
+	if err := db.First(&novel, job.NovelID).Error; err != nil {
+		return fmt.Errorf("获取小说失败: %w", err)
+	}
+	var node models.StoryNode
+	if err := db.Where("id = ?", step.NodeID).Limit(1).Find(&node).Error; err != nil {
+		return fmt.Errorf("获取故事节点失败: %w", err)
+	}
+	if err := db.Model(step).Update("status", models.AutopilotStepRunning).Error; err != nil {
+		return err
+	}
+	if node.ID != 0 && node.Status != models.StoryNodeWriting && node.Status != models.StoryNodeCompleted {
+		db.Model(&node).Update("status", models.StoryNodeWriting)
+	}
+
+	req := GenerateChapterRequest{
+		Title:           step.Title,
+		NovelTitle:      novel.Title,
+		NovelGenre:      novel.Genre,
+		WorldSetting:    novel.WorldSetting,
+		StyleGuide:      novel.StyleGuide,
+		Outline:         step.Outline,
+		Characters:      nodeCharacters(db, node),
+		PlotPoints:      nodePlotPoints(db, node),
+		ChapterNumber:   step.ChapterOrder,
+		TargetWordCount: job.TargetWordCount,
+		FocusPoints:     step.FocusPoints,
+		AvoidComplete:   node.NodeType != "end",
+		NovelID:         job.NovelID,
+	}
+	r.ai.applyPreviousChapter(&req)
+	threads := r.ai.openForeshadowings(job.NovelID)
+	llmReq := req.toLLM()
+	llmReq.OpenThreads = foreshadowingThreads(threads)
+	result, err := r.ai.chapterGenerator.Generate(ctx, llmReq)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(result.Content) == "" {
+		return errors.New("生成的章节内容为空")
+	}
+
+	// 生成成功后才创建章节，中断或失败时不留下空章节
+	chapter := models.Chapter{
+		NovelID:      job.NovelID,
+		VolumeID:     job.VolumeID,
+		Title:        step.Title,
+		Order:        step.ChapterOrder,
+		Outline:      step.Outline,
+		CharacterIDs: joinNodeIDs(node.Characters),
+		PlotPointIDs: joinNodeIDs(node.PlotPoints),
+		Status:       models.ChapterStatusDraft,
+	}
+	if err := db.Create(&chapter).Error; err != nil {
+		return fmt.Errorf("创建章节失败: %w", err)
+	}
+	updated := chapter
+	updated.Content = result.Content
+	updated.Summary = strings.TrimSpace(result.Summary)
+	// 新建的空章节不需要记录导入版本
+	if _, err := models.UpdateChapterContent(db, nil, &updated, models.ChapterRevisionSourceAIGenerate, job.UserID,
+		fmt.Sprintf("自动写作任务 #%d", job.ID)); err != nil {
+		return fmt.Errorf("保存章节失败: %w", err)
+	}
+
+	req.ChapterID = chapter.ID
+	model := scope.Summary().Model
+	if err := models.UpdateChapterMetadata(db, chapter.ID, func(meta *models.ChapterMetadata) {
+		applyGeneratedMetadata(meta, req, result, model)
+		meta.LastOperation = models.ChapterRevisionSourceAIGenerate
+		meta.LastModel = model
+	}); err != nil {
+		logger.Error("记录章节元数据失败", zap.Uint("chapterId", chapter.ID), zap.Error(err))
+	}
+	r.ai.recordPendingForeshadowing(req, threads, result)
+	onChapterSaved(db, r.ai.ChapterRunners(), job.UserID, &chapter, &updated)
+
+	step.ChapterID = chapter.ID
+	step.Summary = updated.Summary
+	return models.CompleteAutopilotStep(db, step)
+}
+
+// finishNode 节点的章节全部生成后，将节点标记为已完成，并把章节范围更新为实际生成的章节
+func (r *autopilotRunner) finishNode(job *models.AutopilotJob, nodeID int) {
+	first, last := 0, 0
+	for _, step := range job.Steps {
+		if step.NodeID != nodeID {
+			continue
+		}
+		// job.Steps 是生成前读取的，刚生成的步骤状态已在 generate 中更新
+		if step.Status != models.AutopilotStepCompleted {
+			return
+		}
+		if first == 0 {
+			first = step.ChapterOrder
+		}
+		last = step.ChapterOrder
+	}
+	if first == 0 {
+		return
+	}
+	chapterRange := strconv.Itoa(first)
+	if last != first {
+		chapterRange = fmt.Sprintf("%d-%d", first, last)
+	}
+	if err := r.ai.db.Model(&models.StoryNode{}).Where("id = ?", nodeID).
+		Updates(map[string]interface{}{"status": models.StoryNodeCompleted, "chapter_range": chapterRange}).Error; err != nil {
+		logger.Error("更新故事节点状态失败", zap.Int("nodeId", nodeID), zap.Error(err))
+	}
+}
+
+// autopilotNodes 按任务记录的顺序获取故事节点，已删除的节点被忽略
+func autopilotNodes(db *gorm.DB, job *models.AutopilotJob) ([]models.StoryNode, error) {
+	var ids []int
+	for _, part := range strings.Split(job.NodeIDs, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	var found []models.StoryNode
+	if err := db.Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, fmt.Errorf("获取故事节点失败: %w", err)
+	}
+	byID := make(map[int]models.StoryNode, len(found))
+	for _, node := range found {
+		byID[node.ID] = node
+	}
+	nodes := make([]models.StoryNode, 0, len(ids))
+	for _, id := range ids {
+		if node, ok := byID[id]; ok {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("故事节点不存在")
+	}
+	return nodes, nil
+}
+
+// chapterRangePattern 匹配章节范围中的起止序号，如 "1-3"、"第5章"、"10~12"
+var chapterRangePattern = regexp.MustCompile(`(\d+)\s*章?\s*(?:[-~～—–至到]+\s*第?\s*(\d+))?`)
+
+// parseChapterRange 解析故事节点的章节范围，返回起止章节序号，无法解析时返回 false
+func parseChapterRange(s string) (int, int, bool) {
+	m := chapterRangePattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, false
+	}
+	from, _ := strconv.Atoi(m[1])
+	to := from
+	if m[2] != "" {
+		to, _ = strconv.Atoi(m[2])
+	}
+	if from <= 0 || to < from {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+// allocateNodeChapters 分配各节点生成的章节数：以节点章节范围的章节数为权重（没有范围时为 1）；
+// total 为 0 时直接使用权重，否则按权重分配 total 章，每个节点至少一章，章节数少于节点数时只覆盖前面的节点
+func allocateNodeChapters(nodes []models.StoryNode, total int) []int {
+	weights := make([]int, len(nodes))
+	sum := 0
+	for i, node := range nodes {
+		weights[i] = 1
+		if from, to, ok := parseChapterRange(node.ChapterRange); ok {
+			weights[i] = to - from + 1
+		}
+		sum += weights[i]
+	}
+	if total <= 0 {
+		return weights
+	}
+
+	counts := make([]int, len(nodes))
+	if total <= len(nodes) {
+		for i := 0; i < total; i++ {
+			counts[i] = 1
+		}
+		return counts
+	}
+	// 每个节点先分一章，其余按权重分配，余数依次给小数部分较大的节点
+	extra := total - len(nodes)
+	remainders := make([]int, len(nodes))
+	assigned := 0
+	for i, w := range weights {
+		counts[i] = 1 + extra*w/sum
+		remainders[i] = extra * w % sum
+		assigned += counts[i]
+	}
+	for ; assigned < total; assigned++ {
+		best := 0
+		for i := range remainders {
+			if remainders[i] > remainders[best] {
+				best = i
+			}
+		}
+		counts[best]++
+		remainders[best] = -1
+	}
+	return counts
+}
+
+// nodeCharacters 故事节点涉及的角色，格式为"名称：简介"
+func nodeCharacters(db *gorm.DB, node models.StoryNode) []string {
+	if len(node.Characters) == 0 {
+		return nil
+	}
+	var characters []models.Character
+	db.Where("id IN ?", node.Characters).Order("id ASC").Find(&characters)
+	result := make([]string, 0, len(characters))
+	for _, c := range characters {
+		if c.Description != "" {
+			result = append(result, c.Name+"："+c.Description)
+		} else {
+			result = append(result, c.Name)
+		}
+	}
+	return result
+}
+
+// nodePlotPoints 故事节点涉及的情节，格式为"标题：内容"
+func nodePlotPoints(db *gorm.DB, node models.StoryNode) []string {
+	if len(node.PlotPoints) == 0 {
+		return nil
+	}
+	var plotPoints []models.PlotPoint
+	db.Where("id IN ?", node.PlotPoints).Order("id ASC").Find(&plotPoints)
+	result := make([]string, 0, len(plotPoints))
+	for _, p := range plotPoints {
+		if p.Content != "" {
+			result = append(result, p.Title+"："+p.Content)
+		} else {
+			result = append(result, p.Title)
+		}
+	}
+	return result
+}
+
+// joinNodeIDs 将故事节点中的角色或情节ID转换为章节使用的逗号分隔格式
+func joinNodeIDs(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// StartAutopilotRequest 创建自动写作任务请求
+type StartAutopilotRequest struct {
+	NovelID         uint `json:"novelId" binding:"required"`
+	StorylineID     int  `json:"storylineId" binding:"required"`
+	FromNodeID      int  `json:"fromNodeId"`      // 起始节点，为 0 时从第一个节点开始
+	ToNodeID        int  `json:"toNodeId"`        // 结束节点，为 0 时到最后一个节点
+	ChapterCount    int  `json:"chapterCount"`    // 生成的章节数，为 0 时按各节点的章节范围
+	VolumeID        uint `json:"volumeId"`        // 生成的章节所属卷
+	TargetWordCount int  `json:"targetWordCount"` // 每章目标字数
+}
+
+// StartAutopilot 创建自动写作任务
+// @Summary 创建自动写作任务
+// @Description 按故事线节点（已完成的节点除外）规划章节大纲，并在后台逐章生成，每章的摘要作为下一章的前文，生成的章节以草稿保存。同一小说同时只能有一个未结束的任务
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param request body StartAutopilotRequest true "任务参数"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/autopilot [post]
+func (h *AIHandler) StartAutopilot(c *gin.Context) {
+	if !checkLLMConfigured(c) {
+		return
+	}
+
+	var req StartAutopilotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.ChapterCount < 0 || req.ChapterCount > autopilotMaxChapters {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  fmt.Sprintf("章节数不能超过 %d", autopilotMaxChapters),
+		})
+		return
+	}
+
+	var storyline models.Storyline
+	if err := h.db.Where("id = ? AND novel_id = ?", req.StorylineID, req.NovelID).
+		Preload("Nodes", func(db *gorm.DB) *gorm.DB {
+			return db.Order("order_index ASC, id ASC")
+		}).First(&storyline).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"msg":  "故事线不存在",
+		})
+		return
+	}
+	var nodes []models.StoryNode
+	started := req.FromNodeID == 0
+	for _, node := range storyline.Nodes {
+		started = started || node.ID == req.FromNodeID
+		if started && node.Status != models.StoryNodeCompleted {
+			nodes = append(nodes, node)
+		}
+		if node.ID == req.ToNodeID {
+			break
+		}
+	}
+	if len(nodes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "没有可生成的故事节点",
+		})
+		return
+	}
+	total := 0
+	for _, n := range allocateNodeChapters(nodes, req.ChapterCount) {
+		total += n
+	}
+	if total > autopilotMaxChapters {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  fmt.Sprintf("节点的章节范围共 %d 章，超过单个任务的上限 %d 章，请指定章节数", total, autopilotMaxChapters),
+		})
+		return
+	}
+
+	active, err := models.ActiveAutopilotJob(h.db, req.NovelID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询自动写作任务失败",
+		})
+		return
+	}
+	if active != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"code": 409,
+			"msg":  "该小说已有未结束的自动写作任务",
+			"data": active,
+		})
+		return
+	}
+
+	var lastOrder int
+	if err := h.db.Model(&models.Chapter{}).Where("novel_id = ?", req.NovelID).
+		Select("COALESCE(MAX(?), 0)", clause.Column{Name: "order"}).Scan(&lastOrder).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取章节失败",
+		})
+		return
+	}
+	ids := make([]int, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.ID
+	}
+	now := time.Now()
+	job := models.AutopilotJob{
+		NovelID:         req.NovelID,
+		UserID:          currentUserID(c),
+		StorylineID:     storyline.ID,
+		NodeIDs:         joinNodeIDs(ids),
+		ChapterCount:    req.ChapterCount,
+		VolumeID:        req.VolumeID,
+		TargetWordCount: req.TargetWordCount,
+		StartOrder:      lastOrder + 1,
+		Status:          models.AutopilotPending,
+		StartedAt:       &now,
+	}
+	if err := h.db.Create(&job).Error; err != nil {
+		logger.Error("创建自动写作任务失败", zap.Uint("novelId", req.NovelID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "创建自动写作任务失败",
+		})
+		return
+	}
+	h.autopilot.start(job.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "自动写作已开始",
+		"data": job,
+	})
+}
+
+// ListAutopilotJobs 获取小说的自动写作任务
+// @Summary 获取自动写作任务列表
+// @Description 获取小说的自动写作任务及进度（不含步骤），最近创建的在前
+// @Tags AI
+// @Produce json
+// @Param novelId query int true "小说ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/autopilot [get]
+func (h *AIHandler) ListAutopilotJobs(c *gin.Context) {
+	novelID, err := strconv.ParseUint(c.Query("novelId"), 10, 32)
+	if err != nil || novelID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的小说ID",
+		})
+		return
+	}
+	jobs, err := models.ListAutopilotJobs(h.db, uint(novelID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取自动写作任务失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": jobs,
+	})
+}
+
+// loadAutopilotJob 获取路径中指定的任务（含步骤），不存在时返回 404
+func (h *AIHandler) loadAutopilotJob(c *gin.Context) (*models.AutopilotJob, bool) {
+	id, ok := parseIDParam(c, "id", "无效的任务ID")
+	if !ok {
+		return nil, false
+	}
+	job, err := models.GetAutopilotJob(h.db, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "自动写作任务不存在",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "获取自动写作任务失败",
+			})
+		}
+		return nil, false
+	}
+	return job, true
+}
+
+// GetAutopilotJob 获取自动写作任务详情
+// @Summary 获取自动写作任务
+// @Description 获取任务状态及每一章的规划、生成状态和生成的章节
+// @Tags AI
+// @Produce json
+// @Param id path int true "任务ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/autopilot/{id} [get]
+func (h *AIHandler) GetAutopilotJob(c *gin.Context) {
+	job, ok := h.loadAutopilotJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": job,
+	})
+}
+
+// transitionAutopilot 修改任务状态并返回修改后的任务，当前状态不允许时返回 409
+func (h *AIHandler) transitionAutopilot(c *gin.Context, change func(job *models.AutopilotJob) (bool, error), conflictMsg, successMsg string) {
+	job, ok := h.loadAutopilotJob(c)
+	if !ok {
+		return
+	}
+	changed, err := change(job)
+	if err != nil {
+		logger.Error("更新自动写作任务状态失败", zap.Uint("jobId", job.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "更新自动写作任务失败",
+		})
+		return
+	}
+	if !changed {
+		c.JSON(http.StatusConflict, gin.H{
+			"code": 409,
+			"msg":  conflictMsg,
+		})
+		return
+	}
+	if job, err = models.GetAutopilotJob(h.db, job.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取自动写作任务失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  successMsg,
+		"data": job,
+	})
+}
+
+// PauseAutopilot 暂停自动写作任务
+// @Summary 暂停自动写作任务
+// @Description 正在生成的章节完成后暂停，之后可以继续
+// @Tags AI
+// @Produce json
+// @Param id path int true "任务ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/autopilot/{id}/pause [post]
+func (h *AIHandler) PauseAutopilot(c *gin.Context) {
+	h.transitionAutopilot(c, func(job *models.AutopilotJob) (bool, error) {
+		return models.TransitionAutopilotJob(h.db, job.ID,
+			[]string{models.AutopilotPending, models.AutopilotPlanning, models.AutopilotRunning}, models.AutopilotPaused, nil)
+	}, "任务未在执行", "任务已暂停")
+}
+
+// ResumeAutopilot 继续自动写作任务
+// @Summary 继续自动写作任务
+// @Description 继续已暂停或失败的任务，从第一个未生成的章节开始
+// @Tags AI
+// @Produce json
+// @Param id path int true "任务ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/autopilot/{id}/resume [post]
+func (h *AIHandler) ResumeAutopilot(c *gin.Context) {
+	if !checkLLMConfigured(c) {
+		return
+	}
+	h.transitionAutopilot(c, func(job *models.AutopilotJob) (bool, error) {
+		resumed, err := models.ResumeAutopilotJob(h.db, job.ID)
+		if resumed {
+			h.autopilot.start(job.ID)
+		}
+		return resumed, err
+	}, "只能继续已暂停或失败的任务", "任务已继续")
+}
+
+// CancelAutopilot 取消自动写作任务
+// @Summary 取消自动写作任务
+// @Description 取消未结束的任务并中断正在生成的章节，已生成的章节保留
+// @Tags AI
+// @Produce json
+// @Param id path int true "任务ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/autopilot/{id}/cancel [post]
+func (h *AIHandler) CancelAutopilot(c *gin.Context) {
+	h.transitionAutopilot(c, func(job *models.AutopilotJob) (bool, error) {
+		now := time.Now()
+		canceled, err := models.TransitionAutopilotJob(h.db, job.ID, models.AutopilotActiveStatuses, models.AutopilotCanceled,
+			map[string]interface{}{"finished_at": &now})
+		if canceled {
+			h.autopilot.cancel(job.ID)
+		}
+		return canceled, err
+	}, "任务已结束", "任务已取消")
+}
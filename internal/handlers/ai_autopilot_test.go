@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChapterRange(t *testing.T) {
+	cases := []struct {
+		in       string
+		from, to int
+		ok       bool
+	}{
+		{"1-3", 1, 3, true},
+		{"第5章", 5, 5, true},
+		{"第3-5章", 3, 5, true},
+		{"10 ~ 12", 10, 12, true},
+		{"第7章至第9章", 7, 9, true},
+		{"", 0, 0, false},
+		{"5-2", 0, 0, false},
+	}
+	for _, c := range cases {
+		from, to, ok := parseChapterRange(c.in)
+		assert.Equal(t, c.ok, ok, c.in)
+		assert.Equal(t, c.from, from, c.in)
+		assert.Equal(t, c.to, to, c.in)
+	}
+}
+
+func TestAllocateNodeChapters(t *testing.T) {
+	nodes := []models.StoryNode{{ChapterRange: "1-4"}, {}, {ChapterRange: "6-7"}}
+	assert.Equal(t, []int{4, 1, 2}, allocateNodeChapters(nodes, 0))
+	assert.Equal(t, []int{1, 1, 0}, allocateNodeChapters(nodes, 2))
+	assert.Equal(t, []int{1, 1, 1}, allocateNodeChapters(nodes, 3))
+	// 每个节点先分一章，其余 7 章按 4:1:2 分配
+	assert.Equal(t, []int{5, 2, 3}, allocateNodeChapters(nodes, 10))
+}
+
+// setupAutopilot 创建自动写作测试所需的数据表和小说
+func setupAutopilot(t *testing.T) (*AIHandler, *llm.MockProvider, models.Novel) {
+	h, mock := setupMockAIHandler(t)
+	useSingleConnection(t, h.db)
+	require.NoError(t, h.db.AutoMigrate(&models.Novel{}, &models.Volume{}, &models.Chapter{}, &models.ChapterRevision{},
+		&models.Character{}, &models.PlotPoint{}, &models.Storyline{}, &models.StoryNode{}, &models.Foreshadowing{},
+		&models.StorySummary{}, &models.AutopilotJob{}, &models.AutopilotStep{}))
+
+	novel := models.Novel{Title: "剑来", Genre: "玄幻"}
+	require.NoError(t, h.db.Create(&novel).Error)
+	return h, mock, novel
+}
+
+// performAutopilotAction 以登录用户身份调用带任务ID的处理函数
+func performAutopilotAction(handler gin.HandlerFunc, id uint) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(id)}}
+	c.Set(constants.UserField, &models.User{BaseModel: models.BaseModel{ID: 1}})
+	handler(c)
+	return w
+}
+
+// autopilotPlan 构造章节规划的模拟响应
+func autopilotPlan(titles ...string) llm.MockResponse {
+	chapters := make([]llm.PlannedChapter, len(titles))
+	for i, title := range titles {
+		chapters[i] = llm.PlannedChapter{Title: title, Outline: title + "的大纲"}
+	}
+	data, _ := json.Marshal(map[string]interface{}{"chapters": chapters})
+	return llm.MockResponse{Content: string(data)}
+}
+
+// autopilotChapter 构造章节生成的模拟响应
+func autopilotChapter(content, summary, hint string) llm.MockResponse {
+	data, _ := json.Marshal(map[string]interface{}{"title": "", "content": content, "summary": summary,
+		"keyEvents": []string{summary}, "nextChapterHint": hint})
+	return llm.MockResponse{Content: string(data)}
+}
+
+// taskPrompts 返回指定任务的提示词
+func taskPrompts(mock *llm.MockProvider, task string) []string {
+	var prompts []string
+	for _, req := range mock.Requests() {
+		if req.Task == task {
+			prompts = append(prompts, req.Messages[len(req.Messages)-1].Content)
+		}
+	}
+	return prompts
+}
+
+func TestAutopilot_Run(t *testing.T) {
+	h, mock, novel := setupAutopilot(t)
+	character := models.Character{NovelID: novel.ID, Name: "林风", Description: "剑修少年"}
+	require.NoError(t, h.db.Create(&character).Error)
+	require.NoError(t, h.db.Create(&models.Chapter{NovelID: novel.ID, Title: "下山", Order: 1, Content: "林风下山。", Summary: "林风拜别师父下山"}).Error)
+	storyline := models.Storyline{NovelID: int(novel.ID), Title: "主线"}
+	require.NoError(t, h.db.Create(&storyline).Error)
+	nodes := []*models.StoryNode{
+		{StorylineID: storyline.ID, Title: "出师", Status: models.StoryNodeCompleted, OrderIndex: 0},
+		{StorylineID: storyline.ID, Title: "入门", Description: "林风拜入青云宗", NodeType: "start", ChapterRange: "2-3", OrderIndex: 1, Characters: []int{int(character.ID)}},
+		{StorylineID: storyline.ID, Title: "大比", Description: "宗门大比", NodeType: "end", ChapterRange: "4", OrderIndex: 2},
+	}
+	require.NoError(t, h.db.Create(&nodes).Error)
+
+	// 预设的响应按调用顺序返回
+	mock.Script(llm.PromptChapterPlan, autopilotPlan("山门试剑", "夜探藏经阁"), autopilotPlan("风起青云"))
+	mock.Script(llm.PromptChapterGenerate,
+		autopilotChapter("林风在山门前比剑。", "林风比剑险胜", "林风夜探藏经阁"),
+		autopilotChapter("林风夜入藏经阁。", "林风发现师父的线索", ""),
+		autopilotChapter("宗门大比开始。", "林风连胜三场", ""))
+
+	w := performAIRequest(h.StartAutopilot, StartAutopilotRequest{NovelID: novel.ID, StorylineID: storyline.ID, TargetWordCount: 3000})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var job models.AutopilotJob
+	require.NoError(t, json.Unmarshal(mustData(t, w), &job))
+	assert.Equal(t, 2, job.StartOrder)
+	h.autopilot.wait()
+
+	loaded, err := models.GetAutopilotJob(h.db, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.AutopilotCompleted, loaded.Status, loaded.Error)
+	assert.Equal(t, 3, loaded.TotalSteps)
+	assert.Equal(t, 3, loaded.CompletedSteps)
+	assert.NotNil(t, loaded.FinishedAt)
+	require.Len(t, loaded.Steps, 3)
+
+	// 规划：已完成的节点被跳过，按章节范围分配章节数，后续节点参考此前规划的章节
+	plans := taskPrompts(mock, llm.PromptChapterPlan)
+	require.Len(t, plans, 2)
+	assert.Contains(t, plans[0], "林风拜别师父下山")
+	assert.Contains(t, plans[0], "林风：剑修少年")
+	assert.Contains(t, plans[0], "宗门大比")
+	assert.Contains(t, plans[1], "第 3 章 夜探藏经阁：夜探藏经阁的大纲")
+
+	// 生成：每章以上一章的摘要和下章提示作为前文
+	prompts := taskPrompts(mock, llm.PromptChapterGenerate)
+	require.Len(t, prompts, 3)
+	assert.Contains(t, prompts[0], "山门试剑的大纲")
+	assert.Contains(t, prompts[1], "第 2 章 山门试剑：林风比剑险胜\n下章提示：林风夜探藏经阁")
+	assert.Contains(t, prompts[2], "第 3 章 夜探藏经阁：林风发现师父的线索")
+
+	var chapters []models.Chapter
+	require.NoError(t, h.db.Where("novel_id = ?", novel.ID).Order("id ASC").Find(&chapters).Error)
+	require.Len(t, chapters, 4)
+	for i, chapter := range chapters[1:] {
+		assert.Equal(t, i+2, chapter.Order)
+		assert.Equal(t, models.ChapterStatusDraft, chapter.Status)
+		assert.Equal(t, loaded.Steps[i].ChapterID, chapter.ID)
+		assert.Equal(t, loaded.Steps[i].Summary, chapter.Summary)
+		assert.Equal(t, 3000, chapter.Metadata.TargetWordCount)
+	}
+	assert.Equal(t, fmt.Sprint(character.ID), chapters[1].CharacterIDs)
+	var revisions int64
+	h.db.Model(&models.ChapterRevision{}).Where("chapter_id = ?", chapters[1].ID).Count(&revisions)
+	assert.Equal(t, int64(1), revisions)
+
+	// 节点标记为已完成，章节范围更新为实际生成的章节
+	var saved []models.StoryNode
+	require.NoError(t, h.db.Where("storyline_id = ?", storyline.ID).Order("order_index ASC").Find(&saved).Error)
+	assert.Equal(t, models.StoryNodeCompleted, saved[1].Status)
+	assert.Equal(t, "2-3", saved[1].ChapterRange)
+	assert.Equal(t, models.StoryNodeCompleted, saved[2].Status)
+	assert.Equal(t, "4", saved[2].ChapterRange)
+
+	// 所有节点都已完成时没有可生成的节点
+	w = performAIRequest(h.StartAutopilot, StartAutopilotRequest{NovelID: novel.ID, StorylineID: storyline.ID})
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+}
+
+func TestAutopilot_FailAndResume(t *testing.T) {
+	h, mock, novel := setupAutopilot(t)
+	storyline := models.Storyline{NovelID: int(novel.ID), Title: "主线"}
+	require.NoError(t, h.db.Create(&storyline).Error)
+	node := models.StoryNode{StorylineID: storyline.ID, Title: "入门", ChapterRange: "1-3"}
+	require.NoError(t, h.db.Create(&node).Error)
+
+	mock.Script(llm.PromptChapterPlan, autopilotPlan("山门试剑", "夜探藏经阁"))
+	mock.Script(llm.PromptChapterGenerate,
+		autopilotChapter("林风在山门前比剑。", "林风比剑险胜", ""),
+		llm.MockResponse{Error: "upstream unavailable"},
+		autopilotChapter("林风夜入藏经阁。", "林风发现师父的线索", ""))
+
+	// 指定章节数时按章节数规划
+	w := performAIRequest(h.StartAutopilot, StartAutopilotRequest{NovelID: novel.ID, StorylineID: storyline.ID, ChapterCount: 2})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var job models.AutopilotJob
+	require.NoError(t, json.Unmarshal(mustData(t, w), &job))
+	h.autopilot.wait()
+
+	loaded, err := models.GetAutopilotJob(h.db, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.AutopilotFailed, loaded.Status)
+	assert.Contains(t, loaded.Error, "第 2 章生成失败")
+	assert.Equal(t, 1, loaded.CompletedSteps)
+	require.Len(t, loaded.Steps, 2)
+	assert.Equal(t, models.AutopilotStepFailed, loaded.Steps[1].Status)
+	var count int64
+	h.db.Model(&models.Chapter{}).Where("novel_id = ?", novel.ID).Count(&count)
+	assert.Equal(t, int64(1), count, "失败的章节不保存")
+	require.NoError(t, h.db.First(&node, node.ID).Error)
+	assert.Equal(t, models.StoryNodeWriting, node.Status)
+
+	// 未在执行的任务不能暂停；失败的任务可以继续，从失败的章节开始生成
+	w = performAutopilotAction(h.PauseAutopilot, job.ID)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	w = performAutopilotAction(h.ResumeAutopilot, job.ID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	h.autopilot.wait()
+
+	loaded, err = models.GetAutopilotJob(h.db, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.AutopilotCompleted, loaded.Status)
+	assert.Empty(t, loaded.Error)
+	assert.Equal(t, 2, loaded.CompletedSteps)
+	assert.Len(t, taskPrompts(mock, llm.PromptChapterPlan), 1, "继续时不重新规划")
+	h.db.Model(&models.Chapter{}).Where("novel_id = ?", novel.ID).Count(&count)
+	assert.Equal(t, int64(2), count)
+	require.NoError(t, h.db.First(&node, node.ID).Error)
+	assert.Equal(t, models.StoryNodeCompleted, node.Status)
+	assert.Equal(t, "1-2", node.ChapterRange)
+
+	w = performAutopilotAction(h.ResumeAutopilot, job.ID)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+}
+
+func TestAutopilot_AdvanceError(t *testing.T) {
+	h, _, novel := setupAutopilot(t)
+	job := models.AutopilotJob{NovelID: novel.ID, UserID: 1, Status: models.AutopilotRunning}
+	require.NoError(t, h.db.Create(&job).Error)
+
+	// 读取任务出错时不再有协程执行，任务标记为失败而不是停留在执行中
+	require.NoError(t, h.db.Migrator().DropTable(&models.AutopilotStep{}))
+	assert.False(t, h.autopilot.advance(context.Background(), job.ID))
+	require.NoError(t, h.db.First(&job, job.ID).Error)
+	assert.Equal(t, models.AutopilotFailed, job.Status)
+	assert.Contains(t, job.Error, "获取自动写作任务失败")
+}
+
+func TestAutopilot_Cancel(t *testing.T) {
+	h, _, novel := setupAutopilot(t)
+	storyline := models.Storyline{NovelID: int(novel.ID), Title: "主线"}
+	require.NoError(t, h.db.Create(&storyline).Error)
+	require.NoError(t, h.db.Create(&models.StoryNode{StorylineID: storyline.ID, Title: "入门"}).Error)
+
+	job := models.AutopilotJob{NovelID: novel.ID, StorylineID: storyline.ID, Status: models.AutopilotPaused}
+	require.NoError(t, h.db.Create(&job).Error)
+
+	// 已有未结束的任务时不能再创建
+	w := performAIRequest(h.StartAutopilot, StartAutopilotRequest{NovelID: novel.ID, StorylineID: storyline.ID})
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+
+	w = performAutopilotAction(h.CancelAutopilot, job.ID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var canceled models.AutopilotJob
+	require.NoError(t, json.Unmarshal(mustData(t, w), &canceled))
+	assert.Equal(t, models.AutopilotCanceled, canceled.Status)
+	assert.NotNil(t, canceled.FinishedAt)
+
+	w = performAutopilotAction(h.CancelAutopilot, job.ID)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	w = performAutopilotAction(h.ResumeAutopilot, job.ID)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	w = performAutopilotAction(h.GetAutopilotJob, 999)
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+}
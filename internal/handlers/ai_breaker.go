@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/circuitbreaker"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// BreakerStatus LLM 熔断器状态
+type BreakerStatus struct {
+	Name                 string    `json:"name"`            // 熔断器名称（llm:提供商:模型）
+	State                string    `json:"state"`           // closed / open / half-open
+	Generation           uint64    `json:"generation"`      // 状态变化次数
+	LastStateChange      time.Time `json:"lastStateChange"` // 最近一次状态变化时间
+	Requests             int64     `json:"requests"`
+	TotalSuccesses       int64     `json:"totalSuccesses"`
+	TotalFailures        int64     `json:"totalFailures"`
+	ConsecutiveSuccesses int64     `json:"consecutiveSuccesses"`
+	ConsecutiveFailures  int64     `json:"consecutiveFailures"`
+}
+
+// newBreakerStatus 转换熔断器统计（circuitbreaker.Stats 含函数字段，不能直接序列化）
+func newBreakerStatus(cb *circuitbreaker.CircuitBreaker) BreakerStatus {
+	stats := cb.GetStats()
+	return BreakerStatus{
+		Name:                 stats.Name,
+		State:                stats.State,
+		Generation:           stats.Generation,
+		LastStateChange:      stats.LastStateChange,
+		Requests:             stats.Counts.Requests,
+		TotalSuccesses:       stats.Counts.TotalSuccesses,
+		TotalFailures:        stats.Counts.TotalFailures,
+		ConsecutiveSuccesses: stats.Counts.ConsecutiveSuccesses,
+		ConsecutiveFailures:  stats.Counts.ConsecutiveFailures,
+	}
+}
+
+// ListBreakers 获取 LLM 熔断器状态
+// @Summary 获取 LLM 熔断器状态
+// @Description 列出所有 LLM 提供商/模型熔断器的状态和计数（仅管理员）
+// @Tags AI
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/breakers [get]
+func (h *AIHandler) ListBreakers(c *gin.Context) {
+	breakers := llm.BreakerRegistry.GetAll()
+	list := make([]BreakerStatus, 0, len(breakers))
+	for _, cb := range breakers {
+		list = append(list, newBreakerStatus(cb))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": list,
+	})
+}
+
+// ResetBreakerRequest 重置熔断器请求（熔断器名称包含冒号，模型名可能包含斜杠，因此不放在路径中）
+type ResetBreakerRequest struct {
+	Name string `json:"name" binding:"required"` // 熔断器名称
+}
+
+// ResetBreaker 重置 LLM 熔断器
+// @Summary 重置 LLM 熔断器
+// @Description 将指定熔断器恢复为关闭状态（仅管理员）
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param request body ResetBreakerRequest true "熔断器名称"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/breakers/reset [post]
+func (h *AIHandler) ResetBreaker(c *gin.Context) {
+	var req ResetBreakerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	cb := llm.BreakerRegistry.Get(req.Name)
+	if cb == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"msg":  "熔断器不存在",
+		})
+		return
+	}
+
+	cb.Reset()
+	user := middleware.GetCurrentUser(c)
+	if user != nil {
+		logger.Info("LLM 熔断器已手动重置", zap.String("breaker", req.Name), zap.Uint("userId", user.ID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "重置成功",
+		"data": newBreakerStatus(cb),
+	})
+}
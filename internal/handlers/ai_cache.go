@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/config"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// dbCacheStore 基于数据库的 LLM 响应缓存存储
+type dbCacheStore struct {
+	db *gorm.DB
+}
+
+func (s *dbCacheStore) Get(ctx context.Context, key string) (*llm.ChatResponse, error) {
+	entry, err := models.GetLLMResponseCache(s.db.WithContext(ctx), key)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return &llm.ChatResponse{
+		Content: entry.Content,
+		Model:   entry.Model,
+		Usage: llm.Usage{
+			PromptTokens:     entry.PromptTokens,
+			CompletionTokens: entry.CompletionTokens,
+			TotalTokens:      entry.TotalTokens,
+		},
+	}, nil
+}
+
+func (s *dbCacheStore) Put(ctx context.Context, key string, req llm.ChatRequest, resp *llm.ChatResponse, ttl time.Duration) error {
+	return models.SaveLLMResponseCache(s.db.WithContext(ctx), &models.LLMResponseCache{
+		CacheKey:         key,
+		Provider:         config.GlobalConfig.LLMProvider,
+		Model:            resp.Model,
+		Task:             req.Task,
+		Content:          resp.Content,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		TotalTokens:      resp.Usage.TotalTokens,
+		ExpiresAt:        time.Now().Add(ttl),
+	})
+}
+
+// withResponseCache 按配置为提供商添加响应缓存，并清理已过期的持久化缓存
+func withResponseCache(db *gorm.DB, provider llm.Provider) llm.Provider {
+	cfg := config.GlobalConfig
+	if !cfg.LLMCacheEnabled {
+		return provider
+	}
+
+	if removed, err := models.DeleteExpiredLLMResponseCaches(db); err != nil {
+		logger.Warn("清理过期响应缓存失败", zap.Error(err))
+	} else if removed > 0 {
+		logger.Info("已清理过期响应缓存", zap.Int64("removed", removed))
+	}
+
+	logger.Info("LLM response cache enabled",
+		zap.Int("ttl_seconds", cfg.LLMCacheTTL),
+		zap.Int("memory_size", cfg.LLMCacheMemorySize),
+		zap.Float64("max_temperature", cfg.LLMCacheMaxTemperature))
+
+	return llm.NewCachedProvider(provider, llm.CacheOptions{
+		TTL:            time.Duration(cfg.LLMCacheTTL) * time.Second,
+		MemorySize:     cfg.LLMCacheMemorySize,
+		MaxTemperature: float32(cfg.LLMCacheMaxTemperature),
+		Store:          &dbCacheStore{db: db},
+	})
+}
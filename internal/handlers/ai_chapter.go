@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
-	"github.com/LingByte/LingDialog/pkg/config"
+	"github.com/LingByte/LingDialog/internal/models"
 	"github.com/LingByte/LingDialog/pkg/llm"
 	"github.com/LingByte/LingDialog/pkg/logger"
 	"github.com/gin-gonic/gin"
@@ -26,11 +30,33 @@ type GenerateChapterRequest struct {
 	WritingStyle    string   `json:"writingStyle"`
 	FocusPoints     []string `json:"focusPoints"`
 	AvoidComplete   bool     `json:"avoidComplete"`
+	NovelID         uint     `json:"novelId"`   // 不为 0 时在提示词中加入未回收的伏笔；前文摘要和本章重点为空时取上一章的摘要和下章提示
+	ChapterID       uint     `json:"chapterId"` // 生成的章节，用于记录生成元数据；本章埋下和回收的伏笔在章节内容保存后记录
+}
+
+// toLLM 转换为生成器请求
+func (req GenerateChapterRequest) toLLM() llm.ChapterGenerateRequest {
+	return llm.ChapterGenerateRequest{
+		Title:           req.Title,
+		NovelTitle:      req.NovelTitle,
+		NovelGenre:      req.NovelGenre,
+		WorldSetting:    req.WorldSetting,
+		StyleGuide:      req.StyleGuide,
+		Outline:         req.Outline,
+		Characters:      req.Characters,
+		PlotPoints:      req.PlotPoints,
+		PreviousSummary: req.PreviousSummary,
+		ChapterNumber:   req.ChapterNumber,
+		TargetWordCount: req.TargetWordCount,
+		WritingStyle:    req.WritingStyle,
+		FocusPoints:     req.FocusPoints,
+		AvoidComplete:   req.AvoidComplete,
+	}
 }
 
 // GenerateChapter 生成章节
 // @Summary 生成章节
-// @Description 使用 AI 生成章节内容
+// @Description 使用 AI 生成章节内容；指定小说时提示模型延续未回收的伏笔，指定章节时本章埋下和回收的伏笔在章节内容保存后记录
 // @Tags AI
 // @Accept json
 // @Produce json
@@ -38,11 +64,7 @@ type GenerateChapterRequest struct {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/chapter/generate [post]
 func (h *AIHandler) GenerateChapter(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -59,22 +81,11 @@ func (h *AIHandler) GenerateChapter(c *gin.Context) {
 		zap.String("title", req.Title),
 		zap.Int("chapterNumber", req.ChapterNumber))
 
-	result, err := h.chapterGenerator.Generate(llm.ChapterGenerateRequest{
-		Title:           req.Title,
-		NovelTitle:      req.NovelTitle,
-		NovelGenre:      req.NovelGenre,
-		WorldSetting:    req.WorldSetting,
-		StyleGuide:      req.StyleGuide,
-		Outline:         req.Outline,
-		Characters:      req.Characters,
-		PlotPoints:      req.PlotPoints,
-		PreviousSummary: req.PreviousSummary,
-		ChapterNumber:   req.ChapterNumber,
-		TargetWordCount: req.TargetWordCount,
-		WritingStyle:    req.WritingStyle,
-		FocusPoints:     req.FocusPoints,
-		AvoidComplete:   req.AvoidComplete,
-	})
+	h.applyPreviousChapter(&req)
+	threads := h.openForeshadowings(req.NovelID)
+	llmReq := req.toLLM()
+	llmReq.OpenThreads = foreshadowingThreads(threads)
+	result, err := h.chapterGenerator.Generate(c.Request.Context(), llmReq)
 
 	if err != nil {
 		logger.Error("Failed to generate chapter",
@@ -86,6 +97,8 @@ func (h *AIHandler) GenerateChapter(c *gin.Context) {
 		})
 		return
 	}
+	h.recordPendingForeshadowing(req, threads, result)
+	h.recordGeneratedMetadata(c, req, result)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
@@ -94,10 +107,277 @@ func (h *AIHandler) GenerateChapter(c *gin.Context) {
 	})
 }
 
+// GenerateChapterStream 流式生成章节
+// @Summary 流式生成章节
+// @Description 使用 AI 流式生成章节：data 事件逐段推送正文，完整 JSON 解析后通过 result 事件返回摘要、关键事件、伏笔等结构化结果
+// @Tags AI
+// @Accept json
+// @Produce text/event-stream
+// @Param request body GenerateChapterRequest true "生成请求"
+// @Success 200 {string} string "SSE stream"
+// @Router /api/ai/chapter/generate-stream [post]
+func (h *AIHandler) GenerateChapterStream(c *gin.Context) {
+	if !checkLLMConfigured(c) {
+		return
+	}
+
+	var req GenerateChapterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	logger.Info("Generating chapter (stream)",
+		zap.String("title", req.Title),
+		zap.Int("chapterNumber", req.ChapterNumber))
+
+	h.applyPreviousChapter(&req)
+	threads := h.openForeshadowings(req.NovelID)
+	llmReq := req.toLLM()
+	llmReq.OpenThreads = foreshadowingThreads(threads)
+
+	setSSEHeaders(c)
+	result, err := h.chapterGenerator.GenerateStream(c.Request.Context(), llmReq, chapterStreamCallback(c))
+	if err != nil {
+		h.chapterStreamFailed(c, "generate", req.Title, err)
+		return
+	}
+	h.recordPendingForeshadowing(req, threads, result)
+	h.recordGeneratedMetadata(c, req, result)
+
+	// 发送最终结构化结果
+	resultJSON, _ := json.Marshal(result)
+	c.SSEvent("result", string(resultJSON))
+	c.Writer.Flush()
+}
+
+// applyPreviousChapter 指定小说时，前文摘要和本章重点为空则取上一章的摘要和下章提示，
+// 前文摘要前附上不包含本章及之后章节的全书梗概和上一章所在卷的摘要
+func (h *AIHandler) applyPreviousChapter(req *GenerateChapterRequest) {
+	if req.NovelID == 0 || (req.PreviousSummary != "" && len(req.FocusPoints) > 0) {
+		return
+	}
+	order := req.ChapterNumber
+	if req.ChapterID != 0 {
+		if chapterOrder, err := chapterOrderIn(h.db, req.NovelID, req.ChapterID); err == nil && chapterOrder > 0 {
+			order = chapterOrder
+		}
+	}
+	if order <= 0 {
+		return
+	}
+	prev, err := models.PreviousChapter(h.db, req.NovelID, order)
+	if err != nil {
+		logger.Warn("获取上一章失败", zap.Uint("novelId", req.NovelID), zap.Int("order", order), zap.Error(err))
+		return
+	}
+	if prev == nil {
+		return
+	}
+
+	hint := prev.Metadata.NextChapterHint
+	if req.PreviousSummary == "" {
+		lines := previousStorySummaries(h.db, req.NovelID, prev.VolumeID, order)
+		if prev.Summary != "" {
+			lines = append(lines, fmt.Sprintf("第 %d 章 %s：%s", prev.Order, prev.Title, prev.Summary))
+		}
+		if hint != "" {
+			lines = append(lines, "下章提示："+hint)
+		}
+		req.PreviousSummary = strings.Join(lines, "\n")
+	}
+	if len(req.FocusPoints) == 0 && hint != "" {
+		req.FocusPoints = []string{hint}
+	}
+}
+
+// lastModel 返回本次请求最近一次调用使用的模型，没有用量统计时为空
+func lastModel(c *gin.Context) string {
+	if scope := llm.UsageScopeFrom(c.Request.Context()); scope != nil {
+		return scope.Summary().Model
+	}
+	return ""
+}
+
+// recordChapterOperation 记录章节最近一次 AI 操作，update 不为空时同时修改其他元数据；失败只记录日志
+func (h *AIHandler) recordChapterOperation(c *gin.Context, chapterID uint, operation string, update func(meta *models.ChapterMetadata)) {
+	if chapterID == 0 {
+		return
+	}
+	model := lastModel(c)
+	err := models.UpdateChapterMetadata(h.db, chapterID, func(meta *models.ChapterMetadata) {
+		if update != nil {
+			update(meta)
+		}
+		meta.LastOperation = operation
+		meta.LastModel = model
+	})
+	if err != nil {
+		logger.Error("记录章节元数据失败", zap.Uint("chapterId", chapterID), zap.String("operation", operation), zap.Error(err))
+	}
+}
+
+// recordGeneratedMetadata 将生成结果中的关键事件、下章提示等写入章节元数据
+func (h *AIHandler) recordGeneratedMetadata(c *gin.Context, req GenerateChapterRequest, result *llm.ChapterGenerateResponse) {
+	h.recordChapterOperation(c, req.ChapterID, models.ChapterRevisionSourceAIGenerate, func(meta *models.ChapterMetadata) {
+		applyGeneratedMetadata(meta, req, result, lastModel(c))
+	})
+}
+
+// applyGeneratedMetadata 用生成结果覆盖元数据中的生成结果字段，model 为生成使用的模型
+func applyGeneratedMetadata(meta *models.ChapterMetadata, req GenerateChapterRequest, result *llm.ChapterGenerateResponse, model string) {
+	meta.KeyEvents = result.KeyEvents
+	meta.CharacterDev = result.CharacterDev
+	meta.PlotProgress = result.PlotProgress
+	meta.Foreshadowing = result.Foreshadowing
+	meta.NextChapterHint = result.NextChapterHint
+	meta.TargetWordCount = req.TargetWordCount
+	meta.Model = model
+	meta.PromptVersion = result.PromptVersion
+}
+
+// chapterStreamCallback 章节流式回调：正文分片通过 data 事件推送，结束时发送 complete 事件
+func chapterStreamCallback(c *gin.Context) llm.StreamCallback {
+	return sseCallback(c, func(segment string, isComplete bool) error {
+		if isComplete {
+			c.SSEvent("complete", "")
+			c.Writer.Flush()
+			return nil
+		}
+
+		data, _ := json.Marshal(gin.H{"content": segment})
+		c.SSEvent("data", string(data))
+		c.Writer.Flush()
+		return nil
+	})
+}
+
+// chapterStreamFailed 处理章节流式生成失败：客户端已断开时丢弃部分结果，否则发送 error 事件
+func (h *AIHandler) chapterStreamFailed(c *gin.Context, action, title string, err error) {
+	if clientGone(c) {
+		logger.Warn("客户端已断开，章节流式生成已停止",
+			zap.String("action", action),
+			zap.String("title", title),
+			zap.Error(err))
+		return
+	}
+	logger.Error("Failed to stream chapter",
+		zap.String("action", action),
+		zap.String("title", title),
+		zap.Error(err))
+	c.SSEvent("error", err.Error())
+	c.Writer.Flush()
+}
+
+// errChapterChanged 章节内容已变化，AI 结果无法写回
+var errChapterChanged = errors.New("章节内容已变化，结果未保存")
+
+// chapterSaver 将生成结果写入章节，返回记录的版本
+type chapterSaver func(content string) (*models.ChapterRevision, error)
+
+// saveChapterResult 返回将 AI 结果写入章节并记录版本和最近 AI 操作的 chapterSaver，chapterID 为 0 时返回 nil（不保存）；
+// 保存后执行 onChapterSaved
+func (h *AIHandler) saveChapterResult(c *gin.Context, chapterID uint, source string, apply func(chapter *models.Chapter, content string) error) chapterSaver {
+	if chapterID == 0 {
+		return nil
+	}
+	return func(content string) (*models.ChapterRevision, error) {
+		var chapter models.Chapter
+		if err := h.db.First(&chapter, chapterID).Error; err != nil {
+			return nil, err
+		}
+		updated := chapter
+		if err := apply(&updated, content); err != nil {
+			return nil, err
+		}
+		revision, err := models.UpdateChapterContent(h.db, &chapter, &updated, source, currentUserID(c), "")
+		if err != nil {
+			return nil, err
+		}
+		h.recordChapterOperation(c, chapterID, source, nil)
+		onChapterSaved(h.db, h.ChapterRunners(), currentUserID(c), &chapter, &updated)
+		return revision, nil
+	}
+}
+
+// saveChapterResponse 保存结果并补充到响应数据，保存失败时只记录日志并返回错误信息
+func saveChapterResponse(save chapterSaver, content string, data gin.H) {
+	if save == nil {
+		return
+	}
+	revision, err := save(content)
+	if err != nil {
+		logger.Error("保存 AI 结果到章节失败", zap.Error(err))
+		data["saveError"] = err.Error()
+		return
+	}
+	data["revision"] = revision
+}
+
+// streamChapterText 流式输出纯文本生成结果，结束后通过 result 事件返回完整内容；save 不为空时将结果写入章节
+func (h *AIHandler) streamChapterText(c *gin.Context, action, title string, save chapterSaver, generate func(callback llm.StreamCallback) (string, error)) {
+	setSSEHeaders(c)
+	content, err := generate(chapterStreamCallback(c))
+	if err != nil {
+		h.chapterStreamFailed(c, action, title, err)
+		return
+	}
+
+	result := gin.H{"content": content}
+	saveChapterResponse(save, content, result)
+	resultJSON, _ := json.Marshal(result)
+	c.SSEvent("result", string(resultJSON))
+	c.Writer.Flush()
+}
+
+// ContinueChapterRequest 续写章节请求
+type ContinueChapterRequest struct {
+	Title           string `json:"title" binding:"required"`
+	ExistingContent string `json:"existingContent" binding:"required"`
+	ContinueHint    string `json:"continueHint"`
+	ChapterID       uint   `json:"chapterId"` // 指定时将续写内容追加到章节并记录版本
+}
+
+// ContinueChapterStream 流式续写章节
+// @Summary 流式续写章节
+// @Description 在已有内容后继续写作，data 事件逐段推送续写内容，result 事件返回完整续写内容；指定 chapterId 时续写内容追加到章节并记录版本
+// @Tags AI
+// @Accept json
+// @Produce text/event-stream
+// @Param request body ContinueChapterRequest true "续写请求"
+// @Success 200 {string} string "SSE stream"
+// @Router /api/ai/chapter/continue-stream [post]
+func (h *AIHandler) ContinueChapterStream(c *gin.Context) {
+	if !checkLLMConfigured(c) {
+		return
+	}
+
+	var req ContinueChapterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	save := h.saveChapterResult(c, req.ChapterID, models.ChapterRevisionSourceAIContinue, func(chapter *models.Chapter, content string) error {
+		chapter.Content += content
+		return nil
+	})
+	h.streamChapterText(c, "continue", req.Title, save, func(callback llm.StreamCallback) (string, error) {
+		return h.chapterGenerator.ContinueChapterStream(c.Request.Context(), req.Title, req.ExistingContent, req.ContinueHint, callback)
+	})
+}
+
 // GenerateChapterSummaryRequest 生成章节摘要请求
 type GenerateChapterSummaryRequest struct {
-	Title   string `json:"title" binding:"required"`
-	Content string `json:"content" binding:"required"`
+	Title     string `json:"title" binding:"required"`
+	Content   string `json:"content" binding:"required"`
+	ChapterID uint   `json:"chapterId"` // 指定时将摘要保存到章节并记录版本
 }
 
 // GenerateChapterSuggestionsRequest 生成章节建议请求
@@ -107,6 +387,7 @@ type GenerateChapterSuggestionsRequest struct {
 	WorldSetting    string `json:"worldSetting"`
 	PreviousSummary string `json:"previousSummary"`
 	ChapterNumber   int    `json:"chapterNumber"`
+	ChapterID       uint   `json:"chapterId"` // 指定时在该章节的元数据中记录本次操作
 }
 
 // ChapterSuggestion 章节建议
@@ -119,7 +400,7 @@ type ChapterSuggestion struct {
 
 // GenerateChapterSummary 生成章节摘要
 // @Summary 生成章节摘要
-// @Description 为章节生成摘要，用于上下文压缩
+// @Description 为章节生成摘要，用于上下文压缩；指定 chapterId 时将摘要保存到章节并记录版本
 // @Tags AI
 // @Accept json
 // @Produce json
@@ -127,11 +408,7 @@ type ChapterSuggestion struct {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/chapter/summary [post]
 func (h *AIHandler) GenerateChapterSummary(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -144,7 +421,7 @@ func (h *AIHandler) GenerateChapterSummary(c *gin.Context) {
 		return
 	}
 
-	result, err := h.chapterGenerator.GenerateSummary(req.Title, req.Content)
+	result, err := h.chapterGenerator.GenerateSummary(c.Request.Context(), req.Title, req.Content)
 	if err != nil {
 		logger.Error("Failed to generate summary",
 			zap.String("title", req.Title),
@@ -156,18 +433,22 @@ func (h *AIHandler) GenerateChapterSummary(c *gin.Context) {
 		return
 	}
 
+	data := gin.H{"summary": result}
+	saveChapterResponse(h.saveChapterResult(c, req.ChapterID, models.ChapterRevisionSourceAISummary, func(chapter *models.Chapter, summary string) error {
+		chapter.Summary = summary
+		return nil
+	}), result, data)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"msg":  "生成成功",
-		"data": gin.H{
-			"summary": result,
-		},
+		"data": data,
 	})
 }
 
 // GenerateChapterSuggestions 生成章节建议
 // @Summary 生成章节建议
-// @Description 根据前文摘要生成多个可能的后续章节建议
+// @Description 根据前文摘要生成多个可能的后续章节建议；指定 chapterId 时在章节元数据中记录本次操作
 // @Tags AI
 // @Accept json
 // @Produce json
@@ -175,11 +456,7 @@ func (h *AIHandler) GenerateChapterSummary(c *gin.Context) {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/chapter/suggestions [post]
 func (h *AIHandler) GenerateChapterSuggestions(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -192,7 +469,7 @@ func (h *AIHandler) GenerateChapterSuggestions(c *gin.Context) {
 		return
 	}
 
-	suggestions, err := h.chapterGenerator.GenerateSuggestions(llm.ChapterSuggestionsRequest{
+	suggestions, err := h.chapterGenerator.GenerateSuggestions(c.Request.Context(), llm.ChapterSuggestionsRequest{
 		NovelTitle:      req.NovelTitle,
 		NovelGenre:      req.NovelGenre,
 		WorldSetting:    req.WorldSetting,
@@ -227,6 +504,7 @@ func (h *AIHandler) GenerateChapterSuggestions(c *gin.Context) {
 		zap.String("novelTitle", req.NovelTitle),
 		zap.Int("chapterNumber", req.ChapterNumber),
 		zap.Int("suggestionCount", len(suggestions)))
+	h.recordChapterOperation(c, req.ChapterID, models.ChapterOperationAISuggestions, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
@@ -245,11 +523,12 @@ type GenerateChapterOutlineRequest struct {
 	PreviousSummary string   `json:"previousSummary"`
 	PlotPoints      []string `json:"plotPoints"`
 	ChapterNumber   int      `json:"chapterNumber"`
+	ChapterID       uint     `json:"chapterId"` // 指定时在该章节的元数据中记录本次操作
 }
 
 // GenerateChapterOutline 生成章节大纲
 // @Summary 生成章节大纲
-// @Description 为章节生成详细大纲
+// @Description 为章节生成详细大纲；指定 chapterId 时在章节元数据中记录本次操作
 // @Tags AI
 // @Accept json
 // @Produce json
@@ -257,11 +536,7 @@ type GenerateChapterOutlineRequest struct {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/chapter/outline [post]
 func (h *AIHandler) GenerateChapterOutline(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -274,7 +549,7 @@ func (h *AIHandler) GenerateChapterOutline(c *gin.Context) {
 		return
 	}
 
-	result, err := h.chapterGenerator.GenerateOutline(llm.ChapterGenerateRequest{
+	result, err := h.chapterGenerator.GenerateOutline(c.Request.Context(), llm.ChapterGenerateRequest{
 		Title:           req.Title,
 		NovelTitle:      req.NovelTitle,
 		NovelGenre:      req.NovelGenre,
@@ -293,6 +568,7 @@ func (h *AIHandler) GenerateChapterOutline(c *gin.Context) {
 		})
 		return
 	}
+	h.recordChapterOperation(c, req.ChapterID, models.ChapterOperationAIOutline, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
@@ -308,11 +584,23 @@ type RefineChapterContentRequest struct {
 	Title           string `json:"title" binding:"required"`
 	OriginalContent string `json:"originalContent" binding:"required"`
 	Feedback        string `json:"feedback" binding:"required"`
+	ChapterID       uint   `json:"chapterId"` // 指定时用优化结果替换章节中的原文并记录版本
+}
+
+// refineSaver 返回将优化结果替换章节中原文的 chapterSaver
+func (h *AIHandler) refineSaver(c *gin.Context, req RefineChapterContentRequest) chapterSaver {
+	return h.saveChapterResult(c, req.ChapterID, models.ChapterRevisionSourceAIRefine, func(chapter *models.Chapter, content string) error {
+		if !strings.Contains(chapter.Content, req.OriginalContent) {
+			return errChapterChanged
+		}
+		chapter.Content = strings.Replace(chapter.Content, req.OriginalContent, content, 1)
+		return nil
+	})
 }
 
 // RefineChapterContent 根据反馈优化章节内容
 // @Summary 优化章节内容
-// @Description 根据反馈意见优化章节内容
+// @Description 根据反馈意见优化章节内容，指定 chapterId 时用结果替换章节中的原文并记录版本
 // @Tags AI
 // @Accept json
 // @Produce json
@@ -320,11 +608,7 @@ type RefineChapterContentRequest struct {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/chapter/refine [post]
 func (h *AIHandler) RefineChapterContent(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -337,7 +621,7 @@ func (h *AIHandler) RefineChapterContent(c *gin.Context) {
 		return
 	}
 
-	result, err := h.chapterGenerator.RefineContent(req.Title, req.OriginalContent, req.Feedback)
+	result, err := h.chapterGenerator.RefineContent(c.Request.Context(), req.Title, req.OriginalContent, req.Feedback)
 	if err != nil {
 		logger.Error("Failed to refine content",
 			zap.String("title", req.Title),
@@ -349,12 +633,41 @@ func (h *AIHandler) RefineChapterContent(c *gin.Context) {
 		return
 	}
 
+	data := gin.H{"content": result}
+	saveChapterResponse(h.refineSaver(c, req), result, data)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"msg":  "优化成功",
-		"data": gin.H{
-			"content": result,
-		},
+		"data": data,
+	})
+}
+
+// RefineChapterContentStream 流式优化章节内容
+// @Summary 流式优化章节内容
+// @Description 根据反馈意见优化章节内容，data 事件逐段推送，result 事件返回完整内容；指定 chapterId 时用结果替换章节中的原文并记录版本
+// @Tags AI
+// @Accept json
+// @Produce text/event-stream
+// @Param request body RefineChapterContentRequest true "优化请求"
+// @Success 200 {string} string "SSE stream"
+// @Router /api/ai/chapter/refine-stream [post]
+func (h *AIHandler) RefineChapterContentStream(c *gin.Context) {
+	if !checkLLMConfigured(c) {
+		return
+	}
+
+	var req RefineChapterContentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	h.streamChapterText(c, "refine", req.Title, h.refineSaver(c, req), func(callback llm.StreamCallback) (string, error) {
+		return h.chapterGenerator.RefineContentStream(c.Request.Context(), req.Title, req.OriginalContent, req.Feedback, callback)
 	})
 }
 
@@ -366,11 +679,24 @@ type ExpandContentRequest struct {
 	NovelGenre      string `json:"novelGenre"`
 	WorldSetting    string `json:"worldSetting"`
 	StyleGuide      string `json:"styleGuide"`
+	ChapterID       uint   `json:"chapterId"` // 指定时在该章节的元数据中记录本次操作
+}
+
+// toLLM 转换为生成器请求
+func (req ExpandContentRequest) toLLM() llm.ExpandContentRequest {
+	return llm.ExpandContentRequest{
+		OriginalContent: req.OriginalContent,
+		ExpandTarget:    req.ExpandTarget,
+		ExpandHint:      req.ExpandHint,
+		NovelGenre:      req.NovelGenre,
+		WorldSetting:    req.WorldSetting,
+		StyleGuide:      req.StyleGuide,
+	}
 }
 
 // ExpandContent 扩写内容
 // @Summary 扩写内容
-// @Description 对指定段落进行扩写
+// @Description 对指定段落进行扩写；指定 chapterId 时在章节元数据中记录本次操作
 // @Tags AI
 // @Accept json
 // @Produce json
@@ -378,11 +704,7 @@ type ExpandContentRequest struct {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/chapter/expand [post]
 func (h *AIHandler) ExpandContent(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -395,14 +717,7 @@ func (h *AIHandler) ExpandContent(c *gin.Context) {
 		return
 	}
 
-	result, err := h.chapterGenerator.ExpandContent(llm.ExpandContentRequest{
-		OriginalContent: req.OriginalContent,
-		ExpandTarget:    req.ExpandTarget,
-		ExpandHint:      req.ExpandHint,
-		NovelGenre:      req.NovelGenre,
-		WorldSetting:    req.WorldSetting,
-		StyleGuide:      req.StyleGuide,
-	})
+	result, err := h.chapterGenerator.ExpandContent(c.Request.Context(), req.toLLM())
 
 	if err != nil {
 		logger.Error("Failed to expand content",
@@ -414,6 +729,8 @@ func (h *AIHandler) ExpandContent(c *gin.Context) {
 		return
 	}
 
+	h.recordChapterOperation(c, req.ChapterID, models.ChapterOperationAIExpand, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"msg":  "扩写成功",
@@ -422,3 +739,35 @@ func (h *AIHandler) ExpandContent(c *gin.Context) {
 		},
 	})
 }
+
+// ExpandContentStream 流式扩写内容
+// @Summary 流式扩写内容
+// @Description 对指定段落进行扩写，data 事件逐段推送，result 事件返回完整内容；指定 chapterId 时在章节元数据中记录本次操作
+// @Tags AI
+// @Accept json
+// @Produce text/event-stream
+// @Param request body ExpandContentRequest true "扩写请求"
+// @Success 200 {string} string "SSE stream"
+// @Router /api/ai/chapter/expand-stream [post]
+func (h *AIHandler) ExpandContentStream(c *gin.Context) {
+	if !checkLLMConfigured(c) {
+		return
+	}
+
+	var req ExpandContentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	h.streamChapterText(c, "expand", "", nil, func(callback llm.StreamCallback) (string, error) {
+		content, err := h.chapterGenerator.ExpandContentStream(c.Request.Context(), req.toLLM(), callback)
+		if err == nil {
+			h.recordChapterOperation(c, req.ChapterID, models.ChapterOperationAIExpand, nil)
+		}
+		return content, err
+	})
+}
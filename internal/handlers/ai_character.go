@@ -2,14 +2,28 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/LingByte/LingDialog/internal/models"
 	"github.com/LingByte/LingDialog/pkg/llm"
 	"github.com/LingByte/LingDialog/pkg/logger"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+// validateCharacterProfile 校验角色状态和自定义属性，空值不校验
+func validateCharacterProfile(status, attributes string) error {
+	if status != "" && !llm.IsValidCharacterStatus(status) {
+		return fmt.Errorf("无效的角色状态: %s", status)
+	}
+	if _, err := models.ParseCharacterAttributes(attributes); err != nil {
+		return fmt.Errorf("自定义属性必须是 JSON 对象: %w", err)
+	}
+	return nil
+}
+
 // GenerateCharacterRequest 生成角色请求
 type GenerateCharacterRequest struct {
 	Name        string `json:"name" binding:"required"`
@@ -22,7 +36,7 @@ type GenerateCharacterRequest struct {
 
 // GenerateCharacter 生成角色
 // @Summary 生成角色
-// @Description 使用 AI 生成角色的完整设定
+// @Description 使用 AI 生成结构化的角色档案
 // @Tags AI
 // @Accept json
 // @Produce json
@@ -47,7 +61,7 @@ func (h *AIHandler) GenerateCharacter(c *gin.Context) {
 		zap.String("name", req.Name),
 		zap.String("role", req.Role))
 
-	result, err := h.characterGenerator.Generate(llm.CharacterGenerateRequest{
+	result, err := h.characterGenerator.Generate(c.Request.Context(), llm.CharacterGenerateRequest{
 		Name:        req.Name,
 		NovelTitle:  req.NovelTitle,
 		NovelGenre:  req.NovelGenre,
@@ -108,7 +122,7 @@ func (h *AIHandler) GenerateCharacterStream(c *gin.Context) {
 	c.Header("Transfer-Encoding", "chunked")
 
 	// 创建回调函数来发送流式数据
-	callback := func(segment string, isComplete bool) error {
+	callback := sseCallback(c, func(segment string, isComplete bool) error {
 		if isComplete {
 			c.SSEvent("complete", "")
 			c.Writer.Flush()
@@ -118,9 +132,9 @@ func (h *AIHandler) GenerateCharacterStream(c *gin.Context) {
 		c.SSEvent("data", segment)
 		c.Writer.Flush()
 		return nil
-	}
+	})
 
-	result, err := h.characterGenerator.GenerateStream(llm.CharacterGenerateRequest{
+	result, err := h.characterGenerator.GenerateStream(c.Request.Context(), llm.CharacterGenerateRequest{
 		Name:        req.Name,
 		NovelTitle:  req.NovelTitle,
 		NovelGenre:  req.NovelGenre,
@@ -130,6 +144,11 @@ func (h *AIHandler) GenerateCharacterStream(c *gin.Context) {
 	}, callback)
 
 	if err != nil {
+		if clientGone(c) {
+			// 角色设定尚未完整，部分内容直接丢弃
+			logger.Warn("客户端已断开，角色生成已停止", zap.String("name", req.Name), zap.Error(err))
+			return
+		}
 		logger.Error("Failed to generate character (stream)",
 			zap.String("name", req.Name),
 			zap.Error(err))
@@ -145,14 +164,17 @@ func (h *AIHandler) GenerateCharacterStream(c *gin.Context) {
 }
 
 // EnhanceDescriptionRequest 增强描述请求
+// 三种方式任选其一：指定 characterId 时读取并保存该角色；传入 profile 时增强该档案；否则将 description 按标签拆分为档案后增强
 type EnhanceDescriptionRequest struct {
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description" binding:"required"`
+	CharacterID uint                  `json:"characterId"`
+	Profile     *llm.CharacterProfile `json:"profile"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
 }
 
 // EnhanceDescription 增强角色描述
 // @Summary 增强角色描述
-// @Description 使用 AI 优化和扩展角色描述
+// @Description 使用 AI 补全和丰富结构化角色档案，指定 characterId 时保存到角色
 // @Tags AI
 // @Accept json
 // @Produce json
@@ -173,13 +195,40 @@ func (h *AIHandler) EnhanceDescription(c *gin.Context) {
 		return
 	}
 
+	var character *models.Character
+	var profile llm.CharacterProfile
+	switch {
+	case req.CharacterID != 0:
+		character = &models.Character{}
+		if err := h.db.First(character, req.CharacterID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "角色不存在",
+			})
+			return
+		}
+		setCallNovel(c, character.NovelID)
+		profile = characterProfile(character)
+	case req.Profile != nil:
+		profile = *req.Profile
+	default:
+		profile = llm.ParseCharacterDescription(req.Name, req.Description)
+	}
+	if strings.TrimSpace(profile.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: 缺少角色名称",
+		})
+		return
+	}
+
 	logger.Info("Enhancing character description",
-		zap.String("name", req.Name))
+		zap.String("name", profile.Name))
 
-	result, err := h.characterGenerator.EnhanceDescription(req.Name, req.Description)
+	result, err := h.characterGenerator.EnhanceDescription(c.Request.Context(), profile)
 	if err != nil {
 		logger.Error("Failed to enhance description",
-			zap.String("name", req.Name),
+			zap.String("name", profile.Name),
 			zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": 500,
@@ -188,26 +237,42 @@ func (h *AIHandler) EnhanceDescription(c *gin.Context) {
 		return
 	}
 
+	data := gin.H{
+		"description": result.Description,
+		"profile":     result,
+	}
+	if character != nil {
+		applyCharacterProfile(character, *result)
+		if err := h.db.Save(character).Error; err != nil {
+			logger.Error("保存角色档案失败", zap.Uint("characterId", character.ID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "保存角色档案失败",
+			})
+			return
+		}
+		data["character"] = character
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"msg":  "增强成功",
-		"data": gin.H{
-			"description": result,
-		},
+		"data": data,
 	})
 }
 
+// maxRelationshipCharacters 一次关系建议最多分析的角色数
+const maxRelationshipCharacters = 20
+
 // SuggestRelationshipsRequest 建议关系请求
 type SuggestRelationshipsRequest struct {
-	Character1   string `json:"character1" binding:"required"`
-	Description1 string `json:"description1" binding:"required"`
-	Character2   string `json:"character2" binding:"required"`
-	Description2 string `json:"description2" binding:"required"`
+	NovelID      uint   `json:"novelId" binding:"required"`
+	CharacterIDs []uint `json:"characterIds"` // 参与分析的角色，为空时取小说的全部角色
 }
 
 // SuggestRelationships 建议角色关系
 // @Summary 建议角色关系
-// @Description 使用 AI 分析两个角色之间可能的关系
+// @Description 使用 AI 分析角色之间可能的关系，建议保存为待确认状态，由作者确认或删除
 // @Tags AI
 // @Accept json
 // @Produce json
@@ -227,19 +292,82 @@ func (h *AIHandler) SuggestRelationships(c *gin.Context) {
 		})
 		return
 	}
+	setCallNovel(c, req.NovelID)
+
+	var novel models.Novel
+	if err := h.db.First(&novel, req.NovelID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"msg":  "小说不存在",
+		})
+		return
+	}
+	query := h.db.Where("novel_id = ?", req.NovelID)
+	if len(req.CharacterIDs) > 0 {
+		query = query.Where("id IN ?", req.CharacterIDs)
+	}
+	var characters []models.Character
+	if err := query.Order("id ASC").Limit(maxRelationshipCharacters).Find(&characters).Error; err != nil {
+		logger.Error("获取角色失败", zap.Uint("novelId", req.NovelID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取角色失败",
+		})
+		return
+	}
+	if len(characters) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: 至少需要两个角色",
+		})
+		return
+	}
+
+	// 已有关系（含待确认的建议）告知模型，并用于去重
+	existing, err := models.ListCharacterRelationships(h.db, req.NovelID, 0, true)
+	if err != nil {
+		logger.Error("获取角色关系失败", zap.Uint("novelId", req.NovelID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取角色关系失败",
+		})
+		return
+	}
+	names := make(map[uint]string, len(characters))
+	profiles := make([]llm.CharacterProfile, len(characters))
+	for i := range characters {
+		names[characters[i].ID] = characters[i].Name
+		profiles[i] = characterProfile(&characters[i])
+	}
+	key := func(from, to uint, relationType string) string {
+		if from > to {
+			from, to = to, from
+		}
+		return fmt.Sprintf("%d-%d-%s", from, to, relationType)
+	}
+	seen := make(map[string]bool, len(existing))
+	var existingTexts []string
+	for _, r := range existing {
+		seen[key(r.FromCharacterID, r.ToCharacterID, r.Type)] = true
+		if names[r.FromCharacterID] != "" && names[r.ToCharacterID] != "" {
+			existingTexts = append(existingTexts, fmt.Sprintf("%s → %s：%s",
+				names[r.FromCharacterID], names[r.ToCharacterID], relationshipName(r.Type, r.Label)))
+		}
+	}
 
 	logger.Info("Suggesting character relationships",
-		zap.String("character1", req.Character1),
-		zap.String("character2", req.Character2))
+		zap.Uint("novelId", req.NovelID),
+		zap.Int("characters", len(characters)))
 
-	result, err := h.characterGenerator.SuggestRelationships(
-		req.Character1, req.Character2,
-		req.Description1, req.Description2,
-	)
+	suggestions, err := h.characterGenerator.SuggestRelationships(c.Request.Context(), llm.RelationshipSuggestRequest{
+		NovelTitle: novel.Title,
+		Characters: profiles,
+		Existing:   existingTexts,
+		Background: novel.WorldSetting,
+	})
 	if err != nil {
 		logger.Error("Failed to suggest relationships",
-			zap.String("character1", req.Character1),
-			zap.String("character2", req.Character2),
+			zap.Uint("novelId", req.NovelID),
 			zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": 500,
@@ -248,11 +376,49 @@ func (h *AIHandler) SuggestRelationships(c *gin.Context) {
 		return
 	}
 
+	relationships := make([]models.CharacterRelationship, 0, len(suggestions))
+	for _, s := range suggestions {
+		from, to := characters[s.FromIndex].ID, characters[s.ToIndex].ID
+		if seen[key(from, to, s.Type)] {
+			continue
+		}
+		seen[key(from, to, s.Type)] = true
+		relationships = append(relationships, models.CharacterRelationship{
+			NovelID:         req.NovelID,
+			FromCharacterID: from,
+			ToCharacterID:   to,
+			Type:            s.Type,
+			Label:           s.Label,
+			Description:     s.Description,
+			Intensity:       s.Intensity,
+			Directional:     s.Directional,
+			Status:          models.CharacterRelationshipStatusSuggested,
+		})
+	}
+	if len(relationships) > 0 {
+		if err := h.db.Create(&relationships).Error; err != nil {
+			logger.Error("保存角色关系建议失败", zap.Uint("novelId", req.NovelID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "保存角色关系建议失败",
+			})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"msg":  "分析成功",
 		"data": gin.H{
-			"suggestion": result,
+			"relationships": relationships,
 		},
 	})
 }
+
+// relationshipName 关系的展示名称：有具体称谓时使用称谓，否则使用类型名称
+func relationshipName(relationType, label string) string {
+	if label != "" {
+		return label
+	}
+	return llm.RelationshipTypeLabel(relationType)
+}
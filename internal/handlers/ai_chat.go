@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,12 +10,15 @@ import (
 	"time"
 
 	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/constants"
 	"github.com/LingByte/LingDialog/pkg/llm"
 	"github.com/LingByte/LingDialog/pkg/logger"
 	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/LingByte/LingDialog/pkg/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ChatMessage 聊天消息
@@ -43,6 +47,7 @@ type ChatResponse struct {
 		CompletionTokens int `json:"completionTokens"`
 		TotalTokens      int `json:"totalTokens"`
 	} `json:"usage,omitempty"`
+	Cached bool `json:"cached"` // 是否命中响应缓存
 }
 
 // SessionListRequest 会话列表请求
@@ -127,6 +132,9 @@ func (h *AIHandler) chatNormal(c *gin.Context, req ChatRequest, userID uint) {
 		})
 		return
 	}
+	if session.NovelID != nil {
+		setCallNovel(c, *session.NovelID)
+	}
 
 	// 构建消息列表
 	messages := make([]llm.Message, len(req.Messages))
@@ -137,10 +145,11 @@ func (h *AIHandler) chatNormal(c *gin.Context, req ChatRequest, userID uint) {
 		}
 	}
 
-	// 如果指定了小说 ID，添加小说上下文
-	if req.NovelID != nil {
-		logger.Info("开始构建小说上下文", zap.Uint("novelID", *req.NovelID))
-		contextMessage, err := h.buildNovelContext(*req.NovelID)
+	// 会话关联小说时添加小说上下文，与小说工具使用同一部小说
+	var promptVersion string
+	if session.NovelID != nil {
+		logger.Info("开始构建小说上下文", zap.Uint("novelID", *session.NovelID))
+		contextMessage, promptRef, _, err := h.buildNovelContext(c.Request.Context(), *session.NovelID, messages, req.MaxTokens)
 		if err != nil {
 			logger.Error("Failed to build novel context", zap.Error(err))
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -152,17 +161,29 @@ func (h *AIHandler) chatNormal(c *gin.Context, req ChatRequest, userID uint) {
 		if contextMessage != nil {
 			// 将上下文消息插入到消息列表开头
 			messages = append([]llm.Message{*contextMessage}, messages...)
+			promptVersion = promptRef.String()
 			logger.Info("小说上下文已添加到消息列表",
 				zap.Int("contextLength", len(contextMessage.Content)),
 				zap.Int("totalMessages", len(messages)))
 		}
 	} else {
-		logger.Info("未指定小说ID，跳过上下文构建")
+		logger.Info("会话未关联小说，跳过上下文构建")
 	}
 
-	// 调用 LLM
-	response, err := h.characterGenerator.Chat(messages, req.Temperature, req.MaxTokens)
+	// 调用 LLM，会话关联小说时启用小说工具
+	var response *llm.ChatResponse
+	var transcript []llm.Message
+	if tools := h.chatTools(c.Request.Context(), session); tools != nil {
+		response, transcript, err = h.characterGenerator.ChatCompletionWithTools(c.Request.Context(), withToolsPrompt(messages), req.Temperature, req.MaxTokens, tools, nil)
+	} else {
+		response, err = h.characterGenerator.ChatCompletion(c.Request.Context(), messages, req.Temperature, req.MaxTokens)
+	}
 	if err != nil {
+		if clientGone(c) {
+			// 非流式调用取消时没有可用的部分内容，不保存消息
+			logger.Warn("客户端已断开，对话已取消", zap.Uint("sessionID", session.ID), zap.Error(err))
+			return
+		}
 		logger.Error("Chat failed", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": 500,
@@ -171,46 +192,24 @@ func (h *AIHandler) chatNormal(c *gin.Context, req ChatRequest, userID uint) {
 		return
 	}
 
-	responseTime := time.Since(startTime).Milliseconds()
-
-	// 保存用户消息
-	lastUserMsg := req.Messages[len(req.Messages)-1]
-	userMessage := models.ChatMessage{
-		SessionID:    session.ID,
-		Role:         lastUserMsg.Role,
-		Content:      lastUserMsg.Content,
-		Model:        h.characterGenerator.GetModel(),
-		Temperature:  req.Temperature,
-		MaxTokens:    req.MaxTokens,
-		ResponseTime: responseTime,
-	}
-	h.db.Create(&userMessage)
+	h.saveChatExchange(session.ID, req, transcript, response, promptVersion, time.Since(startTime).Milliseconds(), false)
 
-	// 保存AI回复消息（这里需要实际的token统计）
-	assistantMessage := models.ChatMessage{
-		SessionID:        session.ID,
-		Role:             "assistant",
-		Content:          response,
-		Model:            h.characterGenerator.GetModel(),
-		Temperature:      req.Temperature,
-		MaxTokens:        req.MaxTokens,
-		ResponseTime:     responseTime,
-		PromptTokens:     0, // TODO: 从LLM响应中获取实际值
-		CompletionTokens: 0, // TODO: 从LLM响应中获取实际值
-		TotalTokens:      0, // TODO: 从LLM响应中获取实际值
+	result := ChatResponse{
+		SessionID: session.ID,
+		Message: ChatMessage{
+			Role:    "assistant",
+			Content: response.Content,
+		},
+		Cached: response.Cached,
 	}
-	h.db.Create(&assistantMessage)
+	result.Usage.PromptTokens = response.Usage.PromptTokens
+	result.Usage.CompletionTokens = response.Usage.CompletionTokens
+	result.Usage.TotalTokens = response.Usage.TotalTokens
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"msg":  "success",
-		"data": ChatResponse{
-			SessionID: session.ID,
-			Message: ChatMessage{
-				Role:    "assistant",
-				Content: response,
-			},
-		},
+		"data": result,
 	})
 }
 
@@ -232,6 +231,9 @@ func (h *AIHandler) chatStream(c *gin.Context, req ChatRequest, userID uint) {
 		c.SSEvent("error", "创建会话失败: "+err.Error())
 		return
 	}
+	if session.NovelID != nil {
+		setCallNovel(c, *session.NovelID)
+	}
 
 	// 发送会话ID
 	sessionData := map[string]interface{}{
@@ -249,10 +251,11 @@ func (h *AIHandler) chatStream(c *gin.Context, req ChatRequest, userID uint) {
 		}
 	}
 
-	// 如果指定了小说 ID，添加小说上下文
-	if req.NovelID != nil {
-		logger.Info("开始构建小说上下文（流式）", zap.Uint("novelID", *req.NovelID))
-		contextMessage, err := h.buildNovelContext(*req.NovelID)
+	// 会话关联小说时添加小说上下文，与小说工具使用同一部小说
+	var promptVersion string
+	if session.NovelID != nil {
+		logger.Info("开始构建小说上下文（流式）", zap.Uint("novelID", *session.NovelID))
+		contextMessage, promptRef, _, err := h.buildNovelContext(c.Request.Context(), *session.NovelID, messages, req.MaxTokens)
 		if err != nil {
 			logger.Error("Failed to build novel context", zap.Error(err))
 			c.SSEvent("error", "获取小说信息失败: "+err.Error())
@@ -261,12 +264,13 @@ func (h *AIHandler) chatStream(c *gin.Context, req ChatRequest, userID uint) {
 		if contextMessage != nil {
 			// 将上下文消息插入到消息列表开头
 			messages = append([]llm.Message{*contextMessage}, messages...)
+			promptVersion = promptRef.String()
 			logger.Info("小说上下文已添加到消息列表（流式）",
 				zap.Int("contextLength", len(contextMessage.Content)),
 				zap.Int("totalMessages", len(messages)))
 		}
 	} else {
-		logger.Info("未指定小说ID，跳过上下文构建（流式）")
+		logger.Info("会话未关联小说，跳过上下文构建（流式）")
 	}
 
 	// 创建流式回调
@@ -279,46 +283,11 @@ func (h *AIHandler) chatStream(c *gin.Context, req ChatRequest, userID uint) {
 		return
 	}
 
-	var fullResponse strings.Builder
-	callback := func(segment string, isComplete bool) error {
+	callback := sseCallback(c, func(segment string, isComplete bool) error {
 		if isComplete {
-			responseTime := time.Since(startTime).Milliseconds()
-
-			// 保存用户消息
-			lastUserMsg := req.Messages[len(req.Messages)-1]
-			userMessage := models.ChatMessage{
-				SessionID:    session.ID,
-				Role:         lastUserMsg.Role,
-				Content:      lastUserMsg.Content,
-				Model:        h.characterGenerator.GetModel(),
-				Temperature:  req.Temperature,
-				MaxTokens:    req.MaxTokens,
-				ResponseTime: responseTime,
-			}
-			h.db.Create(&userMessage)
-
-			// 保存AI回复消息
-			assistantMessage := models.ChatMessage{
-				SessionID:        session.ID,
-				Role:             "assistant",
-				Content:          fullResponse.String(),
-				Model:            h.characterGenerator.GetModel(),
-				Temperature:      req.Temperature,
-				MaxTokens:        req.MaxTokens,
-				ResponseTime:     responseTime,
-				PromptTokens:     0, // TODO: 从LLM响应中获取实际值
-				CompletionTokens: 0, // TODO: 从LLM响应中获取实际值
-				TotalTokens:      0, // TODO: 从LLM响应中获取实际值
-			}
-			h.db.Create(&assistantMessage)
-
-			c.SSEvent("done", "[DONE]")
-			flusher.Flush()
 			return nil
 		}
 
-		fullResponse.WriteString(segment)
-
 		// 发送数据块
 		data := map[string]interface{}{
 			"content": segment,
@@ -327,16 +296,105 @@ func (h *AIHandler) chatStream(c *gin.Context, req ChatRequest, userID uint) {
 		c.SSEvent("message", string(jsonData))
 		flusher.Flush()
 		return nil
-	}
+	})
 
-	// 调用流式 LLM
-	_, err = h.characterGenerator.ChatStream(messages, req.Temperature, req.MaxTokens, callback)
+	// 调用流式 LLM，会话关联小说时启用小说工具，工具调用轮次结束后才输出最终回复
+	var response *llm.ChatResponse
+	var transcript []llm.Message
+	if tools := h.chatTools(c.Request.Context(), session); tools != nil {
+		response, transcript, err = h.characterGenerator.ChatCompletionWithTools(c.Request.Context(), withToolsPrompt(messages), req.Temperature, req.MaxTokens, tools, callback)
+	} else {
+		response, err = h.characterGenerator.ChatCompletionStream(c.Request.Context(), messages, req.Temperature, req.MaxTokens, callback)
+	}
+	responseTime := time.Since(startTime).Milliseconds()
 	if err != nil {
+		// 中断前已输出的内容和已完成的工具调用标记为中断后保存，与客户端已看到的内容保持一致
+		if response != nil && (response.Content != "" || len(transcript) > 0) {
+			h.saveChatExchange(session.ID, req, transcript, response, promptVersion, responseTime, true)
+		}
+		if clientGone(c) {
+			logger.Warn("客户端已断开，流式对话已停止",
+				zap.Uint("sessionID", session.ID),
+				zap.Int64("responseTime", responseTime),
+				zap.Error(err))
+			return
+		}
 		logger.Error("Chat stream failed", zap.Error(err))
 		c.SSEvent("error", err.Error())
 		flusher.Flush()
 		return
 	}
+
+	h.saveChatExchange(session.ID, req, transcript, response, promptVersion, responseTime, false)
+
+	// 发送用量和缓存标记
+	usageJson, _ := json.Marshal(map[string]interface{}{
+		"usage":  response.Usage,
+		"cached": response.Cached,
+	})
+	c.SSEvent("usage", string(usageJson))
+	c.SSEvent("done", "[DONE]")
+	flusher.Flush()
+}
+
+// saveChatExchange 保存本轮的用户消息、工具调用过程和 AI 回复，interrupted 表示回复因取消或错误中途停止
+// 各轮工具调用的 token 合计记在最终回复上，中间消息不重复计数
+func (h *AIHandler) saveChatExchange(sessionID uint, req ChatRequest, transcript []llm.Message, response *llm.ChatResponse, promptVersion string, responseTime int64, interrupted bool) {
+	// 保存用户消息
+	lastUserMsg := req.Messages[len(req.Messages)-1]
+	userMessage := models.ChatMessage{
+		SessionID:    sessionID,
+		Role:         lastUserMsg.Role,
+		Content:      lastUserMsg.Content,
+		Model:        h.characterGenerator.GetModel(),
+		Temperature:  req.Temperature,
+		MaxTokens:    req.MaxTokens,
+		ResponseTime: responseTime,
+	}
+	h.db.Create(&userMessage)
+
+	// 保存工具调用过程
+	toolNames := make(map[string]string)
+	for _, msg := range transcript {
+		message := models.ChatMessage{
+			SessionID:  sessionID,
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Model:      h.characterGenerator.GetModel(),
+			ToolCallID: msg.ToolCallID,
+			ToolName:   toolNames[msg.ToolCallID],
+		}
+		if len(msg.ToolCalls) > 0 {
+			for _, call := range msg.ToolCalls {
+				toolNames[call.ID] = call.Function.Name
+			}
+			data, _ := json.Marshal(msg.ToolCalls)
+			message.ToolCalls = string(data)
+		}
+		h.db.Create(&message)
+	}
+
+	// 保存AI回复消息，模型以实际响应为准（可能经过模型路由）
+	model := h.characterGenerator.GetModel()
+	if response.Model != "" {
+		model = response.Model
+	}
+	assistantMessage := models.ChatMessage{
+		SessionID:        sessionID,
+		Role:             "assistant",
+		Content:          response.Content,
+		Model:            model,
+		PromptVersion:    promptVersion,
+		Temperature:      req.Temperature,
+		MaxTokens:        req.MaxTokens,
+		ResponseTime:     responseTime,
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+		TotalTokens:      response.Usage.TotalTokens,
+		Cached:           response.Cached,
+		Interrupted:      interrupted,
+	}
+	h.db.Create(&assistantMessage)
 }
 
 // GetSessions 获取用户的聊天会话列表
@@ -516,53 +574,6 @@ func (h *AIHandler) ClearHistory(c *gin.Context) {
 	})
 }
 
-// GetUsageStats 获取用户聊天使用统计
-// @Summary 获取聊天使用统计
-// @Description 获取用户的聊天使用统计信息
-// @Tags AI
-// @Accept json
-// @Produce json
-// @Param days query int false "统计天数" default(7)
-// @Success 200 {object} map[string]interface{}
-// @Router /api/ai/chat/usage [get]
-func (h *AIHandler) GetUsageStats(c *gin.Context) {
-	user := middleware.GetCurrentUser(c)
-	daysStr := c.DefaultQuery("days", "7")
-	days, err := strconv.Atoi(daysStr)
-	if err != nil || days <= 0 {
-		days = 7
-	}
-
-	// 获取最近N天的使用统计
-	var usage []models.ChatUsage
-	h.db.Where("user_id = ? AND date >= DATE_SUB(CURDATE(), INTERVAL ? DAY)", user.ID, days).
-		Order("date DESC").
-		Find(&usage)
-
-	// 计算总计
-	var totalStats struct {
-		TotalMessages int `json:"totalMessages"`
-		TotalSessions int `json:"totalSessions"`
-		TotalTokens   int `json:"totalTokens"`
-	}
-
-	for _, u := range usage {
-		totalStats.TotalMessages += u.MessageCount
-		totalStats.TotalSessions += u.SessionCount
-		totalStats.TotalTokens += u.TotalTokens
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"code": 200,
-		"msg":  "success",
-		"data": map[string]interface{}{
-			"dailyUsage": usage,
-			"totalStats": totalStats,
-			"periodDays": days,
-		},
-	})
-}
-
 // getOrCreateSession 获取或创建会话
 func (h *AIHandler) getOrCreateSession(sessionID *uint, userID uint, novelID *uint, title string) (*models.ChatSession, error) {
 	if sessionID != nil {
@@ -604,14 +615,40 @@ func (h *AIHandler) getOrCreateSession(sessionID *uint, userID uint, novelID *ui
 	return &session, nil
 }
 
+// 小说上下文各分区在最终上下文中的排列基数
+const (
+	contextOrderNovel      = 0
+	contextOrderSettings   = 100000
+	contextOrderCharacters = 200000
+	contextOrderPlotPoints = 300000
+	contextOrderStorylines = 400000
+	contextOrderSummaries  = 450000
+	contextOrderChapters   = 500000
+	contextOrderStats      = 900000
+	contextOrderRole       = 1000000
+)
+
+// 小说上下文的优先级层级
+const (
+	contextTierRequired = iota // 小说信息、助手角色设定
+	contextTierRecent          // 最近章节、重要设定、全书梗概
+	contextTierActive          // 进行中的故事线节点、角色
+	contextTierHistory         // 较早章节摘要、卷摘要、情节点
+	contextTierExtra           // 其余设定、计划中的故事线节点、已被汇总的章节摘要
+)
+
+// defaultRecentChapters 默认完整纳入的最近章节数
+const defaultRecentChapters = 3
+
 // buildNovelContext 构建小说上下文信息
-func (h *AIHandler) buildNovelContext(novelID uint) (*llm.Message, error) {
+// 按优先级在模型的 token 预算内选取内容，history 为同一请求中的对话消息，maxTokens 为回复的最大 token 数
+func (h *AIHandler) buildNovelContext(ctx context.Context, novelID uint, history []llm.Message, maxTokens int) (*llm.Message, llm.PromptRef, *llm.ContextReport, error) {
 	logger.Info("开始构建小说上下文", zap.Uint("novelID", novelID))
 
 	// 获取小说基本信息
 	var novel models.Novel
 	if err := h.db.First(&novel, novelID).Error; err != nil {
-		return nil, fmt.Errorf("小说不存在")
+		return nil, llm.PromptRef{}, nil, fmt.Errorf("小说不存在")
 	}
 
 	// 获取角色信息
@@ -622,168 +659,308 @@ func (h *AIHandler) buildNovelContext(novelID uint) (*llm.Message, error) {
 	var plotPoints []models.PlotPoint
 	h.db.Where("novel_id = ?", novelID).Find(&plotPoints)
 
+	// 获取设定信息
+	var settings []models.NovelSetting
+	h.db.Where("novel_id = ?", novelID).Order("order_index ASC").Find(&settings)
+
+	// 获取进行中的故事线及其节点
+	var storylines []models.Storyline
+	h.db.Where("novel_id = ? AND status = ?", novelID, "active").
+		Order("priority DESC").
+		Preload("Nodes", func(db *gorm.DB) *gorm.DB {
+			return db.Where("status <> ?", "completed").Order("order_index ASC")
+		}).
+		Find(&storylines)
+
 	// 获取所有章节信息（按顺序排列）
 	var chapters []models.Chapter
 	h.db.Where("novel_id = ?", novelID).
-		Order("order ASC").
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "order"}}).
 		Find(&chapters)
 
-	// 自动为没有摘要的章节生成摘要
-	for i := range chapters {
-		if chapters[i].Summary == "" && chapters[i].Content != "" {
-			logger.Info("为章节自动生成摘要",
-				zap.Uint("chapterID", chapters[i].ID),
-				zap.String("chapterTitle", chapters[i].Title))
-
-			summary, err := h.chapterGenerator.GenerateSummary(chapters[i].Title, chapters[i].Content)
-			if err != nil {
-				logger.Error("自动生成章节摘要失败",
-					zap.Uint("chapterID", chapters[i].ID),
-					zap.Error(err))
-				continue
-			}
-
-			// 更新章节摘要
-			h.db.Model(&chapters[i]).Update("summary", summary)
-			chapters[i].Summary = summary
-
-			logger.Info("章节摘要自动生成成功",
-				zap.Uint("chapterID", chapters[i].ID),
-				zap.Int("summaryLength", len(summary)))
+	// 卷摘要和全书梗概；章节摘要缺失或有待更新的汇总时在后台汇总，本次使用已有的摘要
+	var summaries []models.StorySummary
+	h.db.Where("novel_id = ?", novelID).Find(&summaries)
+	var synopsis *models.StorySummary
+	volumeSummaries := make(map[uint]*models.StorySummary)
+	needsRollup := false
+	for i := range summaries {
+		summary := &summaries[i]
+		needsRollup = needsRollup || summary.Stale
+		if summary.Level == models.StorySummaryNovel {
+			synopsis = summary
+		} else {
+			volumeSummaries[summary.VolumeID] = summary
 		}
 	}
+	volumeTitles := make(map[uint]string)
+	if len(volumeSummaries) > 0 {
+		volumeIDs := make([]uint, 0, len(volumeSummaries))
+		for id := range volumeSummaries {
+			volumeIDs = append(volumeIDs, id)
+		}
+		var volumes []models.Volume
+		if err := h.db.Select("id", "title").Where("id IN ?", volumeIDs).Find(&volumes).Error; err != nil {
+			logger.Warn("获取分卷标题失败", zap.Uint("novelID", novelID), zap.Error(err))
+		}
+		for _, v := range volumes {
+			volumeTitles[v.ID] = v.Title
+		}
+	}
+	for _, chapter := range chapters {
+		if chapter.Content != "" && (chapter.Summary == "" || chapter.SummaryStale) || synopsis == nil && chapter.Summary != "" {
+			needsRollup = true
+			break
+		}
+	}
+	if info := llm.CallInfoFrom(ctx); needsRollup && info != nil {
+		scheduleSummaryRollup(h.summaries, novelID, info.UserID)
+	}
 
 	logger.Info("获取小说相关数据",
 		zap.String("title", novel.Title),
 		zap.Int("characters", len(characters)),
 		zap.Int("plotPoints", len(plotPoints)),
-		zap.Int("chapters", len(chapters)))
+		zap.Int("settings", len(settings)),
+		zap.Int("storylines", len(storylines)),
+		zap.Int("chapters", len(chapters)),
+		zap.Int("storySummaries", len(summaries)))
 
-	// 构建上下文内容
-	var contextParts []string
+	var items []llm.ContextItem
 
 	// 基本信息
-	contextParts = append(contextParts, fmt.Sprintf("# 小说信息\n标题：%s", novel.Title))
+	novelInfo := []string{fmt.Sprintf("# 小说信息\n标题：%s", novel.Title)}
 	if novel.Genre != "" {
-		contextParts = append(contextParts, fmt.Sprintf("类型：%s", novel.Genre))
+		novelInfo = append(novelInfo, fmt.Sprintf("类型：%s", novel.Genre))
 	}
 	if novel.Description != "" {
-		contextParts = append(contextParts, fmt.Sprintf("简介：%s", novel.Description))
+		novelInfo = append(novelInfo, fmt.Sprintf("简介：%s", novel.Description))
 	}
 	if novel.WorldSetting != "" {
-		contextParts = append(contextParts, fmt.Sprintf("世界设定：%s", novel.WorldSetting))
+		novelInfo = append(novelInfo, fmt.Sprintf("世界设定：%s", novel.WorldSetting))
 	}
 	if novel.StyleGuide != "" {
-		contextParts = append(contextParts, fmt.Sprintf("写作风格：%s", novel.StyleGuide))
-	}
+		novelInfo = append(novelInfo, fmt.Sprintf("写作风格：%s", novel.StyleGuide))
+	}
+	items = append(items, llm.ContextItem{
+		Key:      "novel",
+		Priority: contextTierRequired,
+		Order:    contextOrderNovel,
+		Text:     strings.Join(novelInfo, "\n"),
+		Required: true,
+	})
 
-	// 角色信息
-	if len(characters) > 0 {
-		contextParts = append(contextParts, "\n# 主要角色")
-		for _, char := range characters {
-			contextParts = append(contextParts, fmt.Sprintf("- %s：%s", char.Name, char.Description))
+	// 最近章节完整纳入（放不下时退化为摘要），由近及远分配预算
+	recentCount := utils.GetIntValue(h.db, constants.KEY_CHAT_CONTEXT_RECENT_CHAPTERS, defaultRecentChapters)
+	recentStart := len(chapters) - recentCount
+	if recentStart < 0 {
+		recentStart = 0
+	}
+	for i := len(chapters) - 1; i >= recentStart; i-- {
+		chapter := chapters[i]
+		heading := chapterHeading(chapter)
+		content := "\n【章节内容】（暂无内容）"
+		if chapter.Content != "" {
+			content = "\n【章节内容】\n" + chapter.Content
 		}
+		items = append(items, llm.ContextItem{
+			Key:      fmt.Sprintf("chapter:%d", chapter.ID),
+			Section:  "已有章节内容",
+			Priority: contextTierRecent,
+			Order:    contextOrderChapters + i,
+			Text:     heading + content + "\n---",
+			Fallback: heading + "\n---",
+		})
 	}
 
-	// 情节点信息
-	if len(plotPoints) > 0 {
-		contextParts = append(contextParts, "\n# 重要情节点")
-		for _, plot := range plotPoints {
-			contextParts = append(contextParts, fmt.Sprintf("- %s：%s", plot.Title, plot.Content))
+	// 设定：重要设定优先
+	for i, setting := range settings {
+		tier := contextTierExtra
+		if setting.IsImportant {
+			tier = contextTierRecent
 		}
+		items = append(items, llm.ContextItem{
+			Key:      fmt.Sprintf("setting:%d", setting.ID),
+			Section:  "重要设定",
+			Priority: tier,
+			Order:    contextOrderSettings + i,
+			Text:     fmt.Sprintf("- [%s] %s：%s", setting.Category, setting.Title, setting.Content),
+		})
 	}
 
-	// 所有章节的完整内容
-	if len(chapters) > 0 {
-		contextParts = append(contextParts, "\n# 已有章节内容")
-
-		// 计算总字符数，避免上下文过长
-		totalContentLength := 0
-		const maxContentLength = 50000 // 限制总内容长度，避免超出token限制
-
-		logger.Info("开始处理章节内容", zap.Int("chapterCount", len(chapters)))
-
-		for i, chapter := range chapters {
-			chapterContent := fmt.Sprintf("\n## 第%d章：%s", chapter.Order, chapter.Title)
-
-			// 添加章节摘要（如果有）
-			if chapter.Summary != "" {
-				chapterContent += fmt.Sprintf("\n【章节摘要】%s", chapter.Summary)
+	// 故事线节点：写作中的节点优先，计划中的节点次之
+	nodeIndex := 0
+	for _, storyline := range storylines {
+		for _, node := range storyline.Nodes {
+			tier := contextTierExtra
+			if node.Status == "writing" {
+				tier = contextTierActive
 			}
-
-			// 添加章节完整内容
-			if chapter.Content != "" {
-				logger.Info("处理章节内容",
-					zap.Int("chapterOrder", chapter.Order),
-					zap.String("chapterTitle", chapter.Title),
-					zap.Int("contentLength", len(chapter.Content)))
-
-				// 检查是否会超出长度限制
-				contentToAdd := fmt.Sprintf("\n【章节内容】\n%s", chapter.Content)
-				if totalContentLength+len(chapterContent)+len(contentToAdd) > maxContentLength {
-					// 如果会超出限制，只添加部分内容
-					remainingLength := maxContentLength - totalContentLength - len(chapterContent)
-					if remainingLength > 100 {
-						truncatedContent := chapter.Content
-						if len(truncatedContent) > remainingLength-50 {
-							truncatedContent = truncatedContent[:remainingLength-50] + "...(内容过长，已截断)"
-						}
-						chapterContent += fmt.Sprintf("\n【章节内容】\n%s", truncatedContent)
-						logger.Warn("章节内容被截断",
-							zap.Int("originalLength", len(chapter.Content)),
-							zap.Int("truncatedLength", len(truncatedContent)))
-					} else {
-						chapterContent += "\n【章节内容】（内容过长，已省略）"
-						logger.Warn("章节内容被省略", zap.Int("chapterOrder", chapter.Order))
-					}
-					contextParts = append(contextParts, chapterContent)
-					contextParts = append(contextParts, "---")
-					contextParts = append(contextParts, "\n【注意】由于内容过长，部分章节内容已被截断或省略。")
-					logger.Warn("达到内容长度限制，停止添加更多章节",
-						zap.Int("processedChapters", i+1),
-						zap.Int("totalChapters", len(chapters)))
-					break
-				} else {
-					chapterContent += contentToAdd
-				}
-			} else {
-				chapterContent += "\n【章节内容】（暂无内容）"
-				logger.Info("章节无内容", zap.Int("chapterOrder", chapter.Order))
+			text := fmt.Sprintf("- [%s] %s", storyline.Title, node.Title)
+			if node.ChapterRange != "" {
+				text += fmt.Sprintf("（章节 %s）", node.ChapterRange)
+			}
+			if node.Description != "" {
+				text += "：" + node.Description
 			}
+			items = append(items, llm.ContextItem{
+				Key:      fmt.Sprintf("storyNode:%d", node.ID),
+				Section:  "故事线进展",
+				Priority: tier,
+				Order:    contextOrderStorylines + nodeIndex,
+				Text:     text,
+			})
+			nodeIndex++
+		}
+	}
 
-			// 添加分隔线
-			chapterContent += "\n---"
+	// 角色信息：已死亡或失踪的角色优先级较低
+	for i, char := range characters {
+		tier := contextTierActive
+		if char.Status == llm.CharacterStatusDead || char.Status == llm.CharacterStatusMissing {
+			tier = contextTierHistory
+		}
+		profile := characterProfile(&char)
+		text := "- " + char.Name
+		if body := profile.Text(); body != "" {
+			text += "\n  " + strings.ReplaceAll(body, "\n", "\n  ")
+		}
+		items = append(items, llm.ContextItem{
+			Key:      fmt.Sprintf("character:%d", char.ID),
+			Section:  "主要角色",
+			Priority: tier,
+			Order:    contextOrderCharacters + i,
+			Text:     text,
+			Fallback: fmt.Sprintf("- %s：%s", char.Name, char.Description),
+		})
+	}
 
-			contextParts = append(contextParts, chapterContent)
-			totalContentLength += len(chapterContent)
+	// 全书梗概和卷摘要：以较少的篇幅概括较早的章节
+	if synopsis != nil && synopsis.Content != "" {
+		items = append(items, llm.ContextItem{
+			Key:      "summary:novel",
+			Section:  "故事梗概",
+			Priority: contextTierRecent,
+			Order:    contextOrderSummaries,
+			Text:     synopsis.Content,
+		})
+	}
+	listedVolumes := make(map[uint]bool)
+	for _, chapter := range chapters {
+		summary := volumeSummaries[chapter.VolumeID]
+		if summary == nil || summary.Content == "" || listedVolumes[chapter.VolumeID] {
+			continue
 		}
+		listedVolumes[chapter.VolumeID] = true
+		items = append(items, llm.ContextItem{
+			Key:      fmt.Sprintf("summary:volume:%d", summary.VolumeID),
+			Section:  "分卷摘要",
+			Priority: contextTierHistory,
+			Order:    contextOrderSummaries + len(listedVolumes),
+			Text:     fmt.Sprintf("- %s：%s", volumeTitles[summary.VolumeID], summary.Content),
+		})
+	}
 
-		// 添加章节统计信息
-		contextParts = append(contextParts, fmt.Sprintf("\n【统计信息】当前共有 %d 章节", len(chapters)))
-	} else {
-		contextParts = append(contextParts, "\n# 已有章节内容\n暂无章节内容")
+	// 较早章节只纳入摘要，由近及远分配预算；已被梗概或卷摘要概括的章节优先级较低
+	for i := recentStart - 1; i >= 0; i-- {
+		chapter := chapters[i]
+		tier := contextTierHistory
+		if storySummaryCovers(synopsis, chapter) || storySummaryCovers(volumeSummaries[chapter.VolumeID], chapter) {
+			tier = contextTierExtra
+		}
+		items = append(items, llm.ContextItem{
+			Key:      fmt.Sprintf("chapter:%d", chapter.ID),
+			Section:  "已有章节内容",
+			Priority: tier,
+			Order:    contextOrderChapters + i,
+			Text:     chapterHeading(chapter) + "\n---",
+		})
 	}
 
-	contextParts = append(contextParts, "\n# 角色设定\n你是一个专业的小说创作助手，专门帮助作者讨论和完善小说创作。请基于以上小说信息和已有章节内容，为用户提供专业的创作建议、情节讨论和写作指导。重点关注：\n- 基于已有章节的情节发展和走向\n- 角色在已有章节中的成长轨迹和后续发展\n- 世界观在已有章节中的展现和需要完善的地方\n- 已有章节中的冲突设置和后续解决方案\n- 保持与已有章节风格一致的写作技巧\n- 基于当前进度的后续章节规划\n- 分析已有章节的优缺点并提供改进建议\n\n请返回纯文本，不要返回任何Markdown或者JSON格式。在回答时，请充分考虑已有章节的内容和发展脉络。")
+	// 情节点信息
+	for i, plot := range plotPoints {
+		items = append(items, llm.ContextItem{
+			Key:      fmt.Sprintf("plotPoint:%d", plot.ID),
+			Section:  "重要情节点",
+			Priority: contextTierHistory,
+			Order:    contextOrderPlotPoints + i,
+			Text:     fmt.Sprintf("- %s：%s", plot.Title, plot.Content),
+		})
+	}
+
+	// 章节统计信息
+	stats := fmt.Sprintf("\n【统计信息】当前共有 %d 章节", len(chapters))
+	if len(chapters) == 0 {
+		stats = "\n# 已有章节内容\n暂无章节内容"
+	}
+	items = append(items, llm.ContextItem{
+		Key:      "stats",
+		Priority: contextTierRequired,
+		Order:    contextOrderStats,
+		Text:     stats,
+		Required: true,
+	})
+
+	// 助手角色设定（提示词模板）
+	rolePrompt, promptRef, err := llm.RenderPrompt(llm.PromptChatSystem, llm.ChatSystemPrompt{
+		NovelTitle: novel.Title,
+		NovelGenre: novel.Genre,
+	})
+	if err != nil {
+		return nil, llm.PromptRef{}, nil, err
+	}
+	items = append(items, llm.ContextItem{
+		Key:      "role",
+		Priority: contextTierRequired,
+		Order:    contextOrderRole,
+		Text:     "\n" + rolePrompt,
+		Required: true,
+	})
 
-	context := strings.Join(contextParts, "\n")
+	replyReserve := utils.GetIntValue(h.db, constants.KEY_CHAT_CONTEXT_REPLY_RESERVE, llm.DefaultReplyReserve)
+	if maxTokens > replyReserve {
+		replyReserve = maxTokens
+	}
+	contextText, report := llm.BuildContext(llm.ContextBudgetConfig{
+		Model:        h.characterGenerator.GetModel(),
+		MaxTokens:    utils.GetIntValue(h.db, constants.KEY_CHAT_CONTEXT_MAX_TOKENS, 0),
+		ReplyReserve: replyReserve,
+		History:      history,
+	}, items)
+	if report.Degraded() {
+		contextText += "\n\n【注意】由于上下文长度限制，部分内容已以摘要代替或省略。"
+	}
 
 	logger.Info("小说上下文构建完成",
-		zap.Int("contextLength", len(context)),
-		zap.Int("totalParts", len(contextParts)))
+		zap.Int("contextLength", len(contextText)),
+		zap.Int("budget", report.Budget),
+		zap.Int("usedTokens", report.UsedTokens),
+		zap.Int("included", len(report.Included)),
+		zap.Int("dropped", len(report.Dropped)))
 
 	return &llm.Message{
 		Role:    "system",
-		Content: context,
-	}, nil
+		Content: contextText,
+	}, promptRef, report, nil
+}
+
+// chapterHeading 章节标题及摘要
+func chapterHeading(chapter models.Chapter) string {
+	heading := fmt.Sprintf("\n## 第%d章：%s", chapter.Order, chapter.Title)
+	if chapter.Summary != "" {
+		heading += fmt.Sprintf("\n【章节摘要】%s", chapter.Summary)
+	}
+	return heading
 }
 
 // TestBuildNovelContext 测试构建小说上下文（仅用于测试）
 func (h *AIHandler) TestBuildNovelContext(novelID uint) (*llm.Message, error) {
-	return h.buildNovelContext(novelID)
+	message, _, _, err := h.buildNovelContext(context.Background(), novelID, nil, 0)
+	return message, err
 }
 
 // DebugNovelContext 调试小说上下文构建（仅用于开发调试）
+// 返回上下文内容及预算报告（纳入和丢弃的条目），可通过 maxTokens 参数模拟回复的最大 token 数
 func (h *AIHandler) DebugNovelContext(c *gin.Context) {
 	novelIDStr := c.Param("novelId")
 	novelID, err := strconv.ParseUint(novelIDStr, 10, 32)
@@ -794,8 +971,9 @@ func (h *AIHandler) DebugNovelContext(c *gin.Context) {
 		})
 		return
 	}
+	maxTokens, _ := strconv.Atoi(c.Query("maxTokens"))
 
-	contextMessage, err := h.buildNovelContext(uint(novelID))
+	contextMessage, promptRef, report, err := h.buildNovelContext(c.Request.Context(), uint(novelID), nil, maxTokens)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": 500,
@@ -811,6 +989,8 @@ func (h *AIHandler) DebugNovelContext(c *gin.Context) {
 			"novelId":       novelID,
 			"contextLength": len(contextMessage.Content),
 			"context":       contextMessage.Content,
+			"promptVersion": promptRef.String(),
+			"budget":        report,
 		},
 	})
 }
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 聊天中可供模型调用的小说工具
+const (
+	toolGetCharacter      = "get_character"
+	toolSearchChapters    = "search_chapters"
+	toolReadChapter       = "read_chapter"
+	toolListSettings      = "list_settings"
+	toolGetStorylineNodes = "get_storyline_nodes"
+	toolCreatePlotDraft   = "create_plot_draft"
+)
+
+// 工具结果的长度限制（字符数），避免单次结果占满上下文
+const (
+	toolChapterMaxRunes = 6000 // read_chapter 返回的正文上限
+	toolSnippetRunes    = 120  // search_chapters 匹配片段长度
+	toolSettingMaxRunes = 800  // list_settings 每条设定内容上限
+	toolMaxResults      = 10   // 列表类工具的最大返回条数
+)
+
+// novelToolsPrompt 启用工具时附加的系统提示
+const novelToolsPrompt = `你可以调用工具查询当前小说的资料：角色（get_character）、章节检索与原文（search_chapters、read_chapter）、设定（list_settings）、故事线节点（get_storyline_nodes），以及创建情节草稿（create_plot_draft）。
+上下文中没有提供的细节请先用工具查询，不要凭空编造；只有用户明确要求记录情节时才创建草稿。`
+
+// novelTools 绑定到单个小说的聊天工具
+type novelTools struct {
+	db      *gorm.DB
+	novelID uint
+}
+
+// chatTools 为会话关联的小说创建工具；会话未关联小说或提供商不支持工具调用时返回 nil
+func (h *AIHandler) chatTools(ctx context.Context, session *models.ChatSession) *llm.FunctionToolManager {
+	if session.NovelID == nil || !h.characterGenerator.SupportsTools() {
+		return nil
+	}
+
+	t := &novelTools{db: h.db.WithContext(ctx), novelID: *session.NovelID}
+	manager := llm.NewFunctionToolManager()
+	manager.RegisterTool(toolGetCharacter, "按名称或别名查找本小说的角色，返回结构化角色档案（支持模糊匹配）",
+		json.RawMessage(`{"type":"object","properties":{"name":{"type":"string","description":"角色名称或其中一部分"}},"required":["name"]}`),
+		t.getCharacter)
+	manager.RegisterTool(toolSearchChapters, "按关键词检索本小说的章节标题、摘要和正文，返回匹配的章节及片段",
+		json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","description":"关键词"},"limit":{"type":"integer","description":"最多返回条数，默认5"}},"required":["query"]}`),
+		t.searchChapters)
+	manager.RegisterTool(toolReadChapter, "读取本小说某一章的原文，按章节ID或章节序号指定",
+		json.RawMessage(`{"type":"object","properties":{"chapterId":{"type":"integer","description":"章节ID"},"order":{"type":"integer","description":"章节序号"}}}`),
+		t.readChapter)
+	manager.RegisterTool(toolListSettings, "列出本小说的设定，可按分类过滤（world/power/tech/concept/rule/org/item/location/other）",
+		json.RawMessage(`{"type":"object","properties":{"category":{"type":"string","description":"设定分类，为空时返回全部"}}}`),
+		t.listSettings)
+	manager.RegisterTool(toolGetStorylineNodes, "获取本小说的故事线及其节点，可指定故事线ID",
+		json.RawMessage(`{"type":"object","properties":{"storylineId":{"type":"integer","description":"故事线ID，为空时返回全部故事线"}}}`),
+		t.getStorylineNodes)
+	manager.RegisterTool(toolCreatePlotDraft, "为本小说创建一个情节草稿，供作者稍后确认",
+		json.RawMessage(`{"type":"object","properties":{"title":{"type":"string","description":"情节标题"},"content":{"type":"string","description":"情节内容"}},"required":["title","content"]}`),
+		t.createPlotDraft)
+	return manager
+}
+
+// withToolsPrompt 在用户消息之前插入工具使用说明
+func withToolsPrompt(messages []llm.Message) []llm.Message {
+	index := 0
+	for index < len(messages) && messages[index].Role == "system" {
+		index++
+	}
+	result := make([]llm.Message, 0, len(messages)+1)
+	result = append(result, messages[:index]...)
+	result = append(result, llm.Message{Role: "system", Content: novelToolsPrompt})
+	return append(result, messages[index:]...)
+}
+
+// toolResult 将工具结果序列化为 JSON 文本
+func toolResult(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// parseToolArgs 解析工具参数
+func parseToolArgs(arguments string, args interface{}) error {
+	if strings.TrimSpace(arguments) == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(arguments), args); err != nil {
+		return fmt.Errorf("参数格式错误: %w", err)
+	}
+	return nil
+}
+
+// truncateRunes 按字符数截断文本
+func truncateRunes(text string, limit int) (string, bool) {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text, false
+	}
+	return string(runes[:limit]), true
+}
+
+// getCharacter 查找角色
+func (t *novelTools) getCharacter(arguments string) (string, error) {
+	var args struct {
+		Name string `json:"name"`
+	}
+	if err := parseToolArgs(arguments, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Name) == "" {
+		return "", fmt.Errorf("缺少角色名称")
+	}
+
+	var characters []models.Character
+	pattern := "%" + strings.TrimSpace(args.Name) + "%"
+	if err := t.db.Where("novel_id = ? AND (name LIKE ? OR aliases LIKE ?)", t.novelID, pattern, pattern).
+		Limit(toolMaxResults).Find(&characters).Error; err != nil {
+		return "", err
+	}
+	if len(characters) == 0 {
+		return "未找到名为「" + args.Name + "」的角色", nil
+	}
+
+	type characterInfo struct {
+		ID uint `json:"id"`
+		llm.CharacterProfile
+		FirstChapterID uint `json:"firstChapterId,omitempty"`
+	}
+	result := make([]characterInfo, len(characters))
+	for i, ch := range characters {
+		result[i] = characterInfo{ID: ch.ID, CharacterProfile: characterProfile(&ch), FirstChapterID: ch.FirstChapterID}
+	}
+	return toolResult(result)
+}
+
+// searchChapters 检索章节
+func (t *novelTools) searchChapters(arguments string) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := parseToolArgs(arguments, &args); err != nil {
+		return "", err
+	}
+	query := strings.TrimSpace(args.Query)
+	if query == "" {
+		return "", fmt.Errorf("缺少关键词")
+	}
+	if args.Limit <= 0 {
+		args.Limit = 5
+	}
+	if args.Limit > toolMaxResults {
+		args.Limit = toolMaxResults
+	}
+
+	pattern := "%" + query + "%"
+	var chapters []models.Chapter
+	if err := t.db.Where("novel_id = ? AND (title LIKE ? OR summary LIKE ? OR content LIKE ?)", t.novelID, pattern, pattern, pattern).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "order"}}).
+		Limit(args.Limit).Find(&chapters).Error; err != nil {
+		return "", err
+	}
+	if len(chapters) == 0 {
+		return "没有章节包含「" + query + "」", nil
+	}
+
+	type chapterMatch struct {
+		ID      uint   `json:"id"`
+		Order   int    `json:"order"`
+		Title   string `json:"title"`
+		Summary string `json:"summary,omitempty"`
+		Snippet string `json:"snippet,omitempty"`
+	}
+	result := make([]chapterMatch, len(chapters))
+	for i, ch := range chapters {
+		result[i] = chapterMatch{ID: ch.ID, Order: ch.Order, Title: ch.Title, Summary: ch.Summary, Snippet: matchSnippet(ch.Content, query)}
+	}
+	return toolResult(result)
+}
+
+// matchSnippet 截取关键词附近的正文片段
+func matchSnippet(content, query string) string {
+	index := strings.Index(content, query)
+	if index < 0 {
+		return ""
+	}
+	runes := []rune(content)
+	start := len([]rune(content[:index])) - toolSnippetRunes/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + toolSnippetRunes
+	if end > len(runes) {
+		end = len(runes)
+	}
+	return string(runes[start:end])
+}
+
+// readChapter 读取章节原文
+func (t *novelTools) readChapter(arguments string) (string, error) {
+	var args struct {
+		ChapterID uint `json:"chapterId"`
+		Order     int  `json:"order"`
+	}
+	if err := parseToolArgs(arguments, &args); err != nil {
+		return "", err
+	}
+
+	query := t.db.Where("novel_id = ?", t.novelID)
+	switch {
+	case args.ChapterID > 0:
+		query = query.Where("id = ?", args.ChapterID)
+	case args.Order > 0:
+		query = query.Where(clause.Eq{Column: clause.Column{Name: "order"}, Value: args.Order})
+	default:
+		return "", fmt.Errorf("需要指定 chapterId 或 order")
+	}
+
+	var chapter models.Chapter
+	if err := query.First(&chapter).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return "章节不存在", nil
+		}
+		return "", err
+	}
+
+	content, truncated := truncateRunes(chapter.Content, toolChapterMaxRunes)
+	return toolResult(map[string]interface{}{
+		"id":        chapter.ID,
+		"order":     chapter.Order,
+		"title":     chapter.Title,
+		"content":   content,
+		"truncated": truncated,
+	})
+}
+
+// listSettings 列出设定
+func (t *novelTools) listSettings(arguments string) (string, error) {
+	var args struct {
+		Category string `json:"category"`
+	}
+	if err := parseToolArgs(arguments, &args); err != nil {
+		return "", err
+	}
+
+	query := t.db.Where("novel_id = ?", t.novelID)
+	if args.Category != "" {
+		query = query.Where("category = ?", args.Category)
+	}
+	var settings []models.NovelSetting
+	if err := query.Order("is_important DESC, order_index ASC").Limit(toolMaxResults * 2).Find(&settings).Error; err != nil {
+		return "", err
+	}
+	if len(settings) == 0 {
+		return "没有找到设定", nil
+	}
+
+	type settingInfo struct {
+		ID       int    `json:"id"`
+		Category string `json:"category"`
+		Title    string `json:"title"`
+		Content  string `json:"content"`
+	}
+	result := make([]settingInfo, len(settings))
+	for i, s := range settings {
+		content, _ := truncateRunes(s.Content, toolSettingMaxRunes)
+		result[i] = settingInfo{ID: s.ID, Category: models.GetCategoryName(s.Category), Title: s.Title, Content: content}
+	}
+	return toolResult(result)
+}
+
+// getStorylineNodes 获取故事线节点
+func (t *novelTools) getStorylineNodes(arguments string) (string, error) {
+	var args struct {
+		StorylineID int `json:"storylineId"`
+	}
+	if err := parseToolArgs(arguments, &args); err != nil {
+		return "", err
+	}
+
+	query := t.db.Where("novel_id = ?", t.novelID)
+	if args.StorylineID > 0 {
+		query = query.Where("id = ?", args.StorylineID)
+	}
+	var storylines []models.Storyline
+	if err := query.Order("priority DESC").
+		Preload("Nodes", func(db *gorm.DB) *gorm.DB { return db.Order("order_index ASC") }).
+		Find(&storylines).Error; err != nil {
+		return "", err
+	}
+	if len(storylines) == 0 {
+		return "没有找到故事线", nil
+	}
+
+	type nodeInfo struct {
+		ID           int    `json:"id"`
+		Title        string `json:"title"`
+		Description  string `json:"description"`
+		NodeType     string `json:"nodeType"`
+		Status       string `json:"status"`
+		ChapterRange string `json:"chapterRange,omitempty"`
+	}
+	type storylineInfo struct {
+		ID     int        `json:"id"`
+		Title  string     `json:"title"`
+		Type   string     `json:"type"`
+		Status string     `json:"status"`
+		Nodes  []nodeInfo `json:"nodes"`
+	}
+	result := make([]storylineInfo, len(storylines))
+	for i, s := range storylines {
+		info := storylineInfo{ID: s.ID, Title: s.Title, Type: s.Type, Status: s.Status, Nodes: make([]nodeInfo, len(s.Nodes))}
+		for j, n := range s.Nodes {
+			info.Nodes[j] = nodeInfo{ID: n.ID, Title: n.Title, Description: n.Description, NodeType: n.NodeType, Status: n.Status, ChapterRange: n.ChapterRange}
+		}
+		result[i] = info
+	}
+	return toolResult(result)
+}
+
+// createPlotDraft 创建情节草稿
+func (t *novelTools) createPlotDraft(arguments string) (string, error) {
+	var args struct {
+		Title   string `json:"title"`
+		Content string `json:"content"`
+	}
+	if err := parseToolArgs(arguments, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Title) == "" {
+		return "", fmt.Errorf("缺少情节标题")
+	}
+
+	plot := models.PlotPoint{
+		NovelID: t.novelID,
+		Title:   strings.TrimSpace(args.Title),
+		Content: args.Content,
+		Status:  models.PlotPointStatusDraft,
+	}
+	if err := t.db.Create(&plot).Error; err != nil {
+		return "", err
+	}
+
+	logger.Info("AI 聊天创建情节草稿", zap.Uint("novelID", t.novelID), zap.Uint("plotPointID", plot.ID))
+	return toolResult(map[string]interface{}{
+		"id":     plot.ID,
+		"title":  plot.Title,
+		"status": plot.Status,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/LingByte/LingDialog/pkg/config"
+	"github.com/LingByte/LingDialog/pkg/llm"
 	"github.com/gin-gonic/gin"
 )
 
@@ -16,6 +17,11 @@ func checkLLMConfigured(c *gin.Context) bool {
 		return true
 	}
 
+	// Mock 提供商离线运行（录制模式的上游配置在创建提供商时校验）
+	if config.IsMockProvider() {
+		return true
+	}
+
 	// 对于 OpenAI 兼容 API，检查 API key
 	if config.GlobalConfig.LLMApiKey == "" {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -27,3 +33,27 @@ func checkLLMConfigured(c *gin.Context) bool {
 
 	return true
 }
+
+// clientGone 判断客户端是否已断开或请求已超时，此时不再写入响应
+func clientGone(c *gin.Context) bool {
+	return c.Request.Context().Err() != nil
+}
+
+// setSSEHeaders 设置 SSE 响应头
+func setSSEHeaders(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Transfer-Encoding", "chunked")
+}
+
+// sseCallback 包装流式回调：客户端断开后返回上下文错误，使提供商立即停止读取上游流
+// 中途取消时已生成的部分内容：聊天回复标记为中断后保存，其余生成结果不落库，直接丢弃
+func sseCallback(c *gin.Context, send llm.StreamCallback) llm.StreamCallback {
+	return func(segment string, isComplete bool) error {
+		if err := c.Request.Context().Err(); err != nil {
+			return err
+		}
+		return send(segment, isComplete)
+	}
+}
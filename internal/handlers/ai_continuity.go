@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	continuityMaxConcurrent  = 2               // 同时执行的连续性检查数
+	continuityCheckTimeout   = 5 * time.Minute // 单次检查的超时时间
+	continuityMaxSettings    = 15              // 提供给模型的设定数上限
+	continuityMaxCharacters  = 15              // 提供给模型的角色数上限
+	continuityMaxSummaries   = 5               // 提供给模型的前文章节摘要数
+	continuitySettingRunes   = 300             // 单条设定内容的截断长度
+	continuityCharacterRunes = 400             // 单个角色档案的截断长度
+)
+
+// continuityCoreCategories 无论正文是否提及都提供给模型的设定分类
+var continuityCoreCategories = map[string]bool{
+	models.SettingCategoryWorld: true,
+	models.SettingCategoryPower: true,
+	models.SettingCategoryTech:  true,
+	models.SettingCategoryRule:  true,
+}
+
+// continuityRunner 在后台执行章节连续性检查，限制并发数
+type continuityRunner struct {
+	db      *gorm.DB
+	checker *llm.ContinuityChecker
+	sem     chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newContinuityRunner 创建连续性检查执行器
+func newContinuityRunner(db *gorm.DB, provider llm.Provider, model string) *continuityRunner {
+	return &continuityRunner{
+		db:      db,
+		checker: llm.NewContinuityChecker(provider, model),
+		sem:     make(chan struct{}, continuityMaxConcurrent),
+	}
+}
+
+// chapterContentHash 章节内容的哈希，用于判断内容是否已检查过
+func chapterContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// start 创建检查记录并在后台检查 chapter（保存时的内容快照），返回排队中的检查记录
+func (r *continuityRunner) start(chapter *models.Chapter, userID uint, trigger string) (*models.ContinuityCheck, error) {
+	check := &models.ContinuityCheck{
+		NovelID:     chapter.NovelID,
+		ChapterID:   chapter.ID,
+		UserID:      userID,
+		Trigger:     trigger,
+		Status:      models.ContinuityCheckPending,
+		ContentHash: chapterContentHash(chapter.Content),
+	}
+	if err := r.db.Create(check).Error; err != nil {
+		return nil, err
+	}
+
+	running := *check
+	snapshot := *chapter
+	r.wg.Add(1)
+	go r.run(&running, &snapshot)
+	return check, nil
+}
+
+// wait 等待所有后台检查结束
+func (r *continuityRunner) wait() {
+	r.wg.Wait()
+}
+
+// fail 将检查标记为失败
+func (r *continuityRunner) fail(check *models.ContinuityCheck, err error) {
+	logger.Warn("章节连续性检查失败",
+		zap.Uint("checkId", check.ID),
+		zap.Uint("chapterId", check.ChapterID),
+		zap.Error(err))
+	now := time.Now()
+	if dbErr := r.db.Model(check).Updates(map[string]interface{}{
+		"status":      models.ContinuityCheckFailed,
+		"error":       err.Error(),
+		"finished_at": &now,
+	}).Error; dbErr != nil {
+		logger.Error("更新连续性检查状态失败", zap.Uint("checkId", check.ID), zap.Error(dbErr))
+	}
+}
+
+// run 执行一次检查，用量计入触发用户，配额已用完时直接失败
+func (r *continuityRunner) run(check *models.ContinuityCheck, chapter *models.Chapter) {
+	defer r.wg.Done()
+	defer func() {
+		if p := recover(); p != nil {
+			r.fail(check, fmt.Errorf("panic: %v", p))
+		}
+	}()
+
+	r.sem <- struct{}{}
+	defer func() { <-r.sem }()
+
+	if err := r.db.Model(check).Update("status", models.ContinuityCheckRunning).Error; err != nil {
+		r.fail(check, err)
+		return
+	}
+
+	if usageQuotaExceeded(r.db, check.UserID) {
+		r.fail(check, errors.New("AI用量已达上限"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), continuityCheckTimeout)
+	defer cancel()
+	ctx, scope := llm.WithUsageScope(ctx)
+	ctx = llm.WithCallInfo(ctx, &llm.CallInfo{UserID: check.UserID, NovelID: check.NovelID, Feature: llm.PromptContinuityCheck})
+	defer recordLLMUsage(r.db, check.UserID, llm.PromptContinuityCheck, scope)
+
+	req, dismissed, err := buildContinuityRequest(r.db, chapter)
+	if err != nil {
+		r.fail(check, err)
+		return
+	}
+	found, err := r.checker.Check(ctx, req)
+	if err != nil {
+		r.fail(check, err)
+		return
+	}
+
+	issues := make([]models.ChapterIssue, 0, len(found))
+	for _, issue := range found {
+		if issue.Quote != "" && dismissed[issue.Quote] {
+			continue
+		}
+		issues = append(issues, models.ChapterIssue{
+			Category:    issue.Category,
+			Severity:    issue.Severity,
+			Quote:       issue.Quote,
+			Position:    quotePosition(chapter.Content, issue.Quote),
+			Description: issue.Description,
+			Reference:   issue.Reference,
+			Suggestion:  issue.Suggestion,
+		})
+	}
+	if err := models.CompleteContinuityCheck(r.db, check, issues); err != nil {
+		r.fail(check, err)
+		return
+	}
+	logger.Info("章节连续性检查完成",
+		zap.Uint("checkId", check.ID),
+		zap.Uint("chapterId", check.ChapterID),
+		zap.Int("issues", len(issues)))
+}
+
+// quotePosition 返回原文片段在章节中的字符位置，找不到时为 -1
+func quotePosition(content, quote string) int {
+	if quote == "" {
+		return -1
+	}
+	idx := strings.Index(content, quote)
+	if idx < 0 {
+		return -1
+	}
+	return utf8.RuneCountInString(content[:idx])
+}
+
+// buildContinuityRequest 按相关性挑选设定、角色和前文摘要，同时返回作者已忽略的原文片段
+// 设定：重要设定、核心分类（世界观、力量体系、科技、规则）以及标题在正文中出现的设定
+// 角色：章节参与角色，以及名称或别名在正文中出现的角色
+func buildContinuityRequest(db *gorm.DB, chapter *models.Chapter) (llm.ContinuityCheckRequest, map[string]bool, error) {
+	req := llm.ContinuityCheckRequest{
+		ChapterNumber: chapter.Order,
+		ChapterTitle:  chapter.Title,
+		Content:       chapter.Content,
+	}
+
+	var novel models.Novel
+	if err := db.Select("id", "title").First(&novel, chapter.NovelID).Error; err != nil {
+		return req, nil, fmt.Errorf("获取小说失败: %w", err)
+	}
+	req.NovelTitle = novel.Title
+
+	var settings []models.NovelSetting
+	if err := db.Where("novel_id = ?", chapter.NovelID).
+		Order("is_important DESC, order_index ASC").Find(&settings).Error; err != nil {
+		return req, nil, fmt.Errorf("获取设定失败: %w", err)
+	}
+	for _, s := range settings {
+		if len(req.Settings) >= continuityMaxSettings {
+			break
+		}
+		if !s.IsImportant && !continuityCoreCategories[s.Category] && !strings.Contains(chapter.Content, s.Title) {
+			continue
+		}
+		content, _ := truncateRunes(s.Content, continuitySettingRunes)
+		req.Settings = append(req.Settings, fmt.Sprintf("[%s] %s：%s", models.GetCategoryName(s.Category), s.Title, content))
+	}
+
+	participants := parseIDList(chapter.CharacterIDs)
+	var characters []models.Character
+	if err := db.Where("novel_id = ?", chapter.NovelID).Order("id ASC").Find(&characters).Error; err != nil {
+		return req, nil, fmt.Errorf("获取角色失败: %w", err)
+	}
+	for _, ch := range characters {
+		if len(req.Characters) >= continuityMaxCharacters {
+			break
+		}
+		if !participants[ch.ID] && !mentionsCharacter(chapter.Content, &ch) {
+			continue
+		}
+		profile := characterProfile(&ch)
+		text, _ := truncateRunes(profile.Text(), continuityCharacterRunes)
+		req.Characters = append(req.Characters, fmt.Sprintf("【%s】\n%s", ch.Name, text))
+	}
+
+	var previous []models.Chapter
+	if err := db.Where("novel_id = ? AND id <> ? AND summary <> ''", chapter.NovelID, chapter.ID).
+		Where(clause.Lt{Column: clause.Column{Name: "order"}, Value: chapter.Order}).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "order"}, Desc: true}).
+		Limit(continuityMaxSummaries).Find(&previous).Error; err != nil {
+		return req, nil, fmt.Errorf("获取前文摘要失败: %w", err)
+	}
+	sort.Slice(previous, func(i, j int) bool { return previous[i].Order < previous[j].Order })
+	for _, p := range previous {
+		req.PreviousSummaries = append(req.PreviousSummaries, fmt.Sprintf("第 %d 章 %s：%s", p.Order, p.Title, p.Summary))
+	}
+
+	dismissedIssues, err := models.DismissedChapterIssues(db, chapter.ID)
+	if err != nil {
+		return req, nil, fmt.Errorf("获取已忽略的问题失败: %w", err)
+	}
+	dismissed := make(map[string]bool, len(dismissedIssues))
+	for _, issue := range dismissedIssues {
+		if issue.Quote != "" {
+			dismissed[issue.Quote] = true
+			req.Dismissed = append(req.Dismissed, fmt.Sprintf("「%s」%s", issue.Quote, issue.Description))
+		} else {
+			req.Dismissed = append(req.Dismissed, issue.Description)
+		}
+	}
+	return req, dismissed, nil
+}
+
+// mentionsCharacter 正文中是否出现角色的名称或别名
+func mentionsCharacter(content string, ch *models.Character) bool {
+	if ch.Name != "" && strings.Contains(content, ch.Name) {
+		return true
+	}
+	for _, alias := range models.SplitAliases(ch.Aliases) {
+		if alias = strings.TrimSpace(alias); alias != "" && strings.Contains(content, alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleContinuityCheck 小说开启了自动检查时，在章节内容保存后排队检查
+// runner 为空、内容为空、与上次检查时相同或已有检查在进行时跳过；失败只记录日志，不影响保存
+func scheduleContinuityCheck(db *gorm.DB, runner *continuityRunner, userID uint, chapter *models.Chapter) {
+	if runner == nil || strings.TrimSpace(chapter.Content) == "" {
+		return
+	}
+	var novel models.Novel
+	if err := db.Select("id", "auto_check_continuity").First(&novel, chapter.NovelID).Error; err != nil || !novel.AutoCheckContinuity {
+		return
+	}
+	active, err := models.HasActiveContinuityCheck(db, chapter.ID)
+	if err != nil || active {
+		return
+	}
+	if last, err := models.LastCheckedContentHash(db, chapter.ID); err != nil || last == chapterContentHash(chapter.Content) {
+		return
+	}
+	if _, err := runner.start(chapter, userID, models.ContinuityTriggerAuto); err != nil {
+		logger.Error("创建连续性检查失败", zap.Uint("chapterId", chapter.ID), zap.Error(err))
+	}
+}
+
+// ContinuityCheckRequest 手动触发连续性检查请求
+type ContinuityCheckRequest struct {
+	ChapterID uint `json:"chapterId" binding:"required"`
+}
+
+// CheckChapterContinuity 手动触发章节连续性检查
+// @Summary 检查章节连续性
+// @Description 在后台检查章节是否与设定、角色档案和前文矛盾，立即返回检查记录，结果通过章节问题列表获取
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param request body ContinuityCheckRequest true "检查请求"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/chapter/continuity-check [post]
+func (h *AIHandler) CheckChapterContinuity(c *gin.Context) {
+	var req ContinuityCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var chapter models.Chapter
+	if err := h.db.First(&chapter, req.ChapterID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "章节不存在",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "获取章节失败",
+			})
+		}
+		return
+	}
+	if strings.TrimSpace(chapter.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "章节内容为空",
+		})
+		return
+	}
+	active, err := models.HasActiveContinuityCheck(h.db, chapter.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "查询连续性检查失败",
+		})
+		return
+	}
+	if active {
+		c.JSON(http.StatusConflict, gin.H{
+			"code": 409,
+			"msg":  "该章节已有正在进行的检查",
+		})
+		return
+	}
+
+	check, err := h.continuity.start(&chapter, currentUserID(c), models.ContinuityTriggerManual)
+	if err != nil {
+		logger.Error("创建连续性检查失败", zap.Uint("chapterId", chapter.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "创建连续性检查失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "检查已开始",
+		"data": check,
+	})
+}
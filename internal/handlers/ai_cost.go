@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/config"
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/LingByte/LingDialog/pkg/notification"
+	"github.com/LingByte/LingDialog/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// budgetAlertTimeout 发送预算告警的超时时间
+const budgetAlertTimeout = 30 * time.Second
+
+// LLMBudget 月度预算配置，保存在系统配置 LLM_BUDGET 中
+type LLMBudget struct {
+	Monthly       float64 `json:"monthly"`       // 月度预算，0 表示不告警
+	Currency      string  `json:"currency"`      // 币种，只统计该币种的费用
+	AlertPercents []int   `json:"alertPercents"` // 告警阈值（预算百分比），如 [80, 100]
+}
+
+// defaultBudgetAlertPercents 未配置阈值时的默认告警阈值
+var defaultBudgetAlertPercents = []int{80, 100}
+
+// loadLLMBudget 读取月度预算配置，未配置或无效时返回零值
+func loadLLMBudget(db *gorm.DB) LLMBudget {
+	var budget LLMBudget
+	raw := utils.GetValue(db, constants.KEY_LLM_BUDGET)
+	if strings.TrimSpace(raw) == "" {
+		return budget
+	}
+	if err := json.Unmarshal([]byte(raw), &budget); err != nil {
+		logger.Warn("预算配置无效，已忽略", zap.Error(err))
+		return LLMBudget{}
+	}
+	return budget.normalized()
+}
+
+// normalized 补全默认值，阈值去重并升序排列
+func (b LLMBudget) normalized() LLMBudget {
+	if b.Currency == "" {
+		b.Currency = models.DefaultLLMCurrency
+	}
+	if len(b.AlertPercents) == 0 {
+		b.AlertPercents = defaultBudgetAlertPercents
+	}
+	seen := make(map[int]bool)
+	percents := make([]int, 0, len(b.AlertPercents))
+	for _, p := range b.AlertPercents {
+		if p > 0 && !seen[p] {
+			seen[p] = true
+			percents = append(percents, p)
+		}
+	}
+	sort.Ints(percents)
+	b.AlertPercents = percents
+	return b
+}
+
+// budgetAlerter 月度费用超过预算阈值时通过通知渠道告警，每月每个阈值只告警一次
+type budgetAlerter struct {
+	db       *gorm.DB
+	manager  *notification.NotificationManager
+	channels []notification.NotificationType
+}
+
+// newBudgetAlerter 创建预算告警：站内通知发送给所有管理员，配置了 webhook 时同时发送到钉钉、飞书
+func newBudgetAlerter(db *gorm.DB) *budgetAlerter {
+	cfg := config.GlobalConfig
+	manager := notification.NewNotificationManager()
+	manager.Register(notification.NewInternalNotificationAdapter(notification.NewInternalNotificationService(db)))
+	channels := []notification.NotificationType{notification.TypeInternal}
+	if cfg.LLMBudgetDingTalkWebhook != "" {
+		manager.Register(notification.NewDingTalkNotification(notification.DingTalkConfig{
+			WebhookURL: cfg.LLMBudgetDingTalkWebhook,
+			Secret:     cfg.LLMBudgetDingTalkSecret,
+		}))
+		channels = append(channels, notification.TypeDingTalk)
+	}
+	if cfg.LLMBudgetFeishuWebhook != "" {
+		manager.Register(notification.NewFeishuNotification(notification.FeishuConfig{
+			WebhookURL: cfg.LLMBudgetFeishuWebhook,
+			Secret:     cfg.LLMBudgetFeishuSecret,
+		}))
+		channels = append(channels, notification.TypeFeishu)
+	}
+	return &budgetAlerter{db: db, manager: manager, channels: channels}
+}
+
+// check 统计本月费用，超过新的阈值时异步发送告警
+func (a *budgetAlerter) check(db *gorm.DB, currency string, now time.Time) {
+	budget := loadLLMBudget(db)
+	if budget.Monthly <= 0 || budget.Currency != currency {
+		return
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	spent, err := models.SumLLMCost(db, currency, monthStart.Format("2006-01-02"), now.Format("2006-01-02"))
+	if err != nil {
+		logger.Warn("统计本月 LLM 费用失败", zap.Error(err))
+		return
+	}
+
+	// 只对已越过的最高阈值告警，同一次调用越过多个阈值时不重复发送
+	crossed := 0
+	for _, p := range budget.AlertPercents {
+		if spent >= budget.Monthly*float64(p)/100 {
+			crossed = p
+		}
+	}
+	if crossed == 0 {
+		return
+	}
+
+	alert := models.LLMBudgetAlert{
+		Month:    now.Format("2006-01"),
+		Percent:  crossed,
+		Currency: currency,
+		Budget:   budget.Monthly,
+		Spent:    spent,
+	}
+	first, err := models.ClaimLLMBudgetAlert(db, &alert)
+	if err != nil {
+		logger.Warn("记录预算告警失败", zap.Error(err))
+		return
+	}
+	if first {
+		go a.send(alert)
+	}
+}
+
+// send 向所有渠道发送告警
+func (a *budgetAlerter) send(alert models.LLMBudgetAlert) {
+	var adminIDs []uint
+	if err := a.db.Model(&models.User{}).Where("role = ?", "admin").Pluck("id", &adminIDs).Error; err != nil {
+		logger.Warn("查询管理员失败", zap.Error(err))
+	}
+	to := make([]string, len(adminIDs))
+	for i, id := range adminIDs {
+		to[i] = strconv.FormatUint(uint64(id), 10)
+	}
+
+	title := fmt.Sprintf("AI 费用已达本月预算的 %d%%", alert.Percent)
+	content := fmt.Sprintf("%s 月 AI 调用费用已达 %.2f %s，月度预算 %.2f %s（%d%%）。",
+		alert.Month, alert.Spent, alert.Currency, alert.Budget, alert.Currency, alert.Percent)
+
+	ctx, cancel := context.WithTimeout(context.Background(), budgetAlertTimeout)
+	defer cancel()
+	for _, channel := range a.channels {
+		req := notification.NotificationRequest{Type: channel, Title: title, Content: content, To: to, Context: ctx}
+		if channel != notification.TypeInternal {
+			// 群机器人只发送正文且不区分接收人，带上标题并填充占位接收人
+			req.Content = title + "\n" + content
+			req.To = []string{string(channel)}
+		} else if len(to) == 0 {
+			continue
+		}
+		if err := a.manager.Send(ctx, req); err != nil {
+			logger.Warn("发送预算告警失败", zap.String("channel", string(channel)), zap.Error(err))
+		}
+	}
+	logger.Warn("LLM 费用超过预算阈值",
+		zap.String("month", alert.Month),
+		zap.Int("percent", alert.Percent),
+		zap.Float64("spent", alert.Spent),
+		zap.Float64("budget", alert.Budget))
+}
+
+// ListModelPrices 获取模型价格
+// @Summary 获取模型价格
+// @Description 列出所有模型价格配置，按模型和生效时间排序（仅管理员）
+// @Tags AI
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/prices [get]
+func (h *AIHandler) ListModelPrices(c *gin.Context) {
+	var prices []models.LLMModelPrice
+	if err := h.db.Order("model ASC, effective_from DESC").Find(&prices).Error; err != nil {
+		logger.Error("获取模型价格失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取模型价格失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": prices,
+	})
+}
+
+// SaveModelPriceRequest 设置模型价格请求
+type SaveModelPriceRequest struct {
+	Model         string     `json:"model" binding:"required"` // 模型名称
+	InputPrice    float64    `json:"inputPrice"`               // 输入价格（每百万 token）
+	OutputPrice   float64    `json:"outputPrice"`              // 输出价格（每百万 token）
+	Currency      string     `json:"currency"`                 // 币种，默认 USD
+	EffectiveFrom *time.Time `json:"effectiveFrom"`            // 生效时间，默认立即生效
+	Remark        string     `json:"remark"`                   // 备注
+}
+
+// SaveModelPrice 设置模型价格
+// @Summary 设置模型价格
+// @Description 新增模型价格，同一模型同一生效时间已存在时覆盖；调用按发生时生效的价格计费（仅管理员）
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param request body SaveModelPriceRequest true "模型价格"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/prices [put]
+func (h *AIHandler) SaveModelPrice(c *gin.Context) {
+	var req SaveModelPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.InputPrice < 0 || req.OutputPrice < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "价格不能为负数",
+		})
+		return
+	}
+
+	price := models.LLMModelPrice{
+		Model:         strings.TrimSpace(req.Model),
+		InputPrice:    req.InputPrice,
+		OutputPrice:   req.OutputPrice,
+		Currency:      strings.ToUpper(strings.TrimSpace(req.Currency)),
+		EffectiveFrom: time.Now(),
+		Remark:        req.Remark,
+	}
+	if price.Currency == "" {
+		price.Currency = models.DefaultLLMCurrency
+	}
+	if req.EffectiveFrom != nil {
+		price.EffectiveFrom = *req.EffectiveFrom
+	}
+	if user := middleware.GetCurrentUser(c); user != nil {
+		price.CreateBy = user.Email
+		price.UpdateBy = user.Email
+	}
+	if err := models.SaveLLMModelPrice(h.db, &price); err != nil {
+		logger.Error("保存模型价格失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "保存模型价格失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "保存成功",
+		"data": price,
+	})
+}
+
+// DeleteModelPrice 删除模型价格
+// @Summary 删除模型价格
+// @Description 删除一条价格配置，已计入汇总的费用不会重算（仅管理员）
+// @Tags AI
+// @Produce json
+// @Param id path int true "价格ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/prices/{id} [delete]
+func (h *AIHandler) DeleteModelPrice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的价格ID",
+		})
+		return
+	}
+
+	result := h.db.Delete(&models.LLMModelPrice{}, id)
+	if result.Error != nil {
+		logger.Error("删除模型价格失败", zap.Error(result.Error))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "删除模型价格失败",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"msg":  "价格不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "删除成功",
+	})
+}
+
+// CostReportRequest 费用报表请求
+type CostReportRequest struct {
+	GroupBy string `form:"groupBy,default=date"` // 分组维度：user / novel / task / model / date
+	Since   string `form:"since"`                // 开始日期（YYYY-MM-DD），默认本月 1 日
+	Until   string `form:"until"`                // 结束日期（YYYY-MM-DD，含当天），默认今天
+}
+
+// GetCostReport 获取费用报表
+// @Summary 获取 AI 费用报表
+// @Description 按用户、小说、任务、模型或日期汇总日期范围内的调用费用，不同币种分开统计（仅管理员）
+// @Tags AI
+// @Produce json
+// @Param groupBy query string false "分组维度(user/novel/task/model/date)" default(date)
+// @Param since query string false "开始日期(YYYY-MM-DD)，默认本月1日"
+// @Param until query string false "结束日期(YYYY-MM-DD)，默认今天"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/costs [get]
+func (h *AIHandler) GetCostReport(c *gin.Context) {
+	var req CostReportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if !models.IsValidLLMCostGroup(req.GroupBy) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "不支持的分组维度: " + req.GroupBy,
+		})
+		return
+	}
+	now := time.Now()
+	if req.Since == "" {
+		req.Since = now.Format("2006-01") + "-01"
+	}
+	if req.Until == "" {
+		req.Until = now.Format("2006-01-02")
+	}
+
+	totals, err := models.GetLLMCostReport(h.db, req.GroupBy, req.Since, req.Until)
+	if err != nil {
+		logger.Error("获取费用报表失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取费用报表失败",
+		})
+		return
+	}
+
+	// 各币种合计
+	sums := make(map[string]float64)
+	for _, t := range totals {
+		sums[t.Currency] += t.Cost
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"groupBy": req.GroupBy,
+			"since":   req.Since,
+			"until":   req.Until,
+			"items":   totals,
+			"totals":  sums,
+		},
+	})
+}
+
+// GetBudget 获取月度预算
+// @Summary 获取 AI 月度预算
+// @Description 返回月度预算配置、本月已花费和本月已发送的告警（仅管理员）
+// @Tags AI
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/budget [get]
+func (h *AIHandler) GetBudget(c *gin.Context) {
+	budget := loadLLMBudget(h.db)
+	now := time.Now()
+	month := now.Format("2006-01")
+
+	var spent float64
+	if budget.Currency != "" {
+		var err error
+		spent, err = models.SumLLMCost(h.db, budget.Currency, month+"-01", now.Format("2006-01-02"))
+		if err != nil {
+			logger.Error("统计本月费用失败", zap.Error(err))
+		}
+	}
+	var alerts []models.LLMBudgetAlert
+	h.db.Where("month = ?", month).Order("percent ASC").Find(&alerts)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"budget": budget,
+			"month":  month,
+			"spent":  spent,
+			"alerts": alerts,
+		},
+	})
+}
+
+// SaveBudget 设置月度预算
+// @Summary 设置 AI 月度预算
+// @Description 设置月度预算、币种和告警阈值，monthly 为 0 时关闭告警（仅管理员）
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param request body LLMBudget true "月度预算"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/budget [put]
+func (h *AIHandler) SaveBudget(c *gin.Context) {
+	var budget LLMBudget
+	if err := c.ShouldBindJSON(&budget); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if budget.Monthly < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "预算不能为负数",
+		})
+		return
+	}
+	budget.Currency = strings.ToUpper(strings.TrimSpace(budget.Currency))
+	budget = budget.normalized()
+
+	data, _ := json.Marshal(budget)
+	utils.SetValue(h.db, constants.KEY_LLM_BUDGET, string(data), "json", false, false)
+	logger.Info("AI 月度预算已更新", zap.Float64("monthly", budget.Monthly), zap.String("currency", budget.Currency))
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "保存成功",
+		"data": budget,
+	})
+}
@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	entityMaxConcurrent  = 2               // 同时执行的实体确认数
+	entityConfirmTimeout = 2 * time.Minute // 单次确认的超时时间
+	entityMinTermRunes   = 2               // 参与匹配的名称最少字数，单字容易误中
+	entityDetailRunes    = 80              // 提供给模型的实体简介截断长度
+)
+
+// entityTypeNames 实体类型在提示词中的名称
+var entityTypeNames = map[string]string{
+	models.ChapterEntityCharacter: "角色",
+	models.ChapterEntityPlotPoint: "情节",
+	models.ChapterEntitySetting:   "设定",
+	models.ChapterEntityLocation:  "地点",
+}
+
+// entityRunner 在后台由 AI 确认章节实体，限制并发数；
+// 每次提取都有递增的序号，章节再次保存后，旧的确认结果不再写入
+type entityRunner struct {
+	db        *gorm.DB
+	extractor *llm.EntityExtractor
+	sem       chan struct{}
+	wg        sync.WaitGroup
+
+	mu     sync.Mutex
+	seq    uint64
+	latest map[uint]uint64 // 章节ID -> 最近一次提取的序号
+}
+
+// newEntityRunner 创建实体确认执行器
+func newEntityRunner(db *gorm.DB, provider llm.Provider, model string) *entityRunner {
+	return &entityRunner{
+		db:        db,
+		extractor: llm.NewEntityExtractor(provider, model),
+		sem:       make(chan struct{}, entityMaxConcurrent),
+		latest:    map[uint]uint64{},
+	}
+}
+
+// begin 开始一次章节实体提取，返回提取序号
+func (r *entityRunner) begin(chapterID uint) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	r.latest[chapterID] = r.seq
+	return r.seq
+}
+
+// commit 写入提取结果，章节在此之后又开始了新的提取时放弃写入并返回 false
+func (r *entityRunner) commit(chapterID uint, seq uint64, entities []models.ChapterEntity) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.latest[chapterID] != seq {
+		return false, nil
+	}
+	return true, models.ReplaceChapterEntities(r.db, chapterID, entities)
+}
+
+// start 在后台确认 chapter（保存时的内容快照）中匹配到的实体
+func (r *entityRunner) start(userID uint, chapter *models.Chapter, matches []entityMatch, seq uint64) {
+	snapshot := *chapter
+	r.wg.Add(1)
+	go r.run(userID, &snapshot, matches, seq)
+}
+
+// wait 等待所有后台确认结束
+func (r *entityRunner) wait() {
+	r.wg.Wait()
+}
+
+// run 执行一次确认，用量计入触发用户；配额已用完或确认失败时保留名称匹配的结果
+func (r *entityRunner) run(userID uint, chapter *models.Chapter, matches []entityMatch, seq uint64) {
+	defer r.wg.Done()
+	defer func() {
+		if p := recover(); p != nil {
+			logger.Error("章节实体确认异常", zap.Uint("chapterId", chapter.ID), zap.Any("panic", p))
+		}
+	}()
+
+	r.sem <- struct{}{}
+	defer func() { <-r.sem }()
+
+	if usageQuotaExceeded(r.db, userID) {
+		logger.Warn("AI用量已达上限，跳过章节实体确认", zap.Uint("chapterId", chapter.ID), zap.Uint("userId", userID))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), entityConfirmTimeout)
+	defer cancel()
+	ctx, scope := llm.WithUsageScope(ctx)
+	ctx = llm.WithCallInfo(ctx, &llm.CallInfo{UserID: userID, NovelID: chapter.NovelID, Feature: llm.PromptEntityConfirm})
+	defer recordLLMUsage(r.db, userID, llm.PromptEntityConfirm, scope)
+
+	entities, err := confirmChapterEntities(ctx, r.extractor, chapter, matches)
+	if err != nil {
+		logger.Warn("章节实体确认失败", zap.Uint("chapterId", chapter.ID), zap.Error(err))
+		return
+	}
+	if _, err := r.commit(chapter.ID, seq, entities); err != nil {
+		logger.Error("保存章节实体失败", zap.Uint("chapterId", chapter.ID), zap.Error(err))
+	}
+}
+
+// usageQuotaExceeded 后台任务执行前检查用户的 AI 配额是否已用完，查询失败时视为未超限
+func usageQuotaExceeded(db *gorm.DB, userID uint) bool {
+	if userID == 0 {
+		return false
+	}
+	var user models.User
+	db.Select("id", "role").First(&user, userID)
+	status, err := loadQuotaStatus(db, userID, user.Role, time.Now())
+	if err != nil {
+		return false
+	}
+	_, window := status.exceededWindow()
+	return window != nil
+}
+
+// entityMatch 章节中匹配到的实体，以及提供给模型确认的候选信息
+type entityMatch struct {
+	entity    models.ChapterEntity
+	candidate llm.EntityCandidate
+}
+
+// parseIDList 解析逗号分隔的ID列表，忽略无效项
+func parseIDList(ids string) map[uint]bool {
+	result := map[uint]bool{}
+	for _, part := range strings.Split(ids, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32); err == nil && id > 0 {
+			result[uint(id)] = true
+		}
+	}
+	return result
+}
+
+// countEntityMentions 统计每组名称在正文中出现的次数；较长的名称优先匹配并从正文中移除，
+// 避免"林风"与别名"风"之类的重叠被重复计数；多个实体共用的名称同时计入这些实体
+func countEntityMentions(content string, names [][]string) []int {
+	owners := map[string][]int{}
+	for i, group := range names {
+		for _, name := range group {
+			name = strings.TrimSpace(name)
+			if utf8.RuneCountInString(name) < entityMinTermRunes {
+				continue
+			}
+			if o := owners[name]; len(o) > 0 && o[len(o)-1] == i {
+				continue
+			}
+			owners[name] = append(owners[name], i)
+		}
+	}
+	terms := make([]string, 0, len(owners))
+	for term := range owners {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		li, lj := utf8.RuneCountInString(terms[i]), utf8.RuneCountInString(terms[j])
+		if li != lj {
+			return li > lj
+		}
+		return terms[i] < terms[j]
+	})
+
+	counts := make([]int, len(names))
+	for _, term := range terms {
+		n := strings.Count(content, term)
+		if n == 0 {
+			continue
+		}
+		for _, i := range owners[term] {
+			counts[i] += n
+		}
+		content = strings.ReplaceAll(content, term, "\x00")
+	}
+	return counts
+}
+
+// matchChapterEntities 在章节正文中匹配角色（名称和别名）、正式情节（标题）以及设定和地点（标题）；
+// 章节参与角色、涉及情节中填写的ID即使没有匹配到也会记录，来源为 manual
+func matchChapterEntities(db *gorm.DB, chapter *models.Chapter) ([]entityMatch, error) {
+	var characters []models.Character
+	if err := db.Where("novel_id = ?", chapter.NovelID).Order("id ASC").Find(&characters).Error; err != nil {
+		return nil, fmt.Errorf("获取角色失败: %w", err)
+	}
+	var plotPoints []models.PlotPoint
+	if err := db.Where("novel_id = ? AND (status IS NULL OR status <> ?)", chapter.NovelID, models.PlotPointStatusDraft).
+		Order("id ASC").Find(&plotPoints).Error; err != nil {
+		return nil, fmt.Errorf("获取情节失败: %w", err)
+	}
+	var settings []models.NovelSetting
+	if err := db.Where("novel_id = ?", chapter.NovelID).Order("order_index ASC, id ASC").Find(&settings).Error; err != nil {
+		return nil, fmt.Errorf("获取设定失败: %w", err)
+	}
+
+	manual := map[string]map[uint]bool{
+		models.ChapterEntityCharacter: parseIDList(chapter.CharacterIDs),
+		models.ChapterEntityPlotPoint: parseIDList(chapter.PlotPointIDs),
+	}
+	candidates := make([]entityMatch, 0, len(characters)+len(plotPoints)+len(settings))
+	names := make([][]string, 0, cap(candidates))
+	add := func(entityType string, id uint, name string, aliases []string, detail string) {
+		detail, _ = truncateRunes(strings.TrimSpace(detail), entityDetailRunes)
+		candidates = append(candidates, entityMatch{
+			entity: models.ChapterEntity{
+				NovelID:    chapter.NovelID,
+				ChapterID:  chapter.ID,
+				EntityType: entityType,
+				EntityID:   id,
+				Name:       name,
+			},
+			candidate: llm.EntityCandidate{Type: entityTypeNames[entityType], Name: name, Aliases: aliases, Detail: detail},
+		})
+		names = append(names, append([]string{name}, aliases...))
+	}
+	for i := range characters {
+		ch := &characters[i]
+		add(models.ChapterEntityCharacter, ch.ID, ch.Name, characterProfile(ch).Aliases, ch.Description)
+	}
+	for _, p := range plotPoints {
+		add(models.ChapterEntityPlotPoint, p.ID, p.Title, nil, p.Content)
+	}
+	for _, s := range settings {
+		entityType := models.ChapterEntitySetting
+		if s.Category == models.SettingCategoryLocation {
+			entityType = models.ChapterEntityLocation
+		}
+		add(entityType, uint(s.ID), s.Title, nil, s.Content)
+	}
+
+	counts := countEntityMentions(chapter.Content, names)
+	matches := make([]entityMatch, 0)
+	for i, m := range candidates {
+		m.entity.Mentions = counts[i]
+		switch {
+		case manual[m.entity.EntityType][m.entity.EntityID]:
+			m.entity.Source = models.ChapterEntitySourceManual
+		case counts[i] > 0:
+			m.entity.Source = models.ChapterEntitySourceMatch
+		default:
+			continue
+		}
+		matches = append(matches, m)
+	}
+	return matches, nil
+}
+
+// matchedEntities 返回匹配结果中的章节实体
+func matchedEntities(matches []entityMatch) []models.ChapterEntity {
+	entities := make([]models.ChapterEntity, len(matches))
+	for i, m := range matches {
+		entities[i] = m.entity
+	}
+	return entities
+}
+
+// hasMatchedCandidates 是否有需要 AI 确认的匹配结果（作者填写的实体不需要确认）
+func hasMatchedCandidates(matches []entityMatch) bool {
+	for _, m := range matches {
+		if m.entity.Source == models.ChapterEntitySourceMatch {
+			return true
+		}
+	}
+	return false
+}
+
+// confirmChapterEntities 由模型确认名称匹配到的实体：确认的来源改为 ai，未确认的丢弃，作者填写的保留
+func confirmChapterEntities(ctx context.Context, extractor *llm.EntityExtractor, chapter *models.Chapter, matches []entityMatch) ([]models.ChapterEntity, error) {
+	req := llm.EntityConfirmRequest{
+		ChapterTitle: chapter.Title,
+		Content:      chapter.Content,
+	}
+	var pending []int
+	for i, m := range matches {
+		if m.entity.Source == models.ChapterEntitySourceMatch {
+			pending = append(pending, i)
+			req.Candidates = append(req.Candidates, m.candidate)
+		}
+	}
+	confirmed, err := extractor.Confirm(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make(map[int]bool, len(confirmed))
+	for _, idx := range confirmed {
+		keep[pending[idx]] = true
+	}
+	entities := make([]models.ChapterEntity, 0, len(matches))
+	for i, m := range matches {
+		switch {
+		case m.entity.Source == models.ChapterEntitySourceManual:
+		case keep[i]:
+			m.entity.Source = models.ChapterEntitySourceAI
+		default:
+			continue
+		}
+		entities = append(entities, m.entity)
+	}
+	return entities, nil
+}
+
+// extractChapterEntities 章节保存后匹配正文中出现的实体并写入关联表；
+// 小说开启了 AI 确认时，再在后台由 runner 确认匹配结果，runner 为空时只做名称匹配。失败只记录日志，不影响保存
+func extractChapterEntities(db *gorm.DB, runner *entityRunner, userID uint, chapter *models.Chapter) {
+	matches, err := matchChapterEntities(db, chapter)
+	if err != nil {
+		logger.Error("提取章节实体失败", zap.Uint("chapterId", chapter.ID), zap.Error(err))
+		return
+	}
+
+	if runner == nil {
+		if err := models.ReplaceChapterEntities(db, chapter.ID, matchedEntities(matches)); err != nil {
+			logger.Error("保存章节实体失败", zap.Uint("chapterId", chapter.ID), zap.Error(err))
+		}
+		return
+	}
+	seq := runner.begin(chapter.ID)
+	if _, err := runner.commit(chapter.ID, seq, matchedEntities(matches)); err != nil {
+		logger.Error("保存章节实体失败", zap.Uint("chapterId", chapter.ID), zap.Error(err))
+		return
+	}
+	if !hasMatchedCandidates(matches) {
+		return
+	}
+	var novel models.Novel
+	if err := db.Select("id", "confirm_entities_with_ai").First(&novel, chapter.NovelID).Error; err != nil || !novel.ConfirmEntitiesWithAI {
+		return
+	}
+	runner.start(userID, chapter, matches, seq)
+}
+
+// ExtractEntitiesRequest 手动提取章节实体请求
+type ExtractEntitiesRequest struct {
+	ChapterID uint  `json:"chapterId" binding:"required"`
+	Confirm   *bool `json:"confirm"` // 是否由 AI 确认匹配结果，不填时按小说设置
+}
+
+// ExtractChapterEntities 手动提取章节实体
+// @Summary 提取章节实体
+// @Description 按名称和别名匹配章节中出现的角色、情节、设定和地点，可选由 AI 确认，结果替换章节已有的实体
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param request body ExtractEntitiesRequest true "提取请求"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/chapter/extract-entities [post]
+func (h *AIHandler) ExtractChapterEntities(c *gin.Context) {
+	var req ExtractEntitiesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var chapter models.Chapter
+	if err := h.db.First(&chapter, req.ChapterID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "章节不存在",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "获取章节失败",
+			})
+		}
+		return
+	}
+
+	confirm := false
+	if req.Confirm != nil {
+		confirm = *req.Confirm
+	} else {
+		var novel models.Novel
+		if err := h.db.Select("id", "confirm_entities_with_ai").First(&novel, chapter.NovelID).Error; err == nil {
+			confirm = novel.ConfirmEntitiesWithAI
+		}
+	}
+
+	seq := h.entities.begin(chapter.ID)
+	matches, err := matchChapterEntities(h.db, &chapter)
+	if err != nil {
+		logger.Error("提取章节实体失败", zap.Uint("chapterId", chapter.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "提取章节实体失败",
+		})
+		return
+	}
+	entities := matchedEntities(matches)
+	if confirm && hasMatchedCandidates(matches) {
+		if entities, err = confirmChapterEntities(c.Request.Context(), h.entities.extractor, &chapter, matches); err != nil {
+			logger.Error("AI确认章节实体失败", zap.Uint("chapterId", chapter.ID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "AI确认章节实体失败: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	saved, err := h.entities.commit(chapter.ID, seq, entities)
+	if err != nil {
+		logger.Error("保存章节实体失败", zap.Uint("chapterId", chapter.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "保存章节实体失败",
+		})
+		return
+	}
+	if !saved {
+		c.JSON(http.StatusConflict, gin.H{
+			"code": 409,
+			"msg":  "章节已更新，请重新提取",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "提取成功",
+		"data": entities,
+	})
+}
@@ -66,7 +66,7 @@ func (h *AIHandler) GenerateNovelSetting(c *gin.Context) {
 	messages := []llm.Message{
 		{Role: "user", Content: prompt},
 	}
-	response, err := h.characterGenerator.Chat(messages, 0.7, 2000)
+	response, err := h.characterGenerator.Chat(c.Request.Context(), messages, 0.7, 2000)
 	if err != nil {
 		logger.Error("Generate novel setting failed", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
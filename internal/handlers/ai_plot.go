@@ -3,7 +3,6 @@ package handlers
 import (
 	"net/http"
 
-	"github.com/LingByte/LingDialog/pkg/config"
 	"github.com/LingByte/LingDialog/pkg/llm"
 	"github.com/LingByte/LingDialog/pkg/logger"
 	"github.com/gin-gonic/gin"
@@ -31,11 +30,7 @@ type GeneratePlotRequest struct {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/plot/generate [post]
 func (h *AIHandler) GeneratePlot(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -52,7 +47,7 @@ func (h *AIHandler) GeneratePlot(c *gin.Context) {
 		zap.String("title", req.Title),
 		zap.String("plotType", req.PlotType))
 
-	result, err := h.plotGenerator.Generate(llm.PlotGenerateRequest{
+	result, err := h.plotGenerator.Generate(c.Request.Context(), llm.PlotGenerateRequest{
 		Title:        req.Title,
 		NovelTitle:   req.NovelTitle,
 		NovelGenre:   req.NovelGenre,
@@ -96,11 +91,7 @@ type EnhancePlotContentRequest struct {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/plot/enhance [post]
 func (h *AIHandler) EnhancePlotContent(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -116,7 +107,7 @@ func (h *AIHandler) EnhancePlotContent(c *gin.Context) {
 	logger.Info("Enhancing plot content",
 		zap.String("title", req.Title))
 
-	result, err := h.plotGenerator.EnhanceContent(req.Title, req.Content)
+	result, err := h.plotGenerator.EnhanceContent(c.Request.Context(), req.Title, req.Content)
 	if err != nil {
 		logger.Error("Failed to enhance plot content",
 			zap.String("title", req.Title),
@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// promptCacheTTL 生效版本缓存的有效期
+const promptCacheTTL = time.Minute
+
+// dbPromptStore 基于数据库的提示词模板存储
+// 每次渲染提示词都会查询生效版本，这里按名称和语言区域缓存查询结果（包括没有生效版本的情况），
+// 本实例创建、激活、删除模板后调用 invalidate 清空缓存。缓存只在当前进程内有效，
+// 多实例部署时其他实例上的修改要等本实例缓存过期（promptCacheTTL）后才生效
+type dbPromptStore struct {
+	db *gorm.DB
+
+	mu         sync.RWMutex
+	active     map[string]*llm.PromptTemplate
+	expiresAt  time.Time
+	generation int // 每次清空缓存加一，避免清空前查到的旧版本写回缓存
+}
+
+// ActivePrompt 实现 llm.PromptStore
+func (s *dbPromptStore) ActivePrompt(name, locale string) (*llm.PromptTemplate, error) {
+	key := name + "@" + locale
+	s.mu.RLock()
+	cached, ok := s.active[key]
+	ok = ok && time.Now().Before(s.expiresAt)
+	generation := s.generation
+	s.mu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	tpl, err := models.GetActivePromptTemplate(s.db, name, locale)
+	if err != nil {
+		return nil, err
+	}
+	var active *llm.PromptTemplate
+	if tpl != nil {
+		active = &llm.PromptTemplate{
+			Name:    tpl.Name,
+			Version: tpl.Version,
+			Locale:  tpl.Locale,
+			Body:    tpl.Body,
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if generation != s.generation {
+		return active, nil
+	}
+	if s.active == nil || !time.Now().Before(s.expiresAt) {
+		s.active = map[string]*llm.PromptTemplate{}
+		s.expiresAt = time.Now().Add(promptCacheTTL)
+	}
+	s.active[key] = active
+	return active, nil
+}
+
+// invalidate 清空生效版本缓存
+func (s *dbPromptStore) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active = nil
+	s.generation++
+}
+
+// CreatePromptTemplateRequest 创建提示词模板版本请求
+type CreatePromptTemplateRequest struct {
+	Name        string `json:"name" binding:"required"` // 模板名称
+	Locale      string `json:"locale"`                  // 语言区域，默认 zh-CN
+	Body        string `json:"body" binding:"required"` // 模板内容(text/template)
+	Description string `json:"description"`             // 版本说明
+	Active      bool   `json:"active"`                  // 是否立即生效
+}
+
+// UpdatePromptTemplateRequest 更新提示词模板请求（模板内容不可修改，如需修改请创建新版本）
+type UpdatePromptTemplateRequest struct {
+	Description string `json:"description"` // 版本说明
+}
+
+// ListPromptTemplates 获取提示词模板列表
+// @Summary 获取提示词模板列表
+// @Description 获取提示词模板的所有版本，可按名称和语言区域过滤
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param name query string false "模板名称"
+// @Param locale query string false "语言区域"
+// @Param active query bool false "只返回生效版本"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/prompts [get]
+func (h *AIHandler) ListPromptTemplates(c *gin.Context) {
+	query := h.db.Where("is_deleted = ?", models.SoftDeleteStatusActive)
+	if name := c.Query("name"); name != "" {
+		query = query.Where("name = ?", name)
+	}
+	if locale := c.Query("locale"); locale != "" {
+		query = query.Where("locale = ?", locale)
+	}
+	if c.Query("active") == "true" {
+		query = query.Where("active = ?", true)
+	}
+
+	var templates []models.PromptTemplate
+	if err := query.Order("name ASC, locale ASC, version DESC").Find(&templates).Error; err != nil {
+		logger.Error("Failed to list prompt templates", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取提示词模板失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": templates,
+	})
+}
+
+// ListDefaultPrompts 获取内置默认提示词
+// @Summary 获取内置默认提示词
+// @Description 获取所有内置默认提示词模板，可作为创建新版本的起点
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/prompts/defaults [get]
+func (h *AIHandler) ListDefaultPrompts(c *gin.Context) {
+	names := llm.DefaultPromptNames()
+	defaults := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		body, _ := llm.DefaultPrompt(name)
+		defaults = append(defaults, map[string]interface{}{
+			"name":   name,
+			"locale": llm.DefaultPromptLocale,
+			"body":   body,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": defaults,
+	})
+}
+
+// GetPromptTemplate 获取提示词模板详情
+// @Summary 获取提示词模板详情
+// @Description 获取指定版本的提示词模板
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param id path int true "模板ID"
+// @Success 200 {object} models.PromptTemplate
+// @Router /api/ai/prompts/{id} [get]
+func (h *AIHandler) GetPromptTemplate(c *gin.Context) {
+	tpl, ok := h.findPromptTemplate(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": tpl,
+	})
+}
+
+// CreatePromptTemplate 创建提示词模板新版本
+// @Summary 创建提示词模板版本
+// @Description 为指定模板创建新版本，版本号自动递增
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param request body CreatePromptTemplateRequest true "模板信息"
+// @Success 200 {object} models.PromptTemplate
+// @Router /api/ai/prompts [post]
+func (h *AIHandler) CreatePromptTemplate(c *gin.Context) {
+	var req CreatePromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	if _, ok := llm.DefaultPrompt(req.Name); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "未知的模板名称: " + req.Name,
+		})
+		return
+	}
+	if _, err := llm.ParsePromptTemplate(req.Name, req.Body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "模板语法错误: " + err.Error(),
+		})
+		return
+	}
+	if req.Locale == "" {
+		req.Locale = llm.DefaultPromptLocale
+	}
+
+	version, err := models.NextPromptTemplateVersion(h.db, req.Name, req.Locale)
+	if err != nil {
+		logger.Error("Failed to get next prompt version", zap.String("name", req.Name), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "创建提示词模板失败",
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	tpl := models.PromptTemplate{
+		Name:        req.Name,
+		Version:     version,
+		Locale:      req.Locale,
+		Body:        req.Body,
+		Description: req.Description,
+	}
+	tpl.SetCreateInfo(user.Email)
+
+	if err := h.db.Create(&tpl).Error; err != nil {
+		logger.Error("Failed to create prompt template", zap.String("name", req.Name), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "创建提示词模板失败",
+		})
+		return
+	}
+
+	if req.Active {
+		if err := models.ActivatePromptTemplate(h.db, &tpl); err != nil {
+			logger.Error("Failed to activate prompt template", zap.Uint("id", tpl.ID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "激活提示词模板失败",
+			})
+			return
+		}
+	}
+
+	h.prompts.invalidate()
+
+	logger.Info("提示词模板版本已创建",
+		zap.String("name", tpl.Name),
+		zap.Int("version", tpl.Version),
+		zap.String("locale", tpl.Locale),
+		zap.Bool("active", tpl.Active))
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "创建成功",
+		"data": tpl,
+	})
+}
+
+// UpdatePromptTemplate 更新提示词模板说明
+// @Summary 更新提示词模板
+// @Description 更新版本说明，模板内容不可修改，如需修改请创建新版本
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param id path int true "模板ID"
+// @Param request body UpdatePromptTemplateRequest true "模板信息"
+// @Success 200 {object} models.PromptTemplate
+// @Router /api/ai/prompts/{id} [put]
+func (h *AIHandler) UpdatePromptTemplate(c *gin.Context) {
+	tpl, ok := h.findPromptTemplate(c)
+	if !ok {
+		return
+	}
+
+	var req UpdatePromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if err := h.db.Model(tpl).Updates(map[string]interface{}{
+		"description": req.Description,
+		"update_by":   user.Email,
+	}).Error; err != nil {
+		logger.Error("Failed to update prompt template", zap.Uint("id", tpl.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "更新提示词模板失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "更新成功",
+		"data": tpl,
+	})
+}
+
+// ActivatePromptTemplate 激活提示词模板版本
+// @Summary 激活提示词模板版本
+// @Description 将指定版本设为生效版本，同名同语言区域的其他版本自动停用
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param id path int true "模板ID"
+// @Success 200 {object} models.PromptTemplate
+// @Router /api/ai/prompts/{id}/activate [post]
+func (h *AIHandler) ActivatePromptTemplate(c *gin.Context) {
+	tpl, ok := h.findPromptTemplate(c)
+	if !ok {
+		return
+	}
+
+	if err := models.ActivatePromptTemplate(h.db, tpl); err != nil {
+		logger.Error("Failed to activate prompt template", zap.Uint("id", tpl.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "激活提示词模板失败",
+		})
+		return
+	}
+
+	h.prompts.invalidate()
+
+	logger.Info("提示词模板版本已激活",
+		zap.String("name", tpl.Name),
+		zap.Int("version", tpl.Version),
+		zap.String("locale", tpl.Locale))
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "激活成功",
+		"data": tpl,
+	})
+}
+
+// DeletePromptTemplate 删除提示词模板版本
+// @Summary 删除提示词模板版本
+// @Description 软删除指定版本（保留历史以便追溯输出），删除生效版本后回退到内置默认模板
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param id path int true "模板ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/prompts/{id} [delete]
+func (h *AIHandler) DeletePromptTemplate(c *gin.Context) {
+	tpl, ok := h.findPromptTemplate(c)
+	if !ok {
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	if err := h.db.Model(tpl).Updates(map[string]interface{}{
+		"is_deleted": models.SoftDeleteStatusDeleted,
+		"active":     false,
+		"update_by":  user.Email,
+	}).Error; err != nil {
+		logger.Error("Failed to delete prompt template", zap.Uint("id", tpl.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "删除提示词模板失败",
+		})
+		return
+	}
+	h.prompts.invalidate()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "删除成功",
+	})
+}
+
+// findPromptTemplate 根据路径参数查找模板，失败时直接写入响应
+func (h *AIHandler) findPromptTemplate(c *gin.Context) (*models.PromptTemplate, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的模板ID",
+		})
+		return nil, false
+	}
+
+	var tpl models.PromptTemplate
+	if err := h.db.Where("id = ? AND is_deleted = ?", id, models.SoftDeleteStatusActive).First(&tpl).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "提示词模板不存在",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "查询提示词模板失败",
+			})
+		}
+		return nil, false
+	}
+	return &tpl, true
+}
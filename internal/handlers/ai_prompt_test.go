@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPromptTemplateCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if logger.Lg == nil {
+		logger.Lg = zap.NewNop()
+	}
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.PromptTemplate{}))
+	store := &dbPromptStore{db: db}
+	llm.SetPromptStore(store)
+	t.Cleanup(func() { llm.SetPromptStore(nil) })
+	h := &AIHandler{db: db, prompts: store}
+
+	perform := func(handler gin.HandlerFunc, id uint, body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(id)}}
+		c.Set(constants.UserField, &models.User{BaseModel: models.BaseModel{ID: 1}, Email: "test@example.com"})
+		handler(c)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return w
+	}
+	create := func(body string, active bool) models.PromptTemplate {
+		w := perform(h.CreatePromptTemplate, 0, CreatePromptTemplateRequest{Name: llm.PromptChapterSummary, Body: body, Active: active})
+		var resp struct {
+			Data models.PromptTemplate `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data
+	}
+	active := func() int {
+		tpl, err := store.ActivePrompt(llm.PromptChapterSummary, llm.DefaultPromptLocale)
+		require.NoError(t, err)
+		if tpl == nil {
+			return 0
+		}
+		return tpl.Version
+	}
+
+	// 没有生效版本的结果同样缓存，创建后失效
+	assert.Equal(t, 0, active())
+	v1 := create("摘要 v1", true)
+	assert.Equal(t, 1, active())
+
+	// 绕过接口修改数据库时继续使用缓存，过期后重新查询
+	v2 := create("摘要 v2", false)
+	assert.Equal(t, 1, active())
+	require.NoError(t, models.ActivatePromptTemplate(db, &v2))
+	assert.Equal(t, 1, active())
+	store.expiresAt = time.Now()
+	assert.Equal(t, 2, active())
+
+	perform(h.ActivatePromptTemplate, v1.ID, nil)
+	text, ref, err := llm.RenderPrompt(llm.PromptChapterSummary, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "摘要 v1", text)
+	assert.Equal(t, 1, ref.Version)
+
+	perform(h.DeletePromptTemplate, v1.ID, nil)
+	assert.Equal(t, 0, active())
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/LingByte/LingDialog/pkg/config"
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/LingByte/LingDialog/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// modelRouteLoader 从系统配置 LLM_MODEL_ROUTES 读取模型路由表
+// 配置值由 utils.GetValue 缓存，这里再按原始文本缓存解析结果，避免每次调用都解析 JSON
+type modelRouteLoader struct {
+	db *gorm.DB
+
+	mu     sync.Mutex
+	raw    string
+	routes llm.ModelRoutes
+}
+
+// load 返回当前路由表，配置无效时按未配置处理
+func (l *modelRouteLoader) load() llm.ModelRoutes {
+	raw := utils.GetValue(l.db, constants.KEY_LLM_MODEL_ROUTES)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if raw == l.raw {
+		return l.routes
+	}
+	routes, err := parseModelRoutes(raw)
+	if err != nil {
+		logger.Warn("模型路由配置无效，已忽略", zap.Error(err))
+	}
+	l.raw, l.routes = raw, routes
+	return routes
+}
+
+// parseModelRoutes 解析并校验路由表 JSON，空值返回空路由表
+func parseModelRoutes(raw string) (llm.ModelRoutes, error) {
+	routes := llm.ModelRoutes{}
+	if strings.TrimSpace(raw) == "" {
+		return routes, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &routes); err != nil {
+		return llm.ModelRoutes{}, err
+	}
+	if err := routes.Validate(); err != nil {
+		return llm.ModelRoutes{}, err
+	}
+	return routes, nil
+}
+
+// saveModelRoutes 写入路由表
+func saveModelRoutes(db *gorm.DB, routes llm.ModelRoutes) error {
+	data, err := json.Marshal(routes)
+	if err != nil {
+		return err
+	}
+	utils.SetValue(db, constants.KEY_LLM_MODEL_ROUTES, string(data), "json", false, false)
+	return nil
+}
+
+// withModelRouting 按系统配置的路由表为不同任务选择提供商和模型
+// 路由到的其他提供商同样添加响应缓存
+func withModelRouting(db *gorm.DB, provider llm.Provider) llm.Provider {
+	loader := &modelRouteLoader{db: db}
+	return llm.NewRoutingProvider(provider, loader.load, func(name string) (llm.Provider, error) {
+		routed, err := llm.NewProviderByName(name)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("LLM routed provider created", zap.String("provider", name))
+		return withResponseCache(db, routed), nil
+	})
+}
+
+// ListModelRoutes 获取模型路由
+// @Summary 获取 LLM 模型路由
+// @Description 返回按任务配置的提供商、模型和采样参数，以及可配置的任务列表和默认模型（仅管理员）
+// @Tags AI
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/routes [get]
+func (h *AIHandler) ListModelRoutes(c *gin.Context) {
+	routes, err := parseModelRoutes(utils.GetValue(h.db, constants.KEY_LLM_MODEL_ROUTES))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "模型路由配置无效: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"routes": routes,
+			"tasks":  llm.RoutableTasks(),
+			"default": gin.H{
+				"provider": config.GlobalConfig.LLMProvider,
+				"model":    h.characterGenerator.GetModel(),
+			},
+		},
+	})
+}
+
+// SaveModelRoutes 替换模型路由
+// @Summary 设置 LLM 模型路由
+// @Description 用请求中的路由表替换全部路由，键为任务标识、任务分组（如 chapter）或 *，立即生效（仅管理员）
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param request body llm.ModelRoutes true "模型路由表"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/routes [put]
+func (h *AIHandler) SaveModelRoutes(c *gin.Context) {
+	var routes llm.ModelRoutes
+	if err := c.ShouldBindJSON(&routes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if routes == nil {
+		routes = llm.ModelRoutes{}
+	}
+	if err := routes.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "模型路由无效: " + err.Error(),
+		})
+		return
+	}
+
+	h.storeModelRoutes(c, routes)
+}
+
+// SaveModelRoute 设置单个任务的模型路由
+// @Summary 设置任务的 LLM 模型路由
+// @Description 新增或覆盖单个任务（或任务分组、*）的路由，立即生效（仅管理员）
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param task path string true "任务标识"
+// @Param request body llm.ModelRoute true "模型路由"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/routes/{task} [put]
+func (h *AIHandler) SaveModelRoute(c *gin.Context) {
+	task := strings.TrimSpace(c.Param("task"))
+	var route llm.ModelRoute
+	if err := c.ShouldBindJSON(&route); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if err := route.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "模型路由无效: " + err.Error(),
+		})
+		return
+	}
+
+	routes, err := parseModelRoutes(utils.GetValue(h.db, constants.KEY_LLM_MODEL_ROUTES))
+	if err != nil {
+		// 已有配置无效时从空表开始，避免无法通过接口修复
+		logger.Warn("模型路由配置无效，已重置", zap.Error(err))
+	}
+	routes[task] = route
+	h.storeModelRoutes(c, routes)
+}
+
+// DeleteModelRoute 删除单个任务的模型路由
+// @Summary 删除任务的 LLM 模型路由
+// @Description 删除后该任务按分组、* 或生成器默认值选择模型（仅管理员）
+// @Tags AI
+// @Produce json
+// @Param task path string true "任务标识"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/routes/{task} [delete]
+func (h *AIHandler) DeleteModelRoute(c *gin.Context) {
+	task := strings.TrimSpace(c.Param("task"))
+	routes, _ := parseModelRoutes(utils.GetValue(h.db, constants.KEY_LLM_MODEL_ROUTES))
+	if _, ok := routes[task]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"msg":  "模型路由不存在",
+		})
+		return
+	}
+	delete(routes, task)
+	h.storeModelRoutes(c, routes)
+}
+
+// storeModelRoutes 保存路由表并返回保存后的内容
+func (h *AIHandler) storeModelRoutes(c *gin.Context, routes llm.ModelRoutes) {
+	if err := saveModelRoutes(h.db, routes); err != nil {
+		logger.Error("保存模型路由失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "保存模型路由失败",
+		})
+		return
+	}
+	if user := middleware.GetCurrentUser(c); user != nil {
+		logger.Info("LLM 模型路由已更新", zap.Int("routes", len(routes)), zap.Uint("userId", user.ID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "保存成功",
+		"data": routes,
+	})
+}
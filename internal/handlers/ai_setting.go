@@ -3,7 +3,6 @@ package handlers
 import (
 	"net/http"
 
-	"github.com/LingByte/LingDialog/pkg/config"
 	"github.com/LingByte/LingDialog/pkg/logger"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -37,11 +36,7 @@ type EnhanceSettingRequest struct {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/setting/generate [post]
 func (h *AIHandler) GenerateSetting(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -54,12 +49,14 @@ func (h *AIHandler) GenerateSetting(c *gin.Context) {
 		return
 	}
 
+	setCallNovel(c, uint(req.NovelID))
+
 	logger.Info("Generating setting",
 		zap.Int("novelId", req.NovelID),
 		zap.String("category", req.Category),
 		zap.String("title", req.Title))
 
-	title, content, tags, err := h.settingGenerator.Generate(
+	title, content, tags, err := h.settingGenerator.Generate(c.Request.Context(),
 		req.NovelTitle,
 		req.NovelGenre,
 		req.Category,
@@ -100,11 +97,7 @@ func (h *AIHandler) GenerateSetting(c *gin.Context) {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/setting/enhance [post]
 func (h *AIHandler) EnhanceSetting(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -120,7 +113,7 @@ func (h *AIHandler) EnhanceSetting(c *gin.Context) {
 	logger.Info("Enhancing setting",
 		zap.String("title", req.Title))
 
-	content, err := h.settingGenerator.EnhanceSetting(req.Title, req.Content, req.EnhanceHint)
+	content, err := h.settingGenerator.EnhanceSetting(c.Request.Context(), req.Title, req.Content, req.EnhanceHint)
 	if err != nil {
 		logger.Error("Failed to enhance setting",
 			zap.String("title", req.Title),
@@ -3,7 +3,6 @@ package handlers
 import (
 	"net/http"
 
-	"github.com/LingByte/LingDialog/pkg/config"
 	"github.com/LingByte/LingDialog/pkg/llm"
 	"github.com/LingByte/LingDialog/pkg/logger"
 	"github.com/gin-gonic/gin"
@@ -51,11 +50,7 @@ func convertExistingStorylines(existing []ExistingStorylineInfo) []llm.ExistingS
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/storyline/generate [post]
 func (h *AIHandler) GenerateStorylines(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -68,13 +63,15 @@ func (h *AIHandler) GenerateStorylines(c *gin.Context) {
 		return
 	}
 
+	setCallNovel(c, uint(req.NovelID))
+
 	logger.Info("Generating storylines",
 		zap.Int("novelId", req.NovelID),
 		zap.String("novelTitle", req.NovelTitle),
 		zap.Int("storylineCount", req.StorylineCount),
 		zap.Int("existingCount", len(req.ExistingStorylines)))
 
-	result, err := h.storylineGenerator.Generate(llm.StorylineGenerateRequest{
+	result, err := h.storylineGenerator.Generate(c.Request.Context(), llm.StorylineGenerateRequest{
 		NovelTitle:         req.NovelTitle,
 		NovelGenre:         req.NovelGenre,
 		WorldSetting:       req.WorldSetting,
@@ -126,11 +123,7 @@ type ExpandStorylinePartRequest struct {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/storyline/optimize [post]
 func (h *AIHandler) OptimizeStoryline(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -147,7 +140,7 @@ func (h *AIHandler) OptimizeStoryline(c *gin.Context) {
 		zap.Int("currentDescLength", len(req.CurrentDescription)),
 		zap.String("feedback", req.Feedback))
 
-	newDescription, err := h.storylineGenerator.OptimizeStoryline(req.CurrentDescription, req.Feedback)
+	newDescription, err := h.storylineGenerator.OptimizeStoryline(c.Request.Context(), req.CurrentDescription, req.Feedback)
 	if err != nil {
 		logger.Error("Failed to optimize storyline",
 			zap.Error(err))
@@ -177,11 +170,7 @@ func (h *AIHandler) OptimizeStoryline(c *gin.Context) {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/storyline/expand-part [post]
 func (h *AIHandler) ExpandStorylinePart(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -199,7 +188,7 @@ func (h *AIHandler) ExpandStorylinePart(c *gin.Context) {
 		zap.Int("selectedTextLength", len(req.SelectedText)),
 		zap.String("expandHint", req.ExpandHint))
 
-	expandedText, err := h.storylineGenerator.ExpandStorylinePart(req.FullDescription, req.SelectedText, req.ExpandHint)
+	expandedText, err := h.storylineGenerator.ExpandStorylinePart(c.Request.Context(), req.FullDescription, req.SelectedText, req.ExpandHint)
 	if err != nil {
 		logger.Error("Failed to expand storyline part",
 			zap.Error(err))
@@ -236,11 +225,7 @@ type ExpandStoryNodeRequest struct {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/storyline/expand-node [post]
 func (h *AIHandler) ExpandStoryNode(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -253,7 +238,7 @@ func (h *AIHandler) ExpandStoryNode(c *gin.Context) {
 		return
 	}
 
-	result, err := h.storylineGenerator.ExpandNode(req.NodeTitle, req.NodeDescription, req.Context)
+	result, err := h.storylineGenerator.ExpandNode(c.Request.Context(), req.NodeTitle, req.NodeDescription, req.Context)
 	if err != nil {
 		logger.Error("Failed to expand story node",
 			zap.String("nodeTitle", req.NodeTitle),
@@ -289,11 +274,7 @@ type SuggestNodeConnectionsRequest struct {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/storyline/suggest-connections [post]
 func (h *AIHandler) SuggestNodeConnections(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -306,7 +287,7 @@ func (h *AIHandler) SuggestNodeConnections(c *gin.Context) {
 		return
 	}
 
-	result, err := h.storylineGenerator.SuggestConnections(req.Nodes)
+	result, err := h.storylineGenerator.SuggestConnections(c.Request.Context(), req.Nodes)
 	if err != nil {
 		logger.Error("Failed to suggest node connections",
 			zap.Error(err))
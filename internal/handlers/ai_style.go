@@ -3,7 +3,6 @@ package handlers
 import (
 	"net/http"
 
-	"github.com/LingByte/LingDialog/pkg/config"
 	"github.com/LingByte/LingDialog/pkg/llm"
 	"github.com/LingByte/LingDialog/pkg/logger"
 	"github.com/gin-gonic/gin"
@@ -27,11 +26,7 @@ type AnalyzeStyleRequest struct {
 // @Success 200 {object} map[string]interface{}
 // @Router /api/ai/style/analyze [post]
 func (h *AIHandler) AnalyzeStyle(c *gin.Context) {
-	if config.GlobalConfig.LLMApiKey == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"code": 503,
-			"msg":  "AI 功能未配置，请联系管理员",
-		})
+	if !checkLLMConfigured(c) {
 		return
 	}
 
@@ -52,7 +47,7 @@ func (h *AIHandler) AnalyzeStyle(c *gin.Context) {
 	samples := h.styleAnalyzer.ExtractSamples(req.ReferenceText, 3)
 
 	// 分析风格
-	result, err := h.styleAnalyzer.AnalyzeStyle(llm.StyleAnalysisRequest{
+	result, err := h.styleAnalyzer.AnalyzeStyle(c.Request.Context(), llm.StyleAnalysisRequest{
 		NovelTitle: req.NovelTitle,
 		NovelGenre: req.NovelGenre,
 		Samples:    samples,
@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	summaryRollupDelay     = 30 * time.Second // 摘要变化后等待一段时间再汇总，合并连续的修改
+	summaryRefreshTimeout  = 10 * time.Minute // 单轮汇总的超时时间
+	summaryMaxConcurrent   = 2                // 同时汇总的小说数
+	summaryMaxChapters     = 20               // 每轮生成的章节摘要数上限，剩余的在下一轮生成
+	volumeSummaryMaxLength = 500              // 卷摘要字数上限
+	novelSynopsisMaxLength = 800              // 全书梗概字数上限
+)
+
+// summaryRunner 在后台逐级汇总小说的摘要：章节摘要 -> 卷摘要 -> 全书梗概
+// 同一小说同时只有一轮汇总，汇总期间又有变化时结束后再执行一轮
+type summaryRunner struct {
+	db        *gorm.DB
+	generator *llm.ChapterGenerator
+	delay     time.Duration // 自动汇总的等待时间
+	sem       chan struct{}
+	wg        sync.WaitGroup
+
+	mu      sync.Mutex
+	pending map[uint]bool // 已排队或正在汇总的小说
+	again   map[uint]bool // 汇总期间又有变化的小说
+}
+
+// newSummaryRunner 创建摘要汇总执行器
+func newSummaryRunner(db *gorm.DB, generator *llm.ChapterGenerator) *summaryRunner {
+	return &summaryRunner{
+		db:        db,
+		generator: generator,
+		delay:     summaryRollupDelay,
+		sem:       make(chan struct{}, summaryMaxConcurrent),
+		pending:   map[uint]bool{},
+		again:     map[uint]bool{},
+	}
+}
+
+// schedule 等待 delay 后在后台汇总小说的摘要，用量计入 userID；已在排队或汇总中时合并
+func (r *summaryRunner) schedule(novelID, userID uint, delay time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending[novelID] {
+		r.again[novelID] = true
+		return
+	}
+	r.pending[novelID] = true
+	r.wg.Add(1)
+	go r.run(novelID, userID, delay)
+}
+
+// wait 等待所有后台汇总结束
+func (r *summaryRunner) wait() {
+	r.wg.Wait()
+}
+
+// run 执行汇总，直到没有新的变化或剩余的章节摘要
+func (r *summaryRunner) run(novelID, userID uint, delay time.Duration) {
+	defer r.wg.Done()
+	defer func() {
+		if p := recover(); p != nil {
+			logger.Error("小说摘要汇总异常", zap.Uint("novelId", novelID), zap.Any("panic", p))
+			r.mu.Lock()
+			delete(r.pending, novelID)
+			delete(r.again, novelID)
+			r.mu.Unlock()
+		}
+	}()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	for {
+		r.mu.Lock()
+		delete(r.again, novelID)
+		r.mu.Unlock()
+
+		more := r.refresh(novelID, userID)
+
+		r.mu.Lock()
+		if !more && !r.again[novelID] {
+			delete(r.pending, novelID)
+			r.mu.Unlock()
+			return
+		}
+		r.mu.Unlock()
+	}
+}
+
+// refresh 执行一轮汇总，返回是否还需要继续；配额已用完或汇总失败时停止
+func (r *summaryRunner) refresh(novelID, userID uint) bool {
+	r.sem <- struct{}{}
+	defer func() { <-r.sem }()
+
+	if usageQuotaExceeded(r.db, userID) {
+		logger.Warn("AI用量已达上限，跳过小说摘要汇总", zap.Uint("novelId", novelID), zap.Uint("userId", userID))
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), summaryRefreshTimeout)
+	defer cancel()
+	ctx, scope := llm.WithUsageScope(ctx)
+	ctx = llm.WithCallInfo(ctx, &llm.CallInfo{UserID: userID, NovelID: novelID, Feature: llm.PromptSummaryRollup})
+	defer recordLLMUsage(r.db, userID, llm.PromptSummaryRollup, scope)
+
+	result, err := refreshStorySummaries(ctx, r.db, r.generator, novelID)
+	if err != nil {
+		logger.Warn("小说摘要汇总失败", zap.Uint("novelId", novelID), zap.Error(err))
+		return false
+	}
+	logger.Info("小说摘要汇总完成",
+		zap.Uint("novelId", novelID),
+		zap.Int("chapters", result.Chapters),
+		zap.Int("volumes", result.Volumes),
+		zap.Bool("novel", result.Novel))
+	return result.More
+}
+
+// scheduleSummaryRollup 章节摘要变化后排队汇总卷摘要和全书梗概，runner 为空时不自动汇总
+func scheduleSummaryRollup(runner *summaryRunner, novelID, userID uint) {
+	if runner != nil {
+		runner.schedule(novelID, userID, runner.delay)
+	}
+}
+
+// summaryVolumeIDs 返回不为 0 且不重复的卷ID
+func summaryVolumeIDs(ids ...uint) []uint {
+	var result []uint
+	for _, id := range ids {
+		if id != 0 && !utils.InArray(id, result) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// markChapterSummaries 章节保存后更新摘要的待更新标记：只修改了内容时标记章节摘要待更新；
+// 摘要、所属卷或顺序变化时标记卷摘要和全书梗概待更新，并排队汇总
+func markChapterSummaries(db *gorm.DB, runner *summaryRunner, userID uint, before, after *models.Chapter) {
+	summaryChanged := after.Summary != before.Summary
+	moved := after.VolumeID != before.VolumeID || after.Order != before.Order
+	if !summaryChanged && !moved {
+		if after.Content != before.Content && after.Summary != "" && !before.SummaryStale {
+			if err := models.SetChapterSummaryStale(db, after.ID, true); err != nil {
+				logger.Error("标记章节摘要待更新失败", zap.Uint("chapterId", after.ID), zap.Error(err))
+			}
+		}
+		return
+	}
+
+	if summaryChanged && before.SummaryStale {
+		if err := models.SetChapterSummaryStale(db, after.ID, false); err != nil {
+			logger.Error("更新章节摘要标记失败", zap.Uint("chapterId", after.ID), zap.Error(err))
+		}
+	}
+	fromOrder := after.Order
+	if before.Order < fromOrder {
+		fromOrder = before.Order
+	}
+	if err := models.MarkStorySummariesStale(db, after.NovelID, summaryVolumeIDs(before.VolumeID, after.VolumeID), fromOrder); err != nil {
+		logger.Error("标记汇总摘要待更新失败", zap.Uint("novelId", after.NovelID), zap.Error(err))
+		return
+	}
+	scheduleSummaryRollup(runner, after.NovelID, userID)
+}
+
+// summaryRefreshResult 一轮汇总的结果
+type summaryRefreshResult struct {
+	Chapters int  // 生成的章节摘要数
+	Volumes  int  // 更新的卷摘要数
+	Novel    bool // 是否更新了全书梗概
+	More     bool // 还有章节等待生成摘要
+}
+
+// chapterSummaryLine 章节摘要在汇总提示词中的格式
+func chapterSummaryLine(ch models.Chapter) string {
+	return fmt.Sprintf("第 %d 章 %s：%s", ch.Order, ch.Title, ch.Summary)
+}
+
+// refreshStorySummaries 执行一轮汇总：先为缺少摘要或摘要待更新的章节生成摘要（每轮最多 summaryMaxChapters 章），
+// 再更新有变化的卷摘要并删除已没有章节的卷摘要，最后更新全书梗概。全书梗概由卷摘要和未分卷章节的摘要按章节顺序汇总
+func refreshStorySummaries(ctx context.Context, db *gorm.DB, generator *llm.ChapterGenerator, novelID uint) (summaryRefreshResult, error) {
+	var result summaryRefreshResult
+	var novel models.Novel
+	if err := db.Select("id", "title").First(&novel, novelID).Error; err != nil {
+		return result, fmt.Errorf("获取小说失败: %w", err)
+	}
+
+	pending, err := models.ChaptersNeedingSummary(db, novelID, summaryMaxChapters+1)
+	if err != nil {
+		return result, fmt.Errorf("获取待生成摘要的章节失败: %w", err)
+	}
+	if len(pending) > summaryMaxChapters {
+		pending = pending[:summaryMaxChapters]
+		result.More = true
+	}
+	for i := range pending {
+		summary, err := generator.GenerateSummary(ctx, pending[i].Title, pending[i].Content)
+		if err != nil {
+			return result, err
+		}
+		if summary = strings.TrimSpace(summary); summary == "" {
+			return result, fmt.Errorf("章节 %d 生成的摘要为空", pending[i].ID)
+		}
+		if err := models.SaveChapterSummary(db, &pending[i], summary); err != nil {
+			return result, fmt.Errorf("保存章节摘要失败: %w", err)
+		}
+		result.Chapters++
+	}
+
+	var chapters []models.Chapter
+	if err := db.Select("id", "novel_id", "volume_id", "title", "order", "summary").
+		Where("novel_id = ? AND summary <> ''", novelID).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "order"}}).Order("id ASC").
+		Find(&chapters).Error; err != nil {
+		return result, fmt.Errorf("获取章节摘要失败: %w", err)
+	}
+	var volumes []models.Volume
+	if err := db.Where("novel_id = ?", novelID).Order("id ASC").Find(&volumes).Error; err != nil {
+		return result, fmt.Errorf("获取分卷失败: %w", err)
+	}
+
+	byVolume := map[uint][]models.Chapter{}
+	for _, ch := range chapters {
+		if ch.VolumeID != 0 {
+			byVolume[ch.VolumeID] = append(byVolume[ch.VolumeID], ch)
+		}
+	}
+	volumeTitles := map[uint]string{}
+	volumeSummaries := map[uint]*models.StorySummary{}
+	var volumeIDs []uint
+	for _, v := range volumes {
+		volumeTitles[v.ID] = v.Title
+		children := byVolume[v.ID]
+		if len(children) == 0 {
+			continue
+		}
+		volumeIDs = append(volumeIDs, v.ID)
+		summary, updated, err := rollupStorySummary(ctx, db, generator, novelID, v.ID,
+			fmt.Sprintf("《%s》的分卷「%s」", novel.Title, v.Title), volumeSummaryMaxLength, children,
+			func() []string {
+				lines := make([]string, len(children))
+				for i, ch := range children {
+					lines[i] = chapterSummaryLine(ch)
+				}
+				return lines
+			})
+		if err != nil {
+			return result, err
+		}
+		volumeSummaries[v.ID] = summary
+		if updated {
+			result.Volumes++
+		}
+	}
+	if err := models.PruneVolumeSummaries(db, novelID, volumeIDs); err != nil {
+		return result, fmt.Errorf("清理卷摘要失败: %w", err)
+	}
+	if len(chapters) == 0 {
+		return result, nil
+	}
+
+	_, updated, err := rollupStorySummary(ctx, db, generator, novelID, 0,
+		fmt.Sprintf("《%s》全书", novel.Title), novelSynopsisMaxLength, chapters,
+		func() []string {
+			var lines []string
+			seen := map[uint]bool{}
+			for _, ch := range chapters {
+				summary := volumeSummaries[ch.VolumeID]
+				if summary == nil || summary.Content == "" {
+					lines = append(lines, chapterSummaryLine(ch))
+					continue
+				}
+				if seen[ch.VolumeID] {
+					continue
+				}
+				seen[ch.VolumeID] = true
+				children := byVolume[ch.VolumeID]
+				lines = append(lines, fmt.Sprintf("第 %d-%d 章（%s）：%s",
+					children[0].Order, children[len(children)-1].Order, volumeTitles[ch.VolumeID], summary.Content))
+			}
+			return lines
+		})
+	if err != nil {
+		return result, err
+	}
+	result.Novel = updated
+	return result, nil
+}
+
+// storySummaryCovers 判断汇总摘要是否已概括该章节：待更新的摘要只对变化之前的章节有效
+func storySummaryCovers(summary *models.StorySummary, chapter models.Chapter) bool {
+	if summary == nil || summary.Content == "" {
+		return false
+	}
+	last := summary.LastChapterOrder
+	if summary.Stale && summary.StaleFromOrder <= last {
+		last = summary.StaleFromOrder - 1
+	}
+	return chapter.Order <= last
+}
+
+// previousStorySummaries 返回续写第 order 章时可用的全书梗概和卷摘要，只使用汇总范围在本章之前的摘要
+func previousStorySummaries(db *gorm.DB, novelID, volumeID uint, order int) []string {
+	var lines []string
+	add := func(label string, volumeID uint) {
+		summary, err := models.GetStorySummary(db, novelID, volumeID)
+		if err != nil {
+			logger.Warn("获取汇总摘要失败", zap.Uint("novelId", novelID), zap.Uint("volumeId", volumeID), zap.Error(err))
+			return
+		}
+		if summary != nil && summary.Content != "" && summary.LastChapterOrder < order {
+			lines = append(lines, label+"："+summary.Content)
+		}
+	}
+	add("故事梗概", 0)
+	if volumeID != 0 {
+		add("本卷前情", volumeID)
+	}
+	return lines
+}
+
+// storySummaryStaleFrom 判断汇总摘要是否需要更新，返回变化的最早章节序号（0 表示重新汇总）
+// 没有标记但汇总的章节数或最后章节变化时（如直接创建带摘要的章节），只多了排在后面的章节则追加
+func storySummaryStaleFrom(summary *models.StorySummary, chapters []models.Chapter) (int, bool) {
+	if summary.ID == 0 || summary.Content == "" {
+		return 0, true
+	}
+	if summary.Stale {
+		return summary.StaleFromOrder, true
+	}
+	last := chapters[len(chapters)-1].Order
+	if len(chapters) == summary.ChapterCount && last == summary.LastChapterOrder {
+		return 0, false
+	}
+	newer := 0
+	for _, ch := range chapters {
+		if ch.Order > summary.LastChapterOrder {
+			newer++
+		}
+	}
+	if newer > 0 && len(chapters)-newer == summary.ChapterCount {
+		return summary.LastChapterOrder + 1, true
+	}
+	return 0, true
+}
+
+// rollupStorySummary 按需更新一级汇总摘要（volumeID 为 0 时为全书梗概），chapters 为其涵盖的有摘要的章节：
+// 没有变化时跳过；只有排在原摘要之后的章节变化时，在原摘要基础上并入这些章节的摘要；否则用 rebuild 返回的下级摘要重新汇总
+func rollupStorySummary(ctx context.Context, db *gorm.DB, generator *llm.ChapterGenerator, novelID, volumeID uint,
+	scope string, maxLength int, chapters []models.Chapter, rebuild func() []string) (*models.StorySummary, bool, error) {
+	summary, err := models.GetStorySummary(db, novelID, volumeID)
+	if err != nil {
+		return nil, false, fmt.Errorf("获取汇总摘要失败: %w", err)
+	}
+	if summary == nil {
+		level := models.StorySummaryNovel
+		if volumeID != 0 {
+			level = models.StorySummaryVolume
+		}
+		summary = &models.StorySummary{NovelID: novelID, Level: level, VolumeID: volumeID}
+	}
+	from, needed := storySummaryStaleFrom(summary, chapters)
+	if !needed {
+		return summary, false, nil
+	}
+	revision := summary.Revision
+
+	req := llm.SummaryRollupRequest{Scope: scope, MaxLength: maxLength}
+	if summary.Content != "" && from > summary.LastChapterOrder {
+		for _, ch := range chapters {
+			if ch.Order > summary.LastChapterOrder {
+				req.Children = append(req.Children, chapterSummaryLine(ch))
+			}
+		}
+		if len(req.Children) > 0 {
+			req.Previous = summary.Content
+		}
+	}
+	if req.Previous == "" {
+		req.Children = rebuild()
+	}
+	content, err := generator.RollupSummary(ctx, req)
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now()
+	summary.Content = content
+	summary.Stale = false
+	summary.StaleFromOrder = 0
+	summary.ChapterCount = len(chapters)
+	summary.LastChapterOrder = chapters[len(chapters)-1].Order
+	summary.GeneratedAt = &now
+	if usage := llm.UsageScopeFrom(ctx); usage != nil {
+		summary.Model = usage.Summary().Model
+	}
+	if err := models.SaveStorySummary(db, summary, revision); err != nil {
+		return nil, false, fmt.Errorf("保存汇总摘要失败: %w", err)
+	}
+	return summary, true, nil
+}
+
+// RefreshSummariesRequest 汇总小说摘要请求
+type RefreshSummariesRequest struct {
+	NovelID uint `json:"novelId" binding:"required"`
+}
+
+// RefreshStorySummaries 立即在后台汇总小说的摘要
+// @Summary 汇总小说摘要
+// @Description 在后台为缺少摘要或摘要待更新的章节生成摘要，并逐级更新卷摘要和全书梗概，结果通过汇总摘要接口获取
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param request body RefreshSummariesRequest true "汇总请求"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/novel/refresh-summaries [post]
+func (h *AIHandler) RefreshStorySummaries(c *gin.Context) {
+	var req RefreshSummariesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	var novel models.Novel
+	if err := h.db.Select("id").First(&novel, req.NovelID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"msg":  "小说不存在",
+		})
+		return
+	}
+
+	h.summaries.schedule(novel.ID, currentUserID(c), 0)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "摘要汇总已开始",
+	})
+}
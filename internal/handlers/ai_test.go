@@ -0,0 +1,706 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/config"
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	if logger.Lg == nil {
+		logger.Lg = zap.NewNop()
+	}
+}
+
+// setupMockAIHandler 使用 Mock 提供商和内存数据库创建 AI 处理器
+func setupMockAIHandler(t *testing.T) (*AIHandler, *llm.MockProvider) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	config.GlobalConfig = &config.Config{LLMProvider: llm.ProviderMock}
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ChatSession{}, &models.ChatMessage{}, &models.ChatUsage{}, &models.PromptTemplate{},
+		&models.LLMUsage{}, &models.LLMQuota{}))
+	t.Cleanup(func() { llm.SetPromptStore(nil) })
+
+	mock := llm.NewMockProvider("")
+	return newAIHandler(db, mock, "mock-model"), mock
+}
+
+// performAIRequest 以登录用户身份调用处理函数
+func performAIRequest(handler gin.HandlerFunc, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(constants.UserField, &models.User{BaseModel: models.BaseModel{ID: 1}, Email: "test@example.com"})
+	handler(c)
+	return w
+}
+
+// newRouteTester 以登录用户身份注册路由，返回按方法和路径发送 JSON 请求的函数，body 为 nil 时不带请求体
+func newRouteTester(register func(r *gin.RouterGroup)) func(method, path string, body any) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(constants.UserField, &models.User{BaseModel: models.BaseModel{ID: 1}})
+	})
+	register(r.Group(""))
+	return func(method, path string, body any) *httptest.ResponseRecorder {
+		var data []byte
+		if body != nil {
+			data, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+}
+
+// useSingleConnection 后台任务与请求共用内存数据库，限制为一个连接
+func useSingleConnection(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+}
+
+func TestAIHandler_GenerateChapter_Mock(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+
+	w := performAIRequest(h.GenerateChapter, GenerateChapterRequest{Title: "第一章", StyleGuide: "简洁明快"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Code int                         `json:"code"`
+		Data llm.ChapterGenerateResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 200, resp.Code)
+	assert.NotEmpty(t, resp.Data.Content)
+	assert.Equal(t, llm.PromptChapterGenerate+"@default", resp.Data.PromptVersion)
+
+	requests := mock.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, llm.PromptChapterGenerate, requests[0].Task)
+	assert.Equal(t, "mock-model", requests[0].Model)
+}
+
+func TestAIHandler_GenerateChapterStream_Mock(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	mock.Script(llm.PromptChapterGenerate, llm.MockResponse{Chunks: []string{
+		`{"title":"第一章","content":"夜色`, `渐深，\n他推`, `开了门。","summary":"主角离家",`,
+		`"keyEvents":["离家"],"foreshadowing":"门外的脚印","nextChapterHint":"追踪脚印"}`,
+	}})
+
+	w := performAIRequest(h.GenerateChapterStream, GenerateChapterRequest{Title: "第一章"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// 只推送正文，结构化字段在 result 事件中返回
+	var streamed strings.Builder
+	var result llm.ChapterGenerateResponse
+	for _, block := range strings.Split(w.Body.String(), "\n\n") {
+		event, data, _ := strings.Cut(block, "\ndata:")
+		switch event {
+		case "event:data":
+			var chunk struct{ Content string }
+			require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+			streamed.WriteString(chunk.Content)
+		case "event:result":
+			require.NoError(t, json.Unmarshal([]byte(data), &result))
+		}
+	}
+	assert.Equal(t, "夜色渐深，\n他推开了门。", streamed.String())
+	assert.Equal(t, streamed.String(), result.Content)
+	assert.Equal(t, "主角离家", result.Summary)
+	assert.Equal(t, []string{"离家"}, result.KeyEvents)
+	assert.Equal(t, "门外的脚印", result.Foreshadowing)
+}
+
+func TestAIHandler_GenerateChapter_Metadata(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&models.Novel{}, &models.Chapter{}, &models.ChapterRevision{}, &models.Storyline{}, &models.StoryNode{}, &models.Foreshadowing{}))
+
+	novel := models.Novel{Title: "剑来"}
+	require.NoError(t, h.db.Create(&novel).Error)
+	prev := models.Chapter{NovelID: novel.ID, Title: "下山", Order: 1, Summary: "林风拜别师父下山",
+		Metadata: models.ChapterMetadata{NextChapterHint: "林风在山道上遇到追查玉佩的神秘人"}}
+	require.NoError(t, h.db.Create(&prev).Error)
+	chapter := models.Chapter{NovelID: novel.ID, Title: "山道", Order: 2}
+	require.NoError(t, h.db.Create(&chapter).Error)
+
+	// 前文摘要和本章重点默认取上一章
+	w := performAIRequest(h.GenerateChapter, GenerateChapterRequest{Title: "山道", NovelID: novel.ID, ChapterID: chapter.ID, TargetWordCount: 3000})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	requests := mock.Requests()
+	require.Len(t, requests, 1)
+	prompt := requests[0].Messages[len(requests[0].Messages)-1].Content
+	assert.Contains(t, prompt, "第 1 章 下山：林风拜别师父下山\n下章提示：林风在山道上遇到追查玉佩的神秘人")
+	assert.Contains(t, prompt, "【本章重点】\n1. 林风在山道上遇到追查玉佩的神秘人")
+
+	require.NoError(t, h.db.First(&chapter, chapter.ID).Error)
+	meta := chapter.Metadata
+	assert.Equal(t, []string{"玉佩异动", "林风决定离开小镇"}, meta.KeyEvents)
+	assert.Equal(t, "林风在山道上遇到追查玉佩的神秘人。", meta.NextChapterHint)
+	assert.Equal(t, 3000, meta.TargetWordCount)
+	assert.Equal(t, llm.PromptChapterGenerate+"@default", meta.PromptVersion)
+	assert.Equal(t, models.ChapterRevisionSourceAIGenerate, meta.LastOperation)
+	assert.NotNil(t, meta.UpdatedAt)
+
+	// 优化只更新最近操作，保留生成结果
+	require.NoError(t, h.db.Model(&chapter).Update("content", "山风呼啸。").Error)
+	w = performAIRequest(h.RefineChapterContent, RefineChapterContentRequest{Title: "山道", OriginalContent: "山风呼啸。", Feedback: "更有画面感", ChapterID: chapter.ID})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, h.db.First(&chapter, chapter.ID).Error)
+	assert.Equal(t, models.ChapterRevisionSourceAIRefine, chapter.Metadata.LastOperation)
+	assert.Equal(t, meta.KeyEvents, chapter.Metadata.KeyEvents)
+	assert.Equal(t, meta.PromptVersion, chapter.Metadata.PromptVersion)
+
+	// 扩写、大纲只记录最近操作；摘要同时保存到章节
+	w = performAIRequest(h.ExpandContent, ExpandContentRequest{ExpandTarget: "山风呼啸。", ChapterID: chapter.ID})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, h.db.First(&chapter, chapter.ID).Error)
+	assert.Equal(t, models.ChapterOperationAIExpand, chapter.Metadata.LastOperation)
+	w = performAIRequest(h.GenerateChapterOutline, GenerateChapterOutlineRequest{Title: "山道", ChapterID: chapter.ID})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, h.db.First(&chapter, chapter.ID).Error)
+	assert.Equal(t, models.ChapterOperationAIOutline, chapter.Metadata.LastOperation)
+
+	mock.Script(llm.PromptChapterSummary, llm.MockResponse{Content: "林风行至山道"})
+	w = performAIRequest(h.GenerateChapterSummary, GenerateChapterSummaryRequest{Title: "山道", Content: "山风呼啸。", ChapterID: chapter.ID})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "saveError")
+	require.NoError(t, h.db.First(&chapter, chapter.ID).Error)
+	assert.Equal(t, "林风行至山道", chapter.Summary)
+	assert.Equal(t, models.ChapterRevisionSourceAISummary, chapter.Metadata.LastOperation)
+	assert.Equal(t, meta.KeyEvents, chapter.Metadata.KeyEvents)
+}
+
+func TestAIHandler_GenerateStorylines_Mock(t *testing.T) {
+	h, _ := setupMockAIHandler(t)
+
+	w := performAIRequest(h.GenerateStorylines, GenerateStorylinesRequest{NovelID: 1, NovelTitle: "测试小说", StorylineCount: 1})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Data llm.StorylineGenerateResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotEmpty(t, resp.Data.Storylines)
+	assert.NotEmpty(t, resp.Data.Storylines[0].Nodes)
+}
+
+func TestAIHandler_Chat_Mock(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	mock.Script(llm.TaskChat, llm.MockResponse{Content: "可以让反派提前登场。"})
+
+	w := performAIRequest(h.Chat, ChatRequest{
+		Messages: []ChatMessage{{Role: "user", Content: "下一章怎么写？"}},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Data ChatResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "可以让反派提前登场。", resp.Data.Message.Content)
+
+	var count int64
+	h.db.Model(&models.ChatMessage{}).Where("session_id = ?", resp.Data.SessionID).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestAIHandler_Chat_NovelTools(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&models.Novel{}, &models.Chapter{}, &models.Character{}, &models.PlotPoint{},
+		&models.NovelSetting{}, &models.Storyline{}, &models.StoryNode{}))
+
+	novel := models.Novel{Title: "测试小说"}
+	require.NoError(t, h.db.Create(&novel).Error)
+	require.NoError(t, h.db.Create(&models.Character{NovelID: novel.ID, Name: "林逸", Description: "寒门少年，擅长剑术"}).Error)
+
+	mock.Script(llm.TaskChat,
+		llm.MockResponse{ToolCalls: []openai.ToolCall{
+			{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: toolGetCharacter, Arguments: `{"name":"林逸"}`}},
+			{ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: toolCreatePlotDraft, Arguments: `{"title":"剑冢试炼","content":"林逸进入剑冢"}`}},
+		}},
+		llm.MockResponse{Content: "林逸擅长剑术，已记录剑冢试炼草稿。"})
+
+	for _, stream := range []bool{false, true} {
+		w := performAIRequest(h.Chat, ChatRequest{
+			NovelID:  &novel.ID,
+			Messages: []ChatMessage{{Role: "user", Content: "林逸擅长什么？"}},
+			Stream:   stream,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), "林逸擅长剑术")
+	}
+
+	// 第二轮请求带上工具调用和工具结果
+	requests := mock.Requests()
+	require.Len(t, requests, 3)
+	require.Len(t, requests[0].Tools, 6)
+	second := requests[1].Messages
+	require.Equal(t, "tool", second[len(second)-2].Role)
+	assert.Contains(t, second[len(second)-2].Content, "寒门少年")
+
+	// 非流式会话：用户消息、工具调用、两条工具结果、最终回复
+	var messages []models.ChatMessage
+	require.NoError(t, h.db.Where("session_id = ?", 1).Order("id").Find(&messages).Error)
+	require.Len(t, messages, 5)
+	assert.Contains(t, messages[1].ToolCalls, toolGetCharacter)
+	assert.Equal(t, toolGetCharacter, messages[2].ToolName)
+	assert.Equal(t, toolCreatePlotDraft, messages[3].ToolName)
+	assert.Equal(t, "林逸擅长剑术，已记录剑冢试炼草稿。", messages[4].Content)
+	assert.Positive(t, messages[4].TotalTokens)
+
+	var draft models.PlotPoint
+	require.NoError(t, h.db.Where("novel_id = ?", novel.ID).First(&draft).Error)
+	assert.Equal(t, models.PlotPointStatusDraft, draft.Status)
+
+	// 继续已有会话时，上下文和工具都使用会话关联的小说，忽略请求中的小说
+	other := models.Novel{Title: "另一部小说"}
+	require.NoError(t, h.db.Create(&other).Error)
+	sessionID := uint(1)
+	w := performAIRequest(h.Chat, ChatRequest{
+		SessionID: &sessionID,
+		NovelID:   &other.ID,
+		Messages:  []ChatMessage{{Role: "user", Content: "继续"}},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	requests = mock.Requests()
+	var prompt strings.Builder
+	for _, m := range requests[len(requests)-1].Messages {
+		prompt.WriteString(m.Content)
+	}
+	assert.Contains(t, prompt.String(), "测试小说")
+	assert.NotContains(t, prompt.String(), "另一部小说")
+}
+
+// disconnectingWriter 写出第一个消息分片后取消请求上下文，模拟客户端断开
+type disconnectingWriter struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w *disconnectingWriter) Write(data []byte) (int, error) {
+	return w.WriteString(string(data))
+}
+
+// WriteString SSE 编码优先使用 WriteString，需同样拦截
+func (w *disconnectingWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseRecorder.WriteString(s)
+	if strings.Contains(w.Body.String(), "event:message") {
+		w.cancel()
+	}
+	return n, err
+}
+
+func TestAIHandler_ChatStream_ClientDisconnect(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	mock.Script(llm.TaskChat, llm.MockResponse{Chunks: []string{"第一段", "第二段", "第三段"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &disconnectingWriter{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+	c, _ := gin.CreateTestContext(w)
+	data, _ := json.Marshal(ChatRequest{Messages: []ChatMessage{{Role: "user", Content: "继续"}}, Stream: true})
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data)).WithContext(ctx)
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(constants.UserField, &models.User{BaseModel: models.BaseModel{ID: 1}, Email: "test@example.com"})
+	h.Chat(c)
+
+	body := w.Body.String()
+	assert.Equal(t, 1, strings.Count(body, "event:message"), body)
+	assert.NotContains(t, body, "event:done")
+	assert.NotContains(t, body, "event:error")
+
+	// 已输出的部分回复标记为中断后保存
+	var reply models.ChatMessage
+	require.NoError(t, h.db.Where("role = ?", "assistant").First(&reply).Error)
+	assert.Equal(t, "第一段", reply.Content)
+	assert.True(t, reply.Interrupted)
+}
+
+func TestAIHandler_DebugNovelContext_Budget(t *testing.T) {
+	h, _ := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&models.Novel{}, &models.Chapter{}, &models.Character{}, &models.PlotPoint{},
+		&models.NovelSetting{}, &models.Storyline{}, &models.StoryNode{}))
+
+	novel := models.Novel{Title: "测试小说", Genre: "玄幻"}
+	require.NoError(t, h.db.Create(&novel).Error)
+	require.NoError(t, h.db.Create(&models.NovelSetting{NovelID: int(novel.ID), Category: "power", Title: "灵力体系", Content: "九重境界", IsImportant: true}).Error)
+	for i, content := range []string{"开端", "发展", strings.Repeat("很长的正文。", 3000)} {
+		require.NoError(t, h.db.Create(&models.Chapter{
+			NovelID: novel.ID,
+			Title:   fmt.Sprintf("第%d章", i+1),
+			Order:   i + 1,
+			Content: content,
+			Summary: fmt.Sprintf("第%d章摘要", i+1),
+		}).Error)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Params = gin.Params{{Key: "novelId", Value: fmt.Sprint(novel.ID)}}
+	h.DebugNovelContext(c)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Data struct {
+			Context string            `json:"context"`
+			Budget  llm.ContextReport `json:"budget"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	report := resp.Data.Budget
+	assert.Equal(t, llm.DefaultContextWindow, report.ContextWindow)
+	assert.LessOrEqual(t, report.UsedTokens, report.Budget)
+
+	modes := map[string]string{}
+	for _, item := range report.Included {
+		modes[item.Key] = item.Mode
+	}
+	assert.Equal(t, llm.ContextModeFull, modes["chapter:1"])
+	assert.Equal(t, llm.ContextModeFallback, modes["chapter:3"], "oversized recent chapter should fall back to its summary")
+	assert.Equal(t, llm.ContextModeFull, modes["setting:1"])
+	assert.Contains(t, resp.Data.Context, "灵力体系")
+	assert.Contains(t, resp.Data.Context, "第3章摘要")
+	assert.NotContains(t, resp.Data.Context, "很长的正文")
+}
+
+func TestAIHandler_Chat_ResponseCache(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&models.LLMResponseCache{}))
+	config.GlobalConfig.LLMCacheEnabled = true
+	config.GlobalConfig.LLMCacheMaxTemperature = 0.7
+	h = newAIHandler(h.db, withResponseCache(h.db, mock), "mock-model")
+	mock.Script(llm.TaskChat, llm.MockResponse{Content: "缓存的回答"})
+
+	var last ChatResponse
+	for i := 0; i < 2; i++ {
+		w := performAIRequest(h.Chat, ChatRequest{
+			Messages:    []ChatMessage{{Role: "user", Content: "主角叫什么？"}},
+			Temperature: 0.2,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Data ChatResponse `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, i == 1, resp.Data.Cached)
+		last = resp.Data
+	}
+	assert.Equal(t, "缓存的回答", last.Message.Content)
+	assert.Len(t, mock.Requests(), 1)
+
+	var entry models.LLMResponseCache
+	require.NoError(t, h.db.First(&entry).Error)
+	assert.Equal(t, llm.TaskChat, entry.Task)
+
+	var usage models.ChatUsage
+	require.NoError(t, h.db.Where("user_id = ?", 1).First(&usage).Error)
+	assert.Equal(t, 1, usage.CacheHits)
+	assert.Equal(t, last.Usage.TotalTokens, usage.CachedTokens)
+}
+
+func TestAIHandler_UsageLedgerAndQuota(t *testing.T) {
+	h, _ := setupMockAIHandler(t)
+	user := &models.User{BaseModel: models.BaseModel{ID: 1}, Email: "test@example.com", Role: "user"}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(constants.UserField, user) })
+	r.POST("/chapter", h.meter(llm.PromptChapterGenerate), h.GenerateChapter)
+	r.GET("/usage", h.GetUsageStats)
+	generate := func() *httptest.ResponseRecorder {
+		data, _ := json.Marshal(GenerateChapterRequest{Title: "第一章"})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/chapter", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := generate()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var entry models.LLMUsage
+	require.NoError(t, h.db.First(&entry).Error)
+	assert.Equal(t, llm.PromptChapterGenerate, entry.Feature)
+	assert.Equal(t, 1, entry.Calls)
+	assert.Greater(t, entry.TotalTokens, 0)
+
+	// 角色配额已用完时拒绝调用并返回剩余配额
+	require.NoError(t, models.SaveLLMQuota(h.db, &models.LLMQuota{Role: "user", DailyTokens: int64(entry.TotalTokens)}))
+	w = generate()
+	require.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	var limited struct {
+		Data struct {
+			Feature string      `json:"feature"`
+			Quota   QuotaStatus `json:"quota"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &limited))
+	assert.Equal(t, llm.PromptChapterGenerate, limited.Data.Feature)
+	assert.Equal(t, int64(0), limited.Data.Quota.Daily.Remaining)
+	assert.Equal(t, int64(-1), limited.Data.Quota.Monthly.Remaining)
+
+	// 用户配置优先于角色配置
+	require.NoError(t, models.SaveLLMQuota(h.db, &models.LLMQuota{UserID: 1, DailyTokens: 1000000}))
+	require.Equal(t, http.StatusOK, generate().Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/usage", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report struct {
+		Data struct {
+			FeatureUsage []models.LLMUsageTotals `json:"featureUsage"`
+			Quota        QuotaStatus             `json:"quota"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	require.Len(t, report.Data.FeatureUsage, 1)
+	assert.Equal(t, int64(2), report.Data.FeatureUsage[0].Requests)
+	assert.Equal(t, int64(1000000), report.Data.Quota.Daily.Limit)
+}
+
+func TestAIHandler_ModelRoutes(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&utils.Config{}))
+	// 配置值有进程内缓存，测试结束时清空，避免影响其他测试
+	t.Cleanup(func() { utils.SetValue(h.db, constants.KEY_LLM_MODEL_ROUTES, "", "json", false, false) })
+
+	w := performAIRequest(h.SaveModelRoutes, llm.ModelRoutes{"chapter": {Provider: "unknown", Model: "x"}})
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	w = performAIRequest(h.SaveModelRoutes, llm.ModelRoutes{
+		"chapter":         {Model: "strong-model", MaxTokens: llm.IntPtr(4000)},
+		"chapter.summary": {Model: "cheap-model"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = performAIRequest(h.GenerateChapter, GenerateChapterRequest{Title: "第一章"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	requests := mock.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "strong-model", requests[0].Model)
+	require.NotNil(t, requests[0].MaxTokens)
+	assert.Equal(t, 4000, *requests[0].MaxTokens)
+
+	w = performAIRequest(h.ListModelRoutes, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Data struct {
+			Routes llm.ModelRoutes `json:"routes"`
+			Tasks  []string        `json:"tasks"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "cheap-model", resp.Data.Routes[llm.PromptChapterSummary].Model)
+	assert.Contains(t, resp.Data.Tasks, llm.PromptChapterSummary)
+	assert.NotContains(t, resp.Data.Tasks, llm.PromptChapterSystem)
+}
+
+func TestAIHandler_CallAudit(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&models.LLMCall{}))
+	llm.SetCallRecorder(&dbCallRecorder{db: h.db, audit: true})
+	t.Cleanup(func() { llm.SetCallRecorder(nil) })
+
+	// 第一次输出不是 JSON，修复后解析成功
+	mock.Script(llm.PromptChapterGenerate,
+		llm.MockResponse{Content: "抱歉，我无法按格式输出"},
+		llm.MockResponse{Content: `{"title":"第一章","content":"正文","summary":"摘要","keyEvents":[],"nextChapterHint":"下一章"}`})
+
+	user := &models.User{BaseModel: models.BaseModel{ID: 1}, Email: "test@example.com", Role: "user"}
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(constants.UserField, user) })
+	r.POST("/chapter", h.meter(llm.PromptChapterGenerate), h.GenerateChapter)
+	data, _ := json.Marshal(GenerateChapterRequest{Title: "第一章"})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/chapter", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var calls []models.LLMCall
+	require.NoError(t, h.db.Order("id ASC").Find(&calls).Error)
+	require.Len(t, calls, 2)
+	for _, call := range calls {
+		assert.Equal(t, uint(1), call.UserID)
+		assert.Equal(t, llm.PromptChapterGenerate, call.Feature)
+		assert.Equal(t, llm.PromptChapterGenerate, call.Task)
+		assert.Equal(t, llm.PromptChapterGenerate+"@default", call.PromptVersion)
+		assert.Equal(t, models.LLMCallStatusSuccess, call.Status)
+		assert.Contains(t, call.Messages, "第一章")
+		require.NotNil(t, call.Parsed)
+	}
+	assert.False(t, *calls[0].Parsed)
+	assert.NotEmpty(t, calls[0].ParseProblems)
+	assert.True(t, *calls[1].Parsed)
+
+	// 按解析结果过滤和按模型汇总
+	failed, total, err := models.ListLLMCalls(h.db, models.LLMCallFilter{Parsed: new(bool), Page: 1, PageSize: 20})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Empty(t, failed[0].Messages)
+	stats, err := models.GetLLMCallStats(h.db, models.LLMCallFilter{})
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, int64(2), stats[0].Calls)
+	assert.Equal(t, int64(1), stats[0].ParseFailures)
+
+	// 脱敏后只保留长度
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(calls[0].ID)}}
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	h.RedactLLMCall(c)
+	var redacted models.LLMCall
+	require.NoError(t, h.db.First(&redacted, calls[0].ID).Error)
+	assert.True(t, redacted.Redacted)
+	assert.NotContains(t, redacted.Messages, "第一章")
+	assert.Equal(t, llm.RedactedContent(calls[0].Response), redacted.Response)
+
+	removed, err := models.DeleteLLMCallsBefore(h.db, time.Now().Add(time.Minute), 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), removed)
+}
+
+func TestAIHandler_CostAccounting(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&utils.Config{}, &models.LLMCall{}, &models.LLMModelPrice{},
+		&models.LLMCostDaily{}, &models.LLMBudgetAlert{}))
+	llm.SetCallRecorder(&dbCallRecorder{db: h.db, audit: true, budget: &budgetAlerter{db: h.db}})
+	t.Cleanup(func() {
+		llm.SetCallRecorder(nil)
+		utils.SetValue(h.db, constants.KEY_LLM_BUDGET, "", "json", false, false)
+	})
+
+	w := performAIRequest(h.SaveModelPrice, SaveModelPriceRequest{Model: "priced-model", InputPrice: -1})
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	w = performAIRequest(h.SaveModelPrice, SaveModelPriceRequest{Model: "priced-model", InputPrice: 2, OutputPrice: 8})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = performAIRequest(h.SaveBudget, LLMBudget{Monthly: 0.007})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	mock.Script(llm.PromptChapterGenerate, llm.MockResponse{
+		Content: `{"title":"第一章","content":"正文","summary":"摘要","keyEvents":[],"nextChapterHint":"下一章"}`,
+		Model:   "priced-model",
+		Usage:   &llm.Usage{PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500},
+	})
+	user := &models.User{BaseModel: models.BaseModel{ID: 1}, Email: "test@example.com", Role: "user"}
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set(constants.UserField, user) })
+	r.POST("/chapter", h.meter(llm.PromptChapterGenerate), h.GenerateChapter)
+	data, _ := json.Marshal(GenerateChapterRequest{Title: "第一章"})
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/chapter", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// 每次 (1000*2 + 500*8) / 1e6 = 0.006
+	var call models.LLMCall
+	require.NoError(t, h.db.First(&call).Error)
+	assert.InDelta(t, 0.006, call.Cost, 1e-9)
+	assert.Equal(t, models.DefaultLLMCurrency, call.Currency)
+
+	today := time.Now().Format("2006-01-02")
+	totals, err := models.GetLLMCostReport(h.db, "task", today, today)
+	require.NoError(t, err)
+	require.Len(t, totals, 1)
+	assert.Equal(t, llm.PromptChapterGenerate, totals[0].Key)
+	assert.Equal(t, int64(2), totals[0].Calls)
+	assert.InDelta(t, 0.012, totals[0].Cost, 1e-9)
+
+	totals, err = models.GetLLMCostReport(h.db, "user", today, today)
+	require.NoError(t, err)
+	require.Len(t, totals, 1)
+	assert.Equal(t, "1", totals[0].Key)
+
+	// 预算 0.007：第一次调用越过 80% 阈值，第二次越过 100% 阈值，各告警一次
+	var alerts []models.LLMBudgetAlert
+	require.NoError(t, h.db.Order("percent ASC").Find(&alerts).Error)
+	require.Len(t, alerts, 2)
+	assert.Equal(t, 80, alerts[0].Percent)
+	assert.Equal(t, 100, alerts[1].Percent)
+}
+
+func TestAIHandler_CharacterProfile(t *testing.T) {
+	h, _ := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&models.Novel{}, &models.Chapter{}, &models.Character{}, &models.PlotPoint{},
+		&models.NovelSetting{}, &models.Storyline{}, &models.StoryNode{}))
+
+	novel := models.Novel{Title: "测试小说"}
+	require.NoError(t, h.db.Create(&novel).Error)
+	legacy := models.Character{NovelID: novel.ID, Name: "林风", Description: "小镇少年。\n性格：外冷内热\n背景：自幼被师父收养", Status: llm.CharacterStatusAlive}
+	require.NoError(t, h.db.Create(&legacy).Error)
+	plain := models.Character{NovelID: novel.ID, Name: "张三", Description: "卖豆腐的", Status: llm.CharacterStatusDead}
+	require.NoError(t, h.db.Create(&plain).Error)
+
+	// 旧描述按标签迁移，检查过的角色标记后不再处理
+	require.NoError(t, MigrateCharacterProfiles(h.db))
+	require.NoError(t, MigrateCharacterProfiles(h.db))
+	require.NoError(t, h.db.First(&legacy, legacy.ID).Error)
+	assert.Equal(t, "小镇少年。", legacy.Description)
+	assert.Equal(t, "外冷内热", legacy.Personality)
+	assert.Equal(t, "自幼被师父收养", legacy.Background)
+	require.NoError(t, h.db.First(&plain, plain.ID).Error)
+	assert.Equal(t, "卖豆腐的", plain.Description)
+	assert.True(t, legacy.ProfileMigrated)
+	assert.True(t, plain.ProfileMigrated)
+
+	// 增强指定角色时保存结构化档案，自定义属性以原档案为准
+	require.NoError(t, h.db.Model(&legacy).Update("attributes", `{"信物":"旧玉佩"}`).Error)
+	w := performAIRequest(h.EnhanceDescription, EnhanceDescriptionRequest{CharacterID: legacy.ID})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, h.db.First(&legacy, legacy.ID).Error)
+	assert.Equal(t, "林风", legacy.Name)
+	assert.Equal(t, "小风", legacy.Aliases)
+	assert.Equal(t, "炼气三层", legacy.PowerLevel)
+	attrs, err := models.ParseCharacterAttributes(legacy.Attributes)
+	require.NoError(t, err)
+	assert.Equal(t, "旧玉佩", attrs["信物"])
+
+	w = performAIRequest(h.EnhanceDescription, EnhanceDescriptionRequest{Description: "没有名字"})
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	// 上下文中使用结构化档案
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Params = gin.Params{{Key: "novelId", Value: fmt.Sprint(novel.ID)}}
+	h.DebugNovelContext(c)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	body := w.Body.String()
+	assert.Contains(t, body, "别名：小风")
+	assert.Contains(t, body, "实力：炼气三层")
+	assert.Contains(t, body, "状态：死亡")
+}
@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/LingByte/LingDialog/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 没有对应提示词模板或任务常量的功能标识
+const (
+	featureNovelSetting = "novel.generate_setting"
+	featureWritingGoals = "writing.goals"
+)
+
+// QuotaWindow 单个配额周期的使用情况
+type QuotaWindow struct {
+	Limit     int64     `json:"limit"`     // 上限，0 表示不限
+	Used      int64     `json:"used"`      // 已使用
+	Remaining int64     `json:"remaining"` // 剩余，不限时为 -1
+	ResetAt   time.Time `json:"resetAt"`   // 周期重置时间
+}
+
+// exceeded 是否已用完
+func (w QuotaWindow) exceeded() bool {
+	return w.Limit > 0 && w.Used >= w.Limit
+}
+
+// QuotaStatus 用户的 LLM token 配额状态
+type QuotaStatus struct {
+	Daily   QuotaWindow `json:"daily"`
+	Monthly QuotaWindow `json:"monthly"`
+}
+
+// newQuotaWindow 计算配额周期的剩余量
+func newQuotaWindow(limit, used int64, resetAt time.Time) QuotaWindow {
+	remaining := int64(-1)
+	if limit > 0 {
+		remaining = limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+	}
+	return QuotaWindow{Limit: limit, Used: used, Remaining: remaining, ResetAt: resetAt}
+}
+
+// loadQuotaStatus 计算用户当前的配额状态
+// 配额优先取用户配置，其次取角色配置，都没有时使用系统配置 LLM_QUOTA_DAILY_TOKENS / LLM_QUOTA_MONTHLY_TOKENS
+func loadQuotaStatus(db *gorm.DB, userID uint, role string, now time.Time) (*QuotaStatus, error) {
+	daily := int64(utils.GetIntValue(db, constants.KEY_LLM_QUOTA_DAILY_TOKENS, 0))
+	monthly := int64(utils.GetIntValue(db, constants.KEY_LLM_QUOTA_MONTHLY_TOKENS, 0))
+	quota, err := models.GetLLMQuota(db, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	if quota != nil {
+		daily, monthly = quota.DailyTokens, quota.MonthlyTokens
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	usedToday, err := models.SumLLMUsageTokens(db, userID, today.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	usedMonth, err := models.SumLLMUsageTokens(db, userID, monthStart.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuotaStatus{
+		Daily:   newQuotaWindow(daily, usedToday, today.AddDate(0, 0, 1)),
+		Monthly: newQuotaWindow(monthly, usedMonth, monthStart.AddDate(0, 1, 0)),
+	}, nil
+}
+
+// exceededWindow 返回已用完的配额周期名称和周期，未超限时返回空
+func (s *QuotaStatus) exceededWindow() (string, *QuotaWindow) {
+	if s.Monthly.exceeded() {
+		return "本月", &s.Monthly
+	}
+	if s.Daily.exceeded() {
+		return "今日", &s.Daily
+	}
+	return "", nil
+}
+
+// recordLLMUsage 将一次请求内的 LLM 用量写入台账，没有发生调用时不记录
+func recordLLMUsage(db *gorm.DB, userID uint, feature string, scope *llm.UsageScope) {
+	summary := scope.Summary()
+	if summary.Calls == 0 {
+		return
+	}
+
+	entry := models.LLMUsage{
+		UserID:           userID,
+		Date:             time.Now().Format("2006-01-02"),
+		Feature:          feature,
+		Model:            summary.Model,
+		Calls:            summary.Calls,
+		PromptTokens:     summary.PromptTokens,
+		CompletionTokens: summary.CompletionTokens,
+		TotalTokens:      summary.TotalTokens,
+		CacheHits:        summary.CacheHits,
+		CachedTokens:     summary.CachedTokens,
+		Estimated:        summary.Estimated,
+	}
+	entry.CreateBy = strconv.FormatUint(uint64(userID), 10)
+	if err := db.Create(&entry).Error; err != nil {
+		logger.Error("记录 LLM 用量失败",
+			zap.Uint("userID", userID),
+			zap.String("feature", feature),
+			zap.Int("totalTokens", summary.TotalTokens),
+			zap.Error(err))
+	}
+}
+
+// meterLLMUsage 返回 AI 功能路由的中间件：调用前检查配额，超限时返回 429 和剩余配额；
+// 调用后将本次请求内所有模型调用的用量按功能计入台账；调用方信息写入上下文供审计记录使用
+func meterLLMUsage(db *gorm.DB, feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := middleware.GetCurrentUser(c)
+		if user == nil {
+			c.Next()
+			return
+		}
+
+		status, err := loadQuotaStatus(db, user.ID, user.Role, time.Now())
+		if err != nil {
+			// 配额查询失败时不阻断请求，只记录日志
+			logger.Error("查询 LLM 配额失败", zap.Uint("userID", user.ID), zap.Error(err))
+		} else if period, window := status.exceededWindow(); window != nil {
+			retryAfter := int(time.Until(window.ResetAt).Seconds()) + 1
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"code": http.StatusTooManyRequests,
+				"msg":  fmt.Sprintf("%s AI 用量已达上限（%d tokens），将于 %s 重置", period, window.Limit, window.ResetAt.Format("2006-01-02 15:04")),
+				"data": gin.H{
+					"feature": feature,
+					"quota":   status,
+				},
+			})
+			return
+		}
+
+		ctx, scope := llm.WithUsageScope(c.Request.Context())
+		ctx = llm.WithCallInfo(ctx, &llm.CallInfo{UserID: user.ID, Feature: feature})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		if err := c.Request.Context().Err(); err != nil {
+			summary := scope.Summary()
+			logger.Warn("AI 请求已取消",
+				zap.Uint("userID", user.ID),
+				zap.String("feature", feature),
+				zap.Int("calls", summary.Calls),
+				zap.Int("totalTokens", summary.TotalTokens),
+				zap.Error(err))
+		}
+		recordLLMUsage(db, user.ID, feature, scope)
+	}
+}
+
+// meter 返回 AI 路由的用量统计和配额中间件
+func (h *AIHandler) meter(feature string) gin.HandlerFunc {
+	return meterLLMUsage(h.db, feature)
+}
+
+// GetUsageStats 获取用户 AI 使用统计
+// @Summary 获取 AI 使用统计
+// @Description 获取用户最近 N 天的聊天统计、按功能和按日期汇总的 token 消耗，以及当前配额状态
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param days query int false "统计天数" default(7)
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/chat/usage [get]
+func (h *AIHandler) GetUsageStats(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days <= 0 {
+		days = 7
+	}
+	since := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
+
+	// 聊天每日统计
+	var usage []models.ChatUsage
+	h.db.Where("user_id = ? AND date >= ?", user.ID, since).
+		Order("date DESC").
+		Find(&usage)
+
+	// 计算总计
+	var totalStats struct {
+		TotalMessages int `json:"totalMessages"`
+		TotalSessions int `json:"totalSessions"`
+		TotalTokens   int `json:"totalTokens"`
+		CacheHits     int `json:"cacheHits"`
+		CachedTokens  int `json:"cachedTokens"`
+	}
+
+	for _, u := range usage {
+		totalStats.TotalMessages += u.MessageCount
+		totalStats.TotalSessions += u.SessionCount
+		totalStats.TotalTokens += u.TotalTokens
+		totalStats.CacheHits += u.CacheHits
+		totalStats.CachedTokens += u.CachedTokens
+	}
+
+	// 全部 AI 功能的用量
+	features, err := models.GetLLMUsageByFeature(h.db, user.ID, since)
+	if err != nil {
+		logger.Error("获取功能用量失败", zap.Error(err))
+	}
+	daily, err := models.GetLLMUsageByDate(h.db, user.ID, since)
+	if err != nil {
+		logger.Error("获取每日用量失败", zap.Error(err))
+	}
+	quota, err := loadQuotaStatus(h.db, user.ID, user.Role, time.Now())
+	if err != nil {
+		logger.Error("获取配额状态失败", zap.Error(err))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "success",
+		"data": map[string]interface{}{
+			"dailyUsage":   usage,
+			"totalStats":   totalStats,
+			"periodDays":   days,
+			"featureUsage": features,
+			"llmDaily":     daily,
+			"quota":        quota,
+		},
+	})
+}
+
+// SaveQuotaRequest 设置配额请求，userId 与 role 二选一
+type SaveQuotaRequest struct {
+	UserID        uint   `json:"userId"`        // 用户ID
+	Role          string `json:"role"`          // 角色
+	DailyTokens   int64  `json:"dailyTokens"`   // 每日 token 上限，0 表示不限
+	MonthlyTokens int64  `json:"monthlyTokens"` // 每月 token 上限，0 表示不限
+	Remark        string `json:"remark"`        // 备注
+}
+
+// ListQuotas 获取配额配置
+// @Summary 获取 LLM 配额配置
+// @Description 列出按用户和按角色配置的 token 配额，以及系统默认配额（仅管理员）
+// @Tags AI
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/quotas [get]
+func (h *AIHandler) ListQuotas(c *gin.Context) {
+	var quotas []models.LLMQuota
+	if err := h.db.Order("role ASC, user_id ASC").Find(&quotas).Error; err != nil {
+		logger.Error("获取配额配置失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取配额配置失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"quotas": quotas,
+			"default": gin.H{
+				"dailyTokens":   utils.GetIntValue(h.db, constants.KEY_LLM_QUOTA_DAILY_TOKENS, 0),
+				"monthlyTokens": utils.GetIntValue(h.db, constants.KEY_LLM_QUOTA_MONTHLY_TOKENS, 0),
+			},
+		},
+	})
+}
+
+// SaveQuota 设置用户或角色的配额
+// @Summary 设置 LLM 配额
+// @Description 为用户或角色设置每日、每月 token 上限，已存在时覆盖（仅管理员）
+// @Tags AI
+// @Accept json
+// @Produce json
+// @Param request body SaveQuotaRequest true "配额"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/quotas [put]
+func (h *AIHandler) SaveQuota(c *gin.Context) {
+	var req SaveQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if (req.UserID == 0) == (req.Role == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "userId 和 role 必须且只能指定一个",
+		})
+		return
+	}
+	if req.DailyTokens < 0 || req.MonthlyTokens < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "配额不能为负数",
+		})
+		return
+	}
+
+	quota := models.LLMQuota{
+		UserID:        req.UserID,
+		Role:          req.Role,
+		DailyTokens:   req.DailyTokens,
+		MonthlyTokens: req.MonthlyTokens,
+		Remark:        req.Remark,
+	}
+	if user := middleware.GetCurrentUser(c); user != nil {
+		quota.CreateBy = user.Email
+		quota.UpdateBy = user.Email
+	}
+	if err := models.SaveLLMQuota(h.db, &quota); err != nil {
+		logger.Error("保存配额失败", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "保存配额失败",
+		})
+		return
+	}
+
+	saved, _ := models.GetLLMQuota(h.db, req.UserID, req.Role)
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "保存成功",
+		"data": saved,
+	})
+}
+
+// DeleteQuota 删除配额配置
+// @Summary 删除 LLM 配额
+// @Description 删除用户或角色的配额配置，删除后回退到角色或系统默认配额（仅管理员）
+// @Tags AI
+// @Produce json
+// @Param id path int true "配额ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/ai/admin/quotas/{id} [delete]
+func (h *AIHandler) DeleteQuota(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的配额ID",
+		})
+		return
+	}
+
+	result := h.db.Delete(&models.LLMQuota{}, id)
+	if result.Error != nil {
+		logger.Error("删除配额失败", zap.Error(result.Error))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "删除配额失败",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"msg":  "配额不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "删除成功",
+	})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ChapterEntityHandler 章节实体处理器
+type ChapterEntityHandler struct {
+	db *gorm.DB
+}
+
+// NewChapterEntityHandler 创建章节实体处理器
+func NewChapterEntityHandler(db *gorm.DB) *ChapterEntityHandler {
+	return &ChapterEntityHandler{
+		db: db,
+	}
+}
+
+// ListChapterEntities 获取章节中出现的实体
+// @Summary 获取章节实体
+// @Description 获取章节中出现的角色、情节、设定和地点及出现次数，保存章节内容时自动更新
+// @Tags Chapters
+// @Produce json
+// @Param id path int true "章节ID"
+// @Param type query string false "实体类型(character/plot_point/setting/location)"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/chapters/{id}/entities [get]
+func (h *ChapterEntityHandler) ListChapterEntities(c *gin.Context) {
+	chapterID, ok := parseIDParam(c, "id", "无效的章节ID")
+	if !ok {
+		return
+	}
+	entityType := c.Query("type")
+	if entityType != "" && !models.IsValidChapterEntityType(entityType) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的实体类型",
+		})
+		return
+	}
+
+	entities, err := models.ListChapterEntities(h.db, chapterID)
+	if err != nil {
+		logger.Error("获取章节实体失败", zap.Uint("chapterId", chapterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取章节实体失败",
+		})
+		return
+	}
+	if entityType != "" {
+		filtered := entities[:0]
+		for _, e := range entities {
+			if e.EntityType == entityType {
+				filtered = append(filtered, e)
+			}
+		}
+		entities = filtered
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": entities,
+	})
+}
+
+// ListEntityChapters 获取实体出现的章节
+// @Summary 获取实体出现的章节
+// @Description 获取角色、情节、设定或地点出现的章节及每章的出现次数，按章节顺序排列
+// @Tags Chapters
+// @Produce json
+// @Param type path string true "实体类型(character/plot_point/setting/location)"
+// @Param id path int true "实体ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/entities/{type}/{id}/chapters [get]
+func (h *ChapterEntityHandler) ListEntityChapters(c *gin.Context) {
+	entityType := c.Param("type")
+	if !models.IsValidChapterEntityType(entityType) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的实体类型",
+		})
+		return
+	}
+	entityID, ok := parseIDParam(c, "id", "无效的实体ID")
+	if !ok {
+		return
+	}
+
+	chapters, err := models.ListEntityChapters(h.db, entityType, entityID)
+	if err != nil {
+		logger.Error("获取实体出现的章节失败",
+			zap.String("entityType", entityType),
+			zap.Uint("entityId", entityID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取实体出现的章节失败",
+		})
+		return
+	}
+	totalMentions := 0
+	for _, ch := range chapters {
+		totalMentions += ch.Mentions
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"chapters":      chapters,
+			"totalMentions": totalMentions,
+		},
+	})
+}
+
+// RegisterChapterEntityRoutes 注册章节实体相关路由
+func RegisterChapterEntityRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	handler := NewChapterEntityHandler(db)
+
+	chapters := r.Group("/chapters/:id")
+	chapters.Use(middleware.RequireAuth())
+	{
+		chapters.GET("/entities", handler.ListChapterEntities)
+	}
+
+	entities := r.Group("/entities")
+	entities.Use(middleware.RequireAuth())
+	{
+		entities.GET("/:type/:id/chapters", handler.ListEntityChapters)
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountEntityMentions(t *testing.T) {
+	content := "林风拔剑，林风儿在一旁观战。阿风！"
+	counts := countEntityMentions(content, [][]string{{"林风", "阿风", "风"}, {"林风儿"}})
+	assert.Equal(t, []int{2, 1}, counts)
+}
+
+func TestChapterEntities(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	useSingleConnection(t, h.db)
+	require.NoError(t, h.db.AutoMigrate(&models.Novel{}, &models.Chapter{}, &models.ChapterRevision{}, &models.Character{},
+		&models.PlotPoint{}, &models.NovelSetting{}, &models.Storyline{}, &models.StoryNode{}, &models.ChapterEntity{}))
+
+	novel := models.Novel{Title: "剑来"}
+	require.NoError(t, h.db.Create(&novel).Error)
+	linFeng := models.Character{NovelID: novel.ID, Name: "林风", Aliases: "阿风、风少"}
+	suYao := models.Character{NovelID: novel.ID, Name: "苏瑶"}
+	zhaoHu := models.Character{NovelID: novel.ID, Name: "赵虎"}
+	require.NoError(t, h.db.Create(&[]*models.Character{&linFeng, &suYao, &zhaoHu}).Error)
+	require.NoError(t, h.db.Create(&models.PlotPoint{NovelID: novel.ID, Title: "擂台比武"}).Error)
+	require.NoError(t, h.db.Create(&models.PlotPoint{NovelID: novel.ID, Title: "秘境开启", Status: models.PlotPointStatusDraft}).Error)
+	require.NoError(t, h.db.Create(&models.NovelSetting{NovelID: int(novel.ID), Category: models.SettingCategoryLocation, Title: "青云山"}).Error)
+	require.NoError(t, h.db.Create(&models.NovelSetting{NovelID: int(novel.ID), Category: models.SettingCategoryPower, Title: "筑基"}).Error)
+	chapter := models.Chapter{NovelID: novel.ID, Title: "擂台", Order: 1}
+	require.NoError(t, h.db.Create(&chapter).Error)
+
+	// 保存内容时按名称和别名匹配，作者填写的角色即使没有出现也记录
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	content := "林风登上青云山。“阿风！”苏瑶喊道。擂台比武开始，林风施展筑基剑诀，秘境开启在即。"
+	before := chapter
+	require.NoError(t, h.db.Model(&chapter).Updates(map[string]any{"content": content, "character_ids": fmt.Sprint(zhaoHu.ID)}).Error)
+	recordChapterEdit(h.db, nil, c, &before)
+	entities, err := models.ListChapterEntities(h.db, chapter.ID)
+	require.NoError(t, err)
+	mentions := map[string]int{}
+	sources := map[string]string{}
+	for _, e := range entities {
+		mentions[e.Name] = e.Mentions
+		sources[e.Name] = e.Source
+	}
+	assert.Equal(t, map[string]int{"林风": 3, "苏瑶": 1, "赵虎": 0, "擂台比武": 1, "青云山": 1, "筑基": 1}, mentions)
+	assert.Equal(t, models.ChapterEntitySourceManual, sources["赵虎"])
+	assert.Equal(t, models.ChapterEntitySourceMatch, sources["林风"])
+
+	perform := newRouteTester(func(r *gin.RouterGroup) { RegisterChapterEntityRoutes(r, h.db) })
+	w := perform(http.MethodGet, fmt.Sprintf("/chapters/%d/entities?type=location", chapter.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(mustData(t, w), &entities))
+	require.Len(t, entities, 1)
+	assert.Equal(t, "青云山", entities[0].Name)
+	assert.Equal(t, http.StatusBadRequest, perform(http.MethodGet, "/entities/monster/1/chapters", nil).Code)
+
+	// 开启 AI 确认后，未确认的匹配结果被丢弃，作者填写的保留
+	require.NoError(t, h.db.Model(&novel).Update("confirm_entities_with_ai", true).Error)
+	mock.Script(llm.PromptEntityConfirm, llm.MockResponse{Content: `{"confirmed":[1,3,4,9]}`})
+	next := models.Chapter{NovelID: novel.ID, Title: "夜谈", Order: 2}
+	require.NoError(t, h.db.Create(&next).Error)
+	before = next
+	require.NoError(t, h.db.Model(&next).Updates(map[string]any{"content": content, "character_ids": fmt.Sprint(zhaoHu.ID)}).Error)
+	recordChapterEdit(h.db, &ChapterRunners{entities: h.entities}, c, &before)
+	h.entities.wait()
+
+	requests := mock.Requests()
+	require.Len(t, requests, 1)
+	prompt := requests[0].Messages[len(requests[0].Messages)-1].Content
+	assert.Contains(t, prompt, "1. [角色] 林风（别名：阿风、风少）")
+	assert.Contains(t, prompt, "4. [地点] 青云山")
+	assert.NotContains(t, prompt, "赵虎")
+	entities, err = models.ListChapterEntities(h.db, next.ID)
+	require.NoError(t, err)
+	sources = map[string]string{}
+	for _, e := range entities {
+		sources[e.Name] = e.Source
+	}
+	assert.Equal(t, map[string]string{"林风": "ai", "赵虎": "manual", "擂台比武": "ai", "青云山": "ai"}, sources)
+
+	// 实体出现的章节按章节顺序排列
+	w = perform(http.MethodGet, fmt.Sprintf("/entities/character/%d/chapters", linFeng.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var appearances struct {
+		Chapters      []models.EntityChapter `json:"chapters"`
+		TotalMentions int                    `json:"totalMentions"`
+	}
+	require.NoError(t, json.Unmarshal(mustData(t, w), &appearances))
+	require.Len(t, appearances.Chapters, 2)
+	assert.Equal(t, chapter.ID, appearances.Chapters[0].ChapterID)
+	assert.Equal(t, 6, appearances.TotalMentions)
+
+	// 手动提取可以跳过 AI 确认
+	confirm := false
+	w = performAIRequest(h.ExtractChapterEntities, ExtractEntitiesRequest{ChapterID: next.ID, Confirm: &confirm})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(mustData(t, w), &entities))
+	assert.Len(t, entities, 6)
+	assert.Len(t, mock.Requests(), 1)
+
+	require.NoError(t, models.DeleteEntityLinks(h.db, suYao.ID, models.ChapterEntityCharacter))
+	chapters, err := models.ListEntityChapters(h.db, models.ChapterEntityCharacter, suYao.ID)
+	require.NoError(t, err)
+	assert.Empty(t, chapters)
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/LingByte/LingDialog/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 版本对比方式
+const (
+	revisionDiffLine      = "line"      // 按行对比
+	revisionDiffParagraph = "paragraph" // 按段落对比，忽略空行和首尾空白
+)
+
+// ChapterRevisionHandler 章节版本处理器
+type ChapterRevisionHandler struct {
+	db      *gorm.DB
+	runners *ChapterRunners
+}
+
+// NewChapterRevisionHandler 创建章节版本处理器，runners 用于恢复版本后的后续处理
+func NewChapterRevisionHandler(db *gorm.DB, runners *ChapterRunners) *ChapterRevisionHandler {
+	return &ChapterRevisionHandler{
+		db:      db,
+		runners: runners,
+	}
+}
+
+// ChapterRunners 章节保存后在后台确认实体、检查连续性和汇总摘要的执行器，由 AI 处理器创建；
+// 为 nil 或其中的执行器为空时，对应的处理只做同步部分或跳过
+type ChapterRunners struct {
+	entities   *entityRunner
+	continuity *continuityRunner
+	summaries  *summaryRunner
+}
+
+// currentUserID 返回当前登录用户ID，未登录时为 0
+func currentUserID(c *gin.Context) uint {
+	if user := middleware.GetCurrentUser(c); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// recordChapterEdit 通用编辑接口保存章节成功后记录修改后的版本，before 为保存前的章节
+// 重新读取保存后的章节，只有标题、内容、大纲或摘要变化时才记录；记录失败不影响编辑。之后按修改的字段执行 onChapterSaved
+func recordChapterEdit(db *gorm.DB, runners *ChapterRunners, c *gin.Context, before *models.Chapter) {
+	var after models.Chapter
+	if err := db.First(&after, before.ID).Error; err != nil {
+		logger.Error("获取保存后的章节失败", zap.Uint("chapterId", before.ID), zap.Error(err))
+		return
+	}
+	changed := after.Title != before.Title || after.Content != before.Content ||
+		after.Outline != before.Outline || after.Summary != before.Summary
+	linked := after.CharacterIDs != before.CharacterIDs || after.PlotPointIDs != before.PlotPointIDs
+	moved := after.VolumeID != before.VolumeID || after.Order != before.Order
+	if changed {
+		if _, err := models.RecordChapterRevision(db, before, &after, models.ChapterRevisionSourceManual, currentUserID(c), ""); err != nil {
+			logger.Error("记录章节版本失败", zap.Uint("chapterId", before.ID), zap.Error(err))
+		}
+	}
+	if changed || linked || moved {
+		onChapterSaved(db, runners, currentUserID(c), before, &after)
+	}
+}
+
+// onChapterSaved 章节保存后的后续处理，before、after 为保存前后的章节：内容、参与角色或涉及情节变化时提取章节实体；
+// 内容变化时记录生成结果中待记录的伏笔，并按小说设置自动检查连续性；同时更新章节摘要、卷摘要和全书梗概的待更新标记
+func onChapterSaved(db *gorm.DB, runners *ChapterRunners, userID uint, before, after *models.Chapter) {
+	if runners == nil {
+		runners = &ChapterRunners{}
+	}
+	if after.Content != before.Content || after.CharacterIDs != before.CharacterIDs || after.PlotPointIDs != before.PlotPointIDs {
+		extractChapterEntities(db, runners.entities, userID, after)
+	}
+	if after.Content != before.Content {
+		if err := models.ApplyPendingForeshadowing(db, after.ID); err != nil {
+			logger.Error("记录伏笔失败", zap.Uint("chapterId", after.ID), zap.Error(err))
+		}
+		scheduleContinuityCheck(db, runners.continuity, userID, after)
+	}
+	markChapterSummaries(db, runners.summaries, userID, before, after)
+}
+
+// parseChapterRevisionIDs 解析路径中的章节ID和版本ID（版本ID不存在时为 0）
+func parseChapterRevisionIDs(c *gin.Context) (chapterID, revisionID uint, ok bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的章节ID",
+		})
+		return 0, 0, false
+	}
+	if c.Param("revisionId") == "" {
+		return uint(id), 0, true
+	}
+	rid, err := strconv.ParseUint(c.Param("revisionId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的版本ID",
+		})
+		return 0, 0, false
+	}
+	return uint(id), uint(rid), true
+}
+
+// loadRevision 获取章节的指定版本，不存在时返回 404
+func (h *ChapterRevisionHandler) loadRevision(c *gin.Context, chapterID, revisionID uint) (*models.ChapterRevision, bool) {
+	revision, err := models.GetChapterRevision(h.db, chapterID, revisionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "版本不存在",
+			})
+		} else {
+			logger.Error("获取章节版本失败", zap.Uint("revisionId", revisionID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "获取章节版本失败",
+			})
+		}
+		return nil, false
+	}
+	return revision, true
+}
+
+// loadChapter 获取章节，不存在时返回 404
+func (h *ChapterRevisionHandler) loadChapter(c *gin.Context, chapterID uint) (*models.Chapter, bool) {
+	var chapter models.Chapter
+	if err := h.db.First(&chapter, chapterID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "章节不存在",
+			})
+		} else {
+			logger.Error("获取章节失败", zap.Uint("chapterId", chapterID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "获取章节失败",
+			})
+		}
+		return nil, false
+	}
+	return &chapter, true
+}
+
+// ListChapterRevisions 获取章节版本列表
+// @Summary 获取章节版本列表
+// @Description 按版本号倒序列出章节的历史版本，列表不含正文
+// @Tags Chapters
+// @Produce json
+// @Param id path int true "章节ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/chapters/{id}/revisions [get]
+func (h *ChapterRevisionHandler) ListChapterRevisions(c *gin.Context) {
+	chapterID, _, ok := parseChapterRevisionIDs(c)
+	if !ok {
+		return
+	}
+
+	revisions, err := models.ListChapterRevisions(h.db, chapterID)
+	if err != nil {
+		logger.Error("获取章节版本列表失败", zap.Uint("chapterId", chapterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取章节版本列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": revisions,
+	})
+}
+
+// GetChapterRevision 获取章节版本详情
+// @Summary 获取章节版本详情
+// @Description 获取章节指定版本的标题、内容、大纲和摘要
+// @Tags Chapters
+// @Produce json
+// @Param id path int true "章节ID"
+// @Param revisionId path int true "版本ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/chapters/{id}/revisions/{revisionId} [get]
+func (h *ChapterRevisionHandler) GetChapterRevision(c *gin.Context) {
+	chapterID, revisionID, ok := parseChapterRevisionIDs(c)
+	if !ok {
+		return
+	}
+	revision, ok := h.loadRevision(c, chapterID, revisionID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": revision,
+	})
+}
+
+// ChapterRevisionDiffRequest 版本对比请求
+type ChapterRevisionDiffRequest struct {
+	From uint   `form:"from" binding:"required"` // 旧版本ID
+	To   uint   `form:"to"`                      // 新版本ID，为空时与章节当前内容对比
+	Mode string `form:"mode,default=paragraph"`  // 对比方式：line / paragraph
+}
+
+// ChapterRevisionDiff 版本对比结果
+type ChapterRevisionDiff struct {
+	From         *models.ChapterRevision `json:"from"`
+	To           *models.ChapterRevision `json:"to"` // 与当前内容对比时为空
+	Mode         string                  `json:"mode"`
+	TitleChanged bool                    `json:"titleChanged"`
+	Title        []utils.DiffLine        `json:"title"`
+	Content      []utils.DiffLine        `json:"content"`
+	Outline      []utils.DiffLine        `json:"outline"`
+	Summary      []utils.DiffLine        `json:"summary"`
+	Added        int                     `json:"added"`   // 内容新增的行（段落）数
+	Removed      int                     `json:"removed"` // 内容删除的行（段落）数
+}
+
+// DiffChapterRevisions 对比章节版本
+// @Summary 对比章节版本
+// @Description 按行或段落对比两个版本的标题、内容、大纲和摘要，不指定 to 时与章节当前内容对比
+// @Tags Chapters
+// @Produce json
+// @Param id path int true "章节ID"
+// @Param from query int true "旧版本ID"
+// @Param to query int false "新版本ID"
+// @Param mode query string false "对比方式(line/paragraph)" default(paragraph)
+// @Success 200 {object} map[string]interface{}
+// @Router /api/chapters/{id}/revisions/diff [get]
+func (h *ChapterRevisionHandler) DiffChapterRevisions(c *gin.Context) {
+	chapterID, _, ok := parseChapterRevisionIDs(c)
+	if !ok {
+		return
+	}
+	var req ChapterRevisionDiffRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	split := utils.SplitParagraphs
+	switch req.Mode {
+	case revisionDiffParagraph:
+	case revisionDiffLine:
+		split = utils.SplitLines
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "不支持的对比方式: " + req.Mode,
+		})
+		return
+	}
+
+	from, ok := h.loadRevision(c, chapterID, req.From)
+	if !ok {
+		return
+	}
+	var to *models.ChapterRevision
+	var target models.Chapter
+	if req.To != 0 {
+		if to, ok = h.loadRevision(c, chapterID, req.To); !ok {
+			return
+		}
+		to.Apply(&target)
+	} else {
+		chapter, ok := h.loadChapter(c, chapterID)
+		if !ok {
+			return
+		}
+		target = *chapter
+	}
+
+	diff := ChapterRevisionDiff{
+		From:         from,
+		To:           to,
+		Mode:         req.Mode,
+		TitleChanged: from.Title != target.Title,
+		Title:        utils.DiffLines(utils.SplitLines(from.Title), utils.SplitLines(target.Title)),
+		Content:      utils.DiffLines(split(from.Content), split(target.Content)),
+		Outline:      utils.DiffLines(split(from.Outline), split(target.Outline)),
+		Summary:      utils.DiffLines(split(from.Summary), split(target.Summary)),
+	}
+	for _, line := range diff.Content {
+		switch line.Op {
+		case utils.DiffInsert:
+			diff.Added++
+		case utils.DiffDelete:
+			diff.Removed++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "对比成功",
+		"data": diff,
+	})
+}
+
+// RestoreChapterRevision 恢复章节版本
+// @Summary 恢复章节版本
+// @Description 用指定版本的标题、内容、大纲和摘要覆盖章节，并记录为新版本，恢复前的内容仍可在历史中找回
+// @Tags Chapters
+// @Produce json
+// @Param id path int true "章节ID"
+// @Param revisionId path int true "版本ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/chapters/{id}/revisions/{revisionId}/restore [post]
+func (h *ChapterRevisionHandler) RestoreChapterRevision(c *gin.Context) {
+	chapterID, revisionID, ok := parseChapterRevisionIDs(c)
+	if !ok {
+		return
+	}
+	revision, ok := h.loadRevision(c, chapterID, revisionID)
+	if !ok {
+		return
+	}
+	chapter, ok := h.loadChapter(c, chapterID)
+	if !ok {
+		return
+	}
+
+	restored := *chapter
+	revision.Apply(&restored)
+	note := fmt.Sprintf("恢复自版本 %d", revision.Version)
+	saved, err := models.UpdateChapterContent(h.db, chapter, &restored, models.ChapterRevisionSourceRestore, currentUserID(c), note)
+	if err != nil {
+		logger.Error("恢复章节版本失败",
+			zap.Uint("chapterId", chapterID),
+			zap.Uint("revisionId", revisionID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "恢复章节版本失败",
+		})
+		return
+	}
+	onChapterSaved(h.db, h.runners, currentUserID(c), chapter, &restored)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "恢复成功",
+		"data": gin.H{
+			"chapter":  restored,
+			"revision": saved, // 内容与当前一致时为空
+		},
+	})
+}
+
+// RegisterChapterRevisionRoutes 注册章节版本相关路由
+func RegisterChapterRevisionRoutes(r *gin.RouterGroup, db *gorm.DB, runners *ChapterRunners) {
+	handler := NewChapterRevisionHandler(db, runners)
+
+	revisions := r.Group("/chapters/:id/revisions")
+	revisions.Use(middleware.RequireAuth())
+	{
+		revisions.GET("", handler.ListChapterRevisions)
+		revisions.GET("/diff", handler.DiffChapterRevisions)
+		revisions.GET("/:revisionId", handler.GetChapterRevision)
+		revisions.POST("/:revisionId/restore", handler.RestoreChapterRevision)
+	}
+}
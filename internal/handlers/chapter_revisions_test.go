@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// performRevisionRequest 调用章节版本处理函数
+func performRevisionRequest(handler gin.HandlerFunc, params gin.Params, query string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = params
+	c.Request = httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	handler(c)
+	return w
+}
+
+func TestChapterRevisions(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&models.Chapter{}, &models.ChapterRevision{}))
+	revisions := NewChapterRevisionHandler(h.db, nil)
+
+	chapter := models.Chapter{NovelID: 1, Title: "第一章", Content: "手写的开头。\n第二段。"}
+	require.NoError(t, h.db.Create(&chapter).Error)
+
+	// 通用编辑保存后：先记录编辑前的内容，再记录编辑后的版本；只改状态不记录
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	require.NoError(t, h.db.Model(&models.Chapter{}).Where("id = ?", chapter.ID).Update("status", "draft").Error)
+	recordChapterEdit(h.db, nil, c, &chapter)
+	require.NoError(t, h.db.First(&chapter, chapter.ID).Error)
+	before := chapter
+	edited := chapter
+	edited.Content = "手写的开头。\n修改后的第二段。"
+	require.NoError(t, h.db.Model(&chapter).Update("content", edited.Content).Error)
+	recordChapterEdit(h.db, nil, c, &before)
+
+	// AI 优化只替换章节中的原文
+	mock.Script(llm.PromptChapterRefine, llm.MockResponse{Content: "润色后的第二段。"})
+	w := performAIRequest(h.RefineChapterContent, RefineChapterContentRequest{
+		Title: "第一章", OriginalContent: "修改后的第二段。", Feedback: "润色", ChapterID: chapter.ID,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "saveError")
+	require.NoError(t, h.db.First(&chapter, chapter.ID).Error)
+	assert.Equal(t, "手写的开头。\n润色后的第二段。", chapter.Content)
+
+	// 原文已不在章节中时不保存
+	w = performAIRequest(h.RefineChapterContent, RefineChapterContentRequest{
+		Title: "第一章", OriginalContent: "不存在的段落", Feedback: "润色", ChapterID: chapter.ID,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "saveError")
+
+	params := gin.Params{{Key: "id", Value: fmt.Sprint(chapter.ID)}}
+	w = performRevisionRequest(revisions.ListChapterRevisions, params, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var list struct {
+		Data []models.ChapterRevision `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Data, 3)
+	assert.Equal(t, models.ChapterRevisionSourceAIRefine, list.Data[0].Source)
+	assert.Equal(t, uint(1), list.Data[0].AuthorID)
+	assert.Equal(t, models.ChapterRevisionSourceManual, list.Data[1].Source)
+	assert.Equal(t, models.ChapterRevisionSourceImport, list.Data[2].Source)
+	assert.Empty(t, list.Data[0].Content)
+	original, refined := list.Data[2], list.Data[0]
+
+	// 按段落对比最初版本和当前内容
+	w = performRevisionRequest(revisions.DiffChapterRevisions, params, fmt.Sprintf("from=%d", original.ID))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var diff struct {
+		Data ChapterRevisionDiff `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, []utils.DiffLine{
+		{Op: utils.DiffEqual, Text: "手写的开头。"},
+		{Op: utils.DiffDelete, Text: "第二段。"},
+		{Op: utils.DiffInsert, Text: "润色后的第二段。"},
+	}, diff.Data.Content)
+	assert.Equal(t, 1, diff.Data.Added)
+	assert.False(t, diff.Data.TitleChanged)
+
+	w = performRevisionRequest(revisions.DiffChapterRevisions, params, fmt.Sprintf("from=%d&to=%d&mode=word", original.ID, refined.ID))
+	require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	// 恢复最初版本，恢复操作本身也成为新版本
+	restoreParams := append(params, gin.Param{Key: "revisionId", Value: fmt.Sprint(original.ID)})
+	w = performRevisionRequest(revisions.RestoreChapterRevision, restoreParams, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, h.db.First(&chapter, chapter.ID).Error)
+	assert.Equal(t, "手写的开头。\n第二段。", chapter.Content)
+
+	var latest models.ChapterRevision
+	require.NoError(t, h.db.Where("chapter_id = ?", chapter.ID).Order("version DESC").First(&latest).Error)
+	assert.Equal(t, 4, latest.Version)
+	assert.Equal(t, models.ChapterRevisionSourceRestore, latest.Source)
+	assert.True(t, strings.HasSuffix(latest.Note, fmt.Sprint(original.Version)))
+
+	w = performRevisionRequest(revisions.GetChapterRevision, gin.Params{
+		{Key: "id", Value: fmt.Sprint(chapter.ID)}, {Key: "revisionId", Value: "999"},
+	}, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
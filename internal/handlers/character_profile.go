@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// characterProfile 将角色转换为结构化角色档案，自定义属性无法解析时忽略
+func characterProfile(c *models.Character) llm.CharacterProfile {
+	attrs, _ := models.ParseCharacterAttributes(c.Attributes)
+	aliases := models.SplitAliases(c.Aliases)
+	for i := range aliases {
+		aliases[i] = strings.TrimSpace(aliases[i])
+	}
+	return llm.CharacterProfile{
+		Name:        c.Name,
+		Aliases:     aliases,
+		Role:        c.Role,
+		Gender:      c.Gender,
+		Age:         c.Age,
+		Description: c.Description,
+		Appearance:  c.Appearance,
+		Personality: c.Personality,
+		Background:  c.Background,
+		Goals:       c.Goals,
+		Abilities:   c.Abilities,
+		PowerLevel:  c.PowerLevel,
+		Faction:     c.Faction,
+		Status:      c.Status,
+		Attributes:  attrs,
+	}
+}
+
+// applyCharacterProfile 用结构化档案覆盖角色的档案字段（不修改小说和首次出场章节）
+func applyCharacterProfile(c *models.Character, profile llm.CharacterProfile) {
+	profile.Normalize()
+	c.Name = profile.Name
+	c.Aliases = strings.Join(profile.Aliases, ",")
+	c.Role = profile.Role
+	c.Gender = profile.Gender
+	c.Age = profile.Age
+	c.Description = profile.Description
+	c.Appearance = profile.Appearance
+	c.Personality = profile.Personality
+	c.Background = profile.Background
+	c.Goals = profile.Goals
+	c.Abilities = profile.Abilities
+	c.PowerLevel = profile.PowerLevel
+	c.Faction = profile.Faction
+	c.Status = profile.Status
+	c.Attributes = ""
+	if len(profile.Attributes) > 0 {
+		data, _ := json.Marshal(profile.Attributes)
+		c.Attributes = string(data)
+	}
+}
+
+// MigrateCharacterProfiles 将只有整段描述的旧角色按标签拆分为结构化档案
+// 只处理档案字段全部为空且未检查过的角色，检查后标记，之后启动时不再处理
+func MigrateCharacterProfiles(db *gorm.DB) error {
+	var characters []models.Character
+	err := db.Where("profile_migrated = ? AND description <> '' AND COALESCE(appearance, '') = '' "+
+		"AND COALESCE(personality, '') = '' AND COALESCE(background, '') = '' AND COALESCE(goals, '') = '' "+
+		"AND COALESCE(abilities, '') = ''", false).
+		Find(&characters).Error
+	if err != nil {
+		return err
+	}
+
+	var skipped []uint
+	migrated := 0
+	for i := range characters {
+		character := &characters[i]
+		profile := llm.ParseCharacterDescription(character.Name, character.Description)
+		if profile.Description == character.Description {
+			skipped = append(skipped, character.ID) // 没有可识别的标签
+			continue
+		}
+		profile.Status = character.Status
+		applyCharacterProfile(character, profile)
+		character.ProfileMigrated = true
+		if err := db.Select("aliases", "role", "gender", "age", "description", "appearance", "personality",
+			"background", "goals", "abilities", "power_level", "faction", "status", "attributes", "profile_migrated").
+			Updates(character).Error; err != nil {
+			return err
+		}
+		migrated++
+	}
+	if len(skipped) > 0 {
+		if err := db.Model(&models.Character{}).Where("id IN ?", skipped).Update("profile_migrated", true).Error; err != nil {
+			return err
+		}
+	}
+	if migrated > 0 {
+		logger.Info("角色描述已迁移为结构化档案", zap.Int("count", migrated))
+	}
+	return nil
+}
@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// CharacterRelationshipHandler 角色关系处理器
+type CharacterRelationshipHandler struct {
+	db *gorm.DB
+}
+
+// NewCharacterRelationshipHandler 创建角色关系处理器
+func NewCharacterRelationshipHandler(db *gorm.DB) *CharacterRelationshipHandler {
+	return &CharacterRelationshipHandler{
+		db: db,
+	}
+}
+
+// validateCharacterRelationship 校验并规范化角色关系：类型、强度、章节范围，以及两端角色都属于该小说
+func validateCharacterRelationship(db *gorm.DB, r *models.CharacterRelationship) error {
+	if !llm.IsValidRelationshipType(r.Type) {
+		return fmt.Errorf("无效的关系类型: %s", r.Type)
+	}
+	if r.Type == llm.RelationshipCustom && r.Label == "" {
+		return errors.New("自定义关系必须填写关系名称")
+	}
+	if r.Intensity < 0 || r.Intensity > 10 {
+		return errors.New("关系强度必须在 1-10 之间")
+	}
+	if r.Intensity == 0 {
+		r.Intensity = llm.DefaultRelationshipIntensity
+	}
+	if r.ValidFromChapter < 0 || r.ValidToChapter < 0 {
+		return errors.New("章节序号不能为负数")
+	}
+	if r.ValidToChapter > 0 && r.ValidToChapter < r.ValidFromChapter {
+		return errors.New("结束章节不能早于开始章节")
+	}
+	if r.FromCharacterID == 0 || r.ToCharacterID == 0 {
+		return errors.New("缺少关系两端的角色")
+	}
+	if r.FromCharacterID == r.ToCharacterID {
+		return errors.New("角色不能与自己建立关系")
+	}
+	var count int64
+	if err := db.Model(&models.Character{}).
+		Where("id IN ? AND novel_id = ?", []uint{r.FromCharacterID, r.ToCharacterID}, r.NovelID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count != 2 {
+		return errors.New("角色不存在或不属于该小说")
+	}
+	return nil
+}
+
+// loadRelationship 获取角色关系，不存在时返回 404
+func (h *CharacterRelationshipHandler) loadRelationship(c *gin.Context) (*models.CharacterRelationship, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的关系ID",
+		})
+		return nil, false
+	}
+	var relationship models.CharacterRelationship
+	if err := h.db.First(&relationship, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "关系不存在",
+			})
+		} else {
+			logger.Error("获取角色关系失败", zap.Uint64("id", id), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "获取角色关系失败",
+			})
+		}
+		return nil, false
+	}
+	return &relationship, true
+}
+
+// CharacterRelationshipQuery 角色关系查询参数
+type CharacterRelationshipQuery struct {
+	AsOfChapter      int  `form:"asOfChapter"`      // 章节序号，大于 0 时只返回该章节时存在的关系
+	CharacterID      uint `form:"characterId"`      // 只返回与该角色相关的关系
+	IncludeSuggested bool `form:"includeSuggested"` // 是否包含待确认的 AI 建议
+}
+
+// bindRelationshipQuery 解析路径中的小说ID和查询参数
+func bindRelationshipQuery(c *gin.Context) (uint, CharacterRelationshipQuery, bool) {
+	var query CharacterRelationshipQuery
+	novelID, err := strconv.ParseUint(c.Param("novelId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的小说ID",
+		})
+		return 0, query, false
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return 0, query, false
+	}
+	return uint(novelID), query, true
+}
+
+// GetCharacterRelationships 获取角色关系列表
+// @Summary 获取角色关系列表
+// @Description 获取小说的角色关系，可按角色和章节过滤，默认不含待确认的 AI 建议
+// @Tags Characters
+// @Produce json
+// @Param novelId path int true "小说ID"
+// @Param characterId query int false "角色ID"
+// @Param asOfChapter query int false "章节序号"
+// @Param includeSuggested query bool false "是否包含 AI 建议"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/character-relationships/{novelId} [get]
+func (h *CharacterRelationshipHandler) GetCharacterRelationships(c *gin.Context) {
+	novelID, query, ok := bindRelationshipQuery(c)
+	if !ok {
+		return
+	}
+
+	relationships, err := models.ListCharacterRelationships(h.db, novelID, query.AsOfChapter, query.IncludeSuggested)
+	if err != nil {
+		logger.Error("获取角色关系失败", zap.Uint("novelId", novelID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取角色关系失败",
+		})
+		return
+	}
+	if query.CharacterID != 0 {
+		filtered := relationships[:0]
+		for _, r := range relationships {
+			if r.FromCharacterID == query.CharacterID || r.ToCharacterID == query.CharacterID {
+				filtered = append(filtered, r)
+			}
+		}
+		relationships = filtered
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": relationships,
+	})
+}
+
+// RelationshipGraphNode 关系图中的角色节点
+type RelationshipGraphNode struct {
+	ID      uint   `json:"id"`
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+	Faction string `json:"faction"`
+	Status  string `json:"status"`
+}
+
+// RelationshipGraphEdge 关系图中的关系边，单向关系由 source 指向 target
+type RelationshipGraphEdge struct {
+	ID               uint   `json:"id"`
+	Source           uint   `json:"source"`
+	Target           uint   `json:"target"`
+	Type             string `json:"type"`
+	TypeLabel        string `json:"typeLabel"` // 关系类型的中文名称
+	Label            string `json:"label"`
+	Description      string `json:"description"`
+	Intensity        int    `json:"intensity"`
+	Directional      bool   `json:"directional"`
+	ValidFromChapter int    `json:"validFromChapter"`
+	ValidToChapter   int    `json:"validToChapter"`
+	Suggested        bool   `json:"suggested"` // 是否为待确认的 AI 建议
+}
+
+// RelationshipGraph 角色关系图
+type RelationshipGraph struct {
+	Nodes []RelationshipGraphNode `json:"nodes"`
+	Edges []RelationshipGraphEdge `json:"edges"`
+}
+
+// GetRelationshipGraph 获取角色关系图
+// @Summary 获取角色关系图
+// @Description 以节点和边的形式返回小说的角色关系；指定 asOfChapter 时只包含该章节前已出场的角色和当时存在的关系
+// @Tags Characters
+// @Produce json
+// @Param novelId path int true "小说ID"
+// @Param asOfChapter query int false "章节序号"
+// @Param includeSuggested query bool false "是否包含 AI 建议"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/character-relationships/{novelId}/graph [get]
+func (h *CharacterRelationshipHandler) GetRelationshipGraph(c *gin.Context) {
+	novelID, query, ok := bindRelationshipQuery(c)
+	if !ok {
+		return
+	}
+
+	graph, err := buildRelationshipGraph(h.db, novelID, query.AsOfChapter, query.IncludeSuggested)
+	if err != nil {
+		logger.Error("获取角色关系图失败", zap.Uint("novelId", novelID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取角色关系图失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": graph,
+	})
+}
+
+// buildRelationshipGraph 构建角色关系图，两端角色都在图中的关系才作为边
+func buildRelationshipGraph(db *gorm.DB, novelID uint, asOfChapter int, includeSuggested bool) (*RelationshipGraph, error) {
+	var characters []models.Character
+	if err := db.Where("novel_id = ?", novelID).Order("id ASC").Find(&characters).Error; err != nil {
+		return nil, err
+	}
+
+	// 指定章节时排除之后才首次出场的角色
+	var firstOrders map[uint]int
+	if asOfChapter > 0 {
+		var chapters []models.Chapter
+		if err := db.Select("id", "order").Where("novel_id = ?", novelID).Find(&chapters).Error; err != nil {
+			return nil, err
+		}
+		firstOrders = make(map[uint]int, len(chapters))
+		for _, chapter := range chapters {
+			firstOrders[chapter.ID] = chapter.Order
+		}
+	}
+
+	graph := &RelationshipGraph{
+		Nodes: []RelationshipGraphNode{},
+		Edges: []RelationshipGraphEdge{},
+	}
+	inGraph := make(map[uint]bool, len(characters))
+	for _, character := range characters {
+		if order, ok := firstOrders[character.FirstChapterID]; ok && order > asOfChapter {
+			continue
+		}
+		inGraph[character.ID] = true
+		graph.Nodes = append(graph.Nodes, RelationshipGraphNode{
+			ID:      character.ID,
+			Name:    character.Name,
+			Role:    character.Role,
+			Faction: character.Faction,
+			Status:  character.Status,
+		})
+	}
+
+	relationships, err := models.ListCharacterRelationships(db, novelID, asOfChapter, includeSuggested)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range relationships {
+		if !inGraph[r.FromCharacterID] || !inGraph[r.ToCharacterID] {
+			continue
+		}
+		graph.Edges = append(graph.Edges, RelationshipGraphEdge{
+			ID:               r.ID,
+			Source:           r.FromCharacterID,
+			Target:           r.ToCharacterID,
+			Type:             r.Type,
+			TypeLabel:        llm.RelationshipTypeLabel(r.Type),
+			Label:            r.Label,
+			Description:      r.Description,
+			Intensity:        r.Intensity,
+			Directional:      r.Directional,
+			ValidFromChapter: r.ValidFromChapter,
+			ValidToChapter:   r.ValidToChapter,
+			Suggested:        r.Status == models.CharacterRelationshipStatusSuggested,
+		})
+	}
+	return graph, nil
+}
+
+// CreateCharacterRelationship 创建角色关系
+// @Summary 创建角色关系
+// @Description 创建角色关系，两端角色必须属于同一小说
+// @Tags Characters
+// @Accept json
+// @Produce json
+// @Param request body models.CharacterRelationship true "关系信息"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/character-relationships [post]
+func (h *CharacterRelationshipHandler) CreateCharacterRelationship(c *gin.Context) {
+	var relationship models.CharacterRelationship
+	if err := c.ShouldBindJSON(&relationship); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	relationship.ID = 0
+	relationship.Status = "" // 手动创建的关系直接生效
+	if err := validateCharacterRelationship(h.db, &relationship); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	if err := h.db.Create(&relationship).Error; err != nil {
+		logger.Error("创建角色关系失败", zap.Uint("novelId", relationship.NovelID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "创建角色关系失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "创建成功",
+		"data": relationship,
+	})
+}
+
+// UpdateCharacterRelationship 更新角色关系
+// @Summary 更新角色关系
+// @Description 更新角色关系，只修改请求中出现的字段；所属小说和确认状态不可修改
+// @Tags Characters
+// @Accept json
+// @Produce json
+// @Param id path int true "关系ID"
+// @Param request body models.CharacterRelationship true "关系信息"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/character-relationships/{id} [put]
+func (h *CharacterRelationshipHandler) UpdateCharacterRelationship(c *gin.Context) {
+	relationship, ok := h.loadRelationship(c)
+	if !ok {
+		return
+	}
+	id, novelID, status := relationship.ID, relationship.NovelID, relationship.Status
+	if err := c.ShouldBindJSON(relationship); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	relationship.ID, relationship.NovelID, relationship.Status = id, novelID, status
+	if err := validateCharacterRelationship(h.db, relationship); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	if err := h.db.Save(relationship).Error; err != nil {
+		logger.Error("更新角色关系失败", zap.Uint("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "更新角色关系失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "更新成功",
+		"data": relationship,
+	})
+}
+
+// AcceptCharacterRelationship 确认 AI 建议的角色关系
+// @Summary 确认角色关系建议
+// @Description 将 AI 建议的角色关系确认为正式关系
+// @Tags Characters
+// @Produce json
+// @Param id path int true "关系ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/character-relationships/{id}/accept [post]
+func (h *CharacterRelationshipHandler) AcceptCharacterRelationship(c *gin.Context) {
+	relationship, ok := h.loadRelationship(c)
+	if !ok {
+		return
+	}
+	if relationship.Status != models.CharacterRelationshipStatusSuggested {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "该关系不是待确认的建议",
+		})
+		return
+	}
+
+	if err := h.db.Model(relationship).Update("status", "").Error; err != nil {
+		logger.Error("确认角色关系失败", zap.Uint("id", relationship.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "确认角色关系失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "确认成功",
+		"data": relationship,
+	})
+}
+
+// DeleteCharacterRelationship 删除角色关系
+// @Summary 删除角色关系
+// @Description 删除角色关系，也用于拒绝 AI 建议
+// @Tags Characters
+// @Produce json
+// @Param id path int true "关系ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/character-relationships/{id} [delete]
+func (h *CharacterRelationshipHandler) DeleteCharacterRelationship(c *gin.Context) {
+	relationship, ok := h.loadRelationship(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(relationship).Error; err != nil {
+		logger.Error("删除角色关系失败", zap.Uint("id", relationship.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "删除角色关系失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "删除成功",
+	})
+}
+
+// RegisterCharacterRelationshipRoutes 注册角色关系相关路由
+func RegisterCharacterRelationshipRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	handler := NewCharacterRelationshipHandler(db)
+
+	relationships := r.Group("/character-relationships")
+	relationships.Use(middleware.RequireAuth())
+	{
+		relationships.GET("/:novelId", handler.GetCharacterRelationships)
+		relationships.GET("/:novelId/graph", handler.GetRelationshipGraph)
+		relationships.POST("", handler.CreateCharacterRelationship)
+		relationships.PUT("/:id", handler.UpdateCharacterRelationship)
+		relationships.POST("/:id/accept", handler.AcceptCharacterRelationship)
+		relationships.DELETE("/:id", handler.DeleteCharacterRelationship)
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCharacterRelationships(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&models.Novel{}, &models.Chapter{}, &models.Character{}, &models.CharacterRelationship{},
+		&models.Storyline{}, &models.StoryNode{}))
+
+	novel := models.Novel{Title: "剑来"}
+	require.NoError(t, h.db.Create(&novel).Error)
+	chapter := models.Chapter{NovelID: novel.ID, Title: "第五章", Order: 5}
+	require.NoError(t, h.db.Create(&chapter).Error)
+	characters := []models.Character{
+		{NovelID: novel.ID, Name: "林风", Faction: "青云门"},
+		{NovelID: novel.ID, Name: "苏瑶", Faction: "青云门"},
+		{NovelID: novel.ID, Name: "魔尊", FirstChapterID: chapter.ID},
+	}
+	require.NoError(t, h.db.Create(&characters).Error)
+	linFeng, suYao, demon := characters[0].ID, characters[1].ID, characters[2].ID
+
+	perform := newRouteTester(func(r *gin.RouterGroup) { RegisterCharacterRelationshipRoutes(r, h.db) })
+
+	// AI 建议：越界、指向自己和重复的建议被丢弃，其余保存为待确认
+	mock.Script(llm.TaskCharacterRelationships, llm.MockResponse{Content: `{"relationships":[
+		{"fromIndex":0,"toIndex":1,"type":"lover","label":"青梅竹马","description":"自幼相识","intensity":12,"directional":false},
+		{"fromIndex":1,"toIndex":0,"type":"lover","description":"重复"},
+		{"fromIndex":2,"toIndex":0,"type":"宿敌","description":"魔尊视林风为眼中钉","directional":true},
+		{"fromIndex":0,"toIndex":0,"type":"ally"},
+		{"fromIndex":0,"toIndex":5,"type":"ally"}
+	]}`})
+	w := performAIRequest(h.SuggestRelationships, SuggestRelationshipsRequest{NovelID: novel.ID})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var suggested struct {
+		Data struct {
+			Relationships []models.CharacterRelationship `json:"relationships"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &suggested))
+	require.Len(t, suggested.Data.Relationships, 2)
+	lover, rival := suggested.Data.Relationships[0], suggested.Data.Relationships[1]
+	assert.Equal(t, models.CharacterRelationshipStatusSuggested, lover.Status)
+	assert.Equal(t, 10, lover.Intensity)
+	assert.Equal(t, llm.RelationshipCustom, rival.Type)
+	assert.Equal(t, "宿敌", rival.Label)
+	assert.Equal(t, demon, rival.FromCharacterID)
+	assert.True(t, rival.Directional)
+
+	// 待确认的建议默认不出现在列表中，确认后出现
+	w = perform(http.MethodGet, fmt.Sprintf("/character-relationships/%d", novel.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `[]`, string(mustData(t, w)))
+	for _, id := range []uint{lover.ID, rival.ID} {
+		w = perform(http.MethodPost, fmt.Sprintf("/character-relationships/%d/accept", id), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	w = perform(http.MethodPost, fmt.Sprintf("/character-relationships/%d/accept", lover.ID), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 手动创建：校验类型、章节范围和角色归属
+	w = perform(http.MethodPost, "/character-relationships", models.CharacterRelationship{
+		NovelID: novel.ID, FromCharacterID: linFeng, ToCharacterID: suYao, Type: llm.RelationshipCustom,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = perform(http.MethodPost, "/character-relationships", models.CharacterRelationship{
+		NovelID: novel.ID + 1, FromCharacterID: linFeng, ToCharacterID: suYao, Type: llm.RelationshipAlly,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = perform(http.MethodPost, "/character-relationships", models.CharacterRelationship{
+		NovelID: novel.ID, FromCharacterID: linFeng, ToCharacterID: suYao, Type: llm.RelationshipAlly,
+		ValidFromChapter: 1, ValidToChapter: 3,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var ally models.CharacterRelationship
+	require.NoError(t, json.Unmarshal(mustData(t, w), &ally))
+	assert.Equal(t, llm.DefaultRelationshipIntensity, ally.Intensity)
+	assert.Empty(t, ally.Status)
+
+	w = perform(http.MethodPut, fmt.Sprintf("/character-relationships/%d", ally.ID), gin.H{"validToChapter": 4, "novelId": 99})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, h.db.First(&ally, ally.ID).Error)
+	assert.Equal(t, 4, ally.ValidToChapter)
+	assert.Equal(t, novel.ID, ally.NovelID)
+
+	// 第 2 章时魔尊尚未出场，同盟关系仍然存在
+	graphAt := func(chapter int) RelationshipGraph {
+		w := perform(http.MethodGet, fmt.Sprintf("/character-relationships/%d/graph?asOfChapter=%d", novel.ID, chapter), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var graph RelationshipGraph
+		require.NoError(t, json.Unmarshal(mustData(t, w), &graph))
+		return graph
+	}
+	graph := graphAt(2)
+	assert.Len(t, graph.Nodes, 2)
+	require.Len(t, graph.Edges, 2)
+	assert.Equal(t, "恋人", graph.Edges[0].TypeLabel)
+
+	// 第 5 章时魔尊出场，同盟关系已结束
+	graph = graphAt(5)
+	assert.Len(t, graph.Nodes, 3)
+	require.Len(t, graph.Edges, 2)
+	assert.Equal(t, rival.ID, graph.Edges[1].ID)
+	assert.Equal(t, linFeng, graph.Edges[1].Target)
+
+	w = perform(http.MethodDelete, fmt.Sprintf("/character-relationships/%d", rival.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Len(t, graphAt(0).Edges, 2)
+}
+
+// mustData 取出响应中的 data 字段
+func mustData(t *testing.T, w *httptest.ResponseRecorder) json.RawMessage {
+	t.Helper()
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Data
+}
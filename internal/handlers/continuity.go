@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ContinuityHandler 章节连续性检查结果处理器
+type ContinuityHandler struct {
+	db *gorm.DB
+}
+
+// NewContinuityHandler 创建连续性检查结果处理器
+func NewContinuityHandler(db *gorm.DB) *ContinuityHandler {
+	return &ContinuityHandler{
+		db: db,
+	}
+}
+
+// parseIDParam 解析路径中的ID参数，无效时返回 400
+func parseIDParam(c *gin.Context, name, msg string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  msg,
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// ListContinuityChecks 获取章节的连续性检查记录
+// @Summary 获取连续性检查记录
+// @Description 获取章节最近的连续性检查记录（最新在前），用于查看检查进度
+// @Tags Chapters
+// @Produce json
+// @Param id path int true "章节ID"
+// @Param limit query int false "返回数量" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Router /api/chapters/{id}/continuity-checks [get]
+func (h *ContinuityHandler) ListContinuityChecks(c *gin.Context) {
+	chapterID, ok := parseIDParam(c, "id", "无效的章节ID")
+	if !ok {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	var checks []models.ContinuityCheck
+	if err := h.db.Where("chapter_id = ?", chapterID).
+		Order("id DESC").Limit(limit).Find(&checks).Error; err != nil {
+		logger.Error("获取连续性检查记录失败", zap.Uint("chapterId", chapterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取连续性检查记录失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": checks,
+	})
+}
+
+// ListChapterIssues 获取章节的连续性问题
+// @Summary 获取章节问题
+// @Description 获取章节的连续性问题，默认只返回待处理的问题，按严重程度排序；status=all 返回全部
+// @Tags Chapters
+// @Produce json
+// @Param id path int true "章节ID"
+// @Param status query string false "状态(open/resolved/dismissed/superseded/all)" default(open)
+// @Success 200 {object} map[string]interface{}
+// @Router /api/chapters/{id}/issues [get]
+func (h *ContinuityHandler) ListChapterIssues(c *gin.Context) {
+	chapterID, ok := parseIDParam(c, "id", "无效的章节ID")
+	if !ok {
+		return
+	}
+
+	query := h.db.Where("chapter_id = ?", chapterID)
+	if status := c.DefaultQuery("status", models.ChapterIssueOpen); status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	var issues []models.ChapterIssue
+	if err := query.Order("CASE severity WHEN 'high' THEN 0 WHEN 'medium' THEN 1 ELSE 2 END, position ASC, id ASC").
+		Find(&issues).Error; err != nil {
+		logger.Error("获取章节问题失败", zap.Uint("chapterId", chapterID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取章节问题失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": issues,
+	})
+}
+
+// UpdateChapterIssueRequest 处理章节问题请求
+type UpdateChapterIssueRequest struct {
+	Status string `json:"status" binding:"required,oneof=open resolved dismissed"` // resolved 已修改，dismissed 不是问题（之后的检查不再报告），open 重新打开
+	Note   string `json:"note" binding:"max=500"`
+}
+
+// UpdateChapterIssue 处理章节问题
+// @Summary 处理章节问题
+// @Description 将问题标记为已修改或忽略，也可以重新打开；忽略的问题会告知之后的检查不再报告
+// @Tags Chapters
+// @Accept json
+// @Produce json
+// @Param id path int true "问题ID"
+// @Param request body UpdateChapterIssueRequest true "处理结果"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/chapter-issues/{id} [put]
+func (h *ContinuityHandler) UpdateChapterIssue(c *gin.Context) {
+	id, ok := parseIDParam(c, "id", "无效的问题ID")
+	if !ok {
+		return
+	}
+	var req UpdateChapterIssueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	var issue models.ChapterIssue
+	if err := h.db.First(&issue, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "问题不存在",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "获取问题失败",
+			})
+		}
+		return
+	}
+
+	issue.Status = req.Status
+	issue.Note = req.Note
+	if req.Status == models.ChapterIssueOpen {
+		issue.ResolvedBy = 0
+		issue.ResolvedAt = nil
+	} else {
+		now := time.Now()
+		issue.ResolvedBy = currentUserID(c)
+		issue.ResolvedAt = &now
+	}
+	if err := h.db.Model(&issue).Select("status", "note", "resolved_by", "resolved_at").Updates(&issue).Error; err != nil {
+		logger.Error("更新章节问题失败", zap.Uint("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "更新章节问题失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "更新成功",
+		"data": issue,
+	})
+}
+
+// RegisterContinuityRoutes 注册连续性检查结果相关路由
+func RegisterContinuityRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	handler := NewContinuityHandler(db)
+
+	chapters := r.Group("/chapters/:id")
+	chapters.Use(middleware.RequireAuth())
+	{
+		chapters.GET("/continuity-checks", handler.ListContinuityChecks)
+		chapters.GET("/issues", handler.ListChapterIssues)
+	}
+
+	issues := r.Group("/chapter-issues")
+	issues.Use(middleware.RequireAuth())
+	{
+		issues.PUT("/:id", handler.UpdateChapterIssue)
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContinuityCheck(t *testing.T) {
+	h, _ := setupMockAIHandler(t)
+	useSingleConnection(t, h.db)
+	require.NoError(t, h.db.AutoMigrate(&models.Novel{}, &models.Chapter{}, &models.ChapterRevision{}, &models.Character{},
+		&models.NovelSetting{}, &models.PlotPoint{}, &models.Storyline{}, &models.StoryNode{}, &models.ContinuityCheck{}, &models.ChapterIssue{},
+		&models.ChapterEntity{}))
+
+	novel := models.Novel{Title: "剑来"}
+	require.NoError(t, h.db.Create(&novel).Error)
+	require.NoError(t, h.db.Create(&models.Character{NovelID: novel.ID, Name: "林风", PowerLevel: "炼气三层"}).Error)
+	require.NoError(t, h.db.Create(&models.Character{NovelID: novel.ID, Name: "苏瑶"}).Error)
+	require.NoError(t, h.db.Create(&models.NovelSetting{NovelID: int(novel.ID), Category: models.SettingCategoryPower, Title: "修炼境界", Content: "炼气、筑基、金丹"}).Error)
+	require.NoError(t, h.db.Create(&models.Chapter{NovelID: novel.ID, Title: "下山", Order: 1, Summary: "林风拜别师父下山"}).Error)
+	chapter := models.Chapter{NovelID: novel.ID, Title: "擂台", Order: 2, Content: "擂台之上，林风施展出筑基期的剑诀。"}
+	require.NoError(t, h.db.Create(&chapter).Error)
+
+	// 只提供正文提及的角色、核心设定和前文摘要
+	req, _, err := buildContinuityRequest(h.db, &chapter)
+	require.NoError(t, err)
+	require.Len(t, req.Characters, 1)
+	assert.Contains(t, req.Characters[0], "炼气三层")
+	assert.Len(t, req.Settings, 1)
+	assert.Equal(t, []string{"第 1 章 下山：林风拜别师父下山"}, req.PreviousSummaries)
+
+	w := performAIRequest(h.CheckChapterContinuity, ContinuityCheckRequest{ChapterID: chapter.ID})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	h.continuity.wait()
+
+	var check models.ContinuityCheck
+	require.NoError(t, h.db.Last(&check).Error)
+	assert.Equal(t, models.ContinuityCheckCompleted, check.Status, check.Error)
+	assert.Equal(t, models.ContinuityTriggerManual, check.Trigger)
+	assert.Equal(t, 1, check.IssueCount)
+
+	perform := newRouteTester(func(r *gin.RouterGroup) { RegisterContinuityRoutes(r, h.db) })
+
+	w = perform(http.MethodGet, fmt.Sprintf("/chapters/%d/issues", chapter.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var issues []models.ChapterIssue
+	require.NoError(t, json.Unmarshal(mustData(t, w), &issues))
+	require.Len(t, issues, 1)
+	assert.Equal(t, "high", issues[0].Severity)
+	assert.Equal(t, 5, issues[0].Position)
+
+	// 忽略后，开启自动检查并修改正文，同样的问题不再报告
+	w = perform(http.MethodPut, fmt.Sprintf("/chapter-issues/%d", issues[0].ID), gin.H{"status": "dismissed", "note": "越级施展"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, h.db.Model(&novel).Update("auto_check_continuity", true).Error)
+	runners := &ChapterRunners{continuity: h.continuity}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	content := chapter.Content + "苏瑶在台下观战。"
+	require.NoError(t, h.db.Model(&models.Chapter{}).Where("id = ?", chapter.ID).Update("content", content).Error)
+	recordChapterEdit(h.db, runners, c, &chapter)
+	h.continuity.wait()
+	check = models.ContinuityCheck{}
+	require.NoError(t, h.db.Last(&check).Error)
+	assert.Equal(t, models.ContinuityTriggerAuto, check.Trigger)
+	assert.Equal(t, models.ContinuityCheckCompleted, check.Status, check.Error)
+	assert.Zero(t, check.IssueCount)
+
+	// 内容与上次检查相同时不重复检查
+	require.NoError(t, h.db.Model(&models.Chapter{}).Where("id = ?", chapter.ID).Update("title", "擂台比试").Error)
+	recordChapterEdit(h.db, runners, c, &chapter)
+	h.continuity.wait()
+	var count int64
+	h.db.Model(&models.ContinuityCheck{}).Where("chapter_id = ?", chapter.ID).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	w = perform(http.MethodGet, fmt.Sprintf("/chapters/%d/issues?status=all", chapter.ID), nil)
+	require.NoError(t, json.Unmarshal(mustData(t, w), &issues))
+	require.Len(t, issues, 1)
+	assert.Equal(t, models.ChapterIssueDismissed, issues[0].Status)
+}
+
+func TestFailInterruptedContinuityChecks(t *testing.T) {
+	h, _ := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&models.ContinuityCheck{}))
+	for _, status := range []string{models.ContinuityCheckPending, models.ContinuityCheckRunning, models.ContinuityCheckCompleted} {
+		require.NoError(t, h.db.Create(&models.ContinuityCheck{ChapterID: 1, Status: status}).Error)
+	}
+
+	// 重启后排队中和检查中的检查失败，章节可以重新检查
+	require.NoError(t, models.FailInterruptedContinuityChecks(h.db))
+	var checks []models.ContinuityCheck
+	require.NoError(t, h.db.Order("id").Find(&checks).Error)
+	require.Len(t, checks, 3)
+	for _, check := range checks[:2] {
+		assert.Equal(t, models.ContinuityCheckFailed, check.Status)
+		assert.Contains(t, check.Error, "服务重启")
+		assert.NotNil(t, check.FinishedAt)
+	}
+	assert.Equal(t, models.ContinuityCheckCompleted, checks[2].Status)
+	active, err := models.HasActiveContinuityCheck(h.db, 1)
+	require.NoError(t, err)
+	assert.False(t, active)
+}
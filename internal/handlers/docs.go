@@ -7,6 +7,7 @@ import (
 	"github.com/LingByte/LingDialog/internal/models"
 	"github.com/LingByte/LingDialog/pkg/config"
 	"github.com/LingByte/LingDialog/pkg/constants"
+	"github.com/LingByte/LingDialog/pkg/llm"
 	"github.com/LingByte/LingDialog/pkg/logger"
 	"github.com/LingByte/LingDialog/pkg/search"
 	"github.com/LingByte/LingDialog/pkg/utils"
@@ -15,7 +16,11 @@ import (
 	"gorm.io/gorm"
 )
 
-func (h *Handlers) GetObjs() []LingEcho.WebObject {
+// GetObjs 返回通用接口管理的对象，runners 为章节保存后续处理使用的后台执行器，可以为 nil
+func (h *Handlers) GetObjs(runners *ChapterRunners) []LingEcho.WebObject {
+	if runners == nil {
+		runners = &ChapterRunners{}
+	}
 	return []LingEcho.WebObject{
 		{
 			Group:       "lingEcho",
@@ -42,7 +47,7 @@ func (h *Handlers) GetObjs() []LingEcho.WebObject {
 			Model:       &models.Novel{},
 			Name:        "novel",
 			Filterables: []string{"Title", "Status", "Genre", "AuthorID", "UpdatedAt", "CreatedAt"},
-			Editables:   []string{"Title", "Status", "Genre", "Description", "WorldSetting", "Tags", "CoverImage", "StyleGuide", "ReferenceNovel", "AuthorID"},
+			Editables:   []string{"Title", "Status", "Genre", "Description", "WorldSetting", "Tags", "CoverImage", "StyleGuide", "ReferenceNovel", "AuthorID", "AutoCheckContinuity", "ConfirmEntitiesWithAI"},
 			Searchables: []string{"Title", "Description", "Tags"},
 			Orderables:  []string{"UpdatedAt", "CreatedAt", "Title"},
 		},
@@ -65,49 +70,60 @@ func (h *Handlers) GetObjs() []LingEcho.WebObject {
 			Editables:   []string{"Title", "Content", "Order", "Summary", "CharacterIDs", "PlotPointIDs", "PreviousSummary", "Outline", "Status", "NovelID", "VolumeID"},
 			Searchables: []string{"Title", "Content"},
 			Orderables:  []string{"Order", "UpdatedAt", "CreatedAt", "Title"},
-			BeforeUpdate: func(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
-				// 如果更新了内容但没有摘要，自动生成摘要
-				if content, hasContent := vals["Content"]; hasContent && content != nil {
-					if summary, hasSummary := vals["Summary"]; !hasSummary || summary == nil || summary == "" {
-						contentStr, ok := content.(string)
-						if ok && contentStr != "" {
-							// 获取章节标题
-							var title string
-							if titleVal, hasTitle := vals["Title"]; hasTitle && titleVal != nil {
-								title, _ = titleVal.(string)
-							}
-							if title == "" {
-								// 从数据库获取现有标题
-								chapter := vptr.(*models.Chapter)
-								if chapter.Title != "" {
-									title = chapter.Title
-								} else {
-									title = "未命名章节"
-								}
-							}
-
-							// 这里我们需要AI处理器来生成摘要
-							// 由于在WebObject钩子中无法直接访问AI处理器，
-							// 我们先跳过自动生成，让用户手动生成
-							// 或者在聊天上下文构建时自动生成
-							logger.Info("章节内容已更新，建议生成摘要",
-								zap.String("title", title),
-								zap.Int("contentLength", len(contentStr)))
-						}
+			BeforeCreate: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
+				// 新章节带有摘要时，所在卷的摘要和全书梗概需要重新汇总
+				chapter := vptr.(*models.Chapter)
+				if chapter.Summary != "" {
+					if err := models.MarkStorySummariesStale(h.db, chapter.NovelID, summaryVolumeIDs(chapter.VolumeID), chapter.Order); err != nil {
+						logger.Error("标记汇总摘要待更新失败", zap.Uint("novelId", chapter.NovelID), zap.Error(err))
 					}
 				}
+				if chapter.Summary != "" || chapter.Content != "" {
+					scheduleSummaryRollup(runners.summaries, chapter.NovelID, currentUserID(ctx))
+				}
 				return nil
 			},
+			AfterUpdate: func(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
+				// 保存成功后记录版本，并执行提取实体、检查连续性、标记摘要待更新等后续处理
+				recordChapterEdit(h.db, runners, ctx, vptr.(*models.Chapter))
+				return nil
+			},
+			BeforeDelete: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
+				chapter := vptr.(*models.Chapter)
+				if chapter.Summary != "" {
+					if err := models.MarkStorySummariesStale(h.db, chapter.NovelID, summaryVolumeIDs(chapter.VolumeID), chapter.Order); err != nil {
+						return err
+					}
+					scheduleSummaryRollup(runners.summaries, chapter.NovelID, currentUserID(ctx))
+				}
+				return h.db.Where("chapter_id = ?", chapter.ID).Delete(&models.ChapterEntity{}).Error
+			},
 		},
 		{
 			Group:       "novel",
 			Desc:        "Character",
 			Model:       &models.Character{},
 			Name:        "character",
-			Filterables: []string{"NovelID", "Name", "UpdatedAt", "CreatedAt"},
-			Editables:   []string{"Name", "Description", "NovelID"},
-			Searchables: []string{"Name", "Description"},
+			Filterables: []string{"NovelID", "Name", "Role", "Faction", "Status", "FirstChapterID", "UpdatedAt", "CreatedAt"},
+			Editables: []string{"Name", "Aliases", "Role", "Gender", "Age", "Description", "Appearance", "Personality",
+				"Background", "Goals", "Abilities", "PowerLevel", "Faction", "FirstChapterID", "Status", "Attributes", "NovelID"},
+			Searchables: []string{"Name", "Aliases", "Description"},
 			Orderables:  []string{"UpdatedAt", "CreatedAt", "Name"},
+			BeforeCreate: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
+				character := vptr.(*models.Character)
+				if character.Status == "" {
+					character.Status = llm.CharacterStatusAlive
+				}
+				return validateCharacterProfile(character.Status, character.Attributes)
+			},
+			BeforeUpdate: func(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error {
+				status, _ := vals["status"].(string)
+				attributes, _ := vals["attributes"].(string)
+				return validateCharacterProfile(status, attributes)
+			},
+			BeforeDelete: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
+				return models.DeleteEntityLinks(h.db, vptr.(*models.Character).ID, models.ChapterEntityCharacter)
+			},
 		},
 		{
 			Group:       "novel",
@@ -118,6 +134,9 @@ func (h *Handlers) GetObjs() []LingEcho.WebObject {
 			Editables:   []string{"Title", "Content", "NovelID"},
 			Searchables: []string{"Title", "Content"},
 			Orderables:  []string{"UpdatedAt", "CreatedAt", "Title"},
+			BeforeDelete: func(db *gorm.DB, ctx *gin.Context, vptr any) error {
+				return models.DeleteEntityLinks(h.db, vptr.(*models.PlotPoint).ID, models.ChapterEntityPlotPoint)
+			},
 		},
 	}
 }
@@ -23,7 +23,7 @@ func setupTestHandlers() *Handlers {
 
 func TestHandlers_GetObjs(t *testing.T) {
 	h := setupTestHandlers()
-	objs := h.GetObjs()
+	objs := h.GetObjs(nil)
 
 	assert.NotNil(t, objs)
 	assert.Greater(t, len(objs), 0, "should return at least one object")
@@ -0,0 +1,442 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	maxPromptForeshadowings   = 20 // 写入章节生成提示词的未回收伏笔数上限，优先最早埋下的
+	defaultStaleForeshadowing = 10 // 伏笔报告默认只列出至少未回收这么多章的伏笔
+)
+
+// ForeshadowingHandler 伏笔处理器
+type ForeshadowingHandler struct {
+	db *gorm.DB
+}
+
+// NewForeshadowingHandler 创建伏笔处理器
+func NewForeshadowingHandler(db *gorm.DB) *ForeshadowingHandler {
+	return &ForeshadowingHandler{
+		db: db,
+	}
+}
+
+// chapterOrderIn 返回小说中章节的序号，章节不存在或不属于该小说时返回错误
+func chapterOrderIn(db *gorm.DB, novelID, chapterID uint) (int, error) {
+	var chapter models.Chapter
+	if err := db.Where("id = ? AND novel_id = ?", chapterID, novelID).First(&chapter).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, fmt.Errorf("章节 %d 不存在或不属于该小说", chapterID)
+		}
+		return 0, err
+	}
+	return chapter.Order, nil
+}
+
+// validateForeshadowing 校验并规范化伏笔：内容、状态，以及埋下和回收的章节（只填章节ID时补全序号）
+func validateForeshadowing(db *gorm.DB, f *models.Foreshadowing) error {
+	f.Description = strings.TrimSpace(f.Description)
+	if f.Description == "" {
+		return errors.New("伏笔内容不能为空")
+	}
+	if f.Status == "" {
+		f.Status = models.ForeshadowingOpen
+	}
+	if !models.IsValidForeshadowingStatus(f.Status) {
+		return fmt.Errorf("无效的伏笔状态: %s", f.Status)
+	}
+	if f.SetupChapterOrder < 0 || f.PayoffChapterOrder < 0 {
+		return errors.New("章节序号不能为负数")
+	}
+	if f.SetupChapterID != 0 {
+		order, err := chapterOrderIn(db, f.NovelID, f.SetupChapterID)
+		if err != nil {
+			return err
+		}
+		f.SetupChapterOrder = order
+	}
+
+	if f.Status == models.ForeshadowingOpen {
+		f.PayoffChapterID, f.PayoffChapterOrder, f.ClosedAt = 0, 0, nil
+		return nil
+	}
+	if f.Status == models.ForeshadowingPaidOff && f.PayoffChapterID != 0 {
+		order, err := chapterOrderIn(db, f.NovelID, f.PayoffChapterID)
+		if err != nil {
+			return err
+		}
+		f.PayoffChapterOrder = order
+	}
+	if f.PayoffChapterOrder > 0 && f.PayoffChapterOrder < f.SetupChapterOrder {
+		return errors.New("回收章节不能早于埋下伏笔的章节")
+	}
+	if f.ClosedAt == nil {
+		now := time.Now()
+		f.ClosedAt = &now
+	}
+	return nil
+}
+
+// loadForeshadowing 获取路径中指定的伏笔，不存在时返回 404
+func (h *ForeshadowingHandler) loadForeshadowing(c *gin.Context) (*models.Foreshadowing, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的伏笔ID",
+		})
+		return nil, false
+	}
+	var item models.Foreshadowing
+	if err := h.db.First(&item, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "伏笔不存在",
+			})
+		} else {
+			logger.Error("获取伏笔失败", zap.Uint64("id", id), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code": 500,
+				"msg":  "获取伏笔失败",
+			})
+		}
+		return nil, false
+	}
+	return &item, true
+}
+
+// ListForeshadowings 获取伏笔列表
+// @Summary 获取伏笔列表
+// @Description 获取小说的伏笔，按埋下的章节先后排序，可按状态过滤
+// @Tags Foreshadowing
+// @Produce json
+// @Param novelId path int true "小说ID"
+// @Param status query string false "状态(open/paid_off/abandoned)"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/foreshadowings/{novelId} [get]
+func (h *ForeshadowingHandler) ListForeshadowings(c *gin.Context) {
+	novelID, ok := parseNovelID(c)
+	if !ok {
+		return
+	}
+	status := c.Query("status")
+	if status != "" && !models.IsValidForeshadowingStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的伏笔状态: " + status,
+		})
+		return
+	}
+
+	items, err := models.ListForeshadowings(h.db, novelID, status)
+	if err != nil {
+		logger.Error("获取伏笔列表失败", zap.Uint("novelId", novelID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取伏笔列表失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": items,
+	})
+}
+
+// StaleForeshadowing 长期未回收的伏笔
+type StaleForeshadowing struct {
+	models.Foreshadowing
+	ChaptersOpen int `json:"chaptersOpen"` // 埋下后已经过的章节数
+}
+
+// GetStaleForeshadowings 获取长期未回收的伏笔
+// @Summary 未回收伏笔报告
+// @Description 列出已埋下至少 minChapters 章仍未回收的伏笔，按未回收的章节数从多到少排序
+// @Tags Foreshadowing
+// @Produce json
+// @Param novelId path int true "小说ID"
+// @Param minChapters query int false "最少未回收章节数" default(10)
+// @Success 200 {object} map[string]interface{}
+// @Router /api/foreshadowings/{novelId}/stale [get]
+func (h *ForeshadowingHandler) GetStaleForeshadowings(c *gin.Context) {
+	novelID, ok := parseNovelID(c)
+	if !ok {
+		return
+	}
+	minChapters, err := strconv.Atoi(c.DefaultQuery("minChapters", strconv.Itoa(defaultStaleForeshadowing)))
+	if err != nil || minChapters < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的章节数",
+		})
+		return
+	}
+
+	latest, err := models.LatestChapterOrder(h.db, novelID)
+	if err != nil {
+		logger.Error("获取最新章节失败", zap.Uint("novelId", novelID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取伏笔报告失败",
+		})
+		return
+	}
+	items, err := models.ListForeshadowings(h.db, novelID, models.ForeshadowingOpen)
+	if err != nil {
+		logger.Error("获取伏笔列表失败", zap.Uint("novelId", novelID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取伏笔报告失败",
+		})
+		return
+	}
+
+	stale := make([]StaleForeshadowing, 0, len(items))
+	for _, item := range items {
+		open := latest - item.SetupChapterOrder
+		if open < 0 {
+			open = 0
+		}
+		if open >= minChapters {
+			stale = append(stale, StaleForeshadowing{Foreshadowing: item, ChaptersOpen: open})
+		}
+	}
+	sort.SliceStable(stale, func(i, j int) bool { return stale[i].ChaptersOpen > stale[j].ChaptersOpen })
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"latestChapter": latest,
+			"items":         stale,
+		},
+	})
+}
+
+// CreateForeshadowing 添加伏笔
+// @Summary 添加伏笔
+// @Description 手动添加伏笔，只填埋下章节ID时自动补全章节序号
+// @Tags Foreshadowing
+// @Accept json
+// @Produce json
+// @Param request body models.Foreshadowing true "伏笔"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/foreshadowings [post]
+func (h *ForeshadowingHandler) CreateForeshadowing(c *gin.Context) {
+	var item models.Foreshadowing
+	if err := c.ShouldBindJSON(&item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if item.NovelID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "缺少小说ID",
+		})
+		return
+	}
+	item.ID = 0
+	item.Source = models.ForeshadowingSourceManual
+	if err := validateForeshadowing(h.db, &item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	if err := h.db.Create(&item).Error; err != nil {
+		logger.Error("添加伏笔失败", zap.Uint("novelId", item.NovelID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "添加伏笔失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "添加成功",
+		"data": item,
+	})
+}
+
+// UpdateForeshadowing 更新伏笔
+// @Summary 更新伏笔
+// @Description 修改伏笔内容或状态：标记为已回收时可指定回收章节，重新打开时清除回收信息
+// @Tags Foreshadowing
+// @Accept json
+// @Produce json
+// @Param id path int true "伏笔ID"
+// @Param request body models.Foreshadowing true "伏笔"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/foreshadowings/{id} [put]
+func (h *ForeshadowingHandler) UpdateForeshadowing(c *gin.Context) {
+	item, ok := h.loadForeshadowing(c)
+	if !ok {
+		return
+	}
+	id, novelID, source, status := item.ID, item.NovelID, item.Source, item.Status
+	if err := c.ShouldBindJSON(item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	item.ID, item.NovelID, item.Source = id, novelID, source
+	if item.Status != status {
+		// 状态变化时重新记录关闭时间
+		item.ClosedAt = nil
+	}
+	if err := validateForeshadowing(h.db, item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	if err := h.db.Save(item).Error; err != nil {
+		logger.Error("更新伏笔失败", zap.Uint("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "更新伏笔失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "更新成功",
+		"data": item,
+	})
+}
+
+// DeleteForeshadowing 删除伏笔
+// @Summary 删除伏笔
+// @Description 删除伏笔记录；不打算回收的伏笔建议标记为已放弃
+// @Tags Foreshadowing
+// @Produce json
+// @Param id path int true "伏笔ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/foreshadowings/{id} [delete]
+func (h *ForeshadowingHandler) DeleteForeshadowing(c *gin.Context) {
+	item, ok := h.loadForeshadowing(c)
+	if !ok {
+		return
+	}
+	if err := h.db.Delete(item).Error; err != nil {
+		logger.Error("删除伏笔失败", zap.Uint("id", item.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "删除伏笔失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "删除成功",
+	})
+}
+
+// openForeshadowings 返回写入章节生成提示词的未回收伏笔，novelID 为 0 或查询失败时为空
+func (h *AIHandler) openForeshadowings(novelID uint) []models.Foreshadowing {
+	if novelID == 0 {
+		return nil
+	}
+	items, err := models.ListForeshadowings(h.db, novelID, models.ForeshadowingOpen)
+	if err != nil {
+		logger.Error("获取未回收伏笔失败", zap.Uint("novelId", novelID), zap.Error(err))
+		return nil
+	}
+	if len(items) > maxPromptForeshadowings {
+		items = items[:maxPromptForeshadowings]
+	}
+	return items
+}
+
+// foreshadowingThreads 将未回收伏笔格式化为提示词中的待延续线索
+func foreshadowingThreads(items []models.Foreshadowing) []string {
+	threads := make([]string, 0, len(items))
+	for _, item := range items {
+		var notes []string
+		if item.SetupChapterOrder > 0 {
+			notes = append(notes, fmt.Sprintf("第 %d 章埋下", item.SetupChapterOrder))
+		}
+		if item.IntendedPayoff != "" {
+			notes = append(notes, "计划回收："+item.IntendedPayoff)
+		}
+		thread := item.Description
+		if len(notes) > 0 {
+			thread += "（" + strings.Join(notes, "；") + "）"
+		}
+		threads = append(threads, thread)
+	}
+	return threads
+}
+
+// recordPendingForeshadowing 将生成结果中本章新埋下和回收的伏笔保存到章节，章节内容保存后才写入伏笔表；失败只记录日志
+func (h *AIHandler) recordPendingForeshadowing(req GenerateChapterRequest, threads []models.Foreshadowing, result *llm.ChapterGenerateResponse) {
+	if req.NovelID == 0 || req.ChapterID == 0 || result == nil {
+		return
+	}
+	if err := models.SetPendingForeshadowing(h.db, req.NovelID, req.ChapterID, pendingForeshadowing(threads, result)); err != nil {
+		logger.Error("保存待记录的伏笔失败", zap.Uint("chapterId", req.ChapterID), zap.Error(err))
+	}
+}
+
+// pendingForeshadowing 从生成结果中取出本章新埋下和回收的伏笔，threads 为写入提示词的未回收伏笔
+func pendingForeshadowing(threads []models.Foreshadowing, result *llm.ChapterGenerateResponse) *models.PendingForeshadowing {
+	pending := &models.PendingForeshadowing{}
+	for _, i := range result.PaidOffThreadIndexes(len(threads)) {
+		pending.PaidOffIDs = append(pending.PaidOffIDs, threads[i].ID)
+	}
+	for _, setup := range result.ForeshadowingSetups {
+		description := strings.TrimSpace(setup.Description)
+		if description == "" {
+			continue
+		}
+		pending.Setups = append(pending.Setups, models.PendingForeshadowingSetup{
+			Description: description,
+			Payoff:      strings.TrimSpace(setup.Payoff),
+		})
+	}
+	return pending
+}
+
+// RegisterForeshadowingRoutes 注册伏笔相关路由
+func RegisterForeshadowingRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	handler := NewForeshadowingHandler(db)
+
+	foreshadowings := r.Group("/foreshadowings")
+	foreshadowings.Use(middleware.RequireAuth())
+	{
+		foreshadowings.GET("/:novelId", handler.ListForeshadowings)
+		foreshadowings.GET("/:novelId/stale", handler.GetStaleForeshadowings)
+		foreshadowings.POST("", handler.CreateForeshadowing)
+		foreshadowings.PUT("/:id", handler.UpdateForeshadowing)
+		foreshadowings.DELETE("/:id", handler.DeleteForeshadowing)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForeshadowing(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&models.Novel{}, &models.Chapter{}, &models.ChapterRevision{}, &models.Storyline{}, &models.StoryNode{}, &models.Foreshadowing{}))
+
+	novel := models.Novel{Title: "剑来"}
+	require.NoError(t, h.db.Create(&novel).Error)
+	chapters := []models.Chapter{{NovelID: novel.ID, Title: "下山", Order: 1}, {NovelID: novel.ID, Title: "擂台", Order: 12}}
+	require.NoError(t, h.db.Create(&chapters).Error)
+
+	perform := newRouteTester(func(r *gin.RouterGroup) { RegisterForeshadowingRoutes(r, h.db) })
+
+	// 手动添加：只填章节ID时补全序号
+	w := perform(http.MethodPost, "/foreshadowings", models.Foreshadowing{NovelID: novel.ID, Description: "师父留下的玉佩",
+		IntendedPayoff: "玉佩是开启秘境的钥匙", SetupChapterID: chapters[0].ID})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var jade models.Foreshadowing
+	require.NoError(t, json.Unmarshal(mustData(t, w), &jade))
+	assert.Equal(t, 1, jade.SetupChapterOrder)
+	w = perform(http.MethodPost, "/foreshadowings", models.Foreshadowing{NovelID: novel.ID, Description: "神秘人的面具", SetupChapterOrder: 5})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var mask models.Foreshadowing
+	require.NoError(t, json.Unmarshal(mustData(t, w), &mask))
+	w = perform(http.MethodPost, "/foreshadowings", models.Foreshadowing{NovelID: novel.ID, Description: "无效", Status: "closed"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 报告按未回收的章节数排序
+	w = perform(http.MethodGet, fmt.Sprintf("/foreshadowings/%d/stale?minChapters=5", novel.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report struct {
+		LatestChapter int                  `json:"latestChapter"`
+		Items         []StaleForeshadowing `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(mustData(t, w), &report))
+	assert.Equal(t, 12, report.LatestChapter)
+	require.Len(t, report.Items, 2)
+	assert.Equal(t, jade.ID, report.Items[0].ID)
+	assert.Equal(t, 11, report.Items[0].ChaptersOpen)
+	assert.Equal(t, 7, report.Items[1].ChaptersOpen)
+
+	// 生成章节：未回收的伏笔写入提示词，回收第 1 条并埋下新伏笔；章节内容保存后才记录
+	secret := models.Chapter{NovelID: novel.ID, Title: "秘境", Order: 13}
+	require.NoError(t, h.db.Create(&secret).Error)
+	mock.Script(llm.PromptChapterGenerate, llm.MockResponse{Content: `{"title":"第十三章","content":"玉佩发出光芒，秘境之门缓缓打开。",` +
+		`"summary":"秘境开启","keyEvents":["秘境开启"],"nextChapterHint":"进入秘境",` +
+		`"foreshadowingSetups":[{"description":"门后传来熟悉的声音","payoff":"师父仍然在世"}],"paidOffThreads":[1,1,9]}`},
+		llm.MockResponse{Content: `{"title":"第十三章","content":"秘境之门纹丝不动。","summary":"秘境未开","keyEvents":["秘境未开"],` +
+			`"nextChapterHint":"寻找钥匙","foreshadowingSetups":[{"description":"门上刻着陌生的文字"}]}`})
+	generate := func() {
+		w := performAIRequest(h.GenerateChapter, GenerateChapterRequest{Title: "秘境", NovelID: novel.ID, ChapterID: secret.ID})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	save := func(content string) {
+		before := models.Chapter{}
+		require.NoError(t, h.db.First(&before, secret.ID).Error)
+		require.NoError(t, h.db.Model(&models.Chapter{}).Where("id = ?", secret.ID).Update("content", content).Error)
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		recordChapterEdit(h.db, nil, c, &before)
+	}
+	listOpen := func() []models.Foreshadowing {
+		w := perform(http.MethodGet, fmt.Sprintf("/foreshadowings/%d?status=open", novel.ID), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var open []models.Foreshadowing
+		require.NoError(t, json.Unmarshal(mustData(t, w), &open))
+		return open
+	}
+
+	generate()
+	requests := mock.Requests()
+	require.Len(t, requests, 1)
+	prompt := requests[0].Messages[len(requests[0].Messages)-1].Content
+	assert.Contains(t, prompt, "1. 师父留下的玉佩（第 1 章埋下；计划回收：玉佩是开启秘境的钥匙）")
+	assert.Contains(t, prompt, "2. 神秘人的面具（第 5 章埋下）")
+	assert.Len(t, listOpen(), 2, "未保存的草稿不记录伏笔")
+
+	save("玉佩发出光芒，秘境之门缓缓打开。")
+	require.NoError(t, h.db.First(&jade, jade.ID).Error)
+	assert.Equal(t, models.ForeshadowingPaidOff, jade.Status)
+	assert.Equal(t, 13, jade.PayoffChapterOrder)
+	assert.NotNil(t, jade.ClosedAt)
+	open := listOpen()
+	require.Len(t, open, 2)
+	assert.Equal(t, mask.ID, open[0].ID)
+	assert.Equal(t, "门后传来熟悉的声音", open[1].Description)
+	assert.Equal(t, models.ForeshadowingSourceAI, open[1].Source)
+	assert.Equal(t, 13, open[1].SetupChapterOrder)
+
+	// 重新生成两次：保存前不影响伏笔，保存后替换该章此前记录的伏笔，此前回收的伏笔重新打开
+	generate()
+	generate()
+	var count int64
+	h.db.Model(&models.Foreshadowing{}).Where("novel_id = ?", novel.ID).Count(&count)
+	assert.Equal(t, int64(3), count)
+	save("秘境之门纹丝不动。")
+	h.db.Model(&models.Foreshadowing{}).Where("novel_id = ?", novel.ID).Count(&count)
+	assert.Equal(t, int64(3), count)
+	var reopened models.Foreshadowing
+	require.NoError(t, h.db.First(&reopened, jade.ID).Error)
+	assert.Equal(t, models.ForeshadowingOpen, reopened.Status)
+	assert.Zero(t, reopened.PayoffChapterOrder)
+	assert.Nil(t, reopened.ClosedAt)
+	open = listOpen()
+	require.Len(t, open, 3)
+	assert.Equal(t, "门上刻着陌生的文字", open[2].Description)
+
+	// 再次保存内容时没有待记录的伏笔，不重复记录
+	save("秘境之门纹丝不动，林风皱起眉头。")
+	h.db.Model(&models.Foreshadowing{}).Where("novel_id = ?", novel.ID).Count(&count)
+	assert.Equal(t, int64(3), count)
+
+	// 放弃后重新打开时清除关闭时间
+	w = perform(http.MethodPut, fmt.Sprintf("/foreshadowings/%d", mask.ID), gin.H{"description": mask.Description, "status": "abandoned"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(mustData(t, w), &mask))
+	assert.NotNil(t, mask.ClosedAt)
+	w = perform(http.MethodPut, fmt.Sprintf("/foreshadowings/%d", mask.ID), gin.H{"status": "open"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(mustData(t, w), &mask))
+	assert.Nil(t, mask.ClosedAt)
+	assert.Equal(t, 5, mask.SetupChapterOrder)
+}
@@ -235,6 +235,9 @@ func (h *SettingHandler) DeleteSetting(c *gin.Context) {
 		})
 		return
 	}
+	if err := models.DeleteEntityLinks(h.db, uint(id), models.ChapterEntitySetting, models.ChapterEntityLocation); err != nil {
+		logger.Error("删除设定的章节关联失败", zap.Int("id", id), zap.Error(err))
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// StorySummaryHandler 汇总摘要处理器
+type StorySummaryHandler struct {
+	db *gorm.DB
+}
+
+// NewStorySummaryHandler 创建汇总摘要处理器
+func NewStorySummaryHandler(db *gorm.DB) *StorySummaryHandler {
+	return &StorySummaryHandler{
+		db: db,
+	}
+}
+
+// GetStorySummaries 获取小说的全书梗概和卷摘要
+// @Summary 获取汇总摘要
+// @Description 获取小说的全书梗概、各卷摘要及其待更新状态，以及缺少摘要或摘要待更新的章节数
+// @Tags Chapters
+// @Produce json
+// @Param novelId path int true "小说ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/story-summaries/{novelId} [get]
+func (h *StorySummaryHandler) GetStorySummaries(c *gin.Context) {
+	novelID, ok := parseNovelID(c)
+	if !ok {
+		return
+	}
+
+	summaries, err := models.ListStorySummaries(h.db, novelID)
+	if err != nil {
+		logger.Error("获取汇总摘要失败", zap.Uint("novelId", novelID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取汇总摘要失败",
+		})
+		return
+	}
+	pending, err := models.CountChaptersNeedingSummary(h.db, novelID)
+	if err != nil {
+		logger.Error("统计待生成摘要的章节失败", zap.Uint("novelId", novelID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"msg":  "获取汇总摘要失败",
+		})
+		return
+	}
+
+	var synopsis *models.StorySummary
+	volumes := make([]models.StorySummary, 0, len(summaries))
+	for i := range summaries {
+		if summaries[i].Level == models.StorySummaryNovel {
+			synopsis = &summaries[i]
+		} else {
+			volumes = append(volumes, summaries[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"synopsis":        synopsis,
+			"volumes":         volumes,
+			"pendingChapters": pending,
+		},
+	})
+}
+
+// RegisterStorySummaryRoutes 注册汇总摘要相关路由
+func RegisterStorySummaryRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	handler := NewStorySummaryHandler(db)
+
+	summaries := r.Group("/story-summaries")
+	summaries.Use(middleware.RequireAuth())
+	{
+		summaries.GET("/:novelId", handler.GetStorySummaries)
+	}
+}
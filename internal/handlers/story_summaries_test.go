@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/llm"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rollupPrompts 返回摘要汇总请求的提示词
+func rollupPrompts(mock *llm.MockProvider) []string {
+	var prompts []string
+	for _, req := range mock.Requests() {
+		prompt := req.Messages[len(req.Messages)-1].Content
+		if strings.Contains(prompt, "【章节摘要】") {
+			prompts = append(prompts, prompt)
+		}
+	}
+	return prompts
+}
+
+func TestStorySummaries(t *testing.T) {
+	h, mock := setupMockAIHandler(t)
+	useSingleConnection(t, h.db)
+	require.NoError(t, h.db.AutoMigrate(&models.Novel{}, &models.Volume{}, &models.Chapter{}, &models.ChapterRevision{},
+		&models.Character{}, &models.PlotPoint{}, &models.NovelSetting{}, &models.Storyline{}, &models.StoryNode{},
+		&models.ChapterEntity{}, &models.StorySummary{}))
+
+	novel := models.Novel{Title: "剑来"}
+	require.NoError(t, h.db.Create(&novel).Error)
+	volume := models.Volume{NovelID: novel.ID, Title: "下山"}
+	require.NoError(t, h.db.Create(&volume).Error)
+	chapters := []*models.Chapter{
+		{NovelID: novel.ID, VolumeID: volume.ID, Title: "出师", Order: 1, Content: "林风拜别师父。"},
+		{NovelID: novel.ID, VolumeID: volume.ID, Title: "入城", Order: 2, Content: "林风进入青云城。"},
+		{NovelID: novel.ID, Title: "番外", Order: 3, Content: "苏瑶的往事。", Summary: "苏瑶回忆往事"},
+	}
+	require.NoError(t, h.db.Create(&chapters).Error)
+
+	// 预设的响应按调用顺序返回
+	mock.Script(llm.PromptChapterSummary, llm.MockResponse{Content: "林风下山"}, llm.MockResponse{Content: "林风入城"},
+		llm.MockResponse{Content: "林风在城中遇险"})
+	mock.Script(llm.PromptSummaryRollup, llm.MockResponse{Content: "卷一：林风下山入城"}, llm.MockResponse{Content: "梗概：林风下山，苏瑶往事"},
+		llm.MockResponse{Content: "梗概：林风与苏瑶重逢"}, llm.MockResponse{Content: "卷一：林风下山遇险"}, llm.MockResponse{Content: "梗概：林风遇险"})
+
+	// 首次汇总：生成缺少的章节摘要，再汇总卷摘要和全书梗概
+	h.summaries.schedule(novel.ID, 1, 0)
+	h.summaries.wait()
+
+	prompts := rollupPrompts(mock)
+	require.Len(t, prompts, 2)
+	assert.Contains(t, prompts[0], "第 2 章 入城：林风入城")
+	assert.Contains(t, prompts[1], "第 1-2 章（下山）：卷一：林风下山入城")
+	assert.Contains(t, prompts[1], "第 3 章 番外：苏瑶回忆往事")
+	synopsis, err := models.GetStorySummary(h.db, novel.ID, 0)
+	require.NoError(t, err)
+	require.NotNil(t, synopsis)
+	assert.Equal(t, "梗概：林风下山，苏瑶往事", synopsis.Content)
+	assert.Equal(t, 3, synopsis.ChapterCount)
+	assert.Equal(t, 3, synopsis.LastChapterOrder)
+	assert.False(t, synopsis.Stale)
+
+	// 新增排在后面的章节时只追加到原梗概
+	require.NoError(t, h.db.Create(&models.Chapter{NovelID: novel.ID, Title: "重逢", Order: 4, Summary: "林风与苏瑶重逢"}).Error)
+	h.summaries.schedule(novel.ID, 1, 0)
+	h.summaries.wait()
+	prompts = rollupPrompts(mock)
+	require.Len(t, prompts, 3)
+	assert.Contains(t, prompts[2], "【此前的摘要】\n梗概：林风下山，苏瑶往事")
+	assert.Contains(t, prompts[2], "第 4 章 重逢：林风与苏瑶重逢")
+	assert.NotContains(t, prompts[2], "第 3 章")
+
+	// 只修改内容时章节摘要标记为待更新，卷摘要和梗概在重新生成章节摘要后从该章起重新汇总
+	h.summaries.delay = 0
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	var edited models.Chapter
+	require.NoError(t, h.db.First(&edited, chapters[1].ID).Error)
+	before := edited
+	require.NoError(t, h.db.Model(&edited).Update("content", "林风在青云城遇险。").Error)
+	recordChapterEdit(h.db, &ChapterRunners{summaries: h.summaries}, c, &before)
+	require.NoError(t, h.db.First(&edited, chapters[1].ID).Error)
+	assert.True(t, edited.SummaryStale)
+
+	perform := newRouteTester(func(r *gin.RouterGroup) { RegisterStorySummaryRoutes(r, h.db) })
+	w := perform(http.MethodGet, fmt.Sprintf("/story-summaries/%d", novel.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var overview struct {
+		Synopsis        *models.StorySummary  `json:"synopsis"`
+		Volumes         []models.StorySummary `json:"volumes"`
+		PendingChapters int                   `json:"pendingChapters"`
+	}
+	require.NoError(t, json.Unmarshal(mustData(t, w), &overview))
+	require.NotNil(t, overview.Synopsis)
+	assert.Len(t, overview.Volumes, 1)
+	assert.Equal(t, 1, overview.PendingChapters)
+
+	// 对话时不再逐章生成摘要，而是在后台汇总；本次使用已有的梗概和卷摘要
+	ctx := llm.WithCallInfo(context.Background(), &llm.CallInfo{UserID: 1, NovelID: novel.ID})
+	msg, _, _, err := h.buildNovelContext(ctx, novel.ID, nil, 0)
+	require.NoError(t, err)
+	assert.Contains(t, msg.Content, "# 故事梗概\n梗概：林风与苏瑶重逢")
+	assert.Contains(t, msg.Content, "- 下山：卷一：林风下山入城")
+	h.summaries.wait()
+
+	prompts = rollupPrompts(mock)
+	require.Len(t, prompts, 5)
+	assert.NotContains(t, prompts[3], "【此前的摘要】")
+	assert.Contains(t, prompts[3], "第 2 章 入城：林风在城中遇险")
+	assert.Contains(t, prompts[4], "第 1-2 章（下山）：卷一：林风下山遇险")
+	assert.Contains(t, prompts[4], "第 4 章 重逢：林风与苏瑶重逢")
+	synopsis, err = models.GetStorySummary(h.db, novel.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "梗概：林风遇险", synopsis.Content)
+	assert.Equal(t, 4, synopsis.ChapterCount)
+	assert.False(t, synopsis.Stale)
+
+	// 续写时前文摘要附上不包含本章的梗概和卷摘要
+	req := GenerateChapterRequest{NovelID: novel.ID, ChapterNumber: 5}
+	h.applyPreviousChapter(&req)
+	assert.True(t, strings.HasPrefix(req.PreviousSummary, "故事梗概：梗概：林风遇险\n"), req.PreviousSummary)
+	req = GenerateChapterRequest{NovelID: novel.ID, ChapterNumber: 3}
+	h.applyPreviousChapter(&req)
+	assert.Equal(t, "本卷前情：卷一：林风下山遇险\n第 2 章 入城：林风在城中遇险", req.PreviousSummary)
+}
@@ -23,11 +23,9 @@ type StorylineHandler struct {
 // NewStorylineHandler 创建故事线处理器
 func NewStorylineHandler(db *gorm.DB) *StorylineHandler {
 	// 从配置中获取 LLM 设置
-	apiKey := config.GlobalConfig.LLMApiKey
-	baseURL := config.GlobalConfig.LLMBaseURL
-	model := config.GlobalConfig.LLMModel
+	_, _, model := config.GetLLMConfig()
 
-	storylineGenerator := llm.NewStorylineGenerator(apiKey, baseURL, model)
+	storylineGenerator := llm.NewStorylineGenerator(llm.NewProviderFromConfig(), model)
 
 	return &StorylineHandler{
 		db:                 db,
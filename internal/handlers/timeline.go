@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// TimelineHandler 故事内时间线处理器
+type TimelineHandler struct {
+	db *gorm.DB
+}
+
+// NewTimelineHandler 创建时间线处理器
+func NewTimelineHandler(db *gorm.DB) *TimelineHandler {
+	return &TimelineHandler{
+		db: db,
+	}
+}
+
+// respondTimelineError 校验错误返回 400，其他错误记录日志后返回 500
+func respondTimelineError(c *gin.Context, err error, msg string) {
+	var verr *models.TimelineValidationError
+	if errors.As(err, &verr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + verr.Error(),
+		})
+		return
+	}
+	logger.Error(msg, zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"code": 500,
+		"msg":  msg,
+	})
+}
+
+// parseNovelID 解析路径中的小说ID
+func parseNovelID(c *gin.Context) (uint, bool) {
+	novelID, err := strconv.ParseUint(c.Param("novelId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的小说ID",
+		})
+		return 0, false
+	}
+	return uint(novelID), true
+}
+
+// loadEvent 获取路径中指定的事件，不存在时返回 404
+func (h *TimelineHandler) loadEvent(c *gin.Context) (*models.TimelineEvent, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的事件ID",
+		})
+		return nil, false
+	}
+	event, err := models.GetTimelineEvent(h.db, uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code": 404,
+				"msg":  "事件不存在",
+			})
+		} else {
+			respondTimelineError(c, err, "获取事件失败")
+		}
+		return nil, false
+	}
+	return event, true
+}
+
+// GetCalendar 获取小说历法
+// @Summary 获取小说历法
+// @Description 获取小说的故事内历法，没有配置时返回默认历法（十二个月，每月三十天）
+// @Tags Timeline
+// @Produce json
+// @Param novelId path int true "小说ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/timeline/{novelId}/calendar [get]
+func (h *TimelineHandler) GetCalendar(c *gin.Context) {
+	novelID, ok := parseNovelID(c)
+	if !ok {
+		return
+	}
+	cal, err := models.GetTimelineCalendar(h.db, novelID)
+	if err != nil {
+		respondTimelineError(c, err, "获取历法失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": cal,
+	})
+}
+
+// SaveCalendar 保存小说历法
+// @Summary 保存小说历法
+// @Description 保存纪元和月份配置，并按新历法重新排列已有事件；已有事件的时间在新历法中无效时拒绝保存
+// @Tags Timeline
+// @Accept json
+// @Produce json
+// @Param novelId path int true "小说ID"
+// @Param request body models.TimelineCalendar true "历法"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/timeline/{novelId}/calendar [put]
+func (h *TimelineHandler) SaveCalendar(c *gin.Context) {
+	novelID, ok := parseNovelID(c)
+	if !ok {
+		return
+	}
+	var cal models.TimelineCalendar
+	if err := c.ShouldBindJSON(&cal); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	cal.ID = 0
+	cal.NovelID = novelID
+	if err := models.SaveTimelineCalendar(h.db, &cal); err != nil {
+		respondTimelineError(c, err, "保存历法失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "保存成功",
+		"data": cal,
+	})
+}
+
+// GetTimeline 获取时间线
+// @Summary 获取时间线
+// @Description 按故事内时间先后列出小说的事件，可按角色、章节或故事节点过滤
+// @Tags Timeline
+// @Produce json
+// @Param novelId path int true "小说ID"
+// @Param characterId query int false "角色ID"
+// @Param chapterId query int false "章节ID"
+// @Param storyNodeId query int false "故事节点ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/timeline/{novelId} [get]
+func (h *TimelineHandler) GetTimeline(c *gin.Context) {
+	novelID, ok := parseNovelID(c)
+	if !ok {
+		return
+	}
+	var filter models.TimelineFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	events, err := models.ListTimelineEvents(h.db, novelID, filter)
+	if err != nil {
+		respondTimelineError(c, err, "获取时间线失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": events,
+	})
+}
+
+// GetCharacterLocation 查询角色在某个时间点的位置
+// @Summary 查询角色位置
+// @Description 返回角色在指定时间点及之前最近一次有地点记录的事件
+// @Tags Timeline
+// @Produce json
+// @Param novelId path int true "小说ID"
+// @Param characterId path int true "角色ID"
+// @Param era query string false "纪元"
+// @Param year query int true "年"
+// @Param month query int false "月"
+// @Param day query int false "日"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/timeline/{novelId}/characters/{characterId}/location [get]
+func (h *TimelineHandler) GetCharacterLocation(c *gin.Context) {
+	novelID, ok := parseNovelID(c)
+	if !ok {
+		return
+	}
+	characterID, err := strconv.ParseUint(c.Param("characterId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "无效的角色ID",
+		})
+		return
+	}
+	var at models.TimePoint
+	if err := c.ShouldBindQuery(&at); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	event, err := models.FindCharacterLocation(h.db, novelID, uint(characterID), at)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 200,
+			"msg":  "该时间点之前没有该角色的位置记录",
+			"data": nil,
+		})
+		return
+	}
+	if err != nil {
+		respondTimelineError(c, err, "查询角色位置失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": gin.H{
+			"location":   event.Location,
+			"locationId": event.LocationID,
+			"event":      event,
+		},
+	})
+}
+
+// TimelineStoryNode 带故事内时间的故事节点，用于叠加到故事线图
+type TimelineStoryNode struct {
+	ID          int    `json:"id"`
+	StorylineID int    `json:"storylineId"`
+	Title       string `json:"title"`
+	NodeType    string `json:"nodeType"`
+	OrderIndex  int    `json:"orderIndex"`
+	Ordinal     *int64 `json:"ordinal"`   // 关联事件中最早的时间，没有关联事件时为空
+	TimeLabel   string `json:"timeLabel"` // 最早关联事件的格式化时间
+	EventIDs    []uint `json:"eventIds"`
+}
+
+// TimelineStorylineView 与故事线图合并的时间线
+type TimelineStorylineView struct {
+	Calendar *models.TimelineCalendar `json:"calendar"`
+	Events   []models.TimelineEvent   `json:"events"`
+	Nodes    []TimelineStoryNode      `json:"nodes"` // 按故事内时间排序，没有时间的节点按故事线顺序排在最后
+}
+
+// GetStorylineTimeline 获取与故事线合并的时间线
+// @Summary 获取与故事线合并的时间线
+// @Description 返回全部事件和小说所有故事线的节点，节点带有关联事件中最早的故事内时间，便于在故事线图上按时间排列
+// @Tags Timeline
+// @Produce json
+// @Param novelId path int true "小说ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/timeline/{novelId}/storylines [get]
+func (h *TimelineHandler) GetStorylineTimeline(c *gin.Context) {
+	novelID, ok := parseNovelID(c)
+	if !ok {
+		return
+	}
+	cal, err := models.GetTimelineCalendar(h.db, novelID)
+	if err != nil {
+		respondTimelineError(c, err, "获取时间线失败")
+		return
+	}
+	events, err := models.ListTimelineEvents(h.db, novelID, models.TimelineFilter{})
+	if err != nil {
+		respondTimelineError(c, err, "获取时间线失败")
+		return
+	}
+	var storyNodes []models.StoryNode
+	if err := h.db.Joins("JOIN storylines ON storylines.id = story_nodes.storyline_id").
+		Where("storylines.novel_id = ?", novelID).
+		Order("story_nodes.storyline_id ASC, story_nodes.order_index ASC, story_nodes.id ASC").
+		Find(&storyNodes).Error; err != nil {
+		respondTimelineError(c, err, "获取故事节点失败")
+		return
+	}
+
+	nodes := make([]TimelineStoryNode, len(storyNodes))
+	index := make(map[int]int, len(storyNodes))
+	for i, node := range storyNodes {
+		index[node.ID] = i
+		nodes[i] = TimelineStoryNode{
+			ID:          node.ID,
+			StorylineID: node.StorylineID,
+			Title:       node.Title,
+			NodeType:    node.NodeType,
+			OrderIndex:  node.OrderIndex,
+			EventIDs:    []uint{},
+		}
+	}
+	// 事件已按时间排序，节点的第一个事件即最早的时间
+	for _, event := range events {
+		i, ok := index[event.StoryNodeID]
+		if !ok {
+			continue
+		}
+		node := &nodes[i]
+		if node.Ordinal == nil {
+			ordinal := event.Ordinal
+			node.Ordinal = &ordinal
+			node.TimeLabel = event.TimeLabel
+		}
+		node.EventIDs = append(node.EventIDs, event.ID)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i].Ordinal, nodes[j].Ordinal
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return *a < *b
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": TimelineStorylineView{
+			Calendar: cal,
+			Events:   events,
+			Nodes:    nodes,
+		},
+	})
+}
+
+// CreateTimelineEvent 创建时间线事件
+// @Summary 创建时间线事件
+// @Description 创建事件，时间按小说历法校验和排序，可关联章节、故事节点、地点和参与角色
+// @Tags Timeline
+// @Accept json
+// @Produce json
+// @Param request body models.TimelineEvent true "事件信息"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/timeline-events [post]
+func (h *TimelineHandler) CreateTimelineEvent(c *gin.Context) {
+	var event models.TimelineEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if event.NovelID == 0 || event.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: 缺少小说ID或事件标题",
+		})
+		return
+	}
+	event.ID = 0
+	if err := models.SaveTimelineEvent(h.db, &event); err != nil {
+		respondTimelineError(c, err, "创建事件失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "创建成功",
+		"data": event,
+	})
+}
+
+// GetTimelineEvent 获取时间线事件
+// @Summary 获取时间线事件
+// @Description 获取事件详情及参与角色
+// @Tags Timeline
+// @Produce json
+// @Param id path int true "事件ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/timeline-events/{id} [get]
+func (h *TimelineHandler) GetTimelineEvent(c *gin.Context) {
+	event, ok := h.loadEvent(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": event,
+	})
+}
+
+// UpdateTimelineEvent 更新时间线事件
+// @Summary 更新时间线事件
+// @Description 更新事件，只修改请求中出现的字段；传入 characterIds 时替换参与角色
+// @Tags Timeline
+// @Accept json
+// @Produce json
+// @Param id path int true "事件ID"
+// @Param request body models.TimelineEvent true "事件信息"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/timeline-events/{id} [put]
+func (h *TimelineHandler) UpdateTimelineEvent(c *gin.Context) {
+	event, ok := h.loadEvent(c)
+	if !ok {
+		return
+	}
+	id, novelID := event.ID, event.NovelID
+	if err := c.ShouldBindJSON(event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	event.ID, event.NovelID = id, novelID
+	if err := models.SaveTimelineEvent(h.db, event); err != nil {
+		respondTimelineError(c, err, "更新事件失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "更新成功",
+		"data": event,
+	})
+}
+
+// DeleteTimelineEvent 删除时间线事件
+// @Summary 删除时间线事件
+// @Description 删除事件及其角色关联
+// @Tags Timeline
+// @Produce json
+// @Param id path int true "事件ID"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/timeline-events/{id} [delete]
+func (h *TimelineHandler) DeleteTimelineEvent(c *gin.Context) {
+	event, ok := h.loadEvent(c)
+	if !ok {
+		return
+	}
+	if err := models.DeleteTimelineEvent(h.db, event.ID); err != nil {
+		respondTimelineError(c, err, "删除事件失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "删除成功",
+	})
+}
+
+// GetEventsBefore 获取发生在某事件之前的事件
+// @Summary 获取之前发生的事件
+// @Description 按故事内时间返回早于指定事件的事件，用于核对倒叙和并行情节
+// @Tags Timeline
+// @Produce json
+// @Param id path int true "事件ID"
+// @Param limit query int false "最多返回的事件数，默认全部"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/timeline-events/{id}/before [get]
+func (h *TimelineHandler) GetEventsBefore(c *gin.Context) {
+	event, ok := h.loadEvent(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	events, err := models.ListEventsBefore(h.db, event, limit)
+	if err != nil {
+		respondTimelineError(c, err, "获取事件失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取成功",
+		"data": events,
+	})
+}
+
+// RegisterTimelineRoutes 注册时间线相关路由
+func RegisterTimelineRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	handler := NewTimelineHandler(db)
+
+	timeline := r.Group("/timeline")
+	timeline.Use(middleware.RequireAuth())
+	{
+		timeline.GET("/:novelId", handler.GetTimeline)
+		timeline.GET("/:novelId/calendar", handler.GetCalendar)
+		timeline.PUT("/:novelId/calendar", handler.SaveCalendar)
+		timeline.GET("/:novelId/storylines", handler.GetStorylineTimeline)
+		timeline.GET("/:novelId/characters/:characterId/location", handler.GetCharacterLocation)
+	}
+
+	events := r.Group("/timeline-events")
+	events.Use(middleware.RequireAuth())
+	{
+		events.POST("", handler.CreateTimelineEvent)
+		events.GET("/:id", handler.GetTimelineEvent)
+		events.PUT("/:id", handler.UpdateTimelineEvent)
+		events.DELETE("/:id", handler.DeleteTimelineEvent)
+		events.GET("/:id/before", handler.GetEventsBefore)
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/LingByte/LingDialog/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeline(t *testing.T) {
+	h, _ := setupMockAIHandler(t)
+	require.NoError(t, h.db.AutoMigrate(&models.Novel{}, &models.Character{}, &models.Storyline{}, &models.StoryNode{},
+		&models.TimelineCalendar{}, &models.TimelineEvent{}, &models.TimelineEventCharacter{}))
+
+	novel := models.Novel{Title: "剑来"}
+	require.NoError(t, h.db.Create(&novel).Error)
+	characters := []models.Character{{NovelID: novel.ID, Name: "林风"}, {NovelID: novel.ID, Name: "苏瑶"}}
+	require.NoError(t, h.db.Create(&characters).Error)
+	linFeng, suYao := characters[0].ID, characters[1].ID
+	var storyline models.Storyline
+	require.NoError(t, h.db.Where("novel_id = ?", novel.ID).First(&storyline).Error)
+	nodes := []models.StoryNode{{StorylineID: storyline.ID, Title: "下山", OrderIndex: 1}, {StorylineID: storyline.ID, Title: "拜师", OrderIndex: 2}}
+	require.NoError(t, h.db.Create(&nodes).Error)
+
+	perform := newRouteTester(func(r *gin.RouterGroup) { RegisterTimelineRoutes(r, h.db) })
+	createEvent := func(event models.TimelineEvent) models.TimelineEvent {
+		event.NovelID = novel.ID
+		w := perform(http.MethodPost, "/timeline-events", event)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var created models.TimelineEvent
+		require.NoError(t, json.Unmarshal(mustData(t, w), &created))
+		return created
+	}
+
+	// 自定义历法：两个纪元，每年两个月
+	w := perform(http.MethodPut, fmt.Sprintf("/timeline/%d/calendar", novel.ID), models.TimelineCalendar{
+		Name:   "天元历",
+		Eras:   []models.CalendarEra{{Name: "太初", Years: 10}, {Name: "天元"}},
+		Months: []models.CalendarMonth{{Name: "上月", Days: 30}, {Name: "下月", Days: 30}},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// 按叙述顺序录入，包含一段倒叙
+	descend := createEvent(models.TimelineEvent{Title: "林风下山", TimePoint: models.TimePoint{Era: "天元", Year: 3, Month: 1, Day: 5},
+		StoryNodeID: nodes[0].ID, Location: "青石镇", CharacterIDs: []uint{linFeng}})
+	flashback := createEvent(models.TimelineEvent{Title: "苏瑶拜师", TimePoint: models.TimePoint{Era: "太初", Year: 8},
+		StoryNodeID: nodes[1].ID, Location: "青云山", CharacterIDs: []uint{linFeng, suYao}})
+	duel := createEvent(models.TimelineEvent{Title: "擂台比试", TimePoint: models.TimePoint{Era: "天元", Year: 3, Month: 2, Day: 1},
+		CharacterIDs: []uint{linFeng}})
+	assert.Equal(t, "天元3年上月5日", descend.TimeLabel)
+
+	w = perform(http.MethodPost, "/timeline-events", models.TimelineEvent{NovelID: novel.ID, Title: "无效",
+		TimePoint: models.TimePoint{Era: "太初", Year: 11}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 时间线按故事内时间排序
+	w = perform(http.MethodGet, fmt.Sprintf("/timeline/%d", novel.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var events []models.TimelineEvent
+	require.NoError(t, json.Unmarshal(mustData(t, w), &events))
+	require.Len(t, events, 3)
+	assert.Equal(t, []uint{flashback.ID, descend.ID, duel.ID}, []uint{events[0].ID, events[1].ID, events[2].ID})
+	assert.Equal(t, []uint{linFeng, suYao}, events[0].CharacterIDs)
+
+	w = perform(http.MethodGet, fmt.Sprintf("/timeline/%d?characterId=%d", novel.ID, suYao), nil)
+	require.NoError(t, json.Unmarshal(mustData(t, w), &events))
+	require.Len(t, events, 1)
+
+	// 擂台比试之前发生的事件
+	w = perform(http.MethodGet, fmt.Sprintf("/timeline-events/%d/before?limit=1", duel.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(mustData(t, w), &events))
+	require.Len(t, events, 1)
+	assert.Equal(t, descend.ID, events[0].ID)
+
+	// 林风在天元三年下月时最后的位置是青石镇（擂台比试没有地点）
+	w = perform(http.MethodGet, fmt.Sprintf("/timeline/%d/characters/%d/location?era=天元&year=3&month=2&day=10", novel.ID, linFeng), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var location struct {
+		Location string               `json:"location"`
+		Event    models.TimelineEvent `json:"event"`
+	}
+	require.NoError(t, json.Unmarshal(mustData(t, w), &location))
+	assert.Equal(t, "青石镇", location.Location)
+	w = perform(http.MethodGet, fmt.Sprintf("/timeline/%d/characters/%d/location?era=太初&year=1", novel.ID, linFeng), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "null", string(mustData(t, w)))
+
+	// 与故事线合并：拜师节点按时间排在下山之前
+	w = perform(http.MethodGet, fmt.Sprintf("/timeline/%d/storylines", novel.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var view TimelineStorylineView
+	require.NoError(t, json.Unmarshal(mustData(t, w), &view))
+	require.Len(t, view.Nodes, 2)
+	assert.Equal(t, nodes[1].ID, view.Nodes[0].ID)
+	assert.Equal(t, "太初8年", view.Nodes[0].TimeLabel)
+	assert.Len(t, view.Events, 3)
+
+	// 删除已有事件所在的纪元会被拒绝；更新事件时间后重新排序
+	w = perform(http.MethodPut, fmt.Sprintf("/timeline/%d/calendar", novel.ID), models.TimelineCalendar{
+		Eras:   []models.CalendarEra{{Name: "天元"}},
+		Months: []models.CalendarMonth{{Name: "上月", Days: 30}, {Name: "下月", Days: 30}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	w = perform(http.MethodPut, fmt.Sprintf("/timeline-events/%d", flashback.ID), gin.H{"era": "天元", "year": 4})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = perform(http.MethodGet, fmt.Sprintf("/timeline-events/%d", flashback.ID), nil)
+	require.NoError(t, json.Unmarshal(mustData(t, w), &flashback))
+	assert.Equal(t, []uint{linFeng, suYao}, flashback.CharacterIDs)
+	assert.Greater(t, flashback.Ordinal, duel.Ordinal)
+
+	w = perform(http.MethodDelete, fmt.Sprintf("/timeline-events/%d", flashback.ID), nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var links int64
+	h.db.Model(&models.TimelineEventCharacter{}).Where("event_id = ?", flashback.ID).Count(&links)
+	assert.Zero(t, links)
+}
@@ -156,11 +156,12 @@ func (h *Handlers) Register(engine *gin.Engine) {
 	} else {
 		logger.Warn("Search handlers is still nil after initialization, routes not registered")
 	}
-	objs := h.GetObjs()
-	LingEcho.RegisterObjects(r, objs)
-
 	// Register AI routes
-	RegisterAIRoutes(r, h.db)
+	aiHandler := RegisterAIRoutes(r, h.db)
+	runners := aiHandler.ChapterRunners()
+
+	objs := h.GetObjs(runners)
+	LingEcho.RegisterObjects(r, objs)
 
 	// Register Storyline routes
 	RegisterStorylineRoutes(r, h.db)
@@ -168,6 +169,27 @@ func (h *Handlers) Register(engine *gin.Engine) {
 	// Register Setting routes
 	RegisterSettingRoutes(r, h.db)
 
+	// Register Chapter Revision routes
+	RegisterChapterRevisionRoutes(r, h.db, runners)
+
+	// Register Continuity routes
+	RegisterContinuityRoutes(r, h.db)
+
+	// Register Chapter Entity routes
+	RegisterChapterEntityRoutes(r, h.db)
+
+	// Register Story Summary routes
+	RegisterStorySummaryRoutes(r, h.db)
+
+	// Register Character Relationship routes
+	RegisterCharacterRelationshipRoutes(r, h.db)
+
+	// Register Timeline routes
+	RegisterTimelineRoutes(r, h.db)
+
+	// Register Foreshadowing routes
+	RegisterForeshadowingRoutes(r, h.db)
+
 	// Register Writing Stats routes
 	RegisterWritingStatsRoutes(r, h.db)
 
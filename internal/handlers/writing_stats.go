@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -48,7 +49,7 @@ func (h *WritingStatsHandler) GetWritingStats(c *gin.Context) {
 	}
 
 	// 获取或生成今日目标
-	goals, err := h.getOrGenerateGoals(user.ID, today)
+	goals, err := h.getOrGenerateGoals(c.Request.Context(), user.ID, today)
 	if err != nil {
 		logger.Error("获取写作目标失败", zap.Error(err))
 		// 使用默认目标
@@ -265,7 +266,7 @@ func (h *WritingStatsHandler) getMonthlyWords(userID uint, today time.Time) int
 }
 
 // getOrGenerateGoals 获取或生成写作目标
-func (h *WritingStatsHandler) getOrGenerateGoals(userID uint, date time.Time) (*models.WritingGoal, error) {
+func (h *WritingStatsHandler) getOrGenerateGoals(ctx context.Context, userID uint, date time.Time) (*models.WritingGoal, error) {
 	// 先尝试获取今日目标
 	goal, err := models.GetWritingGoalByDate(h.db, userID, date)
 	if err == nil {
@@ -275,14 +276,14 @@ func (h *WritingStatsHandler) getOrGenerateGoals(userID uint, date time.Time) (*
 	// 如果没有今日目标，检查是否需要生成
 	if err == gorm.ErrRecordNotFound {
 		// 生成新的目标
-		return h.generateDailyGoals(userID, date)
+		return h.generateDailyGoals(ctx, userID, date)
 	}
 
 	return nil, err
 }
 
 // generateDailyGoals 使用AI生成每日目标
-func (h *WritingStatsHandler) generateDailyGoals(userID uint, date time.Time) (*models.WritingGoal, error) {
+func (h *WritingStatsHandler) generateDailyGoals(ctx context.Context, userID uint, date time.Time) (*models.WritingGoal, error) {
 	// 获取过去一周的数据
 	weekAgo := date.AddDate(0, 0, -7)
 	var weeklyProgress []models.WritingProgress
@@ -305,7 +306,7 @@ func (h *WritingStatsHandler) generateDailyGoals(userID uint, date time.Time) (*
 	if len(weeklyProgress) == 0 {
 		logger.Info("没有历史数据，尝试使用AI生成基础目标", zap.Uint("userID", userID))
 		// 尝试使用AI生成基础目标
-		aiGoal, err := h.generateBasicGoalsWithAI(userID)
+		aiGoal, err := h.generateBasicGoalsWithAI(ctx, userID)
 		if err != nil {
 			logger.Error("AI生成基础目标失败", zap.Error(err))
 			// AI失败时使用默认目标
@@ -329,7 +330,7 @@ func (h *WritingStatsHandler) generateDailyGoals(userID uint, date time.Time) (*
 
 	// 尝试使用AI生成目标
 	logger.Info("尝试使用AI生成写作目标", zap.Int("历史数据天数", len(weeklyProgress)))
-	aiGoal, err := h.generateGoalsWithAI(weeklyProgress)
+	aiGoal, err := h.generateGoalsWithAI(ctx, userID, weeklyProgress)
 	if err != nil {
 		logger.Error("AI生成目标失败", zap.Error(err))
 		// AI失败时使用默认目标
@@ -353,7 +354,7 @@ func (h *WritingStatsHandler) generateDailyGoals(userID uint, date time.Time) (*
 }
 
 // generateBasicGoalsWithAI 为新用户使用AI生成基础写作目标
-func (h *WritingStatsHandler) generateBasicGoalsWithAI(userID uint) (*models.WritingGoal, error) {
+func (h *WritingStatsHandler) generateBasicGoalsWithAI(ctx context.Context, userID uint) (*models.WritingGoal, error) {
 	// 构建AI提示
 	prompt := `作为一个写作助手，请为一个刚开始使用写作平台的新用户制定合理的写作目标。
 
@@ -376,17 +377,14 @@ func (h *WritingStatsHandler) generateBasicGoalsWithAI(userID uint) (*models.Wri
 例如：1500,10000,50000`
 
 	// 获取LLM配置
-	apiKey, baseURL, model := config.GetLLMConfig()
+	apiKey, _, model := config.GetLLMConfig()
 	if apiKey == "" && !config.IsOllamaProvider() {
 		return nil, fmt.Errorf("LLM未配置")
 	}
 
-	// 创建LLM客户端
-	handler := llm.NewHandler(apiKey, baseURL, model)
-
 	// 调用AI
 	logger.Info("调用AI生成新用户基础目标", zap.String("model", model))
-	response, err := handler.GenerateText(prompt, 0.3, 100)
+	response, err := h.queryGoalsAI(ctx, userID, model, prompt)
 	if err != nil {
 		return nil, fmt.Errorf("AI调用失败: %v", err)
 	}
@@ -403,7 +401,7 @@ func (h *WritingStatsHandler) generateBasicGoalsWithAI(userID uint) (*models.Wri
 }
 
 // generateGoalsWithAI 使用AI生成写作目标
-func (h *WritingStatsHandler) generateGoalsWithAI(weeklyProgress []models.WritingProgress) (*models.WritingGoal, error) {
+func (h *WritingStatsHandler) generateGoalsWithAI(ctx context.Context, userID uint, weeklyProgress []models.WritingProgress) (*models.WritingGoal, error) {
 	// 构建历史数据描述
 	historyDesc := "过去一周的写作数据：\n"
 	totalWords := 0
@@ -443,21 +441,18 @@ func (h *WritingStatsHandler) generateGoalsWithAI(weeklyProgress []models.Writin
 例如：2000,15000,80000`, historyDesc)
 
 	// 获取LLM配置
-	apiKey, baseURL, model := config.GetLLMConfig()
+	apiKey, _, model := config.GetLLMConfig()
 	if apiKey == "" && !config.IsOllamaProvider() {
 		return nil, fmt.Errorf("LLM未配置")
 	}
 
-	// 创建LLM客户端
-	handler := llm.NewHandler(apiKey, baseURL, model)
-
 	// 调用AI
 	logger.Info("调用AI生成写作目标",
 		zap.String("model", model),
 		zap.Int("totalWords", totalWords),
 		zap.Int("avgDaily", avgDaily))
 
-	response, err := handler.GenerateText(prompt, 0.3, 100)
+	response, err := h.queryGoalsAI(ctx, userID, model, prompt)
 	if err != nil {
 		return nil, fmt.Errorf("AI调用失败: %v", err)
 	}
@@ -473,6 +468,24 @@ func (h *WritingStatsHandler) generateGoalsWithAI(weeklyProgress []models.Writin
 	return goals, nil
 }
 
+// queryGoalsAI 调用AI生成目标，用户配额已用完时返回错误（调用方回退到默认目标），用量计入台账
+func (h *WritingStatsHandler) queryGoalsAI(ctx context.Context, userID uint, model, prompt string) (string, error) {
+	var user models.User
+	h.db.Select("id", "role").First(&user, userID)
+	if status, err := loadQuotaStatus(h.db, userID, user.Role, time.Now()); err == nil {
+		if _, window := status.exceededWindow(); window != nil {
+			return "", fmt.Errorf("AI用量已达上限")
+		}
+	}
+
+	ctx, scope := llm.WithUsageScope(ctx)
+	ctx = llm.WithCallInfo(ctx, &llm.CallInfo{UserID: userID, Feature: featureWritingGoals})
+	defer recordLLMUsage(h.db, userID, featureWritingGoals, scope)
+
+	handler := llm.NewHandler(llm.NewMeteredProvider(llm.NewProviderFromConfig()), model)
+	return handler.GenerateText(ctx, prompt, 0.3, 100)
+}
+
 // parseAIGoalsResponse 解析AI生成的目标响应
 func (h *WritingStatsHandler) parseAIGoalsResponse(response string) (*models.WritingGoal, error) {
 	logger.Info("开始解析AI响应", zap.String("response", response))
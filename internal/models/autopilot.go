@@ -0,0 +1,178 @@
+package models
+
+import (
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+)
+
+// 自动写作任务状态
+const (
+	AutopilotPending   = "pending"   // 排队中
+	AutopilotPlanning  = "planning"  // 规划章节大纲
+	AutopilotRunning   = "running"   // 逐章生成中
+	AutopilotPaused    = "paused"    // 已暂停，可继续
+	AutopilotCompleted = "completed" // 已完成
+	AutopilotFailed    = "failed"    // 失败，可从失败的步骤继续
+	AutopilotCanceled  = "canceled"  // 已取消，已生成的章节保留
+)
+
+// 自动写作步骤状态
+const (
+	AutopilotStepPending   = "pending"   // 待生成
+	AutopilotStepRunning   = "running"   // 生成中
+	AutopilotStepCompleted = "completed" // 已生成
+	AutopilotStepFailed    = "failed"    // 生成失败
+)
+
+// AutopilotActiveStatuses 未结束的任务状态，同一小说同时只能有一个未结束的任务
+var AutopilotActiveStatuses = []string{AutopilotPending, AutopilotPlanning, AutopilotRunning, AutopilotPaused}
+
+// AutopilotJob 自动写作任务：按故事线节点规划章节大纲，再逐章生成并以草稿保存
+type AutopilotJob struct {
+	BaseModel
+	NovelID         uint            `json:"novelId" gorm:"index;comment:小说ID"`
+	UserID          uint            `json:"userId" gorm:"default:0;comment:创建用户ID，用量计入该用户"`
+	StorylineID     int             `json:"storylineId" gorm:"comment:故事线ID"`
+	NodeIDs         string          `json:"nodeIds" gorm:"size:500;comment:按顺序生成的故事节点ID列表(逗号分隔)"`
+	ChapterCount    int             `json:"chapterCount" gorm:"default:0;comment:计划生成的章节数，0 表示按节点的章节范围"`
+	VolumeID        uint            `json:"volumeId" gorm:"default:0;comment:生成的章节所属卷ID"`
+	TargetWordCount int             `json:"targetWordCount" gorm:"default:0;comment:每章目标字数"`
+	StartOrder      int             `json:"startOrder" gorm:"comment:第一章的章节序号"`
+	Status          string          `json:"status" gorm:"size:20;index;comment:状态(pending/planning/running/paused/completed/failed/canceled)"`
+	TotalSteps      int             `json:"totalSteps" gorm:"default:0;comment:规划的章节数"`
+	CompletedSteps  int             `json:"completedSteps" gorm:"default:0;comment:已生成的章节数"`
+	Error           string          `json:"error,omitempty" gorm:"type:text;comment:失败或暂停原因"`
+	StartedAt       *time.Time      `json:"startedAt" gorm:"comment:开始时间"`
+	FinishedAt      *time.Time      `json:"finishedAt" gorm:"comment:结束时间"`
+	Steps           []AutopilotStep `json:"steps,omitempty" gorm:"foreignKey:JobID"`
+}
+
+func (AutopilotJob) TableName() string {
+	return constants.TABLE_AUTOPILOT_JOB
+}
+
+// AutopilotStep 自动写作任务中的一章
+type AutopilotStep struct {
+	BaseModel
+	JobID        uint       `json:"jobId" gorm:"uniqueIndex:idx_autopilot_step;comment:任务ID"`
+	Seq          int        `json:"seq" gorm:"uniqueIndex:idx_autopilot_step;comment:步骤序号(从1开始)"`
+	NodeID       int        `json:"nodeId" gorm:"comment:所属故事节点ID"`
+	ChapterOrder int        `json:"chapterOrder" gorm:"comment:章节序号"`
+	Title        string     `json:"title" gorm:"size:255;comment:规划的章节标题"`
+	Outline      string     `json:"outline" gorm:"type:text;comment:规划的章节大纲"`
+	FocusPoints  []string   `json:"focusPoints" gorm:"serializer:json;type:text;comment:本章重点(JSON)"`
+	Status       string     `json:"status" gorm:"size:20;comment:状态(pending/running/completed/failed)"`
+	ChapterID    uint       `json:"chapterId" gorm:"default:0;comment:生成的章节ID"`
+	Summary      string     `json:"summary" gorm:"type:text;comment:生成的章节摘要"`
+	Error        string     `json:"error,omitempty" gorm:"type:text;comment:失败原因"`
+	FinishedAt   *time.Time `json:"finishedAt" gorm:"comment:完成时间"`
+}
+
+func (AutopilotStep) TableName() string {
+	return constants.TABLE_AUTOPILOT_STEP
+}
+
+// GetAutopilotJob 获取任务及其步骤，步骤按序号排列
+func GetAutopilotJob(db *gorm.DB, id uint) (*AutopilotJob, error) {
+	var job AutopilotJob
+	err := db.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("seq ASC")
+	}).First(&job, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListAutopilotJobs 获取小说的任务（不含步骤），最近创建的在前
+func ListAutopilotJobs(db *gorm.DB, novelID uint) ([]AutopilotJob, error) {
+	var jobs []AutopilotJob
+	err := db.Where("novel_id = ?", novelID).Order("id DESC").Find(&jobs).Error
+	return jobs, err
+}
+
+// ActiveAutopilotJob 返回小说未结束的任务，没有时返回 nil
+func ActiveAutopilotJob(db *gorm.DB, novelID uint) (*AutopilotJob, error) {
+	var jobs []AutopilotJob
+	err := db.Where("novel_id = ? AND status IN ?", novelID, AutopilotActiveStatuses).
+		Order("id DESC").Limit(1).Find(&jobs).Error
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// TransitionAutopilotJob 任务状态为 from 之一时改为 to，同时更新 fields；返回状态是否已改变
+func TransitionAutopilotJob(db *gorm.DB, id uint, from []string, to string, fields map[string]interface{}) (bool, error) {
+	updates := map[string]interface{}{"status": to}
+	for k, v := range fields {
+		updates[k] = v
+	}
+	result := db.Model(&AutopilotJob{}).Where("id = ? AND status IN ?", id, from).Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// SaveAutopilotPlan 保存规划的步骤并更新任务的章节数
+func SaveAutopilotPlan(db *gorm.DB, job *AutopilotJob, steps []AutopilotStep) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := range steps {
+			steps[i].JobID = job.ID
+			steps[i].Seq = i + 1
+			steps[i].Status = AutopilotStepPending
+		}
+		if len(steps) > 0 {
+			if err := tx.Create(&steps).Error; err != nil {
+				return err
+			}
+		}
+		job.Steps = steps
+		job.TotalSteps = len(steps)
+		return tx.Model(job).Update("total_steps", job.TotalSteps).Error
+	})
+}
+
+// CompleteAutopilotStep 将步骤标记为已生成，并增加任务的已生成章节数
+func CompleteAutopilotStep(db *gorm.DB, step *AutopilotStep) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		step.Status = AutopilotStepCompleted
+		step.Error = ""
+		step.FinishedAt = &now
+		if err := tx.Model(step).Select("status", "chapter_id", "summary", "error", "finished_at").Updates(step).Error; err != nil {
+			return err
+		}
+		return tx.Model(&AutopilotJob{}).Where("id = ?", step.JobID).
+			Update("completed_steps", gorm.Expr("completed_steps + 1")).Error
+	})
+}
+
+// ResumeAutopilotJob 将暂停或失败的任务重新排队，失败的步骤改为待生成；返回状态是否已改变
+func ResumeAutopilotJob(db *gorm.DB, id uint) (bool, error) {
+	resumed := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		resumed, err = TransitionAutopilotJob(tx, id, []string{AutopilotPaused, AutopilotFailed}, AutopilotPending,
+			map[string]interface{}{"error": "", "finished_at": nil})
+		if err != nil || !resumed {
+			return err
+		}
+		return tx.Model(&AutopilotStep{}).Where("job_id = ? AND status = ?", id, AutopilotStepFailed).
+			Updates(map[string]interface{}{"status": AutopilotStepPending, "error": ""}).Error
+	})
+	return resumed, err
+}
+
+// PauseInterruptedAutopilotJobs 服务重启后，将上次未执行完的任务标记为暂停，生成中的步骤改为待生成
+func PauseInterruptedAutopilotJobs(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&AutopilotJob{}).
+			Where("status IN ?", []string{AutopilotPending, AutopilotPlanning, AutopilotRunning}).
+			Updates(map[string]interface{}{"status": AutopilotPaused, "error": "服务重启，任务已暂停"}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&AutopilotStep{}).Where("status = ?", AutopilotStepRunning).
+			Update("status", AutopilotStepPending).Error
+	})
+}
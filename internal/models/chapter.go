@@ -1,23 +1,86 @@
 package models
 
-import "github.com/LingByte/LingDialog/pkg/constants"
+import (
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 只记录在章节元数据中、不修改章节的 AI 操作，与章节版本来源一起作为最近一次 AI 操作的取值
+const (
+	ChapterOperationAIExpand      = "ai-expand"      // AI 扩写段落
+	ChapterOperationAIOutline     = "ai-outline"     // AI 生成大纲
+	ChapterOperationAISuggestions = "ai-suggestions" // AI 生成后续章节建议
+)
+
+// ChapterStatusDraft 草稿状态，自动写作生成的章节以草稿保存，等待作者审阅
+const ChapterStatusDraft = "draft"
 
 // Chapter 章节模型
 type Chapter struct {
 	BaseModel
-	NovelID         uint   `json:"novelId" gorm:"index;comment:小说ID"`
-	VolumeID        uint   `json:"volumeId" gorm:"index;comment:卷ID"`
-	Title           string `json:"title" gorm:"size:255;not null;comment:章节标题"`
-	Content         string `json:"content" gorm:"type:text;comment:章节内容"`
-	Order           int    `json:"order" gorm:"comment:章节顺序"`
-	Summary         string `json:"summary" gorm:"type:text;comment:章节摘要"`
-	CharacterIDs    string `json:"characterIds" gorm:"size:500;comment:参与角色ID列表(逗号分隔)"`
-	PlotPointIDs    string `json:"plotPointIds" gorm:"size:500;comment:涉及情节ID列表(逗号分隔)"`
-	PreviousSummary string `json:"previousSummary" gorm:"type:text;comment:前文摘要"`
-	Outline         string `json:"outline" gorm:"type:text;comment:章节大纲"`
-	Status          string `json:"status" gorm:"size:50;comment:章节状态(draft/generated/reviewed/published)"`
+	NovelID         uint            `json:"novelId" gorm:"index;comment:小说ID"`
+	VolumeID        uint            `json:"volumeId" gorm:"index;comment:卷ID"`
+	Title           string          `json:"title" gorm:"size:255;not null;comment:章节标题"`
+	Content         string          `json:"content" gorm:"type:text;comment:章节内容"`
+	Order           int             `json:"order" gorm:"comment:章节顺序"`
+	Summary         string          `json:"summary" gorm:"type:text;comment:章节摘要"`
+	SummaryStale    bool            `json:"summaryStale" gorm:"default:false;comment:内容修改后摘要尚未更新"`
+	CharacterIDs    string          `json:"characterIds" gorm:"size:500;comment:参与角色ID列表(逗号分隔)"`
+	PlotPointIDs    string          `json:"plotPointIds" gorm:"size:500;comment:涉及情节ID列表(逗号分隔)"`
+	PreviousSummary string          `json:"previousSummary" gorm:"type:text;comment:前文摘要"`
+	Outline         string          `json:"outline" gorm:"type:text;comment:章节大纲"`
+	Status          string          `json:"status" gorm:"size:50;comment:章节状态(draft/generated/reviewed/published)"`
+	Metadata        ChapterMetadata `json:"metadata" gorm:"serializer:json;type:text;comment:AI 生成元数据(JSON)"`
+
+	GeneratedForeshadowing ChapterForeshadowing `json:"-" gorm:"serializer:json;type:text;comment:生成结果中的伏笔(JSON)"`
 }
 
 func (Chapter) TableName() string {
 	return constants.TABLE_CHAPTER
 }
+
+// ChapterMetadata AI 操作章节时记录的元数据：生成章节时覆盖生成结果字段，续写、优化等操作只更新最近操作
+type ChapterMetadata struct {
+	KeyEvents       []string `json:"keyEvents,omitempty"`       // 关键事件
+	CharacterDev    string   `json:"characterDev,omitempty"`    // 角色发展
+	PlotProgress    string   `json:"plotProgress,omitempty"`    // 情节推进
+	Foreshadowing   string   `json:"foreshadowing,omitempty"`   // 伏笔设置
+	NextChapterHint string   `json:"nextChapterHint,omitempty"` // 下章提示，生成下一章时作为默认重点
+	TargetWordCount int      `json:"targetWordCount,omitempty"` // 生成时的目标字数
+	Model           string   `json:"model,omitempty"`           // 生成时使用的模型
+	PromptVersion   string   `json:"promptVersion,omitempty"`   // 生成时使用的提示词模板版本
+
+	LastOperation string     `json:"lastOperation,omitempty"` // 最近一次 AI 操作，取值为章节版本来源或 ChapterOperation*
+	LastModel     string     `json:"lastModel,omitempty"`     // 最近一次 AI 操作使用的模型
+	UpdatedAt     *time.Time `json:"updatedAt,omitempty"`     // 最近一次 AI 操作时间
+}
+
+// UpdateChapterMetadata 读取章节元数据，由 update 修改后写回，只更新元数据字段
+func UpdateChapterMetadata(db *gorm.DB, chapterID uint, update func(meta *ChapterMetadata)) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var chapter Chapter
+		if err := tx.Select("id", "metadata").First(&chapter, chapterID).Error; err != nil {
+			return err
+		}
+		update(&chapter.Metadata)
+		now := time.Now()
+		chapter.Metadata.UpdatedAt = &now
+		return tx.Model(&chapter).Select("metadata").Updates(&chapter).Error
+	})
+}
+
+// PreviousChapter 返回小说中序号小于 order 的最后一章，没有时返回 nil
+func PreviousChapter(db *gorm.DB, novelID uint, order int) (*Chapter, error) {
+	var chapters []Chapter
+	err := db.Where("novel_id = ?", novelID).
+		Where(clause.Lt{Column: clause.Column{Name: "order"}, Value: order}).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "order"}, Desc: true}).
+		Limit(1).Find(&chapters).Error
+	if err != nil || len(chapters) == 0 {
+		return nil, err
+	}
+	return &chapters[0], nil
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 章节实体类型
+const (
+	ChapterEntityCharacter = "character"  // 角色
+	ChapterEntityPlotPoint = "plot_point" // 情节
+	ChapterEntitySetting   = "setting"    // 设定（地点以外的分类）
+	ChapterEntityLocation  = "location"   // 地点（分类为 location 的设定）
+)
+
+// 章节实体来源
+const (
+	ChapterEntitySourceMatch  = "match"  // 正文中匹配到名称或别名
+	ChapterEntitySourceAI     = "ai"     // 匹配后经 AI 确认
+	ChapterEntitySourceManual = "manual" // 作者在章节的参与角色、涉及情节中填写
+)
+
+// ChapterEntity 章节中出现的角色、情节、设定或地点，保存章节时自动提取
+type ChapterEntity struct {
+	BaseModel
+	NovelID    uint   `json:"novelId" gorm:"index;comment:小说ID"`
+	ChapterID  uint   `json:"chapterId" gorm:"uniqueIndex:idx_chapter_entity;comment:章节ID"`
+	EntityType string `json:"entityType" gorm:"size:20;uniqueIndex:idx_chapter_entity;index:idx_entity_chapters;comment:实体类型(character/plot_point/setting/location)"`
+	EntityID   uint   `json:"entityId" gorm:"uniqueIndex:idx_chapter_entity;index:idx_entity_chapters;comment:实体ID"`
+	Name       string `json:"name" gorm:"size:255;comment:提取时的实体名称"`
+	Mentions   int    `json:"mentions" gorm:"default:0;comment:名称和别名在正文中出现的次数"`
+	Source     string `json:"source" gorm:"size:20;default:'match';comment:来源(match/ai/manual)"`
+}
+
+func (ChapterEntity) TableName() string {
+	return constants.TABLE_CHAPTER_ENTITY
+}
+
+// IsValidChapterEntityType 是否为支持的章节实体类型
+func IsValidChapterEntityType(entityType string) bool {
+	switch entityType {
+	case ChapterEntityCharacter, ChapterEntityPlotPoint, ChapterEntitySetting, ChapterEntityLocation:
+		return true
+	}
+	return false
+}
+
+// ReplaceChapterEntities 用新的提取结果替换章节已有的实体
+func ReplaceChapterEntities(db *gorm.DB, chapterID uint, entities []ChapterEntity) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("chapter_id = ?", chapterID).Delete(&ChapterEntity{}).Error; err != nil {
+			return err
+		}
+		if len(entities) == 0 {
+			return nil
+		}
+		for i := range entities {
+			entities[i].ID = 0
+			entities[i].ChapterID = chapterID
+		}
+		return tx.Create(&entities).Error
+	})
+}
+
+// ListChapterEntities 获取章节中出现的实体，同类型按出现次数排序
+func ListChapterEntities(db *gorm.DB, chapterID uint) ([]ChapterEntity, error) {
+	var entities []ChapterEntity
+	err := db.Where("chapter_id = ?", chapterID).
+		Order("entity_type ASC, mentions DESC, id ASC").Find(&entities).Error
+	return entities, err
+}
+
+// DeleteEntityLinks 删除实体与章节的关联，删除角色、情节或设定时调用
+func DeleteEntityLinks(db *gorm.DB, entityID uint, entityTypes ...string) error {
+	return db.Where("entity_type IN ? AND entity_id = ?", entityTypes, entityID).Delete(&ChapterEntity{}).Error
+}
+
+// EntityChapter 实体出现的章节
+type EntityChapter struct {
+	ChapterID uint   `json:"chapterId"`
+	VolumeID  uint   `json:"volumeId"`
+	Title     string `json:"title"`
+	Order     int    `json:"order"`
+	Mentions  int    `json:"mentions"`
+	Source    string `json:"source"`
+}
+
+// ListEntityChapters 获取实体出现的章节，按章节顺序排列
+func ListEntityChapters(db *gorm.DB, entityType string, entityID uint) ([]EntityChapter, error) {
+	var links []ChapterEntity
+	if err := db.Where("entity_type = ? AND entity_id = ?", entityType, entityID).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return []EntityChapter{}, nil
+	}
+	byChapter := make(map[uint]*ChapterEntity, len(links))
+	chapterIDs := make([]uint, 0, len(links))
+	for i := range links {
+		byChapter[links[i].ChapterID] = &links[i]
+		chapterIDs = append(chapterIDs, links[i].ChapterID)
+	}
+
+	var chapters []Chapter
+	if err := db.Select("id", "volume_id", "title", "order").Where("id IN ?", chapterIDs).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "order"}}).Order("id ASC").
+		Find(&chapters).Error; err != nil {
+		return nil, err
+	}
+	result := make([]EntityChapter, 0, len(chapters))
+	for _, ch := range chapters {
+		link := byChapter[ch.ID]
+		result = append(result, EntityChapter{
+			ChapterID: ch.ID,
+			VolumeID:  ch.VolumeID,
+			Title:     ch.Title,
+			Order:     ch.Order,
+			Mentions:  link.Mentions,
+			Source:    link.Source,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+)
+
+// 章节版本来源
+const (
+	ChapterRevisionSourceManual     = "manual"      // 手动编辑
+	ChapterRevisionSourceAIGenerate = "ai-generate" // AI 生成
+	ChapterRevisionSourceAIRefine   = "ai-refine"   // AI 优化
+	ChapterRevisionSourceAIContinue = "ai-continue" // AI 续写
+	ChapterRevisionSourceAISummary  = "ai-summary"  // AI 生成摘要
+	ChapterRevisionSourceImport     = "import"      // 导入，或启用版本历史前已有的内容
+	ChapterRevisionSourceRestore    = "restore"     // 从历史版本恢复
+)
+
+// ChapterRevision 章节版本快照，章节标题、内容、大纲或摘要每次变更后记录一条
+type ChapterRevision struct {
+	BaseModel
+	ChapterID     uint   `json:"chapterId" gorm:"not null;uniqueIndex:idx_chapter_revision_version;comment:章节ID"`
+	NovelID       uint   `json:"novelId" gorm:"index;comment:小说ID"`
+	Version       int    `json:"version" gorm:"not null;uniqueIndex:idx_chapter_revision_version;comment:版本号(章节内递增)"`
+	Title         string `json:"title" gorm:"size:255;comment:章节标题"`
+	Content       string `json:"content,omitempty" gorm:"type:text;comment:章节内容"`
+	Outline       string `json:"outline,omitempty" gorm:"type:text;comment:章节大纲"`
+	Summary       string `json:"summary,omitempty" gorm:"type:text;comment:章节摘要"`
+	ContentLength int    `json:"contentLength" gorm:"default:0;comment:内容字数"`
+	Source        string `json:"source" gorm:"size:20;index;comment:来源(manual/ai-generate/ai-refine/ai-continue/ai-summary/import/restore)"`
+	AuthorID      uint   `json:"authorId" gorm:"default:0;comment:修改人ID(未知为0)"`
+	Note          string `json:"note" gorm:"size:255;comment:备注"`
+}
+
+func (ChapterRevision) TableName() string {
+	return constants.TABLE_CHAPTER_REVISION
+}
+
+// sameContent 版本内容是否与章节一致
+func (r *ChapterRevision) sameContent(chapter *Chapter) bool {
+	return r.Title == chapter.Title && r.Content == chapter.Content &&
+		r.Outline == chapter.Outline && r.Summary == chapter.Summary
+}
+
+// Apply 将版本内容写回章节（只修改内存中的章节）
+func (r *ChapterRevision) Apply(chapter *Chapter) {
+	chapter.Title = r.Title
+	chapter.Content = r.Content
+	chapter.Outline = r.Outline
+	chapter.Summary = r.Summary
+}
+
+// RecordChapterRevision 记录章节变更后的版本，before 为变更前的章节（可为空）
+// 章节还没有任何版本时，先将 before 记为导入版本，保证修改前的内容可以恢复；
+// 内容与最新版本相同时不重复记录，返回 nil
+func RecordChapterRevision(db *gorm.DB, before, after *Chapter, source string, authorID uint, note string) (*ChapterRevision, error) {
+	var revision *ChapterRevision
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var latest ChapterRevision
+		err := tx.Where("chapter_id = ?", after.ID).Order("version DESC").First(&latest).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) && before != nil {
+			if baseline := newChapterRevision(before, 1, ChapterRevisionSourceImport, 0, ""); !baseline.sameContent(after) {
+				if err := tx.Create(baseline).Error; err != nil {
+					return err
+				}
+				latest = *baseline
+			}
+		}
+		if latest.ID != 0 && latest.sameContent(after) {
+			return nil
+		}
+		revision = newChapterRevision(after, latest.Version+1, source, authorID, note)
+		return tx.Create(revision).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// newChapterRevision 创建章节快照
+func newChapterRevision(chapter *Chapter, version int, source string, authorID uint, note string) *ChapterRevision {
+	return &ChapterRevision{
+		ChapterID:     chapter.ID,
+		NovelID:       chapter.NovelID,
+		Version:       version,
+		Title:         chapter.Title,
+		Content:       chapter.Content,
+		Outline:       chapter.Outline,
+		Summary:       chapter.Summary,
+		ContentLength: len([]rune(chapter.Content)),
+		Source:        source,
+		AuthorID:      authorID,
+		Note:          note,
+	}
+}
+
+// ListChapterRevisions 获取章节的版本列表（按版本号倒序），列表不含内容、大纲和摘要
+func ListChapterRevisions(db *gorm.DB, chapterID uint) ([]ChapterRevision, error) {
+	revisions := []ChapterRevision{}
+	err := db.Where("chapter_id = ?", chapterID).
+		Omit("content", "outline", "summary").
+		Order("version DESC").
+		Find(&revisions).Error
+	return revisions, err
+}
+
+// GetChapterRevision 获取章节的指定版本
+func GetChapterRevision(db *gorm.DB, chapterID, revisionID uint) (*ChapterRevision, error) {
+	var revision ChapterRevision
+	if err := db.Where("id = ? AND chapter_id = ?", revisionID, chapterID).First(&revision).Error; err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// UpdateChapterContent 保存章节的标题、内容、大纲和摘要，并在同一事务中记录版本
+func UpdateChapterContent(db *gorm.DB, before, after *Chapter, source string, authorID uint, note string) (*ChapterRevision, error) {
+	var revision *ChapterRevision
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Chapter{}).Where("id = ?", after.ID).Updates(map[string]interface{}{
+			"title":   after.Title,
+			"content": after.Content,
+			"outline": after.Outline,
+			"summary": after.Summary,
+		}).Error
+		if err != nil {
+			return err
+		}
+		revision, err = RecordChapterRevision(tx, before, after, source, authorID, note)
+		return err
+	})
+	return revision, err
+}
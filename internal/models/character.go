@@ -1,15 +1,54 @@
 package models
 
-import "github.com/LingByte/LingDialog/pkg/constants"
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/LingByte/LingDialog/pkg/constants"
+)
 
 // Character 角色模型
 type Character struct {
 	BaseModel
-	NovelID     uint   `json:"novelId" gorm:"index;comment:小说ID"`
-	Name        string `json:"name" gorm:"size:255;not null;comment:角色名称"`
-	Description string `json:"description" gorm:"type:text;comment:角色描述"`
+	NovelID         uint   `json:"novelId" gorm:"index;comment:小说ID"`
+	Name            string `json:"name" gorm:"size:255;not null;comment:角色名称"`
+	Aliases         string `json:"aliases" gorm:"size:500;comment:别名(逗号分隔)"`
+	Role            string `json:"role" gorm:"size:50;comment:角色定位(主角/配角/反派等)"`
+	Gender          string `json:"gender" gorm:"size:20;comment:性别"`
+	Age             string `json:"age" gorm:"size:50;comment:年龄"`
+	Description     string `json:"description" gorm:"type:text;comment:角色简介"`
+	Appearance      string `json:"appearance" gorm:"type:text;comment:外貌"`
+	Personality     string `json:"personality" gorm:"type:text;comment:性格"`
+	Background      string `json:"background" gorm:"type:text;comment:背景经历"`
+	Goals           string `json:"goals" gorm:"type:text;comment:目标动机"`
+	Abilities       string `json:"abilities" gorm:"type:text;comment:能力技能"`
+	PowerLevel      string `json:"powerLevel" gorm:"size:100;comment:实力等级"`
+	Faction         string `json:"faction" gorm:"size:100;index;comment:所属势力"`
+	FirstChapterID  uint   `json:"firstChapterId" gorm:"default:0;comment:首次出场章节ID"`
+	Status          string `json:"status" gorm:"size:20;default:'alive';comment:状态(alive/dead/missing)"`
+	Attributes      string `json:"attributes" gorm:"type:text;comment:自定义属性(JSON对象)"`
+	ProfileMigrated bool   `json:"-" gorm:"default:false;comment:旧描述是否已检查并迁移为结构化档案"`
 }
 
 func (Character) TableName() string {
 	return constants.TABLE_CHARACTER
 }
+
+// SplitAliases 拆分逗号、顿号分隔的别名
+func SplitAliases(aliases string) []string {
+	return strings.FieldsFunc(aliases, func(r rune) bool {
+		return r == ',' || r == '，' || r == '、'
+	})
+}
+
+// ParseCharacterAttributes 解析自定义属性 JSON，为空时返回 nil
+func ParseCharacterAttributes(attributes string) (map[string]string, error) {
+	if strings.TrimSpace(attributes) == "" {
+		return nil, nil
+	}
+	var attrs map[string]string
+	if err := json.Unmarshal([]byte(attributes), &attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+)
+
+// CharacterRelationshipStatusSuggested AI 建议、等待作者确认的关系
+const CharacterRelationshipStatusSuggested = "suggested"
+
+// CharacterRelationship 角色关系，单向关系由 From 指向 To
+type CharacterRelationship struct {
+	BaseModel
+	NovelID          uint   `json:"novelId" gorm:"index;comment:小说ID"`
+	FromCharacterID  uint   `json:"fromCharacterId" gorm:"not null;index;comment:起始角色ID"`
+	ToCharacterID    uint   `json:"toCharacterId" gorm:"not null;index;comment:目标角色ID"`
+	Type             string `json:"type" gorm:"size:20;not null;comment:关系类型(family/mentor/rival/lover/ally/enemy/custom)"`
+	Label            string `json:"label" gorm:"size:50;comment:具体称谓(自定义类型时为关系名称)"`
+	Description      string `json:"description" gorm:"type:text;comment:关系描述"`
+	Intensity        int    `json:"intensity" gorm:"default:5;comment:关系强度(1-10)"`
+	ValidFromChapter int    `json:"validFromChapter" gorm:"default:0;comment:开始的章节序号(0表示故事开始前已存在)"`
+	ValidToChapter   int    `json:"validToChapter" gorm:"default:0;comment:结束的章节序号(0表示持续至今)"`
+	Directional      bool   `json:"directional" gorm:"default:false;comment:是否单向"`
+	Status           string `json:"status" gorm:"size:20;index;comment:状态(suggested为AI建议待确认，空为正式关系)"`
+}
+
+func (CharacterRelationship) TableName() string {
+	return constants.TABLE_CHARACTER_RELATIONSHIP
+}
+
+// ListCharacterRelationships 获取小说的角色关系，asOfChapter 大于 0 时只返回该章节时存在的关系
+// includeSuggested 为 false 时不包含待确认的 AI 建议
+func ListCharacterRelationships(db *gorm.DB, novelID uint, asOfChapter int, includeSuggested bool) ([]CharacterRelationship, error) {
+	query := db.Where("novel_id = ?", novelID)
+	if !includeSuggested {
+		query = query.Where("COALESCE(status, '') <> ?", CharacterRelationshipStatusSuggested)
+	}
+	if asOfChapter > 0 {
+		query = query.Where("valid_from_chapter <= ? AND (valid_to_chapter <= 0 OR valid_to_chapter >= ?)", asOfChapter, asOfChapter)
+	}
+	var relationships []CharacterRelationship
+	err := query.Order("id ASC").Find(&relationships).Error
+	return relationships, err
+}
@@ -32,21 +32,29 @@ func (ChatSession) TableName() string {
 type ChatMessage struct {
 	BaseModel
 	SessionID uint   `json:"sessionId" gorm:"not null;comment:会话ID"`
-	Role      string `json:"role" gorm:"size:20;not null;comment:角色(user/assistant/system)"`
+	Role      string `json:"role" gorm:"size:20;not null;comment:角色(user/assistant/system/tool)"`
 	Content   string `json:"content" gorm:"type:text;not null;comment:消息内容"`
 
+	// 工具调用
+	ToolCalls  string `json:"toolCalls,omitempty" gorm:"type:text;comment:助手请求的工具调用(JSON)"`
+	ToolCallID string `json:"toolCallId,omitempty" gorm:"size:100;comment:工具结果对应的调用ID"`
+	ToolName   string `json:"toolName,omitempty" gorm:"size:100;comment:工具名称"`
+
 	// Token 统计
 	PromptTokens     int `json:"promptTokens" gorm:"default:0;comment:输入token数"`
 	CompletionTokens int `json:"completionTokens" gorm:"default:0;comment:输出token数"`
 	TotalTokens      int `json:"totalTokens" gorm:"default:0;comment:总token数"`
 
 	// 模型信息
-	Model       string  `json:"model" gorm:"size:100;comment:使用的模型"`
-	Temperature float32 `json:"temperature" gorm:"comment:温度参数"`
-	MaxTokens   int     `json:"maxTokens" gorm:"comment:最大token限制"`
+	Model         string  `json:"model" gorm:"size:100;comment:使用的模型"`
+	Temperature   float32 `json:"temperature" gorm:"comment:温度参数"`
+	MaxTokens     int     `json:"maxTokens" gorm:"comment:最大token限制"`
+	PromptVersion string  `json:"promptVersion,omitempty" gorm:"size:100;comment:系统提示词模板版本"`
 
 	// 响应时间统计
 	ResponseTime int64 `json:"responseTime" gorm:"comment:响应时间(毫秒)"`
+	Cached       bool  `json:"cached" gorm:"default:false;comment:是否命中响应缓存"`
+	Interrupted  bool  `json:"interrupted" gorm:"default:false;comment:回复是否因客户端断开或错误中途停止"`
 
 	// 关联
 	Session ChatSession `json:"session,omitempty" gorm:"foreignKey:SessionID"`
@@ -68,6 +76,8 @@ type ChatUsage struct {
 	TotalTokens      int `json:"totalTokens" gorm:"default:0;comment:总token消耗"`
 	PromptTokens     int `json:"promptTokens" gorm:"default:0;comment:输入token数"`
 	CompletionTokens int `json:"completionTokens" gorm:"default:0;comment:输出token数"`
+	CacheHits        int `json:"cacheHits" gorm:"default:0;comment:响应缓存命中次数"`
+	CachedTokens     int `json:"cachedTokens" gorm:"default:0;comment:缓存命中节省的token数"`
 
 	// 关联
 	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
@@ -87,10 +97,18 @@ func (cs *ChatSession) BeforeCreate(tx *gorm.DB) error {
 
 // AfterCreate 创建后钩子 - 更新用户统计
 func (cm *ChatMessage) AfterCreate(tx *gorm.DB) error {
+	// 命中缓存的回复不消耗 token，单独计入缓存统计
+	consumed, saved, hits := cm.TotalTokens, 0, 0
+	prompt, completion := cm.PromptTokens, cm.CompletionTokens
+	if cm.Cached {
+		consumed, saved, hits = 0, cm.TotalTokens, 1
+		prompt, completion = 0, 0
+	}
+
 	// 更新会话统计
 	tx.Model(&ChatSession{}).Where("id = ?", cm.SessionID).Updates(map[string]interface{}{
 		"message_count": gorm.Expr("message_count + 1"),
-		"total_tokens":  gorm.Expr("total_tokens + ?", cm.TotalTokens),
+		"total_tokens":  gorm.Expr("total_tokens + ?", consumed),
 	})
 
 	// 更新用户每日统计
@@ -109,9 +127,11 @@ func (cm *ChatMessage) AfterCreate(tx *gorm.DB) error {
 	tx.Where("user_id = ? AND date = ?", session.UserID, date).
 		Assign(map[string]interface{}{
 			"message_count":     gorm.Expr("message_count + 1"),
-			"total_tokens":      gorm.Expr("total_tokens + ?", cm.TotalTokens),
-			"prompt_tokens":     gorm.Expr("prompt_tokens + ?", cm.PromptTokens),
-			"completion_tokens": gorm.Expr("completion_tokens + ?", cm.CompletionTokens),
+			"total_tokens":      gorm.Expr("total_tokens + ?", consumed),
+			"prompt_tokens":     gorm.Expr("prompt_tokens + ?", prompt),
+			"completion_tokens": gorm.Expr("completion_tokens + ?", completion),
+			"cache_hits":        gorm.Expr("cache_hits + ?", hits),
+			"cached_tokens":     gorm.Expr("cached_tokens + ?", saved),
 		}).
 		FirstOrCreate(&usage)
 
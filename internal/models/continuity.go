@@ -0,0 +1,131 @@
+package models
+
+import (
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+)
+
+// 连续性检查的触发方式
+const (
+	ContinuityTriggerManual = "manual" // 作者手动触发
+	ContinuityTriggerAuto   = "auto"   // 保存章节后自动触发
+)
+
+// 连续性检查状态
+const (
+	ContinuityCheckPending   = "pending"   // 排队中
+	ContinuityCheckRunning   = "running"   // 检查中
+	ContinuityCheckCompleted = "completed" // 已完成
+	ContinuityCheckFailed    = "failed"    // 失败
+)
+
+// 章节问题状态
+const (
+	ChapterIssueOpen       = "open"       // 待处理
+	ChapterIssueResolved   = "resolved"   // 已修改
+	ChapterIssueDismissed  = "dismissed"  // 作者确认不是问题，之后的检查不再报告
+	ChapterIssueSuperseded = "superseded" // 未处理时章节被重新检查，由新结果取代
+)
+
+// ContinuityCheck 一次章节连续性检查
+type ContinuityCheck struct {
+	BaseModel
+	NovelID     uint       `json:"novelId" gorm:"index;comment:小说ID"`
+	ChapterID   uint       `json:"chapterId" gorm:"index;comment:章节ID"`
+	UserID      uint       `json:"userId" gorm:"default:0;comment:触发用户ID"`
+	Trigger     string     `json:"trigger" gorm:"size:20;comment:触发方式(manual/auto)"`
+	Status      string     `json:"status" gorm:"size:20;index;comment:状态(pending/running/completed/failed)"`
+	ContentHash string     `json:"contentHash" gorm:"size:64;comment:检查时章节内容的哈希"`
+	IssueCount  int        `json:"issueCount" gorm:"default:0;comment:发现的问题数"`
+	Error       string     `json:"error,omitempty" gorm:"type:text;comment:失败原因"`
+	FinishedAt  *time.Time `json:"finishedAt" gorm:"comment:完成时间"`
+}
+
+func (ContinuityCheck) TableName() string {
+	return constants.TABLE_CONTINUITY_CHECK
+}
+
+// ChapterIssue 连续性检查发现的章节问题
+type ChapterIssue struct {
+	BaseModel
+	NovelID     uint       `json:"novelId" gorm:"index;comment:小说ID"`
+	ChapterID   uint       `json:"chapterId" gorm:"index;comment:章节ID"`
+	CheckID     uint       `json:"checkId" gorm:"index;comment:连续性检查ID"`
+	Category    string     `json:"category" gorm:"size:20;comment:分类(setting/character/plot/timeline)"`
+	Severity    string     `json:"severity" gorm:"size:20;index;comment:严重程度(low/medium/high)"`
+	Quote       string     `json:"quote" gorm:"type:text;comment:引发问题的原文片段"`
+	Position    int        `json:"position" gorm:"default:-1;comment:原文片段在章节中的字符位置(-1表示未找到)"`
+	Description string     `json:"description" gorm:"type:text;comment:矛盾说明"`
+	Reference   string     `json:"reference" gorm:"type:text;comment:与之矛盾的设定、角色或前文"`
+	Suggestion  string     `json:"suggestion" gorm:"type:text;comment:修改建议"`
+	Status      string     `json:"status" gorm:"size:20;index;default:'open';comment:状态(open/resolved/dismissed/superseded)"`
+	ResolvedBy  uint       `json:"resolvedBy" gorm:"default:0;comment:处理人ID"`
+	ResolvedAt  *time.Time `json:"resolvedAt" gorm:"comment:处理时间"`
+	Note        string     `json:"note" gorm:"size:500;comment:处理备注"`
+}
+
+func (ChapterIssue) TableName() string {
+	return constants.TABLE_CHAPTER_ISSUE
+}
+
+// HasActiveContinuityCheck 章节是否有排队中或检查中的连续性检查
+func HasActiveContinuityCheck(db *gorm.DB, chapterID uint) (bool, error) {
+	var count int64
+	err := db.Model(&ContinuityCheck{}).
+		Where("chapter_id = ? AND status IN ?", chapterID, []string{ContinuityCheckPending, ContinuityCheckRunning}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// LastCheckedContentHash 返回章节最近一次成功检查时的内容哈希，没有时为空
+func LastCheckedContentHash(db *gorm.DB, chapterID uint) (string, error) {
+	var check ContinuityCheck
+	err := db.Where("chapter_id = ? AND status = ?", chapterID, ContinuityCheckCompleted).
+		Order("id DESC").Limit(1).Find(&check).Error
+	return check.ContentHash, err
+}
+
+// FailInterruptedContinuityChecks 服务重启后，将上次排队中或检查中的检查标记为失败，避免章节一直无法再次检查
+func FailInterruptedContinuityChecks(db *gorm.DB) error {
+	now := time.Now()
+	return db.Model(&ContinuityCheck{}).
+		Where("status IN ?", []string{ContinuityCheckPending, ContinuityCheckRunning}).
+		Updates(map[string]interface{}{"status": ContinuityCheckFailed, "error": "服务重启，检查已中断", "finished_at": &now}).Error
+}
+
+// CompleteContinuityCheck 保存检查结果：之前未处理的问题标记为已取代，写入新问题并更新检查状态
+func CompleteContinuityCheck(db *gorm.DB, check *ContinuityCheck, issues []ChapterIssue) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&ChapterIssue{}).
+			Where("chapter_id = ? AND status = ? AND check_id <> ?", check.ChapterID, ChapterIssueOpen, check.ID).
+			Update("status", ChapterIssueSuperseded).Error; err != nil {
+			return err
+		}
+		for i := range issues {
+			issues[i].NovelID = check.NovelID
+			issues[i].ChapterID = check.ChapterID
+			issues[i].CheckID = check.ID
+			issues[i].Status = ChapterIssueOpen
+		}
+		if len(issues) > 0 {
+			if err := tx.Create(&issues).Error; err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		check.Status = ContinuityCheckCompleted
+		check.IssueCount = len(issues)
+		check.FinishedAt = &now
+		return tx.Model(check).Select("status", "issue_count", "finished_at").Updates(check).Error
+	})
+}
+
+// DismissedChapterIssues 返回章节中作者确认不是问题的记录
+func DismissedChapterIssues(db *gorm.DB, chapterID uint) ([]ChapterIssue, error) {
+	var issues []ChapterIssue
+	err := db.Where("chapter_id = ? AND status = ?", chapterID, ChapterIssueDismissed).
+		Order("id ASC").Find(&issues).Error
+	return issues, err
+}
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 伏笔状态
+const (
+	ForeshadowingOpen      = "open"      // 未回收
+	ForeshadowingPaidOff   = "paid_off"  // 已回收
+	ForeshadowingAbandoned = "abandoned" // 已放弃
+)
+
+// 伏笔来源
+const (
+	ForeshadowingSourceManual = "manual" // 作者手动添加
+	ForeshadowingSourceAI     = "ai"     // AI 生成章节时记录
+)
+
+// Foreshadowing 伏笔：记录埋下的线索、计划的回收方式和回收情况
+type Foreshadowing struct {
+	BaseModel
+	NovelID            uint       `json:"novelId" gorm:"index;comment:小说ID"`
+	Description        string     `json:"description" gorm:"type:text;not null;comment:伏笔内容"`
+	IntendedPayoff     string     `json:"intendedPayoff" gorm:"type:text;comment:计划的回收方式"`
+	SetupChapterID     uint       `json:"setupChapterId" gorm:"default:0;comment:埋下伏笔的章节ID"`
+	SetupChapterOrder  int        `json:"setupChapterOrder" gorm:"default:0;comment:埋下伏笔的章节序号"`
+	Status             string     `json:"status" gorm:"size:20;index;default:'open';comment:状态(open/paid_off/abandoned)"`
+	PayoffChapterID    uint       `json:"payoffChapterId" gorm:"default:0;comment:回收伏笔的章节ID"`
+	PayoffChapterOrder int        `json:"payoffChapterOrder" gorm:"default:0;comment:回收伏笔的章节序号"`
+	ClosedAt           *time.Time `json:"closedAt" gorm:"comment:回收或放弃时间"`
+	Source             string     `json:"source" gorm:"size:20;default:'manual';comment:来源(manual/ai)"`
+	Note               string     `json:"note" gorm:"size:500;comment:备注"`
+}
+
+func (Foreshadowing) TableName() string {
+	return constants.TABLE_FORESHADOWING
+}
+
+// IsValidForeshadowingStatus 是否为支持的伏笔状态
+func IsValidForeshadowingStatus(status string) bool {
+	switch status {
+	case ForeshadowingOpen, ForeshadowingPaidOff, ForeshadowingAbandoned:
+		return true
+	}
+	return false
+}
+
+// ListForeshadowings 获取小说的伏笔，按埋下的章节先后排序；status 为空时返回全部
+func ListForeshadowings(db *gorm.DB, novelID uint, status string) ([]Foreshadowing, error) {
+	query := db.Where("novel_id = ?", novelID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var items []Foreshadowing
+	err := query.Order("setup_chapter_order ASC, id ASC").Find(&items).Error
+	return items, err
+}
+
+// PayOffForeshadowings 将小说中指定的未回收伏笔标记为在该章节回收
+func PayOffForeshadowings(db *gorm.DB, novelID uint, ids []uint, chapterID uint, chapterOrder int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Model(&Foreshadowing{}).
+		Where("novel_id = ? AND id IN ? AND status = ?", novelID, ids, ForeshadowingOpen).
+		Updates(map[string]interface{}{
+			"status":               ForeshadowingPaidOff,
+			"payoff_chapter_id":    chapterID,
+			"payoff_chapter_order": chapterOrder,
+			"closed_at":            time.Now(),
+		}).Error
+}
+
+// ChapterForeshadowing 章节生成结果中的伏笔，作者保存章节内容后才写入伏笔表，未保存的草稿不影响伏笔
+type ChapterForeshadowing struct {
+	Pending    *PendingForeshadowing `json:"pending,omitempty"`    // 最近一次生成结果中待记录的伏笔
+	PaidOffIDs []uint                `json:"paidOffIds,omitempty"` // 已记录的生成结果中本章回收的伏笔ID
+}
+
+// PendingForeshadowing 生成章节时识别出的伏笔
+type PendingForeshadowing struct {
+	Setups     []PendingForeshadowingSetup `json:"setups,omitempty"`     // 本章新埋下的伏笔
+	PaidOffIDs []uint                      `json:"paidOffIds,omitempty"` // 本章回收的伏笔ID
+}
+
+// PendingForeshadowingSetup 待记录的新伏笔
+type PendingForeshadowingSetup struct {
+	Description string `json:"description"`
+	Payoff      string `json:"payoff,omitempty"`
+}
+
+// SetPendingForeshadowing 保存章节生成结果中待记录的伏笔，重新生成时替换上一次未保存的结果；章节不属于该小说时返回 gorm.ErrRecordNotFound
+func SetPendingForeshadowing(db *gorm.DB, novelID, chapterID uint, pending *PendingForeshadowing) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var chapter Chapter
+		if err := tx.Select("id", "generated_foreshadowing").
+			Where("id = ? AND novel_id = ?", chapterID, novelID).First(&chapter).Error; err != nil {
+			return err
+		}
+		chapter.GeneratedForeshadowing.Pending = pending
+		return tx.Model(&chapter).Select("generated_foreshadowing").Updates(&chapter).Error
+	})
+}
+
+// ApplyPendingForeshadowing 章节内容保存后记录生成结果中的伏笔，并清除待记录的伏笔；没有待记录的伏笔时不做修改
+// 同一章节重新生成后保存时替换而不是追加：该章此前由 AI 记录且仍未回收的伏笔被删除，此前由该章回收的伏笔重新打开
+func ApplyPendingForeshadowing(db *gorm.DB, chapterID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var chapter Chapter
+		if err := tx.Select("id", "novel_id", "order", "generated_foreshadowing").First(&chapter, chapterID).Error; err != nil {
+			return err
+		}
+		generated := chapter.GeneratedForeshadowing
+		pending := generated.Pending
+		if pending == nil {
+			return nil
+		}
+
+		if err := tx.Where("novel_id = ? AND setup_chapter_id = ? AND source = ? AND status = ?",
+			chapter.NovelID, chapter.ID, ForeshadowingSourceAI, ForeshadowingOpen).Delete(&Foreshadowing{}).Error; err != nil {
+			return err
+		}
+		if len(generated.PaidOffIDs) > 0 {
+			if err := tx.Model(&Foreshadowing{}).
+				Where("novel_id = ? AND id IN ? AND status = ? AND payoff_chapter_id = ?", chapter.NovelID, generated.PaidOffIDs, ForeshadowingPaidOff, chapter.ID).
+				Updates(map[string]interface{}{
+					"status":               ForeshadowingOpen,
+					"payoff_chapter_id":    0,
+					"payoff_chapter_order": 0,
+					"closed_at":            nil,
+				}).Error; err != nil {
+				return err
+			}
+		}
+		if err := PayOffForeshadowings(tx, chapter.NovelID, pending.PaidOffIDs, chapter.ID, chapter.Order); err != nil {
+			return err
+		}
+		if len(pending.Setups) > 0 {
+			setups := make([]Foreshadowing, 0, len(pending.Setups))
+			for _, setup := range pending.Setups {
+				setups = append(setups, Foreshadowing{
+					NovelID:           chapter.NovelID,
+					Description:       setup.Description,
+					IntendedPayoff:    setup.Payoff,
+					SetupChapterID:    chapter.ID,
+					SetupChapterOrder: chapter.Order,
+					Status:            ForeshadowingOpen,
+					Source:            ForeshadowingSourceAI,
+				})
+			}
+			if err := tx.Create(&setups).Error; err != nil {
+				return err
+			}
+		}
+
+		chapter.GeneratedForeshadowing = ChapterForeshadowing{PaidOffIDs: pending.PaidOffIDs}
+		return tx.Model(&chapter).Select("generated_foreshadowing").Updates(&chapter).Error
+	})
+}
+
+// LatestChapterOrder 返回小说中最大的章节序号，没有章节时为 0
+func LatestChapterOrder(db *gorm.DB, novelID uint) (int, error) {
+	var orders []int
+	err := db.Model(&Chapter{}).Where("novel_id = ?", novelID).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "order"}, Desc: true}).
+		Limit(1).Pluck("order", &orders).Error
+	if err != nil || len(orders) == 0 {
+		return 0, err
+	}
+	return orders[0], nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LLMResponseCache LLM 响应缓存（持久化层，内存缓存未命中时查询）
+type LLMResponseCache struct {
+	BaseModel
+	CacheKey         string    `json:"cacheKey" gorm:"size:64;not null;uniqueIndex;comment:缓存键(请求哈希)"`
+	Provider         string    `json:"provider" gorm:"size:50;comment:提供商"`
+	Model            string    `json:"model" gorm:"size:100;comment:模型"`
+	Task             string    `json:"task" gorm:"size:100;index;comment:调用任务标识"`
+	Content          string    `json:"content" gorm:"type:text;not null;comment:响应内容"`
+	PromptTokens     int       `json:"promptTokens" gorm:"default:0;comment:输入token数"`
+	CompletionTokens int       `json:"completionTokens" gorm:"default:0;comment:输出token数"`
+	TotalTokens      int       `json:"totalTokens" gorm:"default:0;comment:总token数"`
+	HitCount         int       `json:"hitCount" gorm:"default:0;comment:命中次数"`
+	ExpiresAt        time.Time `json:"expiresAt" gorm:"index;comment:过期时间"`
+}
+
+func (LLMResponseCache) TableName() string {
+	return constants.TABLE_LLM_CACHE
+}
+
+// GetLLMResponseCache 获取未过期的缓存并增加命中次数，不存在时返回 nil
+func GetLLMResponseCache(db *gorm.DB, key string) (*LLMResponseCache, error) {
+	// 未命中是常态，使用 Find 避免 record not found 日志
+	var entries []LLMResponseCache
+	err := db.Where("cache_key = ? AND expires_at > ?", key, time.Now()).
+		Limit(1).
+		Find(&entries).Error
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	db.Model(&entries[0]).UpdateColumn("hit_count", gorm.Expr("hit_count + 1"))
+	return &entries[0], nil
+}
+
+// SaveLLMResponseCache 写入缓存，同一缓存键已存在（包括已过期的）时覆盖
+func SaveLLMResponseCache(db *gorm.DB, entry *LLMResponseCache) error {
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "cache_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"provider", "model", "task", "content",
+			"prompt_tokens", "completion_tokens", "total_tokens",
+			"hit_count", "expires_at", "updated_at",
+		}),
+	}).Create(entry).Error
+}
+
+// DeleteExpiredLLMResponseCaches 删除已过期的缓存，返回删除条数
+func DeleteExpiredLLMResponseCaches(db *gorm.DB) (int64, error) {
+	result := db.Where("expires_at <= ?", time.Now()).Delete(&LLMResponseCache{})
+	return result.RowsAffected, result.Error
+}
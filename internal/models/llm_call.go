@@ -0,0 +1,185 @@
+package models
+
+import (
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+)
+
+// LLM 调用状态
+const (
+	LLMCallStatusSuccess   = "success"
+	LLMCallStatusError     = "error"
+	LLMCallStatusCancelled = "cancelled"
+)
+
+// LLMCall LLM 调用审计记录，每次提供商调用（包括命中缓存、失败和取消的调用）记录一条
+type LLMCall struct {
+	BaseModel
+	UserID        uint     `json:"userId" gorm:"default:0;index;comment:用户ID(后台任务为0)"`
+	NovelID       uint     `json:"novelId" gorm:"default:0;index;comment:关联小说ID(未知为0)"`
+	Feature       string   `json:"feature" gorm:"size:100;index;comment:功能标识"`
+	Task          string   `json:"task" gorm:"size:100;index;comment:调用任务标识"`
+	Provider      string   `json:"provider" gorm:"size:50;comment:提供商"`
+	Model         string   `json:"model" gorm:"size:100;index;comment:实际使用的模型"`
+	PromptVersion string   `json:"promptVersion" gorm:"size:150;comment:提示词模板版本"`
+	Stream        bool     `json:"stream" gorm:"default:false;comment:是否流式调用"`
+	Temperature   *float32 `json:"temperature" gorm:"comment:温度"`
+	MaxTokens     *int     `json:"maxTokens" gorm:"comment:最大输出token"`
+
+	Messages  string `json:"messages,omitempty" gorm:"type:text;comment:请求消息(JSON)"`
+	Response  string `json:"response,omitempty" gorm:"type:text;comment:原始响应"`
+	ToolCalls string `json:"toolCalls,omitempty" gorm:"type:text;comment:模型请求的工具调用(JSON)"`
+	Redacted  bool   `json:"redacted" gorm:"default:false;comment:请求和响应正文是否已脱敏"`
+
+	Parsed        *bool  `json:"parsed" gorm:"comment:结构化输出是否解析成功(非结构化调用为空)"`
+	ParseProblems string `json:"parseProblems,omitempty" gorm:"type:text;comment:解析失败的问题列表(JSON)"`
+
+	PromptTokens     int   `json:"promptTokens" gorm:"default:0;comment:输入token数"`
+	CompletionTokens int   `json:"completionTokens" gorm:"default:0;comment:输出token数"`
+	TotalTokens      int   `json:"totalTokens" gorm:"default:0;comment:总token数"`
+	Estimated        bool  `json:"estimated" gorm:"default:false;comment:用量是否为估算值"`
+	Cached           bool  `json:"cached" gorm:"default:false;comment:是否命中响应缓存"`
+	LatencyMs        int64 `json:"latencyMs" gorm:"default:0;comment:耗时(毫秒)"`
+
+	Cost     float64 `json:"cost" gorm:"default:0;comment:费用(未配置价格时为0)"`
+	Currency string  `json:"currency" gorm:"size:10;comment:币种"`
+
+	Status string `json:"status" gorm:"size:20;index;comment:状态(success/error/cancelled)"`
+	Error  string `json:"error,omitempty" gorm:"type:text;comment:错误信息"`
+}
+
+func (LLMCall) TableName() string {
+	return constants.TABLE_LLM_CALL
+}
+
+// LLMCallFilter 审计记录查询条件，零值字段不参与过滤
+type LLMCallFilter struct {
+	UserID   uint      `form:"userId"`
+	NovelID  uint      `form:"novelId"`
+	Feature  string    `form:"feature"`
+	Task     string    `form:"task"`
+	Model    string    `form:"model"`
+	Status   string    `form:"status"`
+	Parsed   *bool     `form:"parsed"`
+	Since    time.Time `form:"since" time_format:"2006-01-02"`
+	Until    time.Time `form:"until" time_format:"2006-01-02"`
+	Page     int       `form:"page,default=1"`
+	PageSize int       `form:"pageSize,default=20"`
+}
+
+// apply 将过滤条件应用到查询，Until 包含当天
+func (f LLMCallFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.UserID > 0 {
+		query = query.Where("user_id = ?", f.UserID)
+	}
+	if f.NovelID > 0 {
+		query = query.Where("novel_id = ?", f.NovelID)
+	}
+	if f.Feature != "" {
+		query = query.Where("feature = ?", f.Feature)
+	}
+	if f.Task != "" {
+		query = query.Where("task = ?", f.Task)
+	}
+	if f.Model != "" {
+		query = query.Where("model = ?", f.Model)
+	}
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.Parsed != nil {
+		query = query.Where("parsed = ?", *f.Parsed)
+	}
+	if !f.Since.IsZero() {
+		query = query.Where("created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		query = query.Where("created_at < ?", f.Until.AddDate(0, 0, 1))
+	}
+	return query
+}
+
+// ListLLMCalls 按条件分页查询审计记录（按时间倒序），列表不含请求消息和响应正文
+func ListLLMCalls(db *gorm.DB, filter LLMCallFilter) ([]LLMCall, int64, error) {
+	var total int64
+	if err := filter.apply(db.Model(&LLMCall{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	calls := []LLMCall{}
+	err := filter.apply(db.Model(&LLMCall{})).
+		Omit("messages", "response", "tool_calls").
+		Order("id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&calls).Error
+	return calls, total, err
+}
+
+// LLMCallStats 按模型和任务汇总的调用统计，用于对比模型效果
+type LLMCallStats struct {
+	Model          string  `json:"model"`
+	Task           string  `json:"task"`
+	Calls          int64   `json:"calls"`
+	Errors         int64   `json:"errors"`
+	Cancelled      int64   `json:"cancelled"`
+	ParseChecked   int64   `json:"parseChecked"`
+	ParseFailures  int64   `json:"parseFailures"`
+	CacheHits      int64   `json:"cacheHits"`
+	AvgLatencyMs   float64 `json:"avgLatencyMs"`
+	AvgTotalTokens float64 `json:"avgTotalTokens"`
+	TotalTokens    int64   `json:"totalTokens"`
+}
+
+// GetLLMCallStats 按模型和任务汇总符合条件的审计记录，按调用次数降序
+func GetLLMCallStats(db *gorm.DB, filter LLMCallFilter) ([]LLMCallStats, error) {
+	stats := []LLMCallStats{}
+	err := filter.apply(db.Model(&LLMCall{})).
+		Select("model, task, COUNT(*) AS calls, "+
+			"SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS errors, "+
+			"SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS cancelled, "+
+			"COUNT(parsed) AS parse_checked, "+
+			"SUM(CASE WHEN parsed = ? THEN 1 ELSE 0 END) AS parse_failures, "+
+			"SUM(CASE WHEN cached = ? THEN 1 ELSE 0 END) AS cache_hits, "+
+			"AVG(latency_ms) AS avg_latency_ms, AVG(total_tokens) AS avg_total_tokens, "+
+			"SUM(total_tokens) AS total_tokens",
+			LLMCallStatusError, LLMCallStatusCancelled, false, true).
+		Group("model, task").
+		Order("calls DESC").
+		Scan(&stats).Error
+	return stats, err
+}
+
+// RedactLLMCall 用脱敏后的内容替换审计记录中的请求消息、响应和工具调用
+func RedactLLMCall(db *gorm.DB, id uint, messages, response, toolCalls string) error {
+	return db.Model(&LLMCall{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"messages":   messages,
+		"response":   response,
+		"tool_calls": toolCalls,
+		"redacted":   true,
+	}).Error
+}
+
+// DeleteLLMCallsBefore 删除指定时间之前的审计记录，每批最多 batchSize 条以免长时间锁表，返回删除总数
+func DeleteLLMCallsBefore(db *gorm.DB, before time.Time, batchSize int) (int64, error) {
+	var removed int64
+	for {
+		var ids []uint
+		if err := db.Model(&LLMCall{}).Where("created_at < ?", before).Limit(batchSize).Pluck("id", &ids).Error; err != nil {
+			return removed, err
+		}
+		if len(ids) == 0 {
+			return removed, nil
+		}
+		result := db.Where("id IN ?", ids).Delete(&LLMCall{})
+		if result.Error != nil {
+			return removed, result.Error
+		}
+		removed += result.RowsAffected
+		if len(ids) < batchSize {
+			return removed, nil
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultLLMCurrency 未指定币种时使用的币种
+const DefaultLLMCurrency = "USD"
+
+// LLMModelPrice 模型价格，同一模型可配置多条，按生效时间取调用时最近生效的一条
+type LLMModelPrice struct {
+	BaseModel
+	Model         string    `json:"model" gorm:"size:100;not null;uniqueIndex:idx_llm_price_model_effective;comment:模型名称"`
+	EffectiveFrom time.Time `json:"effectiveFrom" gorm:"not null;uniqueIndex:idx_llm_price_model_effective;comment:生效时间"`
+	InputPrice    float64   `json:"inputPrice" gorm:"default:0;comment:输入价格(每百万token)"`
+	OutputPrice   float64   `json:"outputPrice" gorm:"default:0;comment:输出价格(每百万token)"`
+	Currency      string    `json:"currency" gorm:"size:10;default:'USD';comment:币种"`
+	Remark        string    `json:"remark" gorm:"size:255;comment:备注"`
+}
+
+func (LLMModelPrice) TableName() string {
+	return constants.TABLE_LLM_MODEL_PRICE
+}
+
+// Cost 计算一次调用的费用
+func (p *LLMModelPrice) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*p.InputPrice + float64(completionTokens)*p.OutputPrice) / 1e6
+}
+
+// GetLLMModelPrice 获取模型在指定时间生效的价格，未配置时返回 nil
+func GetLLMModelPrice(db *gorm.DB, model string, at time.Time) (*LLMModelPrice, error) {
+	var prices []LLMModelPrice
+	err := db.Where("model = ? AND effective_from <= ?", model, at).
+		Order("effective_from DESC").
+		Limit(1).
+		Find(&prices).Error
+	if err != nil || len(prices) == 0 {
+		return nil, err
+	}
+	return &prices[0], nil
+}
+
+// SaveLLMModelPrice 写入价格，同一模型同一生效时间已存在时覆盖
+func SaveLLMModelPrice(db *gorm.DB, price *LLMModelPrice) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "model"}, {Name: "effective_from"}},
+		DoUpdates: clause.AssignmentColumns([]string{"input_price", "output_price", "currency", "remark", "update_by", "updated_at"}),
+	}).Create(price).Error
+}
+
+// LLMCostDaily 每日费用汇总，按用户、小说、任务、模型和币种累计
+// 审计记录会按保留期清理，费用以该表为准长期保存
+type LLMCostDaily struct {
+	BaseModel
+	Date             string  `json:"date" gorm:"size:10;not null;uniqueIndex:idx_llm_cost_daily_key;comment:日期(YYYY-MM-DD)"`
+	UserID           uint    `json:"userId" gorm:"default:0;uniqueIndex:idx_llm_cost_daily_key;comment:用户ID(后台任务为0)"`
+	NovelID          uint    `json:"novelId" gorm:"default:0;uniqueIndex:idx_llm_cost_daily_key;comment:小说ID(未知为0)"`
+	Task             string  `json:"task" gorm:"size:100;default:'';uniqueIndex:idx_llm_cost_daily_key;comment:调用任务标识"`
+	Model            string  `json:"model" gorm:"size:100;default:'';uniqueIndex:idx_llm_cost_daily_key;comment:模型"`
+	Currency         string  `json:"currency" gorm:"size:10;default:'';uniqueIndex:idx_llm_cost_daily_key;comment:币种(未配置价格时为空)"`
+	Calls            int     `json:"calls" gorm:"default:0;comment:调用次数"`
+	PromptTokens     int     `json:"promptTokens" gorm:"default:0;comment:输入token数"`
+	CompletionTokens int     `json:"completionTokens" gorm:"default:0;comment:输出token数"`
+	Cost             float64 `json:"cost" gorm:"default:0;comment:费用"`
+}
+
+func (LLMCostDaily) TableName() string {
+	return constants.TABLE_LLM_COST_DAILY
+}
+
+// AddLLMCostDaily 将一次调用计入当日汇总
+func AddLLMCostDaily(db *gorm.DB, entry *LLMCostDaily) error {
+	entry.Calls = 1
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "date"}, {Name: "user_id"}, {Name: "novel_id"}, {Name: "task"}, {Name: "model"}, {Name: "currency"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"calls":             gorm.Expr("calls + 1"),
+			"prompt_tokens":     gorm.Expr("prompt_tokens + ?", entry.PromptTokens),
+			"completion_tokens": gorm.Expr("completion_tokens + ?", entry.CompletionTokens),
+			"cost":              gorm.Expr("cost + ?", entry.Cost),
+			"updated_at":        time.Now(),
+		}),
+	}).Create(entry).Error
+}
+
+// LLMCostTotals 费用汇总
+type LLMCostTotals struct {
+	Key              string  `json:"key" gorm:"column:group_key"` // 分组值（用户ID、小说ID、任务、模型或日期）
+	Currency         string  `json:"currency"`
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// 费用报表分组维度对应的列
+var llmCostGroupColumns = map[string]string{
+	"user":  "user_id",
+	"novel": "novel_id",
+	"task":  "task",
+	"model": "model",
+	"date":  "date",
+}
+
+// IsValidLLMCostGroup 是否为支持的分组维度
+func IsValidLLMCostGroup(groupBy string) bool {
+	_, ok := llmCostGroupColumns[groupBy]
+	return ok
+}
+
+// GetLLMCostReport 按维度汇总 [since, until] 日期范围内的费用，按币种分开统计、费用降序
+func GetLLMCostReport(db *gorm.DB, groupBy, since, until string) ([]LLMCostTotals, error) {
+	column, ok := llmCostGroupColumns[groupBy]
+	if !ok {
+		column = "date"
+	}
+	totals := []LLMCostTotals{}
+	err := db.Model(&LLMCostDaily{}).
+		Where("date >= ? AND date <= ?", since, until).
+		Select(column + " AS group_key, currency, SUM(calls) AS calls, " +
+			"SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens, SUM(cost) AS cost").
+		Group(column + ", currency").
+		Order("cost DESC").
+		Scan(&totals).Error
+	return totals, err
+}
+
+// SumLLMCost 统计 [since, until] 日期范围内指定币种的总费用
+func SumLLMCost(db *gorm.DB, currency, since, until string) (float64, error) {
+	var total float64
+	err := db.Model(&LLMCostDaily{}).
+		Where("currency = ? AND date >= ? AND date <= ?", currency, since, until).
+		Select("COALESCE(SUM(cost), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// LLMBudgetAlert 已发送的预算告警，每月每个阈值只发送一次
+type LLMBudgetAlert struct {
+	BaseModel
+	Month    string  `json:"month" gorm:"size:7;not null;uniqueIndex:idx_llm_budget_alert;comment:月份(YYYY-MM)"`
+	Percent  int     `json:"percent" gorm:"not null;uniqueIndex:idx_llm_budget_alert;comment:告警阈值(预算百分比)"`
+	Currency string  `json:"currency" gorm:"size:10;comment:币种"`
+	Budget   float64 `json:"budget" gorm:"comment:月度预算"`
+	Spent    float64 `json:"spent" gorm:"comment:告警时已花费"`
+}
+
+func (LLMBudgetAlert) TableName() string {
+	return constants.TABLE_LLM_BUDGET_ALERT
+}
+
+// ClaimLLMBudgetAlert 记录告警，返回是否为首次记录（并发调用时只有一个会返回 true）
+func ClaimLLMBudgetAlert(db *gorm.DB, alert *LLMBudgetAlert) (bool, error) {
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(alert)
+	return result.RowsAffected == 1, result.Error
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LLMUsage LLM 用量台账，每次调用 AI 功能的请求记录一条（一个请求可能包含多次模型调用）
+type LLMUsage struct {
+	BaseModel
+	UserID  uint   `json:"userId" gorm:"not null;index:idx_llm_usage_user_date;comment:用户ID"`
+	Date    string `json:"date" gorm:"size:10;not null;index:idx_llm_usage_user_date;comment:日期(YYYY-MM-DD)"`
+	Feature string `json:"feature" gorm:"size:100;not null;index;comment:功能标识(如 chapter.generate)"`
+	Model   string `json:"model" gorm:"size:100;comment:使用的模型"`
+
+	Calls            int  `json:"calls" gorm:"default:0;comment:模型调用次数"`
+	PromptTokens     int  `json:"promptTokens" gorm:"default:0;comment:输入token数"`
+	CompletionTokens int  `json:"completionTokens" gorm:"default:0;comment:输出token数"`
+	TotalTokens      int  `json:"totalTokens" gorm:"default:0;comment:总token数(计入配额)"`
+	CacheHits        int  `json:"cacheHits" gorm:"default:0;comment:响应缓存命中次数"`
+	CachedTokens     int  `json:"cachedTokens" gorm:"default:0;comment:缓存命中节省的token数"`
+	Estimated        bool `json:"estimated" gorm:"default:false;comment:用量是否为估算值"`
+}
+
+func (LLMUsage) TableName() string {
+	return constants.TABLE_LLM_USAGE
+}
+
+// LLMUsageTotals 用量汇总
+type LLMUsageTotals struct {
+	Feature          string `json:"feature,omitempty"`
+	Date             string `json:"date,omitempty"`
+	Requests         int64  `json:"requests"`
+	Calls            int64  `json:"calls"`
+	PromptTokens     int64  `json:"promptTokens"`
+	CompletionTokens int64  `json:"completionTokens"`
+	TotalTokens      int64  `json:"totalTokens"`
+	CacheHits        int64  `json:"cacheHits"`
+	CachedTokens     int64  `json:"cachedTokens"`
+}
+
+// llmUsageTotalsSelect 汇总查询的字段
+const llmUsageTotalsSelect = "COUNT(*) AS requests, SUM(calls) AS calls, " +
+	"SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens, SUM(total_tokens) AS total_tokens, " +
+	"SUM(cache_hits) AS cache_hits, SUM(cached_tokens) AS cached_tokens"
+
+// SumLLMUsageTokens 统计用户自指定日期（含）以来消耗的 token
+func SumLLMUsageTokens(db *gorm.DB, userID uint, since string) (int64, error) {
+	var total int64
+	err := db.Model(&LLMUsage{}).
+		Where("user_id = ? AND date >= ?", userID, since).
+		Select("COALESCE(SUM(total_tokens), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// GetLLMUsageByFeature 按功能汇总用户自指定日期（含）以来的用量，按消耗 token 降序
+func GetLLMUsageByFeature(db *gorm.DB, userID uint, since string) ([]LLMUsageTotals, error) {
+	totals := []LLMUsageTotals{}
+	err := db.Model(&LLMUsage{}).
+		Where("user_id = ? AND date >= ?", userID, since).
+		Select("feature, " + llmUsageTotalsSelect).
+		Group("feature").
+		Order("total_tokens DESC").
+		Scan(&totals).Error
+	return totals, err
+}
+
+// GetLLMUsageByDate 按日期汇总用户自指定日期（含）以来的用量，按日期降序
+func GetLLMUsageByDate(db *gorm.DB, userID uint, since string) ([]LLMUsageTotals, error) {
+	totals := []LLMUsageTotals{}
+	err := db.Model(&LLMUsage{}).
+		Where("user_id = ? AND date >= ?", userID, since).
+		Select("date, " + llmUsageTotalsSelect).
+		Group("date").
+		Order("date DESC").
+		Scan(&totals).Error
+	return totals, err
+}
+
+// LLMQuota LLM token 配额，按用户或角色配置；同时存在时用户配置优先
+type LLMQuota struct {
+	BaseModel
+	UserID        uint   `json:"userId" gorm:"default:0;uniqueIndex:idx_llm_quota_subject;comment:用户ID(按角色配置时为0)"`
+	Role          string `json:"role" gorm:"size:50;default:'';uniqueIndex:idx_llm_quota_subject;comment:角色(按用户配置时为空)"`
+	DailyTokens   int64  `json:"dailyTokens" gorm:"default:0;comment:每日token上限(0表示不限)"`
+	MonthlyTokens int64  `json:"monthlyTokens" gorm:"default:0;comment:每月token上限(0表示不限)"`
+	Remark        string `json:"remark" gorm:"size:255;comment:备注"`
+}
+
+func (LLMQuota) TableName() string {
+	return constants.TABLE_LLM_QUOTA
+}
+
+// GetLLMQuota 获取用户适用的配额：先查用户配置，再查角色配置，都没有时返回 nil
+func GetLLMQuota(db *gorm.DB, userID uint, role string) (*LLMQuota, error) {
+	var quotas []LLMQuota
+	err := db.Where("(user_id = ? AND role = '') OR (user_id = 0 AND role = ?)", userID, role).
+		Order("user_id DESC").
+		Limit(1).
+		Find(&quotas).Error
+	if err != nil || len(quotas) == 0 {
+		return nil, err
+	}
+	return &quotas[0], nil
+}
+
+// SaveLLMQuota 写入配额，同一用户或角色已存在配置时覆盖
+func SaveLLMQuota(db *gorm.DB, quota *LLMQuota) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "role"}},
+		DoUpdates: clause.AssignmentColumns([]string{"daily_tokens", "monthly_tokens", "remark", "update_by", "updated_at"}),
+	}).Create(quota).Error
+}
@@ -18,6 +18,9 @@ type Novel struct {
 	CoverImage     string `json:"coverImage" gorm:"size:500;comment:封面图片URL"`
 	StyleGuide     string `json:"styleGuide" gorm:"type:text;comment:写作风格指南"`
 	ReferenceNovel string `json:"referenceNovel" gorm:"type:text;comment:参考小说内容"`
+
+	AutoCheckContinuity   bool `json:"autoCheckContinuity" gorm:"default:false;comment:保存章节后自动检查连续性"`
+	ConfirmEntitiesWithAI bool `json:"confirmEntitiesWithAI" gorm:"column:confirm_entities_with_ai;default:false;comment:保存章节后由AI确认匹配到的角色、情节和设定"`
 }
 
 func (Novel) TableName() string {
@@ -7,8 +7,12 @@ type PlotPoint struct {
 	NovelID uint   `json:"novelId" gorm:"index;comment:小说ID"`
 	Title   string `json:"title" gorm:"size:255;not null;comment:情节标题"`
 	Content string `json:"content" gorm:"type:text;comment:情节内容"`
+	Status  string `json:"status" gorm:"size:50;comment:情节状态(draft为AI创建待确认的草稿，空为正式情节)"`
 }
 
+// PlotPointStatusDraft AI 创建、等待作者确认的情节草稿
+const PlotPointStatusDraft = "draft"
+
 func (PlotPoint) TableName() string {
 	return constants.TABLE_PLOT_POINT
 }
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+)
+
+// PromptTemplate 提示词模板模型（按名称+语言区域分版本，同一时间只有一个生效版本）
+type PromptTemplate struct {
+	BaseModel
+	Name        string `json:"name" gorm:"size:100;not null;uniqueIndex:idx_prompt_version;comment:模板名称(如 chapter.generate)"`
+	Version     int    `json:"version" gorm:"not null;uniqueIndex:idx_prompt_version;comment:版本号"`
+	Locale      string `json:"locale" gorm:"size:20;not null;default:zh-CN;uniqueIndex:idx_prompt_version;comment:语言区域"`
+	Body        string `json:"body" gorm:"type:text;not null;comment:模板内容(text/template)"`
+	Description string `json:"description" gorm:"size:500;comment:版本说明"`
+	Active      bool   `json:"active" gorm:"default:false;index;comment:是否为生效版本"`
+}
+
+func (PromptTemplate) TableName() string {
+	return constants.TABLE_PROMPT_TEMPLATE
+}
+
+// GetActivePromptTemplate 获取指定名称和语言区域的生效版本，不存在时返回 nil
+func GetActivePromptTemplate(db *gorm.DB, name, locale string) (*PromptTemplate, error) {
+	// 每次渲染都会查询，使用 Find 避免未配置自定义版本时的 record not found 日志
+	var templates []PromptTemplate
+	err := db.Where("name = ? AND locale = ? AND active = ? AND is_deleted = ?", name, locale, true, SoftDeleteStatusActive).
+		Order("version DESC").
+		Limit(1).
+		Find(&templates).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, nil
+	}
+	return &templates[0], nil
+}
+
+// NextPromptTemplateVersion 获取下一个版本号
+func NextPromptTemplateVersion(db *gorm.DB, name, locale string) (int, error) {
+	var maxVersion int
+	err := db.Model(&PromptTemplate{}).
+		Where("name = ? AND locale = ?", name, locale).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&maxVersion).Error
+	if err != nil {
+		return 0, err
+	}
+	return maxVersion + 1, nil
+}
+
+// ActivatePromptTemplate 激活指定版本，同名同语言区域的其他版本自动停用
+func ActivatePromptTemplate(db *gorm.DB, tpl *PromptTemplate) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&PromptTemplate{}).
+			Where("name = ? AND locale = ? AND id <> ?", tpl.Name, tpl.Locale, tpl.ID).
+			Update("active", false).Error; err != nil {
+			return err
+		}
+		tpl.Active = true
+		return tx.Model(tpl).Update("active", true).Error
+	})
+}
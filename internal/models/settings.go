@@ -27,27 +27,29 @@ func (NovelSetting) TableName() string {
 
 // SettingCategory 设定分类常量
 const (
-	SettingCategoryWorld   = "world"   // 世界观背景
-	SettingCategoryPower   = "power"   // 力量体系（修炼/魔法/异能等）
-	SettingCategoryTech    = "tech"    // 科技设定
-	SettingCategoryConcept = "concept" // 基础概念
-	SettingCategoryRule    = "rule"    // 规则设定
-	SettingCategoryOrg     = "org"     // 组织势力
-	SettingCategoryItem    = "item"    // 物品道具
-	SettingCategoryOther   = "other"   // 其他
+	SettingCategoryWorld    = "world"    // 世界观背景
+	SettingCategoryPower    = "power"    // 力量体系（修炼/魔法/异能等）
+	SettingCategoryTech     = "tech"     // 科技设定
+	SettingCategoryConcept  = "concept"  // 基础概念
+	SettingCategoryRule     = "rule"     // 规则设定
+	SettingCategoryOrg      = "org"      // 组织势力
+	SettingCategoryItem     = "item"     // 物品道具
+	SettingCategoryLocation = "location" // 地点
+	SettingCategoryOther    = "other"    // 其他
 )
 
 // GetCategoryName 获取分类名称
 func GetCategoryName(category string) string {
 	names := map[string]string{
-		SettingCategoryWorld:   "世界观背景",
-		SettingCategoryPower:   "力量体系",
-		SettingCategoryTech:    "科技设定",
-		SettingCategoryConcept: "基础概念",
-		SettingCategoryRule:    "规则设定",
-		SettingCategoryOrg:     "组织势力",
-		SettingCategoryItem:    "物品道具",
-		SettingCategoryOther:   "其他",
+		SettingCategoryWorld:    "世界观背景",
+		SettingCategoryPower:    "力量体系",
+		SettingCategoryTech:     "科技设定",
+		SettingCategoryConcept:  "基础概念",
+		SettingCategoryRule:     "规则设定",
+		SettingCategoryOrg:      "组织势力",
+		SettingCategoryItem:     "物品道具",
+		SettingCategoryLocation: "地点",
+		SettingCategoryOther:    "其他",
 	}
 	if name, ok := names[category]; ok {
 		return name
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 汇总摘要层级：章节摘要保存在章节上，逐级汇总为卷摘要和全书梗概
+const (
+	StorySummaryVolume = "volume" // 卷摘要，由卷内章节摘要汇总
+	StorySummaryNovel  = "novel"  // 全书梗概（前情提要），由卷摘要和未分卷章节的摘要汇总
+)
+
+// StorySummary 卷摘要或全书梗概
+// 下级摘要变化时标记为待更新（Stale），StaleFromOrder 记录变化的最早章节序号：
+// 大于 LastChapterOrder 时只需在原摘要基础上追加新章节，否则需要重新汇总
+type StorySummary struct {
+	BaseModel
+	NovelID          uint       `json:"novelId" gorm:"uniqueIndex:idx_story_summary;comment:小说ID"`
+	Level            string     `json:"level" gorm:"size:20;uniqueIndex:idx_story_summary;comment:层级(volume/novel)"`
+	VolumeID         uint       `json:"volumeId" gorm:"uniqueIndex:idx_story_summary;default:0;comment:卷ID，全书梗概为0"`
+	Content          string     `json:"content" gorm:"type:text;comment:摘要内容"`
+	Stale            bool       `json:"stale" gorm:"default:false;index;comment:下级摘要变化后尚未重新汇总"`
+	StaleFromOrder   int        `json:"staleFromOrder" gorm:"default:0;comment:发生变化的最早章节序号"`
+	ChapterCount     int        `json:"chapterCount" gorm:"default:0;comment:汇总的章节数"`
+	LastChapterOrder int        `json:"lastChapterOrder" gorm:"default:0;comment:汇总到的最后章节序号"`
+	Revision         int        `json:"-" gorm:"default:0;comment:标记待更新的次数，用于判断汇总期间是否又有变化"`
+	Model            string     `json:"model" gorm:"size:100;comment:生成使用的模型"`
+	GeneratedAt      *time.Time `json:"generatedAt" gorm:"comment:生成时间"`
+}
+
+func (StorySummary) TableName() string {
+	return constants.TABLE_STORY_SUMMARY
+}
+
+// GetStorySummary 获取卷摘要（volumeID 不为 0）或全书梗概，不存在时返回 nil
+func GetStorySummary(db *gorm.DB, novelID, volumeID uint) (*StorySummary, error) {
+	level := StorySummaryNovel
+	if volumeID != 0 {
+		level = StorySummaryVolume
+	}
+	var summary StorySummary
+	err := db.Where("novel_id = ? AND level = ? AND volume_id = ?", novelID, level, volumeID).First(&summary).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// ListStorySummaries 获取小说的全书梗概和卷摘要
+func ListStorySummaries(db *gorm.DB, novelID uint) ([]StorySummary, error) {
+	var summaries []StorySummary
+	err := db.Where("novel_id = ?", novelID).Order("level ASC, volume_id ASC").Find(&summaries).Error
+	return summaries, err
+}
+
+// MarkStorySummariesStale 章节摘要变化后，将所在卷的摘要和全书梗概标记为待更新，fromOrder 为变化的章节序号
+// 尚未生成的摘要不需要标记，汇总时会直接生成
+func MarkStorySummariesStale(db *gorm.DB, novelID uint, volumeIDs []uint, fromOrder int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		scope := func() *gorm.DB {
+			query := tx.Model(&StorySummary{}).Where("novel_id = ?", novelID)
+			if len(volumeIDs) == 0 {
+				return query.Where("level = ?", StorySummaryNovel)
+			}
+			return query.Where("level = ? OR (level = ? AND volume_id IN ?)", StorySummaryNovel, StorySummaryVolume, volumeIDs)
+		}
+		if err := scope().Update("revision", gorm.Expr("revision + 1")).Error; err != nil {
+			return err
+		}
+		if err := scope().Where("stale = ?", false).
+			Updates(map[string]interface{}{"stale": true, "stale_from_order": fromOrder}).Error; err != nil {
+			return err
+		}
+		return scope().Where("stale = ? AND stale_from_order > ?", true, fromOrder).
+			Update("stale_from_order", fromOrder).Error
+	})
+}
+
+// SaveStorySummary 保存汇总结果；revision 为汇总开始时读取的版本，期间又被标记待更新时保留待更新标记
+func SaveStorySummary(db *gorm.DB, summary *StorySummary, revision int) error {
+	if summary.ID == 0 {
+		return db.Create(summary).Error
+	}
+	fields := []string{"content", "chapter_count", "last_chapter_order", "model", "generated_at"}
+	result := db.Model(summary).Where("revision = ?", revision).
+		Select(append(fields, "stale", "stale_from_order")).Updates(summary)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+	return db.Model(summary).Select(fields).Updates(summary).Error
+}
+
+// PruneVolumeSummaries 删除不在 keep 中的卷摘要（卷已删除或卷内已没有有摘要的章节）
+func PruneVolumeSummaries(db *gorm.DB, novelID uint, keep []uint) error {
+	query := db.Where("novel_id = ? AND level = ?", novelID, StorySummaryVolume)
+	if len(keep) > 0 {
+		query = query.Where("volume_id NOT IN ?", keep)
+	}
+	return query.Delete(&StorySummary{}).Error
+}
+
+// SetChapterSummaryStale 设置章节摘要是否待更新
+func SetChapterSummaryStale(db *gorm.DB, chapterID uint, stale bool) error {
+	return db.Model(&Chapter{}).Where("id = ?", chapterID).Update("summary_stale", stale).Error
+}
+
+// SaveChapterSummary 保存自动生成的章节摘要，并将所在卷的摘要和全书梗概标记为待更新
+func SaveChapterSummary(db *gorm.DB, chapter *Chapter, summary string) error {
+	if err := db.Model(&Chapter{}).Where("id = ?", chapter.ID).
+		Updates(map[string]interface{}{"summary": summary, "summary_stale": false}).Error; err != nil {
+		return err
+	}
+	chapter.Summary = summary
+	chapter.SummaryStale = false
+	var volumeIDs []uint
+	if chapter.VolumeID != 0 {
+		volumeIDs = []uint{chapter.VolumeID}
+	}
+	return MarkStorySummariesStale(db, chapter.NovelID, volumeIDs, chapter.Order)
+}
+
+// ChaptersNeedingSummary 获取有内容但没有摘要或摘要待更新的章节，按章节顺序排列
+func ChaptersNeedingSummary(db *gorm.DB, novelID uint, limit int) ([]Chapter, error) {
+	var chapters []Chapter
+	err := db.Where("novel_id = ? AND content <> '' AND (summary IS NULL OR summary = '' OR summary_stale = ?)", novelID, true).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "order"}}).Order("id ASC").
+		Limit(limit).Find(&chapters).Error
+	return chapters, err
+}
+
+// CountChaptersNeedingSummary 统计有内容但没有摘要或摘要待更新的章节数
+func CountChaptersNeedingSummary(db *gorm.DB, novelID uint) (int64, error) {
+	var count int64
+	err := db.Model(&Chapter{}).
+		Where("novel_id = ? AND content <> '' AND (summary IS NULL OR summary = '' OR summary_stale = ?)", novelID, true).
+		Count(&count).Error
+	return count, err
+}
@@ -8,6 +8,13 @@ import (
 	"gorm.io/gorm"
 )
 
+// 故事节点状态
+const (
+	StoryNodePlanned   = "planned"   // 计划中
+	StoryNodeWriting   = "writing"   // 写作中
+	StoryNodeCompleted = "completed" // 已完成
+)
+
 // Storyline 故事线模型
 type Storyline struct {
 	ID          int       `json:"id" gorm:"primaryKey;autoIncrement"`
@@ -0,0 +1,436 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/LingByte/LingDialog/pkg/constants"
+	"gorm.io/gorm"
+)
+
+// TimelineValidationError 历法或事件时间不合法，与数据库错误区分
+type TimelineValidationError struct {
+	Err error
+}
+
+func (e *TimelineValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TimelineValidationError) Unwrap() error {
+	return e.Err
+}
+
+// invalid 包装为校验错误，nil 原样返回
+func invalid(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TimelineValidationError{Err: err}
+}
+
+// CalendarEra 纪元，按时间先后排列
+type CalendarEra struct {
+	Name  string `json:"name"`
+	Years int    `json:"years"` // 纪元持续的年数，0 表示没有上限（只允许最后一个纪元）
+}
+
+// CalendarMonth 月份
+type CalendarMonth struct {
+	Name string `json:"name"`
+	Days int    `json:"days"`
+}
+
+// TimelineCalendar 小说的故事内历法，每部小说最多一个，没有配置时使用默认历法
+type TimelineCalendar struct {
+	BaseModel
+	NovelID uint            `json:"novelId" gorm:"uniqueIndex;comment:小说ID"`
+	Name    string          `json:"name" gorm:"size:100;comment:历法名称"`
+	Eras    []CalendarEra   `json:"eras" gorm:"serializer:json;type:text;comment:纪元列表(JSON)"`
+	Months  []CalendarMonth `json:"months" gorm:"serializer:json;type:text;comment:月份列表(JSON)"`
+}
+
+func (TimelineCalendar) TableName() string {
+	return constants.TABLE_TIMELINE_CALENDAR
+}
+
+// TimePoint 故事内的时间点，Month、Day 为 0 表示未指定（按该年/该月第一天排序）
+type TimePoint struct {
+	Era   string `json:"era" form:"era" gorm:"size:50;comment:纪元"`
+	Year  int    `json:"year" form:"year" gorm:"comment:年(从1开始)"`
+	Month int    `json:"month" form:"month" gorm:"comment:月(0表示未指定)"`
+	Day   int    `json:"day" form:"day" gorm:"comment:日(0表示未指定)"`
+}
+
+// chineseMonthNames 默认历法的月份名称
+var chineseMonthNames = []string{"一月", "二月", "三月", "四月", "五月", "六月", "七月", "八月", "九月", "十月", "十一月", "十二月"}
+
+// DefaultTimelineCalendar 默认历法：不分纪元，每年十二个月，每月三十天
+func DefaultTimelineCalendar(novelID uint) *TimelineCalendar {
+	months := make([]CalendarMonth, len(chineseMonthNames))
+	for i, name := range chineseMonthNames {
+		months[i] = CalendarMonth{Name: name, Days: 30}
+	}
+	return &TimelineCalendar{NovelID: novelID, Name: "默认历法", Months: months}
+}
+
+// Validate 校验历法：至少一个月，纪元和月份名称不能为空或重复，只有最后一个纪元可以没有年数上限
+func (cal *TimelineCalendar) Validate() error {
+	if len(cal.Months) == 0 {
+		return errors.New("历法至少需要一个月份")
+	}
+	seen := make(map[string]bool)
+	for i, era := range cal.Eras {
+		if strings.TrimSpace(era.Name) == "" || seen[era.Name] {
+			return fmt.Errorf("纪元名称为空或重复: %q", era.Name)
+		}
+		seen[era.Name] = true
+		if era.Years < 0 || (era.Years == 0 && i != len(cal.Eras)-1) {
+			return fmt.Errorf("纪元 %s 的年数无效", era.Name)
+		}
+	}
+	seen = make(map[string]bool)
+	for _, month := range cal.Months {
+		if strings.TrimSpace(month.Name) == "" || seen[month.Name] {
+			return fmt.Errorf("月份名称为空或重复: %q", month.Name)
+		}
+		seen[month.Name] = true
+		if month.Days <= 0 {
+			return fmt.Errorf("月份 %s 的天数必须大于 0", month.Name)
+		}
+	}
+	return nil
+}
+
+// daysPerYear 每年的天数
+func (cal *TimelineCalendar) daysPerYear() int64 {
+	var days int64
+	for _, month := range cal.Months {
+		days += int64(month.Days)
+	}
+	return days
+}
+
+// Ordinal 将时间点换算为从历法起点开始的天数，用于排序和比较
+// 没有纪元的历法中 Era 必须为空；年份从 1 开始
+func (cal *TimelineCalendar) Ordinal(p TimePoint) (int64, error) {
+	var yearsBefore int64
+	if len(cal.Eras) == 0 {
+		if p.Era != "" {
+			return 0, fmt.Errorf("历法中没有纪元: %s", p.Era)
+		}
+	} else {
+		found := false
+		for _, era := range cal.Eras {
+			if era.Name == p.Era {
+				if era.Years > 0 && p.Year > era.Years {
+					return 0, fmt.Errorf("%s只有 %d 年", era.Name, era.Years)
+				}
+				found = true
+				break
+			}
+			yearsBefore += int64(era.Years)
+		}
+		if !found {
+			return 0, fmt.Errorf("未知的纪元: %s", p.Era)
+		}
+	}
+	if p.Year < 1 {
+		return 0, errors.New("年份必须从 1 开始")
+	}
+	if p.Month < 0 || p.Month > len(cal.Months) {
+		return 0, fmt.Errorf("月份必须在 1-%d 之间", len(cal.Months))
+	}
+
+	ordinal := (yearsBefore + int64(p.Year) - 1) * cal.daysPerYear()
+	if p.Month == 0 {
+		if p.Day != 0 {
+			return 0, errors.New("指定日期时必须指定月份")
+		}
+		return ordinal, nil
+	}
+	for _, month := range cal.Months[:p.Month-1] {
+		ordinal += int64(month.Days)
+	}
+	days := cal.Months[p.Month-1].Days
+	if p.Day < 0 || p.Day > days {
+		return 0, fmt.Errorf("%s只有 %d 天", cal.Months[p.Month-1].Name, days)
+	}
+	if p.Day > 0 {
+		ordinal += int64(p.Day - 1)
+	}
+	return ordinal, nil
+}
+
+// Format 将时间点格式化为"纪元X年某月X日"，未指定的部分省略
+func (cal *TimelineCalendar) Format(p TimePoint) string {
+	text := fmt.Sprintf("%s%d年", p.Era, p.Year)
+	if p.Month > 0 && p.Month <= len(cal.Months) {
+		text += cal.Months[p.Month-1].Name
+		if p.Day > 0 {
+			text += fmt.Sprintf("%d日", p.Day)
+		}
+	}
+	return text
+}
+
+// GetTimelineCalendar 获取小说的历法，没有配置时返回默认历法
+func GetTimelineCalendar(db *gorm.DB, novelID uint) (*TimelineCalendar, error) {
+	var cal TimelineCalendar
+	err := db.Where("novel_id = ?", novelID).First(&cal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultTimelineCalendar(novelID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cal, nil
+}
+
+// SaveTimelineCalendar 保存历法并按新历法重新计算所有事件的排序序数
+// 已有事件的时间在新历法中无效时（如删除了事件所在的纪元）拒绝保存
+func SaveTimelineCalendar(db *gorm.DB, cal *TimelineCalendar) error {
+	if err := cal.Validate(); err != nil {
+		return invalid(err)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var existing TimelineCalendar
+		err := tx.Where("novel_id = ?", cal.NovelID).First(&existing).Error
+		switch {
+		case err == nil:
+			cal.ID = existing.ID
+			cal.CreatedAt = existing.CreatedAt
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+		if err := tx.Save(cal).Error; err != nil {
+			return err
+		}
+
+		var events []TimelineEvent
+		if err := tx.Where("novel_id = ?", cal.NovelID).Find(&events).Error; err != nil {
+			return err
+		}
+		for _, event := range events {
+			ordinal, err := cal.Ordinal(event.TimePoint)
+			if err != nil {
+				return invalid(fmt.Errorf("事件「%s」的时间在新历法中无效: %w", event.Title, err))
+			}
+			if ordinal == event.Ordinal {
+				continue
+			}
+			if err := tx.Model(&TimelineEvent{}).Where("id = ?", event.ID).Update("ordinal", ordinal).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TimelineEvent 故事内时间线上的事件
+type TimelineEvent struct {
+	BaseModel
+	NovelID     uint   `json:"novelId" gorm:"index;comment:小说ID"`
+	Title       string `json:"title" gorm:"size:255;not null;comment:事件标题"`
+	Description string `json:"description" gorm:"type:text;comment:事件描述"`
+	TimePoint   `gorm:"embedded"`
+	Ordinal     int64  `json:"ordinal" gorm:"index;comment:按历法换算的天数(用于排序)"`
+	Sequence    int    `json:"sequence" gorm:"default:0;comment:同一天内的先后顺序"`
+	Duration    int    `json:"duration" gorm:"default:0;comment:持续天数(0表示一天之内)"`
+	ChapterID   uint   `json:"chapterId" gorm:"index;comment:叙述该事件的章节ID"`
+	StoryNodeID int    `json:"storyNodeId" gorm:"index;comment:关联的故事节点ID"`
+	LocationID  uint   `json:"locationId" gorm:"comment:地点设定ID"`
+	Location    string `json:"location" gorm:"size:255;comment:地点"`
+
+	CharacterIDs []uint `json:"characterIds" gorm:"-"` // 参与角色，保存在关联表中
+	TimeLabel    string `json:"timeLabel" gorm:"-"`    // 按历法格式化的时间
+}
+
+func (TimelineEvent) TableName() string {
+	return constants.TABLE_TIMELINE_EVENT
+}
+
+// TimelineEventCharacter 事件与参与角色的关联
+type TimelineEventCharacter struct {
+	EventID     uint `json:"eventId" gorm:"primaryKey;comment:事件ID"`
+	CharacterID uint `json:"characterId" gorm:"primaryKey;index;comment:角色ID"`
+}
+
+func (TimelineEventCharacter) TableName() string {
+	return constants.TABLE_TIMELINE_EVENT_CHARACTER
+}
+
+// timelineOrder 事件的时间先后顺序
+const timelineOrder = "ordinal ASC, sequence ASC, id ASC"
+
+// SaveTimelineEvent 按小说历法计算排序序数后创建或更新事件，并替换参与角色
+func SaveTimelineEvent(db *gorm.DB, event *TimelineEvent) error {
+	cal, err := GetTimelineCalendar(db, event.NovelID)
+	if err != nil {
+		return err
+	}
+	if event.Ordinal, err = cal.Ordinal(event.TimePoint); err != nil {
+		return invalid(err)
+	}
+	event.TimeLabel = cal.Format(event.TimePoint)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(event.CharacterIDs) > 0 {
+			var count int64
+			if err := tx.Model(&Character{}).Where("id IN ? AND novel_id = ?", event.CharacterIDs, event.NovelID).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if int(count) != len(event.CharacterIDs) {
+				return invalid(errors.New("角色不存在或不属于该小说"))
+			}
+		}
+		if err := tx.Save(event).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("event_id = ?", event.ID).Delete(&TimelineEventCharacter{}).Error; err != nil {
+			return err
+		}
+		links := make([]TimelineEventCharacter, 0, len(event.CharacterIDs))
+		for _, characterID := range event.CharacterIDs {
+			links = append(links, TimelineEventCharacter{EventID: event.ID, CharacterID: characterID})
+		}
+		if len(links) == 0 {
+			return nil
+		}
+		return tx.Create(&links).Error
+	})
+}
+
+// DeleteTimelineEvent 删除事件及其角色关联
+func DeleteTimelineEvent(db *gorm.DB, eventID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("event_id = ?", eventID).Delete(&TimelineEventCharacter{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&TimelineEvent{}, eventID).Error
+	})
+}
+
+// fillTimelineEvents 填充事件的参与角色和格式化时间
+func fillTimelineEvents(db *gorm.DB, cal *TimelineCalendar, events []TimelineEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(events))
+	index := make(map[uint]int, len(events))
+	for i := range events {
+		ids[i] = events[i].ID
+		index[events[i].ID] = i
+		events[i].CharacterIDs = []uint{}
+		events[i].TimeLabel = cal.Format(events[i].TimePoint)
+	}
+	var links []TimelineEventCharacter
+	if err := db.Where("event_id IN ?", ids).Order("character_id ASC").Find(&links).Error; err != nil {
+		return err
+	}
+	for _, link := range links {
+		event := &events[index[link.EventID]]
+		event.CharacterIDs = append(event.CharacterIDs, link.CharacterID)
+	}
+	return nil
+}
+
+// TimelineFilter 事件查询条件，零值表示不限
+type TimelineFilter struct {
+	CharacterID uint `form:"characterId"` // 参与角色
+	ChapterID   uint `form:"chapterId"`   // 叙述章节
+	StoryNodeID int  `form:"storyNodeId"` // 故事节点
+}
+
+// ListTimelineEvents 按故事内时间先后获取小说的事件
+func ListTimelineEvents(db *gorm.DB, novelID uint, filter TimelineFilter) ([]TimelineEvent, error) {
+	cal, err := GetTimelineCalendar(db, novelID)
+	if err != nil {
+		return nil, err
+	}
+	query := db.Where("novel_id = ?", novelID)
+	if filter.CharacterID != 0 {
+		query = query.Where("id IN (?)", db.Model(&TimelineEventCharacter{}).
+			Select("event_id").Where("character_id = ?", filter.CharacterID))
+	}
+	if filter.ChapterID != 0 {
+		query = query.Where("chapter_id = ?", filter.ChapterID)
+	}
+	if filter.StoryNodeID != 0 {
+		query = query.Where("story_node_id = ?", filter.StoryNodeID)
+	}
+	var events []TimelineEvent
+	if err := query.Order(timelineOrder).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, fillTimelineEvents(db, cal, events)
+}
+
+// GetTimelineEvent 获取事件及其参与角色
+func GetTimelineEvent(db *gorm.DB, eventID uint) (*TimelineEvent, error) {
+	var event TimelineEvent
+	if err := db.First(&event, eventID).Error; err != nil {
+		return nil, err
+	}
+	cal, err := GetTimelineCalendar(db, event.NovelID)
+	if err != nil {
+		return nil, err
+	}
+	events := []TimelineEvent{event}
+	if err := fillTimelineEvents(db, cal, events); err != nil {
+		return nil, err
+	}
+	return &events[0], nil
+}
+
+// ListEventsBefore 获取故事内时间早于指定事件的事件（按时间先后排列），limit 为 0 时不限数量
+func ListEventsBefore(db *gorm.DB, event *TimelineEvent, limit int) ([]TimelineEvent, error) {
+	cal, err := GetTimelineCalendar(db, event.NovelID)
+	if err != nil {
+		return nil, err
+	}
+	query := db.Where("novel_id = ? AND id <> ?", event.NovelID, event.ID).
+		Where("ordinal < ? OR (ordinal = ? AND (sequence < ? OR (sequence = ? AND id < ?)))",
+			event.Ordinal, event.Ordinal, event.Sequence, event.Sequence, event.ID).
+		Order("ordinal DESC, sequence DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var events []TimelineEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, fillTimelineEvents(db, cal, events)
+}
+
+// FindCharacterLocation 获取角色在指定时间点所在的位置：该时间点及之前最近一次有地点的参与事件
+// 没有记录时返回 gorm.ErrRecordNotFound
+func FindCharacterLocation(db *gorm.DB, novelID, characterID uint, at TimePoint) (*TimelineEvent, error) {
+	cal, err := GetTimelineCalendar(db, novelID)
+	if err != nil {
+		return nil, err
+	}
+	ordinal, err := cal.Ordinal(at)
+	if err != nil {
+		return nil, invalid(err)
+	}
+	var event TimelineEvent
+	err = db.Where("novel_id = ? AND ordinal <= ?", novelID, ordinal).
+		Where("location <> '' OR location_id <> 0").
+		Where("id IN (?)", db.Model(&TimelineEventCharacter{}).Select("event_id").Where("character_id = ?", characterID)).
+		Order("ordinal DESC, sequence DESC, id DESC").
+		First(&event).Error
+	if err != nil {
+		return nil, err
+	}
+	events := []TimelineEvent{event}
+	if err := fillTimelineEvents(db, cal, events); err != nil {
+		return nil, err
+	}
+	return &events[0], nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimelineCalendar_Ordinal(t *testing.T) {
+	cal := &TimelineCalendar{
+		Eras:   []CalendarEra{{Name: "太初", Years: 100}, {Name: "天元"}},
+		Months: []CalendarMonth{{Name: "春月", Days: 90}, {Name: "夏月", Days: 90}, {Name: "秋月", Days: 90}, {Name: "冬月", Days: 95}},
+	}
+	require.NoError(t, cal.Validate())
+
+	ordinal, err := cal.Ordinal(TimePoint{Era: "太初", Year: 1, Month: 1, Day: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), ordinal)
+
+	// 天元元年紧接太初一百年之后
+	ordinal, err = cal.Ordinal(TimePoint{Era: "天元", Year: 1, Month: 2, Day: 3})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100*365+90+2), ordinal)
+
+	// 未指定月日时按该年第一天排序
+	yearOnly, err := cal.Ordinal(TimePoint{Era: "天元", Year: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100*365), yearOnly)
+	assert.Equal(t, "天元1年夏月3日", cal.Format(TimePoint{Era: "天元", Year: 1, Month: 2, Day: 3}))
+
+	for _, p := range []TimePoint{
+		{Era: "太初", Year: 101},
+		{Era: "上古", Year: 1},
+		{Era: "天元", Year: 0},
+		{Era: "天元", Year: 1, Month: 5},
+		{Era: "天元", Year: 1, Month: 1, Day: 91},
+		{Era: "天元", Year: 1, Day: 3},
+	} {
+		_, err := cal.Ordinal(p)
+		assert.Error(t, err, "%+v", p)
+	}
+
+	// 只有最后一个纪元可以没有年数上限
+	cal.Eras = []CalendarEra{{Name: "太初"}, {Name: "天元"}}
+	assert.Error(t, cal.Validate())
+	assert.Error(t, (&TimelineCalendar{}).Validate())
+	assert.NoError(t, DefaultTimelineCalendar(1).Validate())
+}
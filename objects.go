@@ -56,6 +56,7 @@ type (
 	BeforeCreateFunc      func(db *gorm.DB, ctx *gin.Context, vptr any) error
 	BeforeDeleteFunc      func(db *gorm.DB, ctx *gin.Context, vptr any) error
 	BeforeUpdateFunc      func(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error
+	AfterUpdateFunc       func(db *gorm.DB, ctx *gin.Context, vptr any, vals map[string]any) error
 	BeforeRenderFunc      func(db *gorm.DB, ctx *gin.Context, vptr any) (any, error)
 	BeforeQueryRenderFunc func(db *gorm.DB, ctx *gin.Context, r *QueryResult) (any, error)
 )
@@ -88,6 +89,7 @@ type WebObject struct {
 	PrepareQuery      PrepareQuery
 	BeforeCreate      BeforeCreateFunc
 	BeforeUpdate      BeforeUpdateFunc
+	AfterUpdate       AfterUpdateFunc // called after a successful update, vptr is the record before the update, vals are the columns written
 	BeforeDelete      BeforeDeleteFunc
 	BeforeRender      BeforeRenderFunc
 	BeforeQueryRender BeforeQueryRenderFunc
@@ -541,13 +543,16 @@ func handleEditObject(c *gin.Context, obj *WebObject) {
 	}
 	db = obj.buildPrimaryCondition(db.Model(obj.Model), keys)
 
-	if obj.BeforeUpdate != nil {
-		val := reflect.New(obj.modelElem).Interface()
+	var val any
+	if obj.BeforeUpdate != nil || obj.AfterUpdate != nil {
+		val = reflect.New(obj.modelElem).Interface()
 		tx := db.Session(&gorm.Session{})
 		if err := tx.First(val).Error; err != nil {
 			response.Fail(c, "not found", nil)
 			return
 		}
+	}
+	if obj.BeforeUpdate != nil {
 		if err := obj.BeforeUpdate(db, c, val, inputVals); err != nil {
 			response.Fail(c, err.Error(), nil)
 			return
@@ -560,6 +565,13 @@ func handleEditObject(c *gin.Context, obj *WebObject) {
 		return
 	}
 
+	if obj.AfterUpdate != nil {
+		if err := obj.AfterUpdate(db, c, val, vals); err != nil {
+			response.Fail(c, err.Error(), nil)
+			return
+		}
+	}
+
 	response.Success(c, "updated successfully", true)
 }
 
@@ -1,6 +1,7 @@
 package circuitbreaker
 
 import (
+	"context"
 	"errors"
 	"time"
 )
@@ -18,6 +19,9 @@ type RetryConfig struct {
 	// RetryableErrors is a function that determines if an error is retryable
 	// If nil, all errors are retryable
 	RetryableErrors func(error) bool
+	// RetryAfter returns the delay requested by the server for an error (e.g. HTTP Retry-After)
+	// A positive value replaces the backoff interval for that attempt, capped at MaxInterval
+	RetryAfter func(error) time.Duration
 }
 
 // DefaultRetryConfig returns a default retry configuration
@@ -61,8 +65,19 @@ func (rc *RetryConfig) WithRetryableErrors(fn func(error) bool) *RetryConfig {
 	return rc
 }
 
+// WithRetryAfter sets the function returning the server-requested delay for an error
+func (rc *RetryConfig) WithRetryAfter(fn func(error) time.Duration) *RetryConfig {
+	rc.RetryAfter = fn
+	return rc
+}
+
 // Retry executes a function with retry logic
 func Retry(fn func() error, config *RetryConfig) error {
+	return RetryContext(context.Background(), fn, config)
+}
+
+// RetryContext executes a function with retry logic, stopping early when ctx is done
+func RetryContext(ctx context.Context, fn func() error, config *RetryConfig) error {
 	if config == nil {
 		config = DefaultRetryConfig()
 	}
@@ -85,7 +100,24 @@ func Retry(fn func() error, config *RetryConfig) error {
 
 		// Don't sleep after the last attempt
 		if attempt < config.MaxAttempts-1 {
-			time.Sleep(interval)
+			delay := interval
+			if config.RetryAfter != nil {
+				if after := config.RetryAfter(err); after > 0 {
+					delay = after
+					if config.MaxInterval > 0 && delay > config.MaxInterval {
+						delay = config.MaxInterval
+					}
+				}
+			}
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return lastErr
+			case <-timer.C:
+			}
+
 			// Exponential backoff
 			interval = time.Duration(float64(interval) * config.Multiplier)
 			if interval > config.MaxInterval {
@@ -99,17 +131,22 @@ func Retry(fn func() error, config *RetryConfig) error {
 
 // RetryWithCircuitBreaker executes a function with both retry and circuit breaker protection
 func RetryWithCircuitBreaker(cb *CircuitBreaker, fn func() error, retryConfig *RetryConfig, fallback func(error) error) error {
+	return RetryWithCircuitBreakerContext(context.Background(), cb, fn, retryConfig, fallback)
+}
+
+// RetryWithCircuitBreakerContext is RetryWithCircuitBreaker that stops retrying when ctx is done
+func RetryWithCircuitBreakerContext(ctx context.Context, cb *CircuitBreaker, fn func() error, retryConfig *RetryConfig, fallback func(error) error) error {
 	if cb == nil {
 		// If no circuit breaker, just use retry
-		return Retry(fn, retryConfig)
+		return RetryContext(ctx, fn, retryConfig)
 	}
 
 	// Wrap the function to be retried with circuit breaker
 	retryFn := func() error {
-		return cb.Execute(fn)
+		return cb.ExecuteWithContext(ctx, fn)
 	}
 
-	err := Retry(retryFn, retryConfig)
+	err := RetryContext(ctx, retryFn, retryConfig)
 	if err != nil {
 		if fallback != nil {
 			return fallback(err)
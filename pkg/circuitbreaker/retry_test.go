@@ -1,6 +1,7 @@
 package circuitbreaker
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -105,6 +106,38 @@ func TestRetry_ExponentialBackoff(t *testing.T) {
 	assert.Greater(t, duration, 100*time.Millisecond)
 }
 
+func TestRetry_RetryAfter(t *testing.T) {
+	attempts := 0
+	start := time.Now()
+	err := Retry(func() error {
+		attempts++
+		if attempts < 2 {
+			return testError
+		}
+		return nil
+	}, DefaultRetryConfig().
+		WithInitialInterval(time.Millisecond).
+		WithMaxInterval(time.Second).
+		WithRetryAfter(func(error) time.Duration { return 50 * time.Millisecond }))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestRetryContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := RetryContext(ctx, func() error {
+		attempts++
+		cancel()
+		return testError
+	}, DefaultRetryConfig().WithInitialInterval(time.Second))
+
+	assert.Equal(t, testError, err)
+	assert.Equal(t, 1, attempts)
+}
+
 func TestRetryWithCircuitBreaker(t *testing.T) {
 	cb := New(&Config{
 		Name:        "test",
@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/LingByte/LingDialog/pkg/logger"
 	"github.com/LingByte/LingDialog/pkg/utils"
@@ -34,6 +35,9 @@ type Config struct {
 	LLMModel             string `env:"LLM_MODEL"`
 	OllamaBaseURL        string `env:"OLLAMA_BASE_URL"`
 	OllamaModel          string `env:"OLLAMA_MODEL"`
+	LLMMockFixtureDir    string `env:"LLM_MOCK_FIXTURE_DIR"`
+	LLMMockRecord        bool   `env:"LLM_MOCK_RECORD"`
+	LLMMockUpstream      string `env:"LLM_MOCK_UPSTREAM"`
 	SearchEnabled        bool   `env:"SEARCH_ENABLED"`
 	SearchPath           string `env:"SEARCH_PATH"`
 	SearchBatchSize      int    `env:"SEARCH_BATCH_SIZE"`
@@ -50,6 +54,33 @@ type Config struct {
 	LingstorageApiKey    string `env:"LINGSTORAGE_API_KEY"`
 	LingstorageApiSecret string `env:"LINGSTORAGE_API_SECRET"`
 	LingstorageBucket    string `env:"LINGSTORAGE_BUCKET"`
+
+	// LLM 响应缓存
+	LLMCacheEnabled        bool    `env:"LLM_CACHE_ENABLED"`
+	LLMCacheTTL            int     `env:"LLM_CACHE_TTL"` // 秒
+	LLMCacheMemorySize     int     `env:"LLM_CACHE_MEMORY_SIZE"`
+	LLMCacheMaxTemperature float64 `env:"LLM_CACHE_MAX_TEMPERATURE"`
+
+	// LLM 调用熔断、重试与备用提供商
+	LLMCallTimeout        int    `env:"LLM_CALL_TIMEOUT"` // 秒，流式调用为等待首个分片的时间
+	LLMRetryMaxAttempts   int    `env:"LLM_RETRY_MAX_ATTEMPTS"`
+	LLMBreakerMaxFailures int    `env:"LLM_BREAKER_MAX_FAILURES"`
+	LLMBreakerOpenTimeout int    `env:"LLM_BREAKER_OPEN_TIMEOUT"` // 秒
+	LLMFallbackProvider   string `env:"LLM_FALLBACK_PROVIDER"`
+	LLMFallbackBaseURL    string `env:"LLM_FALLBACK_BASE_URL"`
+	LLMFallbackAPIKey     string `env:"LLM_FALLBACK_API_KEY"`
+	LLMFallbackModel      string `env:"LLM_FALLBACK_MODEL"`
+
+	// LLM 调用审计
+	LLMAuditEnabled       bool `env:"LLM_AUDIT_ENABLED"`
+	LLMAuditRetentionDays int  `env:"LLM_AUDIT_RETENTION_DAYS"` // 0 表示不清理
+	LLMAuditRedact        bool `env:"LLM_AUDIT_REDACT"`         // 只保存消息角色和长度，不保存正文
+
+	// LLM 预算告警渠道（站内通知始终发送给管理员）
+	LLMBudgetDingTalkWebhook string `env:"LLM_BUDGET_DINGTALK_WEBHOOK"`
+	LLMBudgetDingTalkSecret  string `env:"LLM_BUDGET_DINGTALK_SECRET"`
+	LLMBudgetFeishuWebhook   string `env:"LLM_BUDGET_FEISHU_WEBHOOK"`
+	LLMBudgetFeishuSecret    string `env:"LLM_BUDGET_FEISHU_SECRET"`
 }
 
 // GlobalConfig is the global configuration instance
@@ -100,6 +131,9 @@ func Load() error {
 		LLMModel:             getStringOrDefault("LLM_MODEL", getStringOrDefault("OPENAI_MODEL", "gpt-3.5-turbo")),
 		OllamaBaseURL:        getStringOrDefault("OLLAMA_BASE_URL", "http://localhost:11434"),
 		OllamaModel:          getStringOrDefault("OLLAMA_MODEL", "llama2"),
+		LLMMockFixtureDir:    getStringOrDefault("LLM_MOCK_FIXTURE_DIR", "./testdata/llm"),
+		LLMMockRecord:        getBoolOrDefault("LLM_MOCK_RECORD", false),
+		LLMMockUpstream:      getStringOrDefault("LLM_MOCK_UPSTREAM", "openai"),
 		SearchEnabled:        getBoolOrDefault("SEARCH_ENABLED", false),
 		SearchPath:           getStringOrDefault("SEARCH_PATH", "./search"),
 		SearchBatchSize:      getIntOrDefault("SEARCH_BATCH_SIZE", 100),
@@ -116,6 +150,29 @@ func Load() error {
 		LingstorageApiKey:    getStringOrDefault("LINGSTORAGE_API_KEY", ""),
 		LingstorageApiSecret: getStringOrDefault("LINGSTORAGE_API_SECRET", ""),
 		LingstorageBucket:    getStringOrDefault("LINGSTORAGE_BUCKET", ""),
+
+		LLMCacheEnabled:        getBoolOrDefault("LLM_CACHE_ENABLED", false),
+		LLMCacheTTL:            getIntOrDefault("LLM_CACHE_TTL", 86400),
+		LLMCacheMemorySize:     getIntOrDefault("LLM_CACHE_MEMORY_SIZE", 1000),
+		LLMCacheMaxTemperature: getFloatOrDefault("LLM_CACHE_MAX_TEMPERATURE", 0.7),
+
+		LLMCallTimeout:        getIntOrDefault("LLM_CALL_TIMEOUT", 60),
+		LLMRetryMaxAttempts:   getIntOrDefault("LLM_RETRY_MAX_ATTEMPTS", 3),
+		LLMBreakerMaxFailures: getIntOrDefault("LLM_BREAKER_MAX_FAILURES", 5),
+		LLMBreakerOpenTimeout: getIntOrDefault("LLM_BREAKER_OPEN_TIMEOUT", 30),
+		LLMFallbackProvider:   getStringOrDefault("LLM_FALLBACK_PROVIDER", ""),
+		LLMFallbackBaseURL:    getStringOrDefault("LLM_FALLBACK_BASE_URL", ""),
+		LLMFallbackAPIKey:     getStringOrDefault("LLM_FALLBACK_API_KEY", ""),
+		LLMFallbackModel:      getStringOrDefault("LLM_FALLBACK_MODEL", ""),
+
+		LLMAuditEnabled:       getBoolOrDefault("LLM_AUDIT_ENABLED", true),
+		LLMAuditRetentionDays: getIntOrDefault("LLM_AUDIT_RETENTION_DAYS", 30),
+		LLMAuditRedact:        getBoolOrDefault("LLM_AUDIT_REDACT", false),
+
+		LLMBudgetDingTalkWebhook: getStringOrDefault("LLM_BUDGET_DINGTALK_WEBHOOK", ""),
+		LLMBudgetDingTalkSecret:  getStringOrDefault("LLM_BUDGET_DINGTALK_SECRET", ""),
+		LLMBudgetFeishuWebhook:   getStringOrDefault("LLM_BUDGET_FEISHU_WEBHOOK", ""),
+		LLMBudgetFeishuSecret:    getStringOrDefault("LLM_BUDGET_FEISHU_SECRET", ""),
 	}
 
 	// Initialize lingstorage client if configured
@@ -160,6 +217,15 @@ func getIntOrDefault(key string, defaultValue int) int {
 	return int(value)
 }
 
+// getFloatOrDefault gets float environment variable value, returns default if empty or invalid
+func getFloatOrDefault(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(utils.GetEnv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 // generateDefaultSessionSecret generates a default session secret for development only
 // This should only be called when SESSION_SECRET is not set in environment
 func generateDefaultSessionSecret() string {
@@ -176,6 +242,12 @@ func GetLLMConfig() (apiKey, baseURL, model string) {
 	case "ollama":
 		// Ollama 不需要 API Key
 		return "", GlobalConfig.OllamaBaseURL, GlobalConfig.OllamaModel
+	case "mock":
+		// Mock 录制模式下转发到上游提供商，使用上游的配置
+		if GlobalConfig.LLMMockUpstream == "ollama" {
+			return "", GlobalConfig.OllamaBaseURL, GlobalConfig.OllamaModel
+		}
+		return GlobalConfig.LLMApiKey, GlobalConfig.LLMBaseURL, GlobalConfig.LLMModel
 	case "openai":
 		fallthrough
 	default:
@@ -188,3 +260,8 @@ func GetLLMConfig() (apiKey, baseURL, model string) {
 func IsOllamaProvider() bool {
 	return GlobalConfig.LLMProvider == "ollama"
 }
+
+// IsMockProvider 检查是否使用 Mock 提供商（离线测试与演示）
+func IsMockProvider() bool {
+	return GlobalConfig.LLMProvider == "mock"
+}
@@ -1,22 +1,42 @@
 package constants
 
 const (
-	TABLE_CHAPTER          = "chapters"
-	TABLE_CHARACTER        = "characters"
-	TABLE_NOVEL            = "novels"
-	TABLE_PLOT_POINT       = "plot_points"
-	TABLE_NOVEL_SETTING    = "novel_settings"
-	TABLE_STORYLINE        = "storylines"
-	TABLE_STORY_NODE       = "story_nodes"
-	TABLE_NODE_CONNECTION  = "node_connections"
-	TABLE_VOLUME           = "volumes"
-	TABLE_USER             = "users"
-	TABLE_CHAT_SESSION     = "chat_sessions"
-	TABLE_CHAT_MESSAGE     = "chat_messages"
-	TABLE_CHAT_USAGE       = "chat_usage"
-	TABLE_WRITING_GOAL     = "writing_goals"
-	TABLE_WRITING_PROGRESS = "writing_progress"
-	TABLE_ACTIVITY         = "activities"
+	TABLE_CHAPTER                  = "chapters"
+	TABLE_CHARACTER                = "characters"
+	TABLE_NOVEL                    = "novels"
+	TABLE_PLOT_POINT               = "plot_points"
+	TABLE_NOVEL_SETTING            = "novel_settings"
+	TABLE_STORYLINE                = "storylines"
+	TABLE_STORY_NODE               = "story_nodes"
+	TABLE_NODE_CONNECTION          = "node_connections"
+	TABLE_VOLUME                   = "volumes"
+	TABLE_USER                     = "users"
+	TABLE_CHAT_SESSION             = "chat_sessions"
+	TABLE_CHAT_MESSAGE             = "chat_messages"
+	TABLE_CHAT_USAGE               = "chat_usage"
+	TABLE_WRITING_GOAL             = "writing_goals"
+	TABLE_WRITING_PROGRESS         = "writing_progress"
+	TABLE_ACTIVITY                 = "activities"
+	TABLE_PROMPT_TEMPLATE          = "prompt_templates"
+	TABLE_LLM_CACHE                = "llm_response_caches"
+	TABLE_LLM_USAGE                = "llm_usage"
+	TABLE_LLM_QUOTA                = "llm_quotas"
+	TABLE_LLM_CALL                 = "llm_calls"
+	TABLE_LLM_MODEL_PRICE          = "llm_model_prices"
+	TABLE_LLM_COST_DAILY           = "llm_cost_daily"
+	TABLE_LLM_BUDGET_ALERT         = "llm_budget_alerts"
+	TABLE_CHAPTER_REVISION         = "chapter_revisions"
+	TABLE_CHARACTER_RELATIONSHIP   = "character_relationships"
+	TABLE_TIMELINE_CALENDAR        = "timeline_calendars"
+	TABLE_TIMELINE_EVENT           = "timeline_events"
+	TABLE_TIMELINE_EVENT_CHARACTER = "timeline_event_characters"
+	TABLE_CONTINUITY_CHECK         = "continuity_checks"
+	TABLE_CHAPTER_ISSUE            = "chapter_issues"
+	TABLE_FORESHADOWING            = "foreshadowings"
+	TABLE_CHAPTER_ENTITY           = "chapter_entities"
+	TABLE_STORY_SUMMARY            = "story_summaries"
+	TABLE_AUTOPILOT_JOB            = "autopilot_jobs"
+	TABLE_AUTOPILOT_STEP           = "autopilot_steps"
 )
 
 // Default Value: 1024
@@ -72,5 +92,20 @@ const KEY_SEARCH_PATH = "SEARCH_PATH"
 const KEY_SEARCH_BATCH_SIZE = "SEARCH_BATCH_SIZE"
 const KEY_SEARCH_INDEX_SCHEDULE = "SEARCH_INDEX_SCHEDULE"
 
+// AI chat context configuration keys
+const KEY_CHAT_CONTEXT_MAX_TOKENS = "CHAT_CONTEXT_MAX_TOKENS"
+const KEY_CHAT_CONTEXT_REPLY_RESERVE = "CHAT_CONTEXT_REPLY_RESERVE"
+const KEY_CHAT_CONTEXT_RECENT_CHAPTERS = "CHAT_CONTEXT_RECENT_CHAPTERS"
+
+// Default LLM token quotas per user, 0 means unlimited
+const KEY_LLM_QUOTA_DAILY_TOKENS = "LLM_QUOTA_DAILY_TOKENS"
+const KEY_LLM_QUOTA_MONTHLY_TOKENS = "LLM_QUOTA_MONTHLY_TOKENS"
+
+// Monthly LLM budget with alert thresholds (JSON), empty disables alerts
+const KEY_LLM_BUDGET = "LLM_BUDGET"
+
+// Per-task LLM model routing table (JSON object keyed by task name)
+const KEY_LLM_MODEL_ROUTES = "LLM_MODEL_ROUTES"
+
 const ENV_STATIC_PREFIX = "STATIC_PREFIX"
 const ENV_STATIC_ROOT = "STATIC_ROOT"
@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// CallInfo 调用方信息，由请求入口写入上下文，随审计记录保存
+type CallInfo struct {
+	UserID  uint   // 用户ID，后台任务为 0
+	NovelID uint   // 关联的小说ID，未知时为 0
+	Feature string // 功能标识（如 chapter.generate_stream）
+}
+
+// callInfoKey 上下文中保存 CallInfo 的键
+type callInfoKey struct{}
+
+// WithCallInfo 在上下文中写入调用方信息，返回的指针可在请求处理过程中补充（如解析出小说ID后）
+func WithCallInfo(ctx context.Context, info *CallInfo) context.Context {
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// CallInfoFrom 返回上下文中的调用方信息，不存在时返回 nil
+func CallInfoFrom(ctx context.Context) *CallInfo {
+	info, _ := ctx.Value(callInfoKey{}).(*CallInfo)
+	return info
+}
+
+// CallRecord 一次提供商调用的审计记录
+type CallRecord struct {
+	ID            uint // 由 CallRecorder 写入后设置，用于回填解析结果
+	Info          CallInfo
+	Task          string
+	Provider      string
+	Model         string // 实际使用的模型，提供商未返回时为请求中的模型
+	PromptVersion string
+	Stream        bool
+	Temperature   *float32
+	MaxTokens     *int
+	Messages      []Message
+	Response      string
+	ToolCalls     []openai.ToolCall
+	Usage         Usage
+	Estimated     bool // 用量是否为估算值
+	Cached        bool
+	Latency       time.Duration
+	Err           error
+	Cancelled     bool
+}
+
+// CallRecorder 审计记录存储
+type CallRecorder interface {
+	// RecordCall 保存一次调用，成功时设置 record.ID
+	RecordCall(ctx context.Context, record *CallRecord)
+	// RecordParse 回填结构化输出的解析结果，problems 为空表示解析成功
+	RecordParse(ctx context.Context, record *CallRecord, problems []string)
+}
+
+var (
+	callRecorderMu sync.RWMutex
+	callRecorder   CallRecorder
+)
+
+// SetCallRecorder 设置全局审计记录存储，传 nil 则不记录
+func SetCallRecorder(recorder CallRecorder) {
+	callRecorderMu.Lock()
+	defer callRecorderMu.Unlock()
+	callRecorder = recorder
+}
+
+func getCallRecorder() CallRecorder {
+	callRecorderMu.RLock()
+	defer callRecorderMu.RUnlock()
+	return callRecorder
+}
+
+// callTrace 记录一次结构化生成过程中最近的调用，用于回填解析结果
+type callTrace struct {
+	mu   sync.Mutex
+	last *CallRecord
+}
+
+// callTraceKey 上下文中保存 callTrace 的键
+type callTraceKey struct{}
+
+// withCallTrace 在上下文中创建调用追踪
+func withCallTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callTraceKey{}, &callTrace{})
+}
+
+// callTraceFrom 返回上下文中的调用追踪，不存在时返回 nil
+func callTraceFrom(ctx context.Context) *callTrace {
+	trace, _ := ctx.Value(callTraceKey{}).(*callTrace)
+	return trace
+}
+
+// setLast 记录最近一次调用
+func (t *callTrace) setLast(record *CallRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = record
+}
+
+// reportParse 将解析结果回填到最近一次调用的审计记录
+func (t *callTrace) reportParse(ctx context.Context, problems []string) {
+	t.mu.Lock()
+	last := t.last
+	t.last = nil
+	t.mu.Unlock()
+
+	recorder := getCallRecorder()
+	if recorder == nil || last == nil || last.ID == 0 {
+		return
+	}
+	recorder.RecordParse(context.WithoutCancel(ctx), last, problems)
+}
+
+// RedactedContent 审计记录中替代已脱敏内容的占位文本
+func RedactedContent(content string) string {
+	if content == "" {
+		return ""
+	}
+	return fmt.Sprintf("[已脱敏 %d 字符]", len([]rune(content)))
+}
+
+// RedactMessages 返回去掉正文、只保留角色、长度和工具调用名称的消息副本
+func RedactMessages(messages []Message) []Message {
+	redacted := make([]Message, len(messages))
+	for i, m := range messages {
+		redacted[i] = Message{
+			Role:       m.Role,
+			Content:    RedactedContent(m.Content),
+			ToolCalls:  RedactToolCalls(m.ToolCalls),
+			ToolCallID: m.ToolCallID,
+		}
+	}
+	return redacted
+}
+
+// RedactToolCalls 返回去掉参数、只保留工具名称的工具调用副本
+func RedactToolCalls(calls []openai.ToolCall) []openai.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	redacted := make([]openai.ToolCall, len(calls))
+	for i, call := range calls {
+		call.Function.Arguments = RedactedContent(call.Function.Arguments)
+		redacted[i] = call
+	}
+	return redacted
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 )
 
 // CharacterGenerateRequest 角色生成请求
@@ -16,18 +18,132 @@ type CharacterGenerateRequest struct {
 	Background  string `json:"background"`  // 背景设定（可选）
 }
 
-// CharacterGenerateResponse 角色生成响应
-type CharacterGenerateResponse struct {
-	Name        string `json:"name"`        // 角色名称
-	Description string `json:"description"` // 完整的角色描述
-	Personality string `json:"personality"` // 性格特点
-	Background  string `json:"background"`  // 背景故事
-	Appearance  string `json:"appearance"`  // 外貌描述
-	Skills      string `json:"skills"`      // 技能特长
-	Goals       string `json:"goals"`       // 目标动机
-	Weaknesses  string `json:"weaknesses"`  // 弱点缺陷
+// 角色状态
+const (
+	CharacterStatusAlive   = "alive"   // 存活
+	CharacterStatusDead    = "dead"    // 死亡
+	CharacterStatusMissing = "missing" // 失踪
+)
+
+// CharacterProfile 结构化角色档案
+type CharacterProfile struct {
+	Name        string            `json:"name"`                  // 角色名称
+	Aliases     []string          `json:"aliases,omitempty"`     // 别名、称号
+	Role        string            `json:"role,omitempty"`        // 角色定位（主角/配角/反派等）
+	Gender      string            `json:"gender,omitempty"`      // 性别
+	Age         string            `json:"age,omitempty"`         // 年龄（可为描述，如"约三百岁"）
+	Description string            `json:"description,omitempty"` // 简介
+	Appearance  string            `json:"appearance,omitempty"`  // 外貌
+	Personality string            `json:"personality,omitempty"` // 性格（含优点和缺点）
+	Background  string            `json:"background,omitempty"`  // 背景经历
+	Goals       string            `json:"goals,omitempty"`       // 目标动机
+	Abilities   string            `json:"abilities,omitempty"`   // 能力、技能
+	PowerLevel  string            `json:"powerLevel,omitempty"`  // 实力等级（如境界）
+	Faction     string            `json:"faction,omitempty"`     // 所属势力
+	Status      string            `json:"status,omitempty"`      // 状态（alive/dead/missing）
+	Attributes  map[string]string `json:"attributes,omitempty"`  // 自定义属性
+}
+
+// profileField 档案中的文本字段及其中文名称，按展示顺序排列
+type profileField struct {
+	Label string
+	Value *string
+}
+
+// textFields 返回档案中除名称外的文本字段
+func (p *CharacterProfile) textFields() []profileField {
+	return []profileField{
+		{"定位", &p.Role},
+		{"性别", &p.Gender},
+		{"年龄", &p.Age},
+		{"简介", &p.Description},
+		{"外貌", &p.Appearance},
+		{"性格", &p.Personality},
+		{"背景", &p.Background},
+		{"目标", &p.Goals},
+		{"能力", &p.Abilities},
+		{"实力", &p.PowerLevel},
+		{"势力", &p.Faction},
+	}
+}
+
+// characterStatusLabels 角色状态的中文名称
+var characterStatusLabels = map[string]string{
+	CharacterStatusAlive:   "存活",
+	CharacterStatusDead:    "死亡",
+	CharacterStatusMissing: "失踪",
+}
+
+// Text 将档案渲染为提示词中使用的多行文本，空字段不输出
+func (p *CharacterProfile) Text() string {
+	var lines []string
+	if len(p.Aliases) > 0 {
+		lines = append(lines, "别名："+strings.Join(p.Aliases, "、"))
+	}
+	for _, field := range p.textFields() {
+		if v := strings.TrimSpace(*field.Value); v != "" {
+			lines = append(lines, field.Label+"："+v)
+		}
+	}
+	if label, ok := characterStatusLabels[p.Status]; ok && p.Status != CharacterStatusAlive {
+		lines = append(lines, "状态："+label)
+	}
+	keys := make([]string, 0, len(p.Attributes))
+	for k := range p.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v := strings.TrimSpace(p.Attributes[k]); v != "" {
+			lines = append(lines, k+"："+v)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// IsValidCharacterStatus 是否为支持的角色状态
+func IsValidCharacterStatus(status string) bool {
+	_, ok := characterStatusLabels[status]
+	return ok
+}
+
+// Normalize 去掉空白别名，状态为空或无效时视为存活
+func (p *CharacterProfile) Normalize() {
+	aliases := p.Aliases[:0]
+	for _, alias := range p.Aliases {
+		if alias = strings.TrimSpace(alias); alias != "" && alias != p.Name {
+			aliases = append(aliases, alias)
+		}
+	}
+	p.Aliases = aliases
+	if !IsValidCharacterStatus(p.Status) {
+		p.Status = CharacterStatusAlive
+	}
 }
 
+// CharacterGenerateResponse 角色生成响应
+type CharacterGenerateResponse = CharacterProfile
+
+// characterResponseFormat 角色档案的 JSON 返回格式，仅附加到需要结构化输出的调用
+const characterResponseFormat = `请以 JSON 格式返回结果，包含以下字段：
+{
+  "name": "角色名称",
+  "aliases": ["别名或称号，没有则为空数组"],
+  "role": "角色定位（主角/配角/反派等）",
+  "gender": "性别",
+  "age": "年龄",
+  "description": "角色简介（80-120字）",
+  "appearance": "外貌描述（80-100字）",
+  "personality": "性格特点，包括优点和弱点缺陷（100-150字）",
+  "background": "背景故事（150-200字）",
+  "goals": "目标动机（80-100字）",
+  "abilities": "能力、技能特长（80-100字）",
+  "powerLevel": "实力等级或境界，不适用时留空",
+  "faction": "所属势力或阵营，没有则留空",
+  "status": "alive",
+  "attributes": {"其他重要属性名": "属性值"}
+}`
+
 // CharacterGenerator 角色生成器
 type CharacterGenerator struct {
 	handler *LLMHandler
@@ -35,7 +151,7 @@ type CharacterGenerator struct {
 }
 
 // NewCharacterGenerator 创建角色生成器
-func NewCharacterGenerator(apiKey, baseURL, model string) *CharacterGenerator {
+func NewCharacterGenerator(provider Provider, model string) *CharacterGenerator {
 	systemPrompt := `你是一个专业的小说角色设计师，擅长创造有深度、立体的角色。
 
 你的任务是根据用户提供的基本信息，生成一个完整、详细的角色设定。
@@ -52,21 +168,9 @@ func NewCharacterGenerator(apiKey, baseURL, model string) *CharacterGenerator {
 - 真实可信，有血有肉
 - 性格复杂，不是单一标签
 - 有成长空间和故事潜力
-- 符合小说的整体风格和背景
-
-请以 JSON 格式返回结果，包含以下字段：
-{
-  "name": "角色名称",
-  "description": "角色的完整描述（200-300字）",
-  "personality": "性格特点（100-150字）",
-  "background": "背景故事（150-200字）",
-  "appearance": "外貌描述（80-100字）",
-  "skills": "技能特长（80-100字）",
-  "goals": "目标动机（80-100字）",
-  "weaknesses": "弱点缺陷（80-100字）"
-}`
+- 符合小说的整体风格和背景`
 
-	handler := NewLLMHandler(context.Background(), apiKey, baseURL, systemPrompt)
+	handler := NewLLMHandler(provider, systemPrompt)
 
 	// 如果没有指定模型，使用默认值
 	if model == "" {
@@ -80,7 +184,7 @@ func NewCharacterGenerator(apiKey, baseURL, model string) *CharacterGenerator {
 }
 
 // Generate 生成角色
-func (g *CharacterGenerator) Generate(req CharacterGenerateRequest) (*CharacterGenerateResponse, error) {
+func (g *CharacterGenerator) Generate(ctx context.Context, req CharacterGenerateRequest) (*CharacterGenerateResponse, error) {
 	// 构建提示词
 	prompt := fmt.Sprintf("请为以下角色生成完整的设定：\n\n")
 	prompt += fmt.Sprintf("角色名称：%s\n", req.Name)
@@ -102,38 +206,30 @@ func (g *CharacterGenerator) Generate(req CharacterGenerateRequest) (*CharacterG
 		prompt += fmt.Sprintf("性格参考：%s\n", req.Personality)
 	}
 
-	if req.Background != "" {
-		prompt += fmt.Sprintf("\n【重要】小说世界观和背景设定：\n%s\n", req.Background)
-		prompt += "\n请严格遵循上述世界观设定，确保角色的背景、能力、经历都符合这个世界的规则和设定。\n"
-	}
-
 	prompt += "\n请生成完整的角色设定，以纯 JSON 格式返回，不要包含任何 markdown 标记或其他文本。"
 
 	// 调用 LLM
 	options := QueryOptions{
 		Model:       g.model,
+		Task:        TaskCharacterGenerate,
 		Temperature: Float32Ptr(0.8), // 较高的温度以获得更有创意的结果
+		SystemContext: []string{
+			characterResponseFormat,
+			ContextSection("小说世界观和背景设定", req.Background, "请严格遵循上述世界观设定，确保角色的背景、能力、经历都符合这个世界的规则和设定。"),
+		},
 	}
 
-	response, err := g.handler.QueryWithOptions(prompt, options)
+	result, err := GenerateStructured[CharacterGenerateResponse](ctx, g.handler, prompt, options)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate character: %w", err)
 	}
 
-	// 清理响应，移除可能的 markdown 代码块标记
-	cleanedResponse := CleanAIResponse(response)
-
-	// 解析响应
-	var result CharacterGenerateResponse
-	if err := json.Unmarshal([]byte(cleanedResponse), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w (response: %s)", err, cleanedResponse)
-	}
-
-	return &result, nil
+	result.Normalize()
+	return result, nil
 }
 
 // GenerateStream 流式生成角色（用于实时显示生成过程）
-func (g *CharacterGenerator) GenerateStream(req CharacterGenerateRequest, callback func(segment string, isComplete bool) error) (*CharacterGenerateResponse, error) {
+func (g *CharacterGenerator) GenerateStream(ctx context.Context, req CharacterGenerateRequest, callback func(segment string, isComplete bool) error) (*CharacterGenerateResponse, error) {
 	// 构建提示词
 	prompt := fmt.Sprintf("请为以下角色生成完整的设定：\n\n")
 	prompt += fmt.Sprintf("角色名称：%s\n", req.Name)
@@ -155,91 +251,310 @@ func (g *CharacterGenerator) GenerateStream(req CharacterGenerateRequest, callba
 		prompt += fmt.Sprintf("性格参考：%s\n", req.Personality)
 	}
 
-	if req.Background != "" {
-		prompt += fmt.Sprintf("\n【重要】小说世界观和背景设定：\n%s\n", req.Background)
-		prompt += "\n请严格遵循上述世界观设定，确保角色的背景、能力、经历都符合这个世界的规则和设定。\n"
-	}
-
 	prompt += "\n请生成完整的角色设定，以纯 JSON 格式返回，不要包含任何 markdown 标记或其他文本。"
 
 	// 调用 LLM 流式接口
 	options := QueryOptions{
 		Model:       g.model,
+		Task:        TaskCharacterGenerate,
 		Temperature: Float32Ptr(0.8),
 		Stream:      true,
+		SystemContext: []string{
+			characterResponseFormat,
+			ContextSection("小说世界观和背景设定", req.Background, "请严格遵循上述世界观设定，确保角色的背景、能力、经历都符合这个世界的规则和设定。"),
+		},
 	}
 
-	response, err := g.handler.QueryStream(prompt, options, callback)
+	result, err := GenerateStructuredStream[CharacterGenerateResponse](ctx, g.handler, prompt, options, callback)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate character: %w", err)
 	}
 
-	// 清理响应，移除可能的 markdown 代码块标记
-	cleanedResponse := CleanAIResponse(response)
-
-	// 解析响应
-	var result CharacterGenerateResponse
-	if err := json.Unmarshal([]byte(cleanedResponse), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w (response: %s)", err, cleanedResponse)
-	}
-
-	return &result, nil
+	result.Normalize()
+	return result, nil
 }
 
-// EnhanceDescription 增强角色描述
-func (g *CharacterGenerator) EnhanceDescription(name, currentDescription string) (string, error) {
-	prompt := fmt.Sprintf(`请帮我优化和扩展以下角色的描述，使其更加生动、立体和有深度：
+// EnhanceDescription 增强角色档案：保留已有设定，补全空缺字段并丰富细节
+func (g *CharacterGenerator) EnhanceDescription(ctx context.Context, profile CharacterProfile) (*CharacterProfile, error) {
+	current, _ := json.MarshalIndent(profile, "", "  ")
+	prompt := fmt.Sprintf(`请帮我优化和完善以下角色的档案，使其更加生动、立体和有深度：
 
-角色名称：%s
-当前描述：%s
+%s
 
-请返回优化后的描述（200-300字），要求：
-1. 保留原有的核心特点
-2. 增加更多细节和深度
-3. 使描述更加生动形象
-4. 突出角色的独特性
+要求：
+1. 保留原有的核心特点，不要改动名称、别名、状态和已有的自定义属性
+2. 补全空缺的字段，为已有字段增加细节和深度
+3. 使描述更加生动形象，突出角色的独特性
+4. 各字段之间保持一致，不要互相矛盾
 
-只返回优化后的描述文本，不要包含其他内容。`, name, currentDescription)
+请以纯 JSON 格式返回完整的角色档案。`, current)
 
 	options := QueryOptions{
-		Model:       g.model,
-		Temperature: Float32Ptr(0.7),
+		Model:         g.model,
+		Task:          TaskCharacterEnhance,
+		Temperature:   Float32Ptr(0.7),
+		SystemContext: []string{characterResponseFormat},
 	}
 
-	response, err := g.handler.QueryWithOptions(prompt, options)
+	result, err := GenerateStructured[CharacterProfile](ctx, g.handler, prompt, options)
 	if err != nil {
-		return "", fmt.Errorf("failed to enhance description: %w", err)
+		return nil, fmt.Errorf("failed to enhance description: %w", err)
+	}
+
+	// 名称、状态和自定义属性以原档案为准
+	result.Name = profile.Name
+	result.Normalize()
+	if profile.Status != "" {
+		result.Status = profile.Status
 	}
+	for k, v := range profile.Attributes {
+		if result.Attributes == nil {
+			result.Attributes = make(map[string]string)
+		}
+		result.Attributes[k] = v
+	}
+	return result, nil
+}
 
-	return response, nil
+// 角色关系类型
+const (
+	RelationshipFamily = "family" // 亲属
+	RelationshipMentor = "mentor" // 师徒
+	RelationshipRival  = "rival"  // 竞争对手
+	RelationshipLover  = "lover"  // 恋人
+	RelationshipAlly   = "ally"   // 盟友
+	RelationshipEnemy  = "enemy"  // 敌人
+	RelationshipCustom = "custom" // 自定义（名称见 Label）
+)
+
+// relationshipTypeLabels 角色关系类型的中文名称
+var relationshipTypeLabels = map[string]string{
+	RelationshipFamily: "亲属",
+	RelationshipMentor: "师徒",
+	RelationshipRival:  "竞争对手",
+	RelationshipLover:  "恋人",
+	RelationshipAlly:   "盟友",
+	RelationshipEnemy:  "敌人",
+	RelationshipCustom: "自定义",
 }
 
-// SuggestRelationships 建议角色关系
-func (g *CharacterGenerator) SuggestRelationships(character1, character2 string, desc1, desc2 string) (string, error) {
-	prompt := fmt.Sprintf(`基于以下两个角色的设定，请建议他们之间可能的关系和互动方式：
+// IsValidRelationshipType 判断关系类型是否合法
+func IsValidRelationshipType(relationType string) bool {
+	_, ok := relationshipTypeLabels[relationType]
+	return ok
+}
 
-角色1：%s
-描述：%s
+// RelationshipTypeLabel 返回关系类型的中文名称，未知类型原样返回
+func RelationshipTypeLabel(relationType string) string {
+	if label, ok := relationshipTypeLabels[relationType]; ok {
+		return label
+	}
+	return relationType
+}
 
-角色2：%s
-描述：%s
+// RelationshipSuggestRequest 角色关系建议请求
+type RelationshipSuggestRequest struct {
+	NovelTitle string             // 小说标题（可选）
+	Characters []CharacterProfile // 参与分析的角色，建议中以数组索引引用
+	Existing   []string           // 已有关系（如"林风 → 苏瑶：恋人"），避免重复建议
+	Background string             // 世界观或剧情背景（可选）
+}
 
-请分析：
-1. 他们可能的关系类型（朋友、敌人、师徒、恋人等）
-2. 互动的可能性和冲突点
-3. 关系发展的潜在方向
+// RelationshipSuggestion AI 建议的角色关系
+type RelationshipSuggestion struct {
+	FromIndex   int    `json:"fromIndex"`                  // 起始角色在数组中的索引
+	ToIndex     int    `json:"toIndex"`                    // 目标角色在数组中的索引
+	Type        string `json:"type"`                       // family, mentor, rival, lover, ally, enemy, custom
+	Label       string `json:"label" llm:"optional"`       // 具体称谓（如"师兄"），自定义类型时为关系名称
+	Description string `json:"description" llm:"optional"` // 关系描述
+	Intensity   int    `json:"intensity" llm:"optional"`   // 关系强度 1-10
+	Directional bool   `json:"directional" llm:"optional"` // 是否单向（由 from 指向 to，如暗恋、师父指向徒弟）
+}
+
+// relationshipsResponse 角色关系建议的模型输出
+type relationshipsResponse struct {
+	Relationships []RelationshipSuggestion `json:"relationships"`
+}
 
-返回简洁的分析（150-200字）。`, character1, desc1, character2, desc2)
+// relationshipResponseFormat 角色关系建议的 JSON 返回格式
+const relationshipResponseFormat = `请以 JSON 格式返回结果：
+{
+  "relationships": [
+    {
+      "fromIndex": 0,
+      "toIndex": 1,
+      "type": "family/mentor/rival/lover/ally/enemy/custom 之一",
+      "label": "具体称谓，如师兄、养父；type 为 custom 时必须填写关系名称",
+      "description": "关系描述和潜在冲突（50-100字）",
+      "intensity": 1-10 的关系强度,
+      "directional": 关系是否单向（如暗恋、师父指向徒弟为 true，盟友为 false）
+    }
+  ]
+}`
+
+// DefaultRelationshipIntensity 未指定时的关系强度
+const DefaultRelationshipIntensity = 5
+
+// NormalizeRelationship 规范化关系类型和强度：未知类型改为自定义并以原类型作为名称，强度限制在 1-10
+func NormalizeRelationship(relationType, label string, intensity int) (string, string, int) {
+	relationType = strings.ToLower(strings.TrimSpace(relationType))
+	label = strings.TrimSpace(label)
+	if !IsValidRelationshipType(relationType) {
+		if label == "" {
+			label = relationType
+		}
+		relationType = RelationshipCustom
+	}
+	switch {
+	case intensity <= 0:
+		intensity = DefaultRelationshipIntensity
+	case intensity > 10:
+		intensity = 10
+	}
+	return relationType, label, intensity
+}
+
+// SuggestRelationships 根据角色档案建议角色之间的结构化关系
+// 引用不存在的角色、角色指向自己或没有名称的自定义关系会被丢弃
+func (g *CharacterGenerator) SuggestRelationships(ctx context.Context, req RelationshipSuggestRequest) ([]RelationshipSuggestion, error) {
+	if len(req.Characters) < 2 {
+		return nil, fmt.Errorf("at least two characters are required")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("基于以下角色的设定，请建议他们之间可能存在的关系：\n\n")
+	if req.NovelTitle != "" {
+		sb.WriteString(fmt.Sprintf("所属小说：%s\n\n", req.NovelTitle))
+	}
+	for i, character := range req.Characters {
+		sb.WriteString(fmt.Sprintf("[%d] %s\n", i, character.Name))
+		if text := character.Text(); text != "" {
+			sb.WriteString(text + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	if len(req.Existing) > 0 {
+		sb.WriteString("已有关系（不要重复建议）：\n")
+		for _, existing := range req.Existing {
+			sb.WriteString("- " + existing + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(`要求：
+1. 用角色前的编号表示 fromIndex 和 toIndex
+2. 只建议有故事潜力的关系，不必两两都有关系
+3. 关系应符合角色的背景、势力和目标，并能制造冲突或推动剧情`)
 
 	options := QueryOptions{
 		Model:       g.model,
+		Task:        TaskCharacterRelationships,
 		Temperature: Float32Ptr(0.7),
+		SystemContext: []string{
+			relationshipResponseFormat,
+			ContextSection("小说世界观和背景设定", req.Background),
+		},
 	}
 
-	response, err := g.handler.QueryWithOptions(prompt, options)
+	result, err := GenerateStructured[relationshipsResponse](ctx, g.handler, sb.String(), options)
 	if err != nil {
-		return "", fmt.Errorf("failed to suggest relationships: %w", err)
+		return nil, fmt.Errorf("failed to suggest relationships: %w", err)
 	}
 
-	return response, nil
+	suggestions := make([]RelationshipSuggestion, 0, len(result.Relationships))
+	for _, s := range result.Relationships {
+		if s.FromIndex < 0 || s.FromIndex >= len(req.Characters) ||
+			s.ToIndex < 0 || s.ToIndex >= len(req.Characters) || s.FromIndex == s.ToIndex {
+			continue
+		}
+		s.Type, s.Label, s.Intensity = NormalizeRelationship(s.Type, s.Label, s.Intensity)
+		if s.Type == RelationshipCustom && s.Label == "" {
+			continue
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, nil
+}
+
+// descriptionLabels 旧版角色描述中常见的标签与档案字段的对应关系
+var descriptionLabels = map[string]func(p *CharacterProfile) *string{
+	"简介":   func(p *CharacterProfile) *string { return &p.Description },
+	"描述":   func(p *CharacterProfile) *string { return &p.Description },
+	"角色描述": func(p *CharacterProfile) *string { return &p.Description },
+	"定位":   func(p *CharacterProfile) *string { return &p.Role },
+	"角色定位": func(p *CharacterProfile) *string { return &p.Role },
+	"身份":   func(p *CharacterProfile) *string { return &p.Role },
+	"性别":   func(p *CharacterProfile) *string { return &p.Gender },
+	"年龄":   func(p *CharacterProfile) *string { return &p.Age },
+	"外貌":   func(p *CharacterProfile) *string { return &p.Appearance },
+	"外貌描述": func(p *CharacterProfile) *string { return &p.Appearance },
+	"外表":   func(p *CharacterProfile) *string { return &p.Appearance },
+	"性格":   func(p *CharacterProfile) *string { return &p.Personality },
+	"性格特点": func(p *CharacterProfile) *string { return &p.Personality },
+	"弱点":   func(p *CharacterProfile) *string { return &p.Personality },
+	"弱点缺陷": func(p *CharacterProfile) *string { return &p.Personality },
+	"背景":   func(p *CharacterProfile) *string { return &p.Background },
+	"背景故事": func(p *CharacterProfile) *string { return &p.Background },
+	"经历":   func(p *CharacterProfile) *string { return &p.Background },
+	"目标":   func(p *CharacterProfile) *string { return &p.Goals },
+	"目标动机": func(p *CharacterProfile) *string { return &p.Goals },
+	"动机":   func(p *CharacterProfile) *string { return &p.Goals },
+	"能力":   func(p *CharacterProfile) *string { return &p.Abilities },
+	"技能":   func(p *CharacterProfile) *string { return &p.Abilities },
+	"技能特长": func(p *CharacterProfile) *string { return &p.Abilities },
+	"实力":   func(p *CharacterProfile) *string { return &p.PowerLevel },
+	"境界":   func(p *CharacterProfile) *string { return &p.PowerLevel },
+	"势力":   func(p *CharacterProfile) *string { return &p.Faction },
+	"阵营":   func(p *CharacterProfile) *string { return &p.Faction },
+}
+
+// splitDescriptionLabel 识别"标签：内容"、"【标签】内容"等格式的行，返回标签和内容
+func splitDescriptionLabel(line string) (label, rest string, ok bool) {
+	line = strings.TrimLeft(line, "-*#• \t")
+	if strings.HasPrefix(line, "【") {
+		if end := strings.Index(line, "】"); end > 0 {
+			return strings.TrimSpace(line[len("【"):end]), strings.TrimLeft(line[end+len("】"):], "：: "), true
+		}
+		return "", "", false
+	}
+	for _, sep := range []string{"：", ":"} {
+		if i := strings.Index(line, sep); i > 0 {
+			label = strings.Trim(line[:i], "* ")
+			if len([]rune(label)) <= 6 {
+				return label, strings.TrimSpace(line[i+len(sep):]), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// ParseCharacterDescription 将旧版的整段角色描述按"性格：""背景："等标签拆分为结构化档案
+// 标签前的文字和无法识别的内容保留在简介中；别名按顿号、逗号拆分
+func ParseCharacterDescription(name, description string) CharacterProfile {
+	profile := CharacterProfile{Name: name}
+	var aliases string
+	target := &profile.Description
+	for _, line := range strings.Split(strings.ReplaceAll(description, "\r\n", "\n"), "\n") {
+		if label, rest, ok := splitDescriptionLabel(line); ok {
+			switch {
+			case label == "别名" || label == "称号":
+				aliases, target = rest, &profile.Description
+				continue
+			case descriptionLabels[label] != nil:
+				target = descriptionLabels[label](&profile)
+				line = rest
+			}
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if *target != "" {
+			*target += "\n"
+		}
+		*target += strings.TrimSpace(line)
+	}
+	profile.Aliases = strings.FieldsFunc(aliases, func(r rune) bool {
+		return r == '、' || r == ',' || r == '，' || r == ' '
+	})
+	profile.Normalize()
+	return profile
 }
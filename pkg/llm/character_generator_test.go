@@ -0,0 +1,52 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCharacterDescription(t *testing.T) {
+	description := `小镇长大的少年。
+别名：小风、风哥
+性格特点：外冷内热
+遇事冷静
+【背景故事】自幼被师父收养
+**技能**：医术、轻功
+弱点：不善与人交往
+口头禅：随他去吧`
+
+	profile := ParseCharacterDescription("林风", description)
+	expected := CharacterProfile{
+		Name:        "林风",
+		Aliases:     []string{"小风", "风哥"},
+		Description: "小镇长大的少年。",
+		Personality: "外冷内热\n遇事冷静\n不善与人交往\n口头禅：随他去吧",
+		Background:  "自幼被师父收养",
+		Abilities:   "医术、轻功",
+		Status:      CharacterStatusAlive,
+	}
+	if !reflect.DeepEqual(profile, expected) {
+		t.Errorf("unexpected profile:\n%+v\nwant:\n%+v", profile, expected)
+	}
+
+	// 没有标签时整段保留为简介
+	plain := ParseCharacterDescription("张三", "一个普通人，在城里卖豆腐。")
+	if plain.Description != "一个普通人，在城里卖豆腐。" || plain.Personality != "" {
+		t.Errorf("unexpected profile: %+v", plain)
+	}
+}
+
+func TestCharacterProfile_Text(t *testing.T) {
+	profile := CharacterProfile{
+		Name:        "林风",
+		Aliases:     []string{"小风"},
+		Gender:      "男",
+		Personality: "外冷内热",
+		Status:      CharacterStatusDead,
+		Attributes:  map[string]string{"信物": "玉佩", "口头禅": ""},
+	}
+	expected := "别名：小风\n性别：男\n性格：外冷内热\n状态：死亡\n信物：玉佩"
+	if text := profile.Text(); text != expected {
+		t.Errorf("unexpected text:\n%s", text)
+	}
+}
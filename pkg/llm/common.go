@@ -3,132 +3,163 @@ package llm
 import (
 	"context"
 	"fmt"
-	"time"
+	"strings"
 
 	"github.com/LingByte/LingDialog/pkg/config"
 	"github.com/LingByte/LingDialog/pkg/logger"
-	"github.com/google/uuid"
 	"github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 )
 
-// LLMHandler 兼容现有代码的LLM处理器
+// LLMHandler 兼容现有代码的LLM处理器，所有调用均通过 Provider 完成
+// 处理器本身不持有上下文，每次调用由调用方传入（通常来自 HTTP 请求），以便客户端断开或超时时取消上游调用
 type LLMHandler struct {
-	client *openai.Client
-	ctx    context.Context
+	provider       Provider
+	systemPrompt   string
+	systemTemplate string // 系统提示词模板名称，设置后每次调用时渲染
 }
 
-// NewLLMHandler 创建LLM处理器（兼容现有代码）
-func NewLLMHandler(ctx context.Context, apiKey, baseURL, model string) *LLMHandler {
-	config := openai.DefaultConfig(apiKey)
-	if baseURL != "" {
-		config.BaseURL = baseURL
-	}
-
+// NewLLMHandler 创建LLM处理器，systemPrompt 会作为系统消息附加到每次调用
+func NewLLMHandler(provider Provider, systemPrompt string) *LLMHandler {
 	return &LLMHandler{
-		client: openai.NewClientWithConfig(config),
-		ctx:    ctx,
+		provider:     provider,
+		systemPrompt: systemPrompt,
 	}
 }
 
-// QueryOptions 查询选项
-type QueryOptions struct {
-	Model       string
-	Temperature *float32
-	MaxTokens   *int
-	Stream      bool
+// Provider 返回底层提供商
+func (h *LLMHandler) Provider() Provider {
+	return h.provider
 }
 
-// QueryWithOptions 使用选项查询
-func (h *LLMHandler) QueryWithOptions(prompt string, options QueryOptions) (string, error) {
-	// 构建请求
-	request := openai.ChatCompletionRequest{
-		Model: options.Model,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-	}
+// WithSystemTemplate 使用提示词模板作为系统提示词，每次调用时渲染生效版本
+func (h *LLMHandler) WithSystemTemplate(name string) *LLMHandler {
+	h.systemTemplate = name
+	return h
+}
+
+// SystemPrompt 返回系统提示词
+func (h *LLMHandler) SystemPrompt() string {
+	prompt, _ := h.resolveSystemPrompt()
+	return prompt
+}
 
-	if options.Temperature != nil {
-		request.Temperature = *options.Temperature
+// resolveSystemPrompt 解析系统提示词，模板渲染失败时使用构造时传入的文本
+func (h *LLMHandler) resolveSystemPrompt() (string, PromptRef) {
+	if h.systemTemplate == "" {
+		return h.systemPrompt, PromptRef{}
 	}
-	if options.MaxTokens != nil {
-		request.MaxTokens = *options.MaxTokens
+	prompt, ref, err := RenderPrompt(h.systemTemplate, nil)
+	if err != nil {
+		logger.Warn("渲染系统提示词失败", zap.String("name", h.systemTemplate), zap.Error(err))
+		return h.systemPrompt, PromptRef{}
 	}
+	return prompt, ref
+}
 
-	// 调用 OpenAI API
-	resp, err := h.client.CreateChatCompletion(h.ctx, request)
-	if err != nil {
-		return "", err
+// QueryOptions 查询选项
+type QueryOptions struct {
+	Model         string
+	Task          string // 调用任务标识，为空时使用 Prompt.Name
+	Temperature   *float32
+	MaxTokens     *int
+	Stream        bool
+	SystemContext []string  // 本次调用附加的系统上下文（风格指南、世界观等），与用户指令分开发送
+	Prompt        PromptRef // 生成用户指令所用的模板版本
+
+	ResponseSchema *JSONSchema // 结构化输出的 Schema，提供商支持时开启 JSON 模式
+	MaxRepairs     int         // 结构化输出校验失败时的修复次数，0 使用默认值，负数表示不修复
+}
+
+// task 返回调用任务标识
+func (o QueryOptions) task() string {
+	if o.Task != "" {
+		return o.Task
 	}
+	return o.Prompt.Name
+}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from LLM")
+// BuildMessages 组合消息：系统提示词、附加系统上下文、用户指令
+func (h *LLMHandler) BuildMessages(prompt string, options QueryOptions) []Message {
+	messages := make([]Message, 0, len(options.SystemContext)+2)
+	systemPrompt, systemRef := h.resolveSystemPrompt()
+	if systemPrompt != "" {
+		messages = append(messages, Message{Role: "system", Content: systemPrompt})
+	}
+	if systemRef.Name != "" || options.Prompt.Name != "" {
+		logger.Debug("使用提示词模板",
+			zap.String("system", systemRef.String()),
+			zap.String("prompt", options.Prompt.String()))
+	}
+	for _, extra := range options.SystemContext {
+		if strings.TrimSpace(extra) == "" {
+			continue
+		}
+		messages = append(messages, Message{Role: "system", Content: extra})
 	}
+	messages = append(messages, Message{Role: "user", Content: prompt})
+	return messages
+}
 
-	return resp.Choices[0].Message.Content, nil
+// QueryWithOptions 使用选项查询
+func (h *LLMHandler) QueryWithOptions(ctx context.Context, prompt string, options QueryOptions) (string, error) {
+	return h.queryMessages(ctx, h.BuildMessages(prompt, options), options)
 }
 
 // QueryStream 流式查询
-func (h *LLMHandler) QueryStream(prompt string, options QueryOptions, callback func(segment string, isComplete bool) error) (string, error) {
-	// 构建请求
-	request := openai.ChatCompletionRequest{
-		Model: options.Model,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-		Stream: true,
-	}
+func (h *LLMHandler) QueryStream(ctx context.Context, prompt string, options QueryOptions, callback func(segment string, isComplete bool) error) (string, error) {
+	return h.streamMessages(ctx, h.BuildMessages(prompt, options), options, callback)
+}
 
-	if options.Temperature != nil {
-		request.Temperature = *options.Temperature
+// chatRequest 构建提供商请求
+func (h *LLMHandler) chatRequest(messages []Message, options QueryOptions) ChatRequest {
+	req := ChatRequest{
+		Model:       options.Model,
+		Task:        options.task(),
+		PromptRef:   options.Prompt,
+		Messages:    messages,
+		Temperature: options.Temperature,
+		MaxTokens:   options.MaxTokens,
 	}
-	if options.MaxTokens != nil {
-		request.MaxTokens = *options.MaxTokens
+	if options.ResponseSchema != nil && supportsJSONMode(h.provider) {
+		req.ResponseSchema = options.ResponseSchema
 	}
+	return req
+}
 
-	// 调用流式API
-	stream, err := h.client.CreateChatCompletionStream(h.ctx, request)
+// queryMessages 发送已组合好的消息（非流式）
+func (h *LLMHandler) queryMessages(ctx context.Context, messages []Message, options QueryOptions) (string, error) {
+	resp, err := h.provider.Chat(ctx, h.chatRequest(messages, options))
 	if err != nil {
 		return "", err
 	}
-	defer stream.Close()
-
-	var fullResponse string
-	for {
-		response, err := stream.Recv()
-		if err != nil {
-			if err.Error() == "EOF" {
-				// 调用完成回调
-				if callback != nil {
-					callback("", true)
-				}
-				break
-			}
-			return "", err
-		}
 
-		if len(response.Choices) > 0 {
-			content := response.Choices[0].Delta.Content
-			if content != "" {
-				fullResponse += content
-				// 调用进度回调
-				if callback != nil {
-					if err := callback(content, false); err != nil {
-						return fullResponse, err
-					}
-				}
-			}
+	return resp.Content, nil
+}
+
+// streamMessages 发送已组合好的消息（流式）
+func (h *LLMHandler) streamMessages(ctx context.Context, messages []Message, options QueryOptions, callback func(segment string, isComplete bool) error) (string, error) {
+	resp, err := h.provider.ChatStream(ctx, h.chatRequest(messages, options), callback)
+	if err != nil {
+		if resp != nil {
+			return resp.Content, err
 		}
+		return "", err
 	}
 
-	return fullResponse, nil
+	return resp.Content, nil
+}
+
+// ContextSection 构建带标题的系统上下文段落，内容为空时返回空字符串
+func ContextSection(title, content string, notes ...string) string {
+	if strings.TrimSpace(content) == "" {
+		return ""
+	}
+	section := fmt.Sprintf("【%s】\n%s\n", title, content)
+	for _, note := range notes {
+		section += "\n" + note + "\n"
+	}
+	return section
 }
 
 // Float32Ptr 返回float32指针
@@ -143,8 +174,11 @@ func IntPtr(i int) *int {
 
 // Message 通用消息结构
 type Message struct {
-	Role    string `json:"role"`    // user, assistant, system
+	Role    string `json:"role"`    // user, assistant, system, tool
 	Content string `json:"content"` // 消息内容
+
+	ToolCalls  []openai.ToolCall `json:"toolCalls,omitempty"`  // 助手请求调用的工具
+	ToolCallID string            `json:"toolCallId,omitempty"` // 工具结果对应的调用 ID（role 为 tool 时）
 }
 
 // GetModel 获取模型名称
@@ -154,37 +188,23 @@ func GetModel() string {
 }
 
 // Chat 通用聊天方法（非流式）
-func (g *CharacterGenerator) Chat(messages []Message, temperature float32, maxTokens int) (string, error) {
-	// 构建 OpenAI 消息格式
-	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		openaiMessages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
-
-	// 构建请求
-	request := openai.ChatCompletionRequest{
-		Model:       g.model,
-		Messages:    openaiMessages,
-		Temperature: temperature,
-	}
-	if maxTokens > 0 {
-		request.MaxTokens = maxTokens
-	}
-
-	// 调用 OpenAI API
-	resp, err := g.handler.client.CreateChatCompletion(g.handler.ctx, request)
+func (g *CharacterGenerator) Chat(ctx context.Context, messages []Message, temperature float32, maxTokens int) (string, error) {
+	resp, err := g.ChatCompletion(ctx, messages, temperature, maxTokens)
 	if err != nil {
 		return "", err
 	}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from LLM")
-	}
+	return resp.Content, nil
+}
+
+// ChatCompletion 通用聊天方法（非流式），返回包含用量和缓存标记的完整响应
+func (g *CharacterGenerator) ChatCompletion(ctx context.Context, messages []Message, temperature float32, maxTokens int) (*ChatResponse, error) {
+	return g.handler.provider.Chat(ctx, g.chatRequest(messages, temperature, maxTokens))
+}
 
-	return resp.Choices[0].Message.Content, nil
+// SupportsTools 当前提供商是否支持工具调用
+func (g *CharacterGenerator) SupportsTools() bool {
+	return SupportsTools(g.handler.provider)
 }
 
 // GetModel 获取当前使用的模型名称
@@ -193,79 +213,36 @@ func (g *CharacterGenerator) GetModel() string {
 }
 
 // ChatStream 通用聊天方法（流式）
-func (g *CharacterGenerator) ChatStream(messages []Message, temperature float32, maxTokens int, callback func(segment string, isComplete bool) error) (string, error) {
-	startTime := time.Now()
-
-	// 构建 OpenAI 消息格式
-	openaiMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		openaiMessages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
+func (g *CharacterGenerator) ChatStream(ctx context.Context, messages []Message, temperature float32, maxTokens int, callback func(segment string, isComplete bool) error) (string, error) {
+	resp, err := g.ChatCompletionStream(ctx, messages, temperature, maxTokens, callback)
+	if err != nil {
+		if resp != nil {
+			return resp.Content, err
 		}
+		return "", err
 	}
 
-	// 构建请求
-	request := openai.ChatCompletionRequest{
-		Model:       g.model,
-		Messages:    openaiMessages,
-		Stream:      true,
-		Temperature: temperature,
-	}
-	if maxTokens > 0 {
-		request.MaxTokens = maxTokens
-	}
-
-	request.StreamOptions = &openai.StreamOptions{
-		IncludeUsage: true,
-	}
-
-	streamID := fmt.Sprintf("stream-%s", uuid.New().String())
-	logger.Info("Starting chat stream", zap.String("streamID", streamID))
+	return resp.Content, nil
+}
 
-	// 创建流
-	stream, err := g.handler.client.CreateChatCompletionStream(g.handler.ctx, request)
-	if err != nil {
-		logger.Error("Failed to create chat stream", zap.Error(err))
-		return "", err
-	}
-	defer stream.Close()
-
-	var fullResponse string
-	var totalTokens int
-
-	// 读取流
-	for {
-		response, err := stream.Recv()
-		if err != nil {
-			logger.Info("Chat stream completed",
-				zap.String("streamID", streamID),
-				zap.Duration("duration", time.Since(startTime)),
-				zap.Int("totalTokens", totalTokens))
-
-			// 调用完成回调
-			if callback != nil {
-				callback("", true)
-			}
-			return fullResponse, nil
-		}
+// ChatCompletionStream 通用聊天方法（流式），返回包含用量和缓存标记的完整响应
+func (g *CharacterGenerator) ChatCompletionStream(ctx context.Context, messages []Message, temperature float32, maxTokens int, callback func(segment string, isComplete bool) error) (*ChatResponse, error) {
+	return g.handler.provider.ChatStream(ctx, g.chatRequest(messages, temperature, maxTokens), callback)
+}
 
-		if len(response.Choices) > 0 {
-			content := response.Choices[0].Delta.Content
-			if content != "" {
-				fullResponse += content
-				if callback != nil {
-					if err := callback(content, false); err != nil {
-						logger.Error("Callback error", zap.Error(err))
-						return fullResponse, err
-					}
-				}
-			}
-		}
+// ChatCompletionWithTools 带工具调用的聊天，callback 为 nil 时使用非流式调用
+// 返回最终回复（用量为各轮之和）和工具调用过程中新增的消息
+func (g *CharacterGenerator) ChatCompletionWithTools(ctx context.Context, messages []Message, temperature float32, maxTokens int, tools *FunctionToolManager, callback StreamCallback) (*ChatResponse, []Message, error) {
+	return tools.Run(ctx, g.handler.provider, g.chatRequest(messages, temperature, maxTokens), callback)
+}
 
-		// 记录 token 使用情况
-		if response.Usage != nil {
-			totalTokens = response.Usage.TotalTokens
-		}
+// chatRequest 构建通用聊天请求
+func (g *CharacterGenerator) chatRequest(messages []Message, temperature float32, maxTokens int) ChatRequest {
+	return ChatRequest{
+		Model:       g.model,
+		Task:        TaskChat,
+		Messages:    messages,
+		Temperature: Float32Ptr(temperature),
+		MaxTokens:   IntPtr(maxTokens),
 	}
 }
@@ -0,0 +1,53 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLLMHandler_BuildMessages(t *testing.T) {
+	h := NewLLMHandler(&fakeProvider{}, "系统提示")
+
+	messages := h.BuildMessages("用户指令", QueryOptions{
+		SystemContext: []string{ContextSection("世界观设定", "修仙世界"), "", ContextSection("写作风格", "")},
+	})
+
+	if len(messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d: %+v", len(messages), messages)
+	}
+	if messages[0].Role != "system" || messages[0].Content != "系统提示" {
+		t.Errorf("unexpected system prompt message: %+v", messages[0])
+	}
+	if messages[1].Role != "system" || !strings.Contains(messages[1].Content, "【世界观设定】\n修仙世界") {
+		t.Errorf("unexpected system context message: %+v", messages[1])
+	}
+	if messages[2].Role != "user" || messages[2].Content != "用户指令" {
+		t.Errorf("unexpected user message: %+v", messages[2])
+	}
+}
+
+func TestChapterGenerator_SendsSystemPrompt(t *testing.T) {
+	fake := &fakeProvider{reply: `{"title":"第一章","content":"正文","summary":"摘要","keyEvents":[],"nextChapterHint":"提示"}`}
+	g := NewChapterGenerator(fake, "fake-model")
+
+	if _, err := g.Generate(context.Background(), ChapterGenerateRequest{Title: "第一章", StyleGuide: "简洁明快"}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	messages := fake.requests[0].Messages
+	if messages[0].Role != "system" || !strings.Contains(messages[0].Content, "网络小说作家") {
+		t.Errorf("system prompt not sent: %+v", messages[0])
+	}
+	var hasFormat, hasStyle bool
+	for _, m := range messages[1 : len(messages)-1] {
+		hasFormat = hasFormat || strings.Contains(m.Content, `"nextChapterHint"`)
+		hasStyle = hasStyle || strings.Contains(m.Content, "简洁明快")
+	}
+	if !hasFormat || !hasStyle {
+		t.Errorf("expected response format and style guide in system context: %+v", messages)
+	}
+	if last := messages[len(messages)-1]; last.Role != "user" || strings.Contains(last.Content, "简洁明快") {
+		t.Errorf("style guide should not be mixed into user instruction: %+v", last)
+	}
+}
@@ -0,0 +1,299 @@
+package llm
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// 上下文预算默认值
+const (
+	DefaultContextWindow = 8192 // 未知模型的上下文窗口
+	DefaultReplyReserve  = 2048 // 为模型回复预留的 token
+	minContextBudget     = 256  // 上下文预算下限，保证必选内容至少部分可用
+	messageTokenOverhead = 4    // 每条消息的格式开销
+)
+
+// 上下文条目的纳入方式
+const (
+	ContextModeFull      = "full"      // 完整纳入
+	ContextModeFallback  = "fallback"  // 以降级内容（如摘要）纳入
+	ContextModeTruncated = "truncated" // 截断后纳入（仅必选条目）
+)
+
+// truncatedMark 截断内容的结尾标记
+const truncatedMark = "…（内容过长，已截断）"
+
+// TokenCounter 估算文本的 token 数
+type TokenCounter func(text string) int
+
+// modelProfile 模型的上下文窗口和分词估算参数
+type modelProfile struct {
+	prefix        string  // 模型名称前缀（小写）
+	window        int     // 上下文窗口
+	tokensPerCJK  float64 // 每个中日韩字符的 token 数
+	charsPerToken float64 // 其余字符每个 token 对应的字符数
+}
+
+// modelProfiles 按前缀匹配，越具体的前缀越靠前
+var modelProfiles = []modelProfile{
+	{"gpt-4o", 128000, 0.8, 4},
+	{"gpt-4.1", 1000000, 0.8, 4},
+	{"o1", 128000, 0.8, 4},
+	{"o3", 200000, 0.8, 4},
+	{"gpt-4-turbo", 128000, 1.0, 4},
+	{"gpt-4-32k", 32768, 1.0, 4},
+	{"gpt-4", 8192, 1.0, 4},
+	{"gpt-3.5-turbo", 16385, 1.0, 4},
+	{"deepseek", 64000, 0.6, 3.5},
+	{"qwen", 32768, 0.7, 3.5},
+	{"glm", 128000, 0.7, 3.5},
+	{"moonshot-v1-128k", 128000, 0.7, 3.5},
+	{"moonshot-v1-32k", 32768, 0.7, 3.5},
+	{"moonshot", 8192, 0.7, 3.5},
+	{"llama3", 8192, 1.2, 4},
+	{"llama2", 4096, 1.5, 3.5},
+	{"mistral", 32768, 1.3, 3.5},
+}
+
+// defaultProfile 未知模型的估算参数（偏保守）
+var defaultProfile = modelProfile{window: DefaultContextWindow, tokensPerCJK: 1.0, charsPerToken: 3.5}
+
+// profileFor 查找模型的估算参数，Ollama 模型名中的标签（如 qwen2:7b）不影响匹配
+func profileFor(model string) modelProfile {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, p := range modelProfiles {
+		if strings.HasPrefix(name, p.prefix) {
+			return p
+		}
+	}
+	return defaultProfile
+}
+
+// ContextWindow 返回模型的上下文窗口大小（token）
+func ContextWindow(model string) int {
+	return profileFor(model).window
+}
+
+// TokenCounterFor 返回模型的 token 估算函数
+// 不依赖具体分词器，按中日韩字符和其余字符分别估算，结果略偏保守
+func TokenCounterFor(model string) TokenCounter {
+	p := profileFor(model)
+	return func(text string) int {
+		var cjk, other int
+		for _, r := range text {
+			switch {
+			case isCJK(r):
+				cjk++
+			case !unicode.IsSpace(r):
+				other++
+			}
+		}
+		tokens := float64(cjk)*p.tokensPerCJK + float64(other)/p.charsPerToken
+		if tokens == 0 {
+			return 0
+		}
+		return int(tokens) + 1
+	}
+}
+
+// isCJK 判断是否为中日韩字符或全角标点
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) ||
+		(r >= 0x3000 && r <= 0x303F) ||
+		(r >= 0xFF00 && r <= 0xFFEF)
+}
+
+// CountMessageTokens 估算消息列表的 token 数（含每条消息的格式开销）
+func CountMessageTokens(count TokenCounter, messages []Message) int {
+	total := 0
+	for _, m := range messages {
+		total += count(m.Content) + messageTokenOverhead
+	}
+	return total
+}
+
+// ContextItem 待纳入上下文的条目
+type ContextItem struct {
+	Key      string // 条目标识，如 chapter:12
+	Section  string // 所属分区，首个纳入的条目前输出“# 分区”标题；为空时不输出标题
+	Priority int    // 优先级层级，数值越小越先分配预算；同层按添加顺序分配
+	Order    int    // 在最终上下文中的排列位置
+	Text     string // 完整内容
+	Fallback string // 完整内容放不下时使用的降级内容（如章节摘要），可为空
+	Required bool   // 必选条目：放不下时截断而不是丢弃
+}
+
+// ContextBudgetConfig 上下文预算配置
+type ContextBudgetConfig struct {
+	Model        string    // 模型名称，决定上下文窗口和 token 估算方式
+	MaxTokens    int       // 上下文 token 上限，<=0 时按模型窗口计算
+	ReplyReserve int       // 为回复预留的 token，<=0 时使用 DefaultReplyReserve
+	History      []Message // 同一请求中的对话消息，占用的 token 从预算中扣除
+}
+
+// ContextItemReport 单个条目的预算分配结果
+type ContextItemReport struct {
+	Key        string `json:"key"`
+	Section    string `json:"section,omitempty"`
+	Priority   int    `json:"priority"`
+	Mode       string `json:"mode,omitempty"` // full / fallback / truncated，丢弃的条目为空
+	Tokens     int    `json:"tokens"`         // 实际占用的 token
+	FullTokens int    `json:"fullTokens"`     // 完整内容的 token
+}
+
+// ContextReport 上下文预算报告
+type ContextReport struct {
+	Model         string              `json:"model"`
+	ContextWindow int                 `json:"contextWindow"`
+	ReplyReserve  int                 `json:"replyReserve"`
+	HistoryTokens int                 `json:"historyTokens"`
+	Budget        int                 `json:"budget"`     // 上下文可用 token
+	UsedTokens    int                 `json:"usedTokens"` // 上下文实际占用 token
+	Included      []ContextItemReport `json:"included"`
+	Dropped       []ContextItemReport `json:"dropped"`
+}
+
+// Degraded 是否有条目被降级、截断或丢弃
+func (r *ContextReport) Degraded() bool {
+	if len(r.Dropped) > 0 {
+		return true
+	}
+	for _, item := range r.Included {
+		if item.Mode != ContextModeFull {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildContext 按优先级在 token 预算内组装上下文
+// 每个条目依次尝试完整内容、降级内容；必选条目仍放不下时截断，其余丢弃。纳入的条目按 Order 排列输出
+func BuildContext(cfg ContextBudgetConfig, items []ContextItem) (string, *ContextReport) {
+	count := TokenCounterFor(cfg.Model)
+	report := &ContextReport{
+		Model:         cfg.Model,
+		ContextWindow: ContextWindow(cfg.Model),
+		ReplyReserve:  cfg.ReplyReserve,
+		HistoryTokens: CountMessageTokens(count, cfg.History),
+		Included:      []ContextItemReport{},
+		Dropped:       []ContextItemReport{},
+	}
+	if report.ReplyReserve <= 0 {
+		report.ReplyReserve = DefaultReplyReserve
+	}
+
+	budget := report.ContextWindow - report.ReplyReserve - report.HistoryTokens - messageTokenOverhead
+	if cfg.MaxTokens > 0 && cfg.MaxTokens < budget {
+		budget = cfg.MaxTokens
+	}
+	if budget < minContextBudget {
+		budget = minContextBudget
+	}
+	report.Budget = budget
+
+	ranked := make([]int, len(items))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return items[ranked[a]].Priority < items[ranked[b]].Priority
+	})
+
+	// 必选条目的完整内容预先占位，避免被低优先级条目挤占后只能截断
+	reserved := 0
+	for _, item := range items {
+		if item.Required {
+			reserved += count(item.Text)
+		}
+	}
+
+	texts := make([]string, len(items))
+	sections := map[string]bool{}
+	used := 0
+	for _, idx := range ranked {
+		item := items[idx]
+		full := count(item.Text)
+		entry := ContextItemReport{Key: item.Key, Section: item.Section, Priority: item.Priority, FullTokens: full}
+
+		header := 0
+		if item.Section != "" && !sections[item.Section] {
+			header = count("# " + item.Section)
+		}
+		if item.Required {
+			reserved -= full
+		}
+		available := budget - used - header - reserved
+
+		switch {
+		case full <= available:
+			texts[idx], entry.Mode, entry.Tokens = item.Text, ContextModeFull, full
+		case item.Fallback != "" && count(item.Fallback) <= available:
+			texts[idx], entry.Mode, entry.Tokens = item.Fallback, ContextModeFallback, count(item.Fallback)
+		case item.Required:
+			texts[idx] = truncateToTokens(count, item.Text, available)
+			entry.Mode, entry.Tokens = ContextModeTruncated, count(texts[idx])
+		}
+		if texts[idx] == "" {
+			report.Dropped = append(report.Dropped, entry)
+			continue
+		}
+
+		if item.Section != "" {
+			sections[item.Section] = true
+		}
+		used += entry.Tokens + header
+		report.Included = append(report.Included, entry)
+	}
+	report.UsedTokens = used
+
+	// 按 Order 输出，分区标题放在该分区第一个条目之前
+	order := make([]int, 0, len(items))
+	for i := range items {
+		if texts[i] != "" {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return items[order[a]].Order < items[order[b]].Order
+	})
+
+	var parts []string
+	written := map[string]bool{}
+	for _, idx := range order {
+		if section := items[idx].Section; section != "" && !written[section] {
+			parts = append(parts, "\n# "+section)
+			written[section] = true
+		}
+		parts = append(parts, texts[idx])
+	}
+	return strings.Join(parts, "\n"), report
+}
+
+// truncateToTokens 截断文本使其不超过指定 token 数
+func truncateToTokens(count TokenCounter, text string, limit int) string {
+	limit -= count(truncatedMark)
+	if limit <= 0 {
+		return ""
+	}
+	runes := []rune(text)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if count(string(runes[:mid])) <= limit {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	if lo == 0 {
+		return ""
+	}
+	return string(runes[:lo]) + truncatedMark
+}
@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenCounterFor(t *testing.T) {
+	count := TokenCounterFor("gpt-4")
+	if n := count(""); n != 0 {
+		t.Errorf("empty text should count 0, got %d", n)
+	}
+	cjk, ascii := count(strings.Repeat("字", 100)), count(strings.Repeat("word ", 25))
+	if cjk < 100 || ascii > 40 {
+		t.Errorf("unexpected estimates: cjk=%d ascii=%d", cjk, ascii)
+	}
+	if deepseek := TokenCounterFor("deepseek-chat")(strings.Repeat("字", 100)); deepseek >= cjk {
+		t.Errorf("deepseek tokenizer should be denser for CJK: %d >= %d", deepseek, cjk)
+	}
+
+	if ContextWindow("gpt-4o-mini") != 128000 || ContextWindow("qwen2:7b") != 32768 || ContextWindow("unknown") != DefaultContextWindow {
+		t.Error("unexpected context windows")
+	}
+}
+
+func TestBuildContext_PriorityAndFallback(t *testing.T) {
+	long := strings.Repeat("长", 3000)
+	items := []ContextItem{
+		{Key: "novel", Priority: 0, Order: 0, Text: "# 小说信息", Required: true},
+		{Key: "chapter:2", Section: "章节", Priority: 1, Order: 12, Text: "第二章" + long, Fallback: "第二章摘要"},
+		{Key: "character:1", Section: "角色", Priority: 2, Order: 5, Text: "- 主角"},
+		{Key: "chapter:1", Section: "章节", Priority: 3, Order: 11, Text: "第一章摘要"},
+		{Key: "extra", Priority: 4, Order: 20, Text: long},
+	}
+
+	text, report := BuildContext(ContextBudgetConfig{Model: "gpt-4", MaxTokens: 500}, items)
+
+	if report.Budget != 500 {
+		t.Errorf("expected budget 500, got %d", report.Budget)
+	}
+	if report.UsedTokens > report.Budget {
+		t.Errorf("used %d tokens over budget %d", report.UsedTokens, report.Budget)
+	}
+	modes := map[string]string{}
+	for _, item := range report.Included {
+		modes[item.Key] = item.Mode
+	}
+	if modes["novel"] != ContextModeFull || modes["chapter:2"] != ContextModeFallback || modes["chapter:1"] != ContextModeFull {
+		t.Errorf("unexpected modes: %v", modes)
+	}
+	if len(report.Dropped) != 1 || report.Dropped[0].Key != "extra" {
+		t.Errorf("expected only extra to be dropped: %+v", report.Dropped)
+	}
+	if !report.Degraded() {
+		t.Error("report should be marked degraded")
+	}
+
+	want := "# 小说信息\n\n# 角色\n- 主角\n\n# 章节\n第一章摘要\n第二章摘要"
+	if text != want {
+		t.Errorf("unexpected context:\n%s", text)
+	}
+}
+
+func TestBuildContext_ReservesReplyAndHistory(t *testing.T) {
+	history := []Message{{Role: "user", Content: strings.Repeat("问", 1000)}}
+
+	_, report := BuildContext(ContextBudgetConfig{Model: "gpt-4", ReplyReserve: 1000, History: history}, nil)
+	if report.HistoryTokens < 1000 {
+		t.Errorf("history tokens not counted: %d", report.HistoryTokens)
+	}
+	if report.Budget != 8192-1000-report.HistoryTokens-messageTokenOverhead {
+		t.Errorf("unexpected budget %d", report.Budget)
+	}
+}
+
+func TestBuildContext_TruncatesRequired(t *testing.T) {
+	items := []ContextItem{
+		{Key: "novel", Priority: 0, Text: strings.Repeat("设", 1000), Required: true},
+		{Key: "role", Priority: 0, Order: 1, Text: "你是助手", Required: true},
+	}
+
+	text, report := BuildContext(ContextBudgetConfig{Model: "gpt-4", MaxTokens: 300}, items)
+	if len(report.Included) != 2 || report.Included[0].Mode != ContextModeTruncated || report.Included[1].Mode != ContextModeFull {
+		t.Fatalf("unexpected report: %+v", report.Included)
+	}
+	if !strings.Contains(text, truncatedMark) || !strings.HasSuffix(text, "你是助手") {
+		t.Errorf("required items should be truncated but kept:\n%s", text)
+	}
+}
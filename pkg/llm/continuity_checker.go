@@ -0,0 +1,123 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// 连续性问题的严重程度
+const (
+	ContinuitySeverityLow    = "low"    // 细节出入，读者不易察觉
+	ContinuitySeverityMedium = "medium" // 明显矛盾，需要修改
+	ContinuitySeverityHigh   = "high"   // 严重违背设定或前文，影响主线
+)
+
+// 连续性问题的分类
+const (
+	ContinuityCategorySetting   = "setting"   // 违背世界观、力量体系、科技限制等设定
+	ContinuityCategoryCharacter = "character" // 与角色的性格、能力、状态等档案矛盾
+	ContinuityCategoryPlot      = "plot"      // 与前文情节矛盾
+	ContinuityCategoryTimeline  = "timeline"  // 时间顺序或时长不合理
+)
+
+// ContinuityCheckRequest 连续性检查请求，设定、角色和前文摘要由调用方按相关性筛选
+type ContinuityCheckRequest struct {
+	NovelTitle        string   // 小说标题
+	ChapterNumber     int      // 章节序号
+	ChapterTitle      string   // 章节标题
+	Content           string   // 章节正文
+	Settings          []string // 相关设定（已格式化为文本）
+	Characters        []string // 相关角色档案（已格式化为文本）
+	PreviousSummaries []string // 前文摘要，按章节先后排列
+	Dismissed         []string // 作者已确认不是问题的描述，不要再次报告
+}
+
+// ContinuityIssue 疑似的连续性问题
+type ContinuityIssue struct {
+	Category    string `json:"category"`                  // setting, character, plot, timeline
+	Severity    string `json:"severity"`                  // low, medium, high
+	Quote       string `json:"quote"`                     // 章节中引发问题的原文片段
+	Description string `json:"description"`               // 矛盾说明
+	Reference   string `json:"reference" llm:"optional"`  // 与之矛盾的设定、角色档案或前文
+	Suggestion  string `json:"suggestion" llm:"optional"` // 修改建议
+}
+
+// continuityResponse 连续性检查的模型输出
+type continuityResponse struct {
+	Issues []ContinuityIssue `json:"issues"`
+}
+
+// isContinuityValue 判断取值是否在允许范围内
+func isContinuityValue(value string, allowed ...string) bool {
+	for _, v := range allowed {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize 规范化分类和严重程度，未知分类归为情节，未知严重程度按中等处理
+func (i *ContinuityIssue) normalize() {
+	i.Category = strings.ToLower(strings.TrimSpace(i.Category))
+	if !isContinuityValue(i.Category, ContinuityCategorySetting, ContinuityCategoryCharacter,
+		ContinuityCategoryPlot, ContinuityCategoryTimeline) {
+		i.Category = ContinuityCategoryPlot
+	}
+	i.Severity = strings.ToLower(strings.TrimSpace(i.Severity))
+	if !isContinuityValue(i.Severity, ContinuitySeverityLow, ContinuitySeverityMedium, ContinuitySeverityHigh) {
+		i.Severity = ContinuitySeverityMedium
+	}
+	i.Quote = strings.TrimSpace(i.Quote)
+	i.Description = strings.TrimSpace(i.Description)
+}
+
+// ContinuityChecker 章节连续性检查器
+type ContinuityChecker struct {
+	handler *LLMHandler
+	model   string
+}
+
+// NewContinuityChecker 创建连续性检查器
+func NewContinuityChecker(provider Provider, model string) *ContinuityChecker {
+	handler := NewLLMHandler(provider, "").WithSystemTemplate(PromptContinuitySystem)
+
+	if model == "" {
+		model = "gpt-3.5-turbo"
+	}
+
+	return &ContinuityChecker{
+		handler: handler,
+		model:   model,
+	}
+}
+
+// Check 检查章节与设定、角色和前文是否矛盾，没有描述的问题会被丢弃
+func (c *ContinuityChecker) Check(ctx context.Context, req ContinuityCheckRequest) ([]ContinuityIssue, error) {
+	prompt, ref, err := RenderPrompt(PromptContinuityCheck, req)
+	if err != nil {
+		return nil, err
+	}
+
+	options := QueryOptions{
+		Model:       c.model,
+		Temperature: Float32Ptr(0.2), // 低温度以减少臆测
+		Prompt:      ref,
+	}
+
+	result, err := GenerateStructured[continuityResponse](ctx, c.handler, prompt, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check continuity: %w", err)
+	}
+
+	issues := make([]ContinuityIssue, 0, len(result.Issues))
+	for _, issue := range result.Issues {
+		issue.normalize()
+		if issue.Description == "" {
+			continue
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
@@ -0,0 +1,104 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// EntityCandidate 按名称在章节正文中匹配到的候选实体
+type EntityCandidate struct {
+	Type    string   // 实体类型说明，如"角色"、"地点"
+	Name    string   // 实体名称
+	Aliases []string // 别名
+	Detail  string   // 实体简介，帮助判断正文是否确实指代该实体
+}
+
+// EntityConfirmRequest 实体确认请求
+type EntityConfirmRequest struct {
+	ChapterTitle string            // 章节标题
+	Content      string            // 章节正文
+	Candidates   []EntityCandidate // 候选实体
+}
+
+// EntityConfirmPrompt entity.confirm 模板变量，候选实体已按序号格式化
+type EntityConfirmPrompt struct {
+	ChapterTitle string
+	Content      string
+	Candidates   []string
+}
+
+// entityConfirmResponse 实体确认的模型输出
+type entityConfirmResponse struct {
+	Confirmed []int `json:"confirmed"` // 确实出现的候选实体序号（从 1 开始）
+}
+
+// EntityExtractor 章节实体确认器：名称匹配可能误中同名词语，由模型结合上下文确认
+type EntityExtractor struct {
+	handler *LLMHandler
+	model   string
+}
+
+// NewEntityExtractor 创建章节实体确认器
+func NewEntityExtractor(provider Provider, model string) *EntityExtractor {
+	handler := NewLLMHandler(provider, "").WithSystemTemplate(PromptEntitySystem)
+
+	if model == "" {
+		model = "gpt-3.5-turbo"
+	}
+
+	return &EntityExtractor{
+		handler: handler,
+		model:   model,
+	}
+}
+
+// Confirm 确认候选实体是否确实在章节中出现，返回确认的候选下标（从 0 开始，已去重并忽略越界序号）
+func (e *EntityExtractor) Confirm(ctx context.Context, req EntityConfirmRequest) ([]int, error) {
+	if len(req.Candidates) == 0 {
+		return nil, nil
+	}
+
+	vars := EntityConfirmPrompt{
+		ChapterTitle: req.ChapterTitle,
+		Content:      req.Content,
+		Candidates:   make([]string, len(req.Candidates)),
+	}
+	for i, c := range req.Candidates {
+		line := fmt.Sprintf("%d. [%s] %s", i+1, c.Type, c.Name)
+		if len(c.Aliases) > 0 {
+			line += "（别名：" + strings.Join(c.Aliases, "、") + "）"
+		}
+		if detail := strings.TrimSpace(c.Detail); detail != "" {
+			line += "：" + detail
+		}
+		vars.Candidates[i] = line
+	}
+
+	prompt, ref, err := RenderPrompt(PromptEntityConfirm, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	options := QueryOptions{
+		Model:       e.model,
+		Temperature: Float32Ptr(0.1), // 判断题，尽量稳定
+		Prompt:      ref,
+	}
+
+	result, err := GenerateStructured[entityConfirmResponse](ctx, e.handler, prompt, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm entities: %w", err)
+	}
+
+	seen := make(map[int]bool, len(result.Confirmed))
+	indexes := make([]int, 0, len(result.Confirmed))
+	for _, n := range result.Confirmed {
+		if n < 1 || n > len(req.Candidates) || seen[n] {
+			continue
+		}
+		seen[n] = true
+		indexes = append(indexes, n-1)
+	}
+	return indexes, nil
+}
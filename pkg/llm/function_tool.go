@@ -1,8 +1,10 @@
 package llm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/LingByte/LingDialog/pkg/logger"
@@ -23,8 +25,9 @@ type FunctionToolDefinition struct {
 
 // FunctionToolManager manages function tools
 type FunctionToolManager struct {
-	tools map[string]*FunctionToolDefinition
-	mutex sync.RWMutex
+	tools     map[string]*FunctionToolDefinition
+	mutex     sync.RWMutex
+	maxRounds int // Run 的最大工具调用轮数，0 使用 DefaultMaxToolRounds
 }
 
 // NewFunctionToolManager creates a new function tool manager
@@ -61,8 +64,16 @@ func (m *FunctionToolManager) GetTools() []openai.Tool {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
+	names := make([]string, 0, len(m.tools))
+	for name := range m.tools {
+		names = append(names, name)
+	}
+	// 固定顺序，保证同一组工具每次生成的请求一致
+	sort.Strings(names)
+
 	tools := make([]openai.Tool, 0, len(m.tools))
-	for _, tool := range m.tools {
+	for _, name := range names {
+		tool := m.tools[name]
 		tools = append(tools, openai.Tool{
 			Type: openai.ToolTypeFunction,
 			Function: &openai.FunctionDefinition{
@@ -135,3 +146,87 @@ func (m *FunctionToolManager) ClearTools() {
 	m.tools = make(map[string]*FunctionToolDefinition)
 	logger.Info("Cleared all function tools")
 }
+
+// DefaultMaxToolRounds 工具调用循环的默认最大轮数，超过后不再提供工具，要求模型直接回复
+const DefaultMaxToolRounds = 5
+
+// ToolCallingProvider 支持工具调用的提供商
+type ToolCallingProvider interface {
+	SupportsTools() bool
+}
+
+// SupportsTools 判断提供商是否支持工具调用
+func SupportsTools(provider Provider) bool {
+	p, ok := provider.(ToolCallingProvider)
+	return ok && p.SupportsTools()
+}
+
+// SetMaxRounds 设置工具调用循环的最大轮数
+func (m *FunctionToolManager) SetMaxRounds(rounds int) *FunctionToolManager {
+	m.maxRounds = rounds
+	return m
+}
+
+// Run 执行工具调用循环：模型请求调用工具时执行工具，把调用和结果追加到消息后再次请求，直到模型给出最终回复
+// callback 不为 nil 时每轮都以流式调用，文本分片实时转发，流结束标记只在最终回复后发送一次
+// 返回最终回复（用量为各轮之和）和循环中新增的消息（带工具调用的助手消息和工具结果）；中途失败时返回已有的部分内容
+func (m *FunctionToolManager) Run(ctx context.Context, provider Provider, req ChatRequest, callback StreamCallback) (*ChatResponse, []Message, error) {
+	maxRounds := m.maxRounds
+	if maxRounds <= 0 {
+		maxRounds = DefaultMaxToolRounds
+	}
+
+	var transcript []Message
+	var usage Usage
+	for round := 1; ; round++ {
+		req.Tools = nil
+		if round <= maxRounds {
+			req.Tools = m.GetTools()
+		}
+
+		resp, err := m.chat(ctx, provider, req, callback)
+		if resp != nil {
+			usage.PromptTokens += resp.Usage.PromptTokens
+			usage.CompletionTokens += resp.Usage.CompletionTokens
+			usage.TotalTokens += resp.Usage.TotalTokens
+			resp.Usage = usage
+		}
+		// 未提供工具的轮次忽略模型返回的工具调用，保证循环结束
+		if err != nil || len(resp.ToolCalls) == 0 || req.Tools == nil {
+			if err == nil && callback != nil {
+				err = callback("", true)
+			}
+			return resp, transcript, err
+		}
+
+		assistant := Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls}
+		req.Messages = append(req.Messages, assistant)
+		transcript = append(transcript, assistant)
+		for _, call := range resp.ToolCalls {
+			result, err := m.HandleToolCall(call)
+			if err != nil {
+				// 工具失败不中断对话，把错误交给模型处理
+				result = "工具调用失败: " + err.Error()
+			}
+			message := Message{Role: "tool", Content: result, ToolCallID: call.ID}
+			req.Messages = append(req.Messages, message)
+			transcript = append(transcript, message)
+		}
+		if err := ctx.Err(); err != nil {
+			return resp, transcript, err
+		}
+	}
+}
+
+// chat 发送一轮请求，流式时屏蔽每轮的结束标记
+func (m *FunctionToolManager) chat(ctx context.Context, provider Provider, req ChatRequest, callback StreamCallback) (*ChatResponse, error) {
+	if callback == nil {
+		return provider.Chat(ctx, req)
+	}
+	return provider.ChatStream(ctx, req, func(segment string, isComplete bool) error {
+		if isComplete {
+			return nil
+		}
+		return callback(segment, false)
+	})
+}
@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestFunctionToolManager_Run(t *testing.T) {
+	mock := NewMockProvider("")
+	mock.Script(TaskChat,
+		MockResponse{ToolCalls: []openai.ToolCall{
+			{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup", Arguments: `{"key":"a"}`}},
+			{ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "broken"}},
+		}, Usage: &Usage{TotalTokens: 3}},
+		MockResponse{Content: "答案是 A", Usage: &Usage{TotalTokens: 5}})
+
+	tools := NewFunctionToolManager()
+	tools.RegisterTool("lookup", "查找", json.RawMessage(`{"type":"object"}`), func(arguments string) (string, error) {
+		return "A:" + arguments, nil
+	})
+	tools.RegisterTool("broken", "总是失败", json.RawMessage(`{"type":"object"}`), func(string) (string, error) {
+		return "", errors.New("boom")
+	})
+
+	var streamed string
+	completions := 0
+	resp, transcript, err := tools.Run(context.Background(), mock, ChatRequest{Task: TaskChat, Messages: []Message{{Role: "user", Content: "问题"}}},
+		func(segment string, isComplete bool) error {
+			if isComplete {
+				completions++
+			}
+			streamed += segment
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "答案是 A" || streamed != "答案是 A" || completions != 1 {
+		t.Errorf("unexpected final reply %q, streamed %q, completions %d", resp.Content, streamed, completions)
+	}
+	if len(transcript) != 3 || transcript[1].Content != `A:{"key":"a"}` || transcript[2].Content != "工具调用失败: boom" {
+		t.Fatalf("unexpected transcript: %+v", transcript)
+	}
+
+	requests := mock.Requests()
+	if len(requests) != 2 || len(requests[1].Messages) != 4 || requests[1].Messages[2].ToolCallID != "call_1" {
+		t.Fatalf("tool results should be sent back to the model: %+v", requests)
+	}
+	if resp.Usage.TotalTokens != 8 {
+		t.Errorf("usage should be summed across rounds, got %+v", resp.Usage)
+	}
+}
+
+func TestFunctionToolManager_RunMaxRounds(t *testing.T) {
+	mock := NewMockProvider("")
+	mock.Script(TaskChat, MockResponse{Content: "继续查", ToolCalls: []openai.ToolCall{
+		{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup"}},
+	}})
+
+	tools := NewFunctionToolManager().SetMaxRounds(2)
+	tools.RegisterTool("lookup", "查找", json.RawMessage(`{"type":"object"}`), func(string) (string, error) { return "无", nil })
+
+	// 超过轮数后不再提供工具，模型的回复直接作为最终结果
+	resp, transcript, err := tools.Run(context.Background(), mock, ChatRequest{Task: TaskChat, Messages: []Message{{Role: "user", Content: "问题"}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := mock.Requests()
+	if len(requests) != 3 || len(requests[1].Tools) != 1 || requests[2].Tools != nil {
+		t.Fatalf("the last round should be sent without tools: %d requests", len(requests))
+	}
+	if resp.Content != "继续查" || len(transcript) != 4 {
+		t.Errorf("unexpected result %q with %d transcript messages", resp.Content, len(transcript))
+	}
+}
+
+func TestToolCallAccumulator(t *testing.T) {
+	first, second := 0, 1
+	var acc toolCallAccumulator
+	acc.add([]openai.ToolCall{{Index: &first, ID: "call_1", Function: openai.FunctionCall{Name: "lookup", Arguments: `{"ke`}}})
+	acc.add([]openai.ToolCall{{Index: &second, ID: "call_2", Function: openai.FunctionCall{Name: "read"}}})
+	acc.add([]openai.ToolCall{{Index: &first, Function: openai.FunctionCall{Arguments: `y":"a"}`}}})
+
+	if len(acc.calls) != 2 || acc.calls[0].Function.Arguments != `{"key":"a"}` || acc.calls[1].ID != "call_2" {
+		t.Errorf("unexpected merged calls: %+v", acc.calls)
+	}
+}
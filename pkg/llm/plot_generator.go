@@ -2,7 +2,6 @@ package llm
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 )
 
@@ -28,6 +27,18 @@ type PlotGenerateResponse struct {
 	Impact      string `json:"impact"`      // 影响和后果
 }
 
+// plotResponseFormat 情节生成的 JSON 返回格式，仅附加到需要结构化输出的调用
+const plotResponseFormat = `请以 JSON 格式返回结果，包含以下字段：
+{
+  "title": "情节标题",
+  "content": "情节详细内容（300-500字）",
+  "summary": "情节摘要（100-150字）",
+  "conflict": "冲突点（100-150字）",
+  "development": "发展方向（100-150字）",
+  "characters": "涉及角色（80-100字）",
+  "impact": "影响和后果（100-150字）"
+}`
+
 // PlotGenerator 情节生成器
 type PlotGenerator struct {
 	handler *LLMHandler
@@ -35,7 +46,7 @@ type PlotGenerator struct {
 }
 
 // NewPlotGenerator 创建情节生成器
-func NewPlotGenerator(apiKey, baseURL, model string) *PlotGenerator {
+func NewPlotGenerator(provider Provider, model string) *PlotGenerator {
 	systemPrompt := `你是一个专业的小说情节设计师，擅长构建引人入胜的故事情节。
 
 你的任务是根据用户提供的信息，生成一个完整、详细的情节设定。
@@ -52,20 +63,9 @@ func NewPlotGenerator(apiKey, baseURL, model string) *PlotGenerator {
 - 逻辑合理，前后连贯
 - 有足够的戏剧张力
 - 符合小说的整体风格
-- 为后续发展留有空间
-
-请以 JSON 格式返回结果，包含以下字段：
-{
-  "title": "情节标题",
-  "content": "情节详细内容（300-500字）",
-  "summary": "情节摘要（100-150字）",
-  "conflict": "冲突点（100-150字）",
-  "development": "发展方向（100-150字）",
-  "characters": "涉及角色（80-100字）",
-  "impact": "影响和后果（100-150字）"
-}`
+- 为后续发展留有空间`
 
-	handler := NewLLMHandler(context.Background(), apiKey, baseURL, systemPrompt)
+	handler := NewLLMHandler(provider, systemPrompt)
 
 	if model == "" {
 		model = "gpt-3.5-turbo"
@@ -78,7 +78,7 @@ func NewPlotGenerator(apiKey, baseURL, model string) *PlotGenerator {
 }
 
 // Generate 生成情节
-func (g *PlotGenerator) Generate(req PlotGenerateRequest) (*PlotGenerateResponse, error) {
+func (g *PlotGenerator) Generate(ctx context.Context, req PlotGenerateRequest) (*PlotGenerateResponse, error) {
 	// 构建提示词
 	prompt := fmt.Sprintf("请为以下情节生成完整的设定：\n\n")
 	prompt += fmt.Sprintf("情节标题：%s\n", req.Title)
@@ -92,11 +92,6 @@ func (g *PlotGenerator) Generate(req PlotGenerateRequest) (*PlotGenerateResponse
 		prompt += fmt.Sprintf("\n请确保情节设定符合【%s】类型小说的特点和风格。\n", req.NovelGenre)
 	}
 
-	if req.WorldSetting != "" {
-		prompt += fmt.Sprintf("\n【重要】小说世界观和背景设定：\n%s\n", req.WorldSetting)
-		prompt += "\n请严格遵循上述世界观设定，确保情节的发展符合这个世界的规则。\n"
-	}
-
 	if req.PlotType != "" {
 		prompt += fmt.Sprintf("情节类型：%s\n", req.PlotType)
 	}
@@ -114,28 +109,24 @@ func (g *PlotGenerator) Generate(req PlotGenerateRequest) (*PlotGenerateResponse
 	// 调用 LLM
 	options := QueryOptions{
 		Model:       g.model,
+		Task:        TaskPlotGenerate,
 		Temperature: Float32Ptr(0.8),
+		SystemContext: []string{
+			plotResponseFormat,
+			ContextSection("小说世界观和背景设定", req.WorldSetting, "请严格遵循上述世界观设定，确保情节的发展符合这个世界的规则。"),
+		},
 	}
 
-	response, err := g.handler.QueryWithOptions(prompt, options)
+	result, err := GenerateStructured[PlotGenerateResponse](ctx, g.handler, prompt, options)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate plot: %w", err)
 	}
 
-	// 清理响应
-	cleanedResponse := CleanAIResponse(response)
-
-	// 解析响应
-	var result PlotGenerateResponse
-	if err := json.Unmarshal([]byte(cleanedResponse), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w (response: %s)", err, cleanedResponse)
-	}
-
-	return &result, nil
+	return result, nil
 }
 
 // GenerateStream 流式生成情节
-func (g *PlotGenerator) GenerateStream(req PlotGenerateRequest, callback func(segment string, isComplete bool) error) (*PlotGenerateResponse, error) {
+func (g *PlotGenerator) GenerateStream(ctx context.Context, req PlotGenerateRequest, callback func(segment string, isComplete bool) error) (*PlotGenerateResponse, error) {
 	// 构建提示词
 	prompt := fmt.Sprintf("请为以下情节生成完整的设定：\n\n")
 	prompt += fmt.Sprintf("情节标题：%s\n", req.Title)
@@ -149,11 +140,6 @@ func (g *PlotGenerator) GenerateStream(req PlotGenerateRequest, callback func(se
 		prompt += fmt.Sprintf("\n请确保情节设定符合【%s】类型小说的特点和风格。\n", req.NovelGenre)
 	}
 
-	if req.WorldSetting != "" {
-		prompt += fmt.Sprintf("\n【重要】小说世界观和背景设定：\n%s\n", req.WorldSetting)
-		prompt += "\n请严格遵循上述世界观设定，确保情节的发展符合这个世界的规则。\n"
-	}
-
 	if req.PlotType != "" {
 		prompt += fmt.Sprintf("情节类型：%s\n", req.PlotType)
 	}
@@ -171,29 +157,25 @@ func (g *PlotGenerator) GenerateStream(req PlotGenerateRequest, callback func(se
 	// 调用 LLM 流式接口
 	options := QueryOptions{
 		Model:       g.model,
+		Task:        TaskPlotGenerate,
 		Temperature: Float32Ptr(0.8),
 		Stream:      true,
+		SystemContext: []string{
+			plotResponseFormat,
+			ContextSection("小说世界观和背景设定", req.WorldSetting, "请严格遵循上述世界观设定，确保情节的发展符合这个世界的规则。"),
+		},
 	}
 
-	response, err := g.handler.QueryStream(prompt, options, callback)
+	result, err := GenerateStructuredStream[PlotGenerateResponse](ctx, g.handler, prompt, options, callback)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate plot: %w", err)
 	}
 
-	// 清理响应
-	cleanedResponse := CleanAIResponse(response)
-
-	// 解析响应
-	var result PlotGenerateResponse
-	if err := json.Unmarshal([]byte(cleanedResponse), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w (response: %s)", err, cleanedResponse)
-	}
-
-	return &result, nil
+	return result, nil
 }
 
 // EnhanceContent 增强情节内容
-func (g *PlotGenerator) EnhanceContent(title, currentContent string) (string, error) {
+func (g *PlotGenerator) EnhanceContent(ctx context.Context, title, currentContent string) (string, error) {
 	prompt := fmt.Sprintf(`请帮我优化和扩展以下情节的内容，使其更加精彩、引人入胜：
 
 情节标题：%s
@@ -209,10 +191,11 @@ func (g *PlotGenerator) EnhanceContent(title, currentContent string) (string, er
 
 	options := QueryOptions{
 		Model:       g.model,
+		Task:        TaskPlotEnhance,
 		Temperature: Float32Ptr(0.7),
 	}
 
-	response, err := g.handler.QueryWithOptions(prompt, options)
+	response, err := g.handler.QueryWithOptions(ctx, prompt, options)
 	if err != nil {
 		return "", fmt.Errorf("failed to enhance content: %w", err)
 	}
@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// DefaultPromptLocale 默认提示词语言区域
+const DefaultPromptLocale = "zh-CN"
+
+// PromptTemplate 提示词模板（text/template 语法）
+type PromptTemplate struct {
+	Name    string
+	Version int
+	Locale  string
+	Body    string
+}
+
+// PromptRef 记录某次输出所使用的模板版本，Version 为 0 表示内置默认模板
+type PromptRef struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	Locale  string `json:"locale"`
+}
+
+// String 返回形如 chapter.generate@v3 的版本标识
+func (r PromptRef) String() string {
+	if r.Name == "" {
+		return ""
+	}
+	if r.Version == 0 {
+		return r.Name + "@default"
+	}
+	return fmt.Sprintf("%s@v%d", r.Name, r.Version)
+}
+
+// PromptStore 提示词模板存储，返回 nil 表示没有生效的自定义版本
+type PromptStore interface {
+	ActivePrompt(name, locale string) (*PromptTemplate, error)
+}
+
+var (
+	promptStoreMu sync.RWMutex
+	promptStore   PromptStore
+)
+
+// SetPromptStore 设置全局提示词模板存储，传 nil 则只使用内置默认模板
+func SetPromptStore(store PromptStore) {
+	promptStoreMu.Lock()
+	defer promptStoreMu.Unlock()
+	promptStore = store
+}
+
+func getPromptStore() PromptStore {
+	promptStoreMu.RLock()
+	defer promptStoreMu.RUnlock()
+	return promptStore
+}
+
+// promptFuncs 模板可用的辅助函数
+var promptFuncs = template.FuncMap{
+	"add":  func(a, b int) int { return a + b },
+	"join": strings.Join,
+}
+
+// ParsePromptTemplate 解析模板内容，用于保存前校验
+func ParsePromptTemplate(name, body string) (*template.Template, error) {
+	return template.New(name).Funcs(promptFuncs).Option("missingkey=error").Parse(body)
+}
+
+// DefaultPrompt 返回内置默认模板
+func DefaultPrompt(name string) (string, bool) {
+	body, ok := defaultPrompts[name]
+	return body, ok
+}
+
+// DefaultPromptNames 返回所有内置模板名称（已排序）
+func DefaultPromptNames() []string {
+	names := make([]string, 0, len(defaultPrompts))
+	for name := range defaultPrompts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RenderPrompt 使用默认语言区域渲染提示词
+func RenderPrompt(name string, data any) (string, PromptRef, error) {
+	return RenderPromptLocale(name, DefaultPromptLocale, data)
+}
+
+// RenderPromptLocale 渲染提示词：优先使用存储中的生效版本，失败时回退到内置默认模板
+func RenderPromptLocale(name, locale string, data any) (string, PromptRef, error) {
+	if store := getPromptStore(); store != nil {
+		tpl, err := store.ActivePrompt(name, locale)
+		if err != nil {
+			logger.Warn("获取提示词模板失败，使用内置默认模板",
+				zap.String("name", name),
+				zap.String("locale", locale),
+				zap.Error(err))
+		} else if tpl != nil {
+			text, err := executePrompt(name, tpl.Body, data)
+			if err == nil {
+				return text, PromptRef{Name: name, Version: tpl.Version, Locale: tpl.Locale}, nil
+			}
+			logger.Warn("渲染提示词模板失败，使用内置默认模板",
+				zap.String("name", name),
+				zap.Int("version", tpl.Version),
+				zap.Error(err))
+		}
+	}
+
+	body, ok := defaultPrompts[name]
+	if !ok {
+		return "", PromptRef{}, fmt.Errorf("unknown prompt template: %s", name)
+	}
+	text, err := executePrompt(name, body, data)
+	if err != nil {
+		return "", PromptRef{}, fmt.Errorf("failed to render prompt %s: %w", name, err)
+	}
+	return text, PromptRef{Name: name, Locale: DefaultPromptLocale}, nil
+}
+
+// parsedPrompts 已解析的模板，按名称和模板内容缓存，模板内容不可修改，无需失效
+var parsedPrompts sync.Map
+
+// executePrompt 执行模板
+func executePrompt(name, body string, data any) (string, error) {
+	key := name + "\x00" + body
+	var tmpl *template.Template
+	if cached, ok := parsedPrompts.Load(key); ok {
+		tmpl = cached.(*template.Template)
+	} else {
+		parsed, err := ParsePromptTemplate(name, body)
+		if err != nil {
+			return "", err
+		}
+		parsedPrompts.Store(key, parsed)
+		tmpl = parsed
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
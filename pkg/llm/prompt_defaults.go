@@ -0,0 +1,868 @@
+package llm
+
+// 内置提示词模板名称
+const (
+	PromptChapterSystem      = "chapter.system"
+	PromptChapterGenerate    = "chapter.generate"
+	PromptChapterSummary     = "chapter.summary"
+	PromptChapterSuggestions = "chapter.suggestions"
+	PromptChapterOutline     = "chapter.outline"
+	PromptChapterRefine      = "chapter.refine"
+	PromptChapterContinue    = "chapter.continue"
+	PromptChapterExpand      = "chapter.expand"
+	PromptChapterPlan        = "chapter.plan"
+
+	PromptSummaryRollup = "summary.rollup"
+
+	PromptStorylineSystem      = "storyline.system"
+	PromptStorylineGenerate    = "storyline.generate"
+	PromptStorylineOptimize    = "storyline.optimize"
+	PromptStorylineExpandPart  = "storyline.expand_part"
+	PromptStorylineExpandNode  = "storyline.expand_node"
+	PromptStorylineConnections = "storyline.suggest_connections"
+
+	PromptSettingSystem   = "setting.system"
+	PromptSettingGenerate = "setting.generate"
+	PromptSettingEnhance  = "setting.enhance"
+
+	PromptStyleSystem  = "style.system"
+	PromptStyleAnalyze = "style.analyze"
+	PromptStyleCompare = "style.compare"
+	PromptStyleImprove = "style.improve"
+
+	PromptChatSystem = "chat.system"
+
+	PromptContinuitySystem = "continuity.system"
+	PromptContinuityCheck  = "continuity.check"
+
+	PromptEntitySystem  = "entity.system"
+	PromptEntityConfirm = "entity.confirm"
+
+	PromptStructuredRepair = "structured.repair"
+)
+
+// 以下为各模板的变量类型，未单独列出的模板直接使用对应的请求结构体：
+// chapter.generate / chapter.outline 使用 ChapterGenerateRequest，
+// chapter.suggestions 使用 ChapterSuggestionsRequest，chapter.expand 使用 ExpandContentRequest，
+// storyline.generate 使用 StorylineGenerateRequest，style.analyze 使用 StyleAnalysisRequest，
+// continuity.check 使用 ContinuityCheckRequest，entity.confirm 使用 EntityConfirmPrompt。
+// *.system 模板没有变量。
+
+// ChapterSummaryPrompt chapter.summary 模板变量
+type ChapterSummaryPrompt struct {
+	Title   string
+	Content string
+}
+
+// ChapterPlanPrompt chapter.plan 模板变量
+type ChapterPlanPrompt struct {
+	NovelTitle      string
+	NovelGenre      string
+	Storyline       string   // 故事线标题
+	NodeTitle       string   // 故事节点标题
+	NodeDescription string   // 故事节点描述
+	NextNode        string   // 下一个故事节点，用于为后续发展留出铺垫
+	Characters      []string // 节点涉及的角色
+	PreviousSummary string   // 前文摘要或此前已规划的章节
+	StartNumber     int      // 第一章的序号
+	Count           int      // 需要规划的章节数
+}
+
+// SummaryRollupPrompt summary.rollup 模板变量
+type SummaryRollupPrompt struct {
+	Scope     string   // 汇总范围，如"《剑来》第一卷「下山」"
+	Previous  string   // 此前的摘要，为空时从头汇总
+	Children  []string // 新增或需要汇总的下级摘要，按章节先后排列
+	MaxLength int      // 摘要字数上限
+}
+
+// ChapterRefinePrompt chapter.refine 模板变量
+type ChapterRefinePrompt struct {
+	Title           string
+	OriginalContent string
+	Feedback        string
+}
+
+// ChapterContinuePrompt chapter.continue 模板变量
+type ChapterContinuePrompt struct {
+	Title           string
+	ExistingContent string
+	ContinueHint    string
+}
+
+// StorylineOptimizePrompt storyline.optimize 模板变量
+type StorylineOptimizePrompt struct {
+	CurrentDescription string
+	Feedback           string
+}
+
+// StorylineExpandPartPrompt storyline.expand_part 模板变量
+type StorylineExpandPartPrompt struct {
+	FullDescription string
+	SelectedText    string
+	ExpandHint      string
+}
+
+// StorylineExpandNodePrompt storyline.expand_node 模板变量
+type StorylineExpandNodePrompt struct {
+	NodeTitle       string
+	NodeDescription string
+	Context         string
+}
+
+// StorylineConnectionsPrompt storyline.suggest_connections 模板变量
+type StorylineConnectionsPrompt struct {
+	Nodes []string
+}
+
+// SettingGeneratePrompt setting.generate 模板变量
+type SettingGeneratePrompt struct {
+	NovelTitle   string
+	NovelGenre   string
+	Category     string // world/power/tech/concept/rule/org/item/other
+	CategoryName string
+	Title        string
+	Requirements string
+}
+
+// SettingEnhancePrompt setting.enhance 模板变量
+type SettingEnhancePrompt struct {
+	Title          string
+	CurrentContent string
+	EnhanceHint    string
+}
+
+// StyleComparePrompt style.compare 模板变量
+type StyleComparePrompt struct {
+	StyleA *StyleAnalysisResponse
+	StyleB *StyleAnalysisResponse
+}
+
+// StyleImprovePrompt style.improve 模板变量
+type StyleImprovePrompt struct {
+	StyleGuide  string
+	TargetGenre string
+}
+
+// ChatSystemPrompt chat.system 模板变量
+type ChatSystemPrompt struct {
+	NovelTitle string
+	NovelGenre string
+}
+
+// StructuredRepairPrompt structured.repair 模板变量
+type StructuredRepairPrompt struct {
+	Problems []string // 校验问题
+	Schema   string   // 期望的 JSON Schema
+}
+
+// defaultPrompts 内置默认模板，数据库中没有生效版本时使用
+var defaultPrompts = map[string]string{
+	PromptChapterSystem: `你是一个专业的网络小说作家，擅长创作引人入胜的章节内容。
+
+你的任务是根据提供的信息，生成一个完整的章节。
+
+重要原则：
+1. **字数控制**：严格按照目标字数要求，不要超出太多（误差控制在200字以内）
+2. **渐进式叙事**：不要一次性讲完所有内容，要为后续章节留有发展空间
+3. **伏笔设置**：适当埋下伏笔，增加悬念
+4. **节奏控制**：注意情节推进的节奏，不要过快或过慢
+5. **角色塑造**：通过对话和行动展现角色性格，而非直接描述
+6. **细节描写**：适当的环境和动作描写，增强代入感
+7. **避免完结**：除非明确要求，否则不要在本章完结某个情节线
+
+写作要求：
+- 使用第三人称叙述
+- 对话要符合角色性格
+- 场景转换要自然
+- 保持悬念和吸引力
+- 严格控制字数在目标范围内`,
+
+	PromptChapterGenerate: `请生成以下章节的内容：
+
+【基本信息】
+小说：{{.NovelTitle}}
+章节：第 {{.ChapterNumber}} 章 - {{.Title}}
+{{if .NovelGenre}}类型：{{.NovelGenre}}
+{{end}}目标字数：严格控制在 {{.TargetWordCount}} 字左右（误差不超过200字）
+{{if .PreviousSummary}}
+【前文回顾】
+{{.PreviousSummary}}
+
+⚠️ 重要：请确保本章内容与前文情节连贯，角色行为符合之前的发展轨迹。
+{{end}}{{if .Outline}}
+【本章大纲】
+{{.Outline}}
+{{end}}{{if .Characters}}
+【参与角色】
+{{range $i, $c := .Characters}}{{add $i 1}}. {{$c}}
+{{end}}{{end}}{{if .PlotPoints}}
+【涉及情节】
+{{range $i, $p := .PlotPoints}}{{add $i 1}}. {{$p}}
+{{end}}{{if .AvoidComplete}}
+⚠️ 注意：本章只需推进情节，不要完结任何情节线，要为后续发展留有空间。
+{{end}}{{end}}{{if .OpenThreads}}
+【待延续的伏笔】
+以下伏笔尚未回收，请在情节中适当呼应，不要遗忘；时机成熟时可以回收：
+{{range $i, $t := .OpenThreads}}{{add $i 1}}. {{$t}}
+{{end}}{{end}}{{if .FocusPoints}}
+【本章重点】
+{{range $i, $p := .FocusPoints}}{{add $i 1}}. {{$p}}
+{{end}}{{end}}{{if .WritingStyle}}
+【写作风格】
+{{.WritingStyle}}
+{{end}}
+
+【重要要求】
+1. 严格控制字数：内容必须控制在目标字数范围内，不要超出太多
+2. 情节完整：确保本章有完整的起承转合
+3. 节奏适中：不要过快推进情节，要有适当的描写和对话
+4. 保持悬念：章节结尾要有引人入胜的悬念或转折
+
+请生成完整的章节内容，以纯 JSON 格式返回，不要包含任何 markdown 标记或其他文本。`,
+
+	PromptChapterSummary: `请为以下章节生成一个简洁的摘要，用于后续章节的上下文参考。
+
+章节标题：{{.Title}}
+章节内容：
+{{.Content}}
+
+摘要要求：
+1. 200字以内
+2. 包含关键情节发展
+3. 包含重要角色动作
+4. 包含伏笔和悬念
+5. 不要包含过多细节描写
+
+只返回摘要文本，不要包含其他内容。`,
+
+	PromptSummaryRollup: `{{if .Previous}}以下是{{.Scope}}此前的摘要，以及之后新增或修改的章节摘要，请在此前摘要的基础上更新：
+
+【此前的摘要】
+{{.Previous}}
+{{else}}请根据以下章节摘要，为{{.Scope}}撰写摘要：
+{{end}}
+【章节摘要】
+{{range .Children}}{{.}}
+{{end}}
+摘要要求：
+1. {{.MaxLength}}字以内
+2. 按时间顺序概括主线情节的发展和目前的局面
+3. 保留主要角色的关键变化、尚未解决的冲突和悬念
+4. 不要逐章复述，不要评价
+
+只返回摘要文本，不要包含其他内容。`,
+
+	PromptChapterSuggestions: `请为以下小说生成5个不同的后续章节建议：
+
+【小说信息】
+小说：{{.NovelTitle}}
+下一章：第 {{.ChapterNumber}} 章
+{{if .NovelGenre}}类型：{{.NovelGenre}}
+{{end}}{{if .PreviousSummary}}
+【前文回顾】
+{{.PreviousSummary}}
+{{end}}
+
+请生成5个不同发展方向的章节建议。
+
+要求：
+- 每个建议都要有不同的发展方向和重点
+- 标题要有悬念和吸引力
+- 大纲要具体但不过于详细
+- 确保与前文情节连贯
+
+请严格按照以下 JSON 格式返回：
+
+{
+  "suggestions": [
+    {
+      "title": "章节标题",
+      "outline": "场景1：描述内容。场景2：描述内容。场景3：描述内容。",
+      "description": "发展方向特点说明",
+      "type": "action"
+    }
+  ]
+}
+
+重要格式要求：
+1. 只返回纯 JSON，不要任何其他文字
+2. outline 字段必须是单行文本，用句号分隔场景
+3. 所有字符串值都必须在一行内，不能包含换行符
+4. 使用标准双引号，不要使用特殊引号
+5. 确保 JSON 格式完全正确，可以被标准解析器解析
+
+示例格式：
+"outline": "场景1：主角发现线索。场景2：遭遇阻碍。场景3：找到突破口。"`,
+
+	PromptChapterOutline: `请为以下章节生成一个详细的大纲：
+
+小说：{{.NovelTitle}}（类型：{{.NovelGenre}}）
+章节：第 {{.ChapterNumber}} 章 - {{.Title}}
+
+{{if .PreviousSummary}}前文回顾：
+{{.PreviousSummary}}
+
+{{end}}{{if .PlotPoints}}涉及情节：
+{{range $i, $p := .PlotPoints}}{{add $i 1}}. {{$p}}
+{{end}}
+{{end}}请生成本章的详细大纲，包括：
+1. 开场（如何承接上文）
+2. 主要情节发展（分3-5个场景）
+3. 角色互动和对话要点
+4. 冲突和转折点
+5. 结尾（如何引出下章）
+
+大纲要具体但不要过于详细，为实际写作留有发挥空间。`,
+
+	PromptChapterRefine: `请根据以下反馈优化章节内容：
+
+章节标题：{{.Title}}
+
+原始内容：
+{{.OriginalContent}}
+
+反馈意见：
+{{.Feedback}}
+
+请根据反馈意见修改内容，保持原有的情节框架，但改进具体的表达、节奏或细节。
+
+重要要求：
+1. 只返回优化后的完整章节内容
+2. 不要返回 JSON 格式
+3. 不要包含任何说明文字
+4. 不要包含标题
+5. 直接返回章节正文内容
+
+开始优化：`,
+
+	PromptChapterContinue: `请续写以下章节：
+
+章节标题：{{.Title}}
+
+已有内容：
+{{.ExistingContent}}
+
+续写提示：{{.ContinueHint}}
+
+请自然地续写内容，保持风格一致，推进情节发展。
+只返回续写的内容部分，不要重复已有内容。`,
+
+	PromptChapterExpand: `请对以下段落进行扩写，增加细节描写和情节发展。
+
+【原始段落】
+{{.ExpandTarget}}
+
+【扩写要求】
+{{.ExpandHint}}
+
+【写作要求】
+1. 保持原有情节和人物设定
+2. 增加环境描写、心理描写、动作细节
+3. 扩写后字数应为原文的 2-3 倍
+4. 保持叙事节奏流畅自然
+5. 不要改变原有的情节走向
+
+{{if .NovelGenre}}小说类型：{{.NovelGenre}}
+{{end}}
+请直接返回扩写后的内容，不要包含任何说明文字。`,
+
+	PromptChapterPlan: `请将以下故事节点拆分为 {{.Count}} 个连续的章节，并为每章撰写大纲：
+
+【小说信息】
+小说：{{.NovelTitle}}{{if .NovelGenre}}（类型：{{.NovelGenre}}）{{end}}
+{{if .Storyline}}故事线：{{.Storyline}}
+{{end}}
+【故事节点】
+{{.NodeTitle}}{{if .NodeDescription}}：{{.NodeDescription}}{{end}}
+{{if .Characters}}
+【涉及角色】
+{{range .Characters}}- {{.}}
+{{end}}{{end}}{{if .PreviousSummary}}
+【前文回顾】
+{{.PreviousSummary}}
+{{end}}{{if .NextNode}}
+【下一个节点】
+{{.NextNode}}（本节点的最后一章需要为其做好铺垫，但不要提前展开）
+{{end}}
+要求：
+1. 共 {{.Count}} 章，从第 {{.StartNumber}} 章开始，按顺序排列
+2. 各章承接前文，逐步推进本节点的情节，最后一章完成本节点的内容
+3. 每章大纲分为 2-4 个场景，写明冲突和转折
+4. 标题要有吸引力，不要带"第X章"
+
+请严格按照以下 JSON 格式返回：
+{
+  "chapters": [
+    {
+      "title": "章节标题",
+      "outline": "场景1：描述内容。场景2：描述内容。",
+      "focusPoints": ["本章重点1", "本章重点2"]
+    }
+  ]
+}
+
+只返回纯 JSON，不要任何其他文字。`,
+
+	PromptStorylineSystem: `你是一个专业的小说结构设计师，擅长创建复杂而引人入胜的故事线结构。
+
+你的任务是根据提供的小说信息，生成完整的多线程故事结构，包括：
+1. 主故事线：核心情节发展
+2. 角色故事线：主要角色的成长弧
+3. 情节故事线：重要的子情节发展
+4. 主题故事线：深层主题的展现
+
+设计原则：
+1. **层次清晰**：主线突出，支线丰富但不喧宾夺主
+2. **节奏控制**：张弛有度，高潮迭起
+3. **角色发展**：每个重要角色都有完整的成长弧
+4. **伏笔呼应**：前期埋下的伏笔要在后期得到呼应
+5. **冲突递进**：从小冲突逐步升级到大冲突
+6. **情感共鸣**：关注读者的情感体验
+
+节点类型说明：
+- start: 故事线的起始点
+- event: 普通情节事件
+- turning: 重要转折点
+- merge: 多条线汇合点
+- end: 故事线结束点
+
+连接类型说明：
+- sequence: 顺序发生
+- cause: 因果关系
+- parallel: 并行发生
+- condition: 条件触发`,
+
+	PromptStorylineGenerate: `请为以下小说生成完整的故事线结构：
+
+【小说信息】
+标题：{{.NovelTitle}}
+{{if .NovelGenre}}类型：{{.NovelGenre}}
+{{end}}{{if .MainConflict}}核心冲突：{{.MainConflict}}
+{{end}}{{if .Characters}}
+【主要角色】
+{{range $i, $c := .Characters}}{{add $i 1}}. {{$c}}
+{{end}}{{end}}{{if .ExistingStorylines}}
+【已有故事线】
+以下故事线已经存在，请生成不同的新故事线，避免重复：
+{{range $i, $s := .ExistingStorylines}}{{add $i 1}}. {{$s.Title}} - {{$s.Description}}
+{{end}}{{end}}
+【生成要求】
+- 创建 {{.StorylineCount}} 条故事线（包含主线和支线）
+- 每条故事线包含 {{.NodesPerLine}} 个关键节点
+- 节点必须具体详细，包含明确的地点、事件、目标和结果
+- 每个节点的描述要包含：在哪里、做什么、遇到谁、获得什么、如何影响后续
+- 节点间要有清晰的逻辑关系和因果联系
+- 考虑角色成长弧和情节发展的具体细节
+- 预留伏笔和悬念设置点，并说明如何呼应
+- 为每条故事线分配不同的颜色
+{{if .ExistingStorylines}}- 重要：新生成的故事线必须与已有故事线有明显区别，不能重复相同的主题或内容
+{{end}}
+【节点描述示例】
+好的节点描述："主角在青云山脉深处的古洞中，击败守护灵兽后获得上古功法《九霄诀》，领悟第一层心法，实力突破到灵师境界，为后续挑战宗门大比奠定基础"
+不好的节点描述："主角修炼突破"（太空洞，缺少具体细节）
+
+
+故事线类型说明：
+- main: 主故事线（核心情节）
+- character: 角色故事线（角色成长）
+- plot: 情节故事线（子情节发展）
+- theme: 主题故事线（主题展现）
+
+请严格按照以下 JSON 格式返回：
+{
+  "storylines": [
+    {
+      "title": "故事线标题",
+      "description": "故事线描述",
+      "type": "main|character|plot|theme",
+      "color": "#十六进制颜色",
+      "priority": 1-10,
+      "nodes": [
+        {
+          "title": "节点标题",
+          "description": "节点详细描述",
+          "nodeType": "start|event|turning|merge|end",
+          "chapterRange": "涉及章节范围，如 '1-3' 或 '5'",
+          "orderIndex": 0,
+          "status": "planned"
+        }
+      ],
+      "connections": [
+        {
+          "fromIndex": 0,
+          "toIndex": 1,
+          "connectionType": "sequence|cause|parallel|condition",
+          "description": "连接描述",
+          "weight": 1-10
+        }
+      ]
+    }
+  ]
+}
+
+不要包含任何 markdown 标记或其他文本，只返回纯 JSON。`,
+
+	PromptStorylineOptimize: `你是一个专业的小说结构设计师。请根据用户的修改意见，重写故事线描述。
+
+【当前描述】
+{{.CurrentDescription}}
+
+【用户的修改意见】
+{{.Feedback}}
+
+请根据用户的意见，生成新的故事线描述。要求：
+1. 保持原有描述的风格和结构
+2. 充分理解并应用用户的修改意见
+3. 如果用户要求增加节点，请扩展描述内容
+4. 如果用户要求修改某些方面，请针对性地调整
+5. 保持描述的连贯性和完整性
+6. 描述应该详细且具体，包含关键情节点
+
+直接返回修改后的完整描述文本，不要添加任何额外的说明或标记。`,
+
+	PromptStorylineExpandPart: `你是一个专业的小说结构设计师。用户选中了故事线描述中的一部分内容，希望你对这部分进行详细扩写。
+
+【完整的故事线描述（提供上下文）】
+{{.FullDescription}}
+
+【用户选中要扩写的部分】
+{{.SelectedText}}{{if .ExpandHint}}
+
+【扩写要求】
+{{.ExpandHint}}{{end}}
+
+请对选中的部分进行详细扩写，要求：
+1. 保持与整体故事线的连贯性和一致性
+2. 扩写应该更加详细和具体，增加情节细节
+3. 如果是节点描述，要包含：具体地点、事件经过、涉及角色、关键对话、情感变化、结果影响
+4. 如果是总体描述，要增加背景信息、冲突设置、发展脉络
+5. 保持原有的风格和语气
+6. 扩写后的内容应该是原内容的 2-3 倍长度
+7. 内容要生动、有画面感，避免空洞的概括
+
+直接返回扩写后的文本，不要添加任何额外的说明、标记或前缀。`,
+
+	PromptStorylineExpandNode: `请扩展以下故事节点的内容：
+
+【节点信息】
+标题：{{.NodeTitle}}
+当前描述：{{.NodeDescription}}
+
+【上下文】
+{{.Context}}
+
+请生成更详细的节点描述，包括：
+1. 具体发生的事件
+2. 涉及的角色和行动
+3. 情节推进的作用
+4. 对后续发展的影响
+5. 可能的伏笔设置
+
+返回扩展后的描述（200-300字）。`,
+
+	PromptStorylineConnections: `请分析以下故事节点，建议合理的连接关系：
+
+【节点列表】
+{{.Nodes}}
+
+请分析节点间的逻辑关系，建议连接方式，包括：
+1. 时间顺序连接
+2. 因果关系连接
+3. 并行发展连接
+4. 条件触发连接
+
+以 JSON 格式返回连接建议：
+{
+  "connections": [
+    {
+      "fromIndex": 0,
+      "toIndex": 1,
+      "connectionType": "sequence|cause|parallel|condition",
+      "description": "连接原因说明",
+      "weight": 1-10
+    }
+  ]
+}`,
+
+	PromptSettingSystem: `你是一个专业的小说世界观设计师，擅长创建详细、合理、有深度的小说设定。
+
+你的任务是根据小说信息和用户需求，生成高质量的设定内容，包括：
+1. 世界观背景：历史、地理、文化、社会结构等
+2. 力量体系：修炼/魔法/异能等级、规则、限制
+3. 科技设定：科技水平、关键技术、应用场景
+4. 基础概念：世界观中的特殊概念、术语解释
+5. 规则设定：世界运行的基本规则和限制
+6. 组织势力：重要组织、势力分布、关系网络
+7. 物品道具：关键物品、装备、宝物等
+
+设计原则：
+1. **逻辑自洽**：设定之间要相互协调，不能自相矛盾
+2. **细节丰富**：提供具体的细节和例子，避免空洞
+3. **层次分明**：从宏观到微观，结构清晰
+4. **服务剧情**：设定要为故事服务，不能喧宾夺主
+5. **留有余地**：保留扩展空间，不要写死
+6. **易于理解**：用清晰的语言解释复杂概念
+
+请以清晰、结构化的方式返回设定内容。`,
+
+	PromptSettingGenerate: `请为以下小说生成【{{.CategoryName}}】设定：
+
+【小说信息】
+标题：{{.NovelTitle}}
+{{if .NovelGenre}}类型：{{.NovelGenre}}
+{{end}}{{if .Title}}
+【设定标题】
+{{.Title}}
+{{end}}{{if .Requirements}}
+【具体要求】
+{{.Requirements}}
+{{end}}
+【生成要求】
+{{if eq .Category "world"}}请生成世界观背景设定，包括：
+1. 世界的基本构成（地理、历史、文化）
+2. 社会结构和政治体系
+3. 重要的历史事件和时间线
+4. 文化特色和风俗习惯
+5. 与故事相关的关键背景信息{{else if eq .Category "power"}}请生成力量体系设定，包括：
+1. 力量的来源和本质
+2. 等级划分和晋升条件
+3. 修炼/使用方法和规则
+4. 力量的限制和代价
+5. 不同等级的具体表现和能力{{else if eq .Category "tech"}}请生成科技设定，包括：
+1. 科技发展水平和时代背景
+2. 关键技术和原理
+3. 技术的应用场景和影响
+4. 技术的限制和副作用
+5. 与故事相关的科技元素{{else if eq .Category "concept"}}请生成基础概念设定，包括：
+1. 概念的定义和含义
+2. 概念的起源和发展
+3. 概念在世界中的作用
+4. 相关的术语和解释
+5. 具体的例子和应用{{else if eq .Category "rule"}}请生成规则设定，包括：
+1. 规则的内容和范围
+2. 规则的来源和依据
+3. 遵守规则的好处
+4. 违反规则的后果
+5. 规则的例外情况{{else if eq .Category "org"}}请生成组织势力设定，包括：
+1. 组织的名称和性质
+2. 组织的历史和发展
+3. 组织结构和成员
+4. 组织的目标和理念
+5. 与其他势力的关系{{else if eq .Category "item"}}请生成物品道具设定，包括：
+1. 物品的名称和外观
+2. 物品的来历和制作
+3. 物品的功能和效果
+4. 使用条件和限制
+5. 物品的稀有度和价值{{else}}请生成详细的设定内容，包括：
+1. 设定的核心内容
+2. 相关的背景信息
+3. 具体的细节和例子
+4. 与故事的关联
+5. 可能的扩展方向{{end}}
+
+请以清晰、结构化的方式返回设定内容。内容要详细具体，避免空洞的概括。
+
+如果用户没有提供标题，请根据内容生成一个合适的标题。
+
+请以 JSON 格式返回，包含以下字段：
+{
+  "title": "设定标题",
+  "content": "详细的设定内容，使用标题、列表、段落等组织",
+  "tags": ["相关标签"]
+}`,
+
+	PromptSettingEnhance: `请完善以下设定内容：
+
+【设定标题】
+{{.Title}}
+
+【当前内容】
+{{.CurrentContent}}{{if .EnhanceHint}}
+
+【完善要求】
+{{.EnhanceHint}}{{end}}
+
+请对设定内容进行完善和扩充，要求：
+1. 增加更多具体的细节和例子
+2. 补充相关的背景信息
+3. 使内容更加丰富和立体
+4. 保持逻辑自洽和结构清晰
+5. 内容应该是原内容的 2-3 倍
+
+直接返回完善后的内容，不要添加任何额外的说明或标记。`,
+
+	PromptStyleSystem: `你是一个专业的文学风格分析师，擅长分析小说的写作风格、叙事技巧和语言特点。
+
+你的任务是：
+1. 分析提供的小说片段，提取其写作风格特征
+2. 总结作者的叙事技巧和语言习惯
+3. 生成可用于 AI 写作的风格指南
+
+分析维度：
+- 写作风格：整体风格（简洁/华丽/写实/浪漫等）
+- 对话风格：对话的特点和处理方式
+- 描写风格：环境、人物、动作的描写方式
+- 节奏控制：情节推进的节奏和张弛
+- 词汇特点：常用词汇、句式结构
+- 叙事视角：第一人称/第三人称，全知/限知`,
+
+	PromptStyleAnalyze: `请分析以下小说的写作风格：
+
+小说：{{.NovelTitle}}
+{{if .NovelGenre}}类型：{{.NovelGenre}}
+{{end}}
+【样本片段】
+{{range $i, $s := .Samples}}
+--- 片段 {{add $i 1}} ---
+{{$s}}
+{{end}}
+
+请从以下维度分析这部小说的写作风格：
+
+1. 整体写作风格（简洁/华丽/写实/浪漫等）
+2. 关键特征（列举3-5个最突出的特点）
+3. 对话风格（对话的处理方式和特点）
+4. 描写风格（环境、人物、动作的描写方式）
+5. 节奏控制（情节推进的节奏）
+6. 词汇水平（用词特点）
+7. 句式特点（句子结构和长度）
+8. 典型例句（从样本中提取2-3个最能体现风格的句子）
+9. 风格指南（总结成一段话，用于指导 AI 模仿这种风格写作）
+
+⚠️ 重要：请严格按照以下 JSON 格式返回，字段名必须使用英文：
+{
+  "writingStyle": "整体风格描述",
+  "keyFeatures": ["特征1", "特征2", "特征3"],
+  "dialogueStyle": "对话风格描述",
+  "descriptionStyle": "描写风格描述",
+  "pacingStyle": "节奏风格描述",
+  "vocabularyLevel": "词汇水平描述",
+  "sentencePattern": "句式特点描述",
+  "examples": ["例句1", "例句2"],
+  "styleGuide": "风格指南（一段完整的文字）"
+}
+
+不要使用中文字段名，不要包含任何 markdown 标记或其他文本，只返回纯 JSON。`,
+
+	PromptStyleCompare: `请比较以下两种写作风格的异同：
+
+风格 A：
+- 整体风格：{{.StyleA.WritingStyle}}
+- 对话风格：{{.StyleA.DialogueStyle}}
+- 描写风格：{{.StyleA.DescriptionStyle}}
+
+风格 B：
+- 整体风格：{{.StyleB.WritingStyle}}
+- 对话风格：{{.StyleB.DialogueStyle}}
+- 描写风格：{{.StyleB.DescriptionStyle}}
+
+请分析：
+1. 主要相似点
+2. 主要差异点
+3. 各自的优势
+4. 适合的场景
+
+返回简洁的分析（300字以内）。`,
+
+	PromptStyleImprove: `当前写作风格：
+{{.StyleGuide}}
+
+目标类型：{{.TargetGenre}}
+
+请针对目标类型，建议如何改进当前的写作风格，包括：
+1. 需要保留的优点
+2. 需要改进的方面
+3. 具体的改进建议
+4. 参考的优秀作品
+
+返回简洁的建议（400字以内）。`,
+
+	PromptContinuitySystem: `你是一个严谨的小说编辑，负责检查章节内容是否与既有设定、角色档案和前文情节保持一致。
+
+检查原则：
+1. 只报告有明确依据的矛盾，依据必须来自提供的设定、角色档案或前文摘要
+2. 不评价文笔、节奏和情节好坏，只关注前后是否一致
+3. 设定中没有提及的内容视为作者的新设定，不算矛盾
+4. 引用原文时必须逐字摘录章节中的片段，不要改写`,
+
+	PromptContinuityCheck: `请检查以下章节是否与已有设定、角色和前文矛盾：
+
+【章节信息】
+{{if .NovelTitle}}小说：{{.NovelTitle}}
+{{end}}章节：{{if .ChapterNumber}}第 {{.ChapterNumber}} 章 - {{end}}{{.ChapterTitle}}
+{{if .Settings}}
+【相关设定】
+{{range .Settings}}{{.}}
+{{end}}{{end}}{{if .Characters}}
+【相关角色】
+{{range .Characters}}{{.}}
+{{end}}{{end}}{{if .PreviousSummaries}}
+【前文摘要】
+{{range .PreviousSummaries}}{{.}}
+{{end}}{{end}}{{if .Dismissed}}
+【作者已确认不是问题，不要再次报告】
+{{range .Dismissed}}- {{.}}
+{{end}}{{end}}
+【章节正文】
+{{.Content}}
+
+请找出疑似的矛盾，例如：违背力量体系或科技限制、角色能力或性格前后不符、已死亡或失踪的角色无故出场、与前文事件冲突、时间顺序不合理。
+
+以 JSON 格式返回，没有问题时 issues 为空数组：
+{
+  "issues": [
+    {
+      "category": "setting|character|plot|timeline",
+      "severity": "low|medium|high",
+      "quote": "章节中引发问题的原文片段（逐字摘录，不超过100字）",
+      "description": "矛盾说明",
+      "reference": "与之矛盾的设定、角色档案或前文内容",
+      "suggestion": "修改建议"
+    }
+  ]
+}`,
+
+	PromptEntitySystem: `你是一个细致的小说编辑，负责确认章节中是否真正出现了指定的角色、情节、设定或地点。
+
+判断原则：
+1. 名称只是作为普通词语出现（例如人名与常用词相同）时不算出现
+2. 角色以别名、称号被提及，或者只在对话、回忆中被提到，都算出现
+3. 情节、设定和地点需要在正文中被实际描写或明确提及才算出现
+4. 只根据章节正文判断，不要推测`,
+
+	PromptEntityConfirm: `以下候选实体的名称在章节正文中被匹配到，请确认哪些确实在本章出现：
+
+【章节】{{.ChapterTitle}}
+
+【候选实体】
+{{range .Candidates}}{{.}}
+{{end}}
+【章节正文】
+{{.Content}}
+
+以 JSON 格式返回确实出现的候选实体序号，都没有出现时 confirmed 为空数组：
+{
+  "confirmed": [1, 2]
+}`,
+
+	PromptChatSystem: `# 角色设定
+你是一个专业的小说创作助手，专门帮助作者讨论和完善小说创作。请基于以上小说信息和已有章节内容，为用户提供专业的创作建议、情节讨论和写作指导。重点关注：
+- 基于已有章节的情节发展和走向
+- 角色在已有章节中的成长轨迹和后续发展
+- 世界观在已有章节中的展现和需要完善的地方
+- 已有章节中的冲突设置和后续解决方案
+- 保持与已有章节风格一致的写作技巧
+- 基于当前进度的后续章节规划
+- 分析已有章节的优缺点并提供改进建议
+
+请返回纯文本，不要返回任何Markdown或者JSON格式。在回答时，请充分考虑已有章节的内容和发展脉络。`,
+
+	PromptStructuredRepair: `你上一次的回复没有通过格式校验，问题如下：
+{{range .Problems}}- {{.}}
+{{end}}
+请修正以上问题并重新输出完整结果，要求：
+1. 只返回一个 JSON 对象，不要包含 markdown 代码块或任何说明文字
+2. 字段名称和类型必须符合以下 JSON Schema：
+{{.Schema}}`,
+}
@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+type fakePromptStore struct {
+	templates map[string]*PromptTemplate
+}
+
+func (s *fakePromptStore) ActivePrompt(name, locale string) (*PromptTemplate, error) {
+	return s.templates[name], nil
+}
+
+func TestRenderPrompt_Default(t *testing.T) {
+	SetPromptStore(nil)
+
+	text, ref, err := RenderPrompt(PromptChatSystem, ChatSystemPrompt{NovelTitle: "测试小说"})
+	if err != nil {
+		t.Fatalf("RenderPrompt failed: %v", err)
+	}
+	if !strings.Contains(text, "小说创作助手") {
+		t.Errorf("expected default chat persona, got %q", text)
+	}
+	if got := ref.String(); got != PromptChatSystem+"@default" {
+		t.Errorf("unexpected ref: %s", got)
+	}
+}
+
+func TestRenderPrompt_StoreOverride(t *testing.T) {
+	SetPromptStore(&fakePromptStore{templates: map[string]*PromptTemplate{
+		PromptChatSystem: {Name: PromptChatSystem, Version: 3, Locale: DefaultPromptLocale, Body: "自定义：{{.NovelTitle}}"},
+	}})
+	defer SetPromptStore(nil)
+
+	text, ref, err := RenderPrompt(PromptChatSystem, ChatSystemPrompt{NovelTitle: "测试小说"})
+	if err != nil {
+		t.Fatalf("RenderPrompt failed: %v", err)
+	}
+	if text != "自定义：测试小说" {
+		t.Errorf("unexpected prompt: %q", text)
+	}
+	if got := ref.String(); got != PromptChatSystem+"@v3" {
+		t.Errorf("unexpected ref: %s", got)
+	}
+}
+
+func TestRenderPrompt_FallbackOnBadTemplate(t *testing.T) {
+	SetPromptStore(&fakePromptStore{templates: map[string]*PromptTemplate{
+		PromptChatSystem: {Name: PromptChatSystem, Version: 2, Locale: DefaultPromptLocale, Body: "{{.Missing}}"},
+	}})
+	defer SetPromptStore(nil)
+
+	_, ref, err := RenderPrompt(PromptChatSystem, ChatSystemPrompt{NovelTitle: "测试小说"})
+	if err != nil {
+		t.Fatalf("RenderPrompt failed: %v", err)
+	}
+	if ref.Version != 0 {
+		t.Errorf("expected fallback to default template, got %s", ref)
+	}
+}
+
+func TestRenderPrompt_UnknownName(t *testing.T) {
+	if _, _, err := RenderPrompt("no.such.prompt", nil); err == nil {
+		t.Error("expected error for unknown prompt")
+	}
+}
@@ -0,0 +1,146 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/LingByte/LingDialog/pkg/config"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// 提供商名称
+const (
+	ProviderOpenAI = "openai" // OpenAI 兼容接口
+	ProviderOllama = "ollama" // 本地 Ollama
+	ProviderMock   = "mock"   // 离线 Mock（测试与演示）
+)
+
+// 未使用提示词模板的调用任务标识（使用模板的调用以模板名称作为任务标识）
+const (
+	TaskChat                   = "chat"
+	TaskCharacterGenerate      = "character.generate"
+	TaskCharacterEnhance       = "character.enhance"
+	TaskCharacterRelationships = "character.relationships"
+	TaskPlotGenerate           = "plot.generate"
+	TaskPlotEnhance            = "plot.enhance"
+	TaskText                   = "text"
+)
+
+// StreamCallback 流式回调，segment 为增量内容，isComplete 表示流结束
+type StreamCallback func(segment string, isComplete bool) error
+
+// Usage token 使用统计
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// ChatRequest 统一的对话请求
+type ChatRequest struct {
+	Model       string    // 模型名称
+	Task        string    // 调用任务标识（如 chapter.generate），用于日志和 Mock 匹配
+	PromptRef   PromptRef // 生成用户指令所用的模板版本，仅用于审计，不参与缓存键和 Mock 匹配
+	Messages    []Message // 消息列表
+	Temperature *float32  // 温度（nil 表示使用服务端默认值）
+	MaxTokens   *int      // 最大输出 token（nil 表示不限制）
+
+	ResponseSchema *JSONSchema   // 非空时要求以 JSON 输出（仅对实现 JSONModeProvider 的提供商设置）
+	Tools          []openai.Tool // 可供模型调用的工具（仅对实现 ToolCallingProvider 的提供商设置）
+}
+
+// ChatResponse 统一的对话响应
+type ChatResponse struct {
+	Content   string            // 回复内容
+	Model     string            // 实际使用的模型
+	Provider  string            // 实际提供回复的提供商，由具体提供商设置（备用提供商接管时与外层包装的名称不同）
+	Usage     Usage             // token 使用统计
+	Cached    bool              // 是否来自响应缓存
+	ToolCalls []openai.ToolCall // 模型请求调用的工具，为空表示已给出最终回复
+}
+
+// Provider 统一的 LLM 提供商接口
+type Provider interface {
+	// Name 返回提供商名称
+	Name() string
+	// Chat 非流式对话
+	Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+	// ChatStream 流式对话，callback 依次收到增量内容，结束时 isComplete 为 true
+	ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*ChatResponse, error)
+	// ListModels 列出可用模型
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// ProviderConfig 提供商配置
+type ProviderConfig struct {
+	Provider string // openai / ollama / mock
+	APIKey   string
+	BaseURL  string
+
+	MockFixtureDir string // Mock 夹具目录
+	MockRecord     bool   // Mock 录制模式：转发到上游并保存夹具
+	MockUpstream   string // 录制模式的上游提供商（openai / ollama）
+}
+
+// NewProvider 根据配置创建提供商
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	switch cfg.Provider {
+	case ProviderOllama:
+		return NewOllamaProvider(cfg.BaseURL), nil
+	case ProviderOpenAI, "":
+		return NewOpenAIProvider(cfg.APIKey, cfg.BaseURL), nil
+	case ProviderMock:
+		mock := NewMockProvider(cfg.MockFixtureDir)
+		if cfg.MockRecord {
+			upstream, err := NewProvider(ProviderConfig{
+				Provider: cfg.MockUpstream,
+				APIKey:   cfg.APIKey,
+				BaseURL:  cfg.BaseURL,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("invalid mock upstream: %w", err)
+			}
+			mock.WithRecorder(upstream)
+		}
+		return mock, nil
+	default:
+		return nil, fmt.Errorf("unsupported llm provider: %s", cfg.Provider)
+	}
+}
+
+// NewProviderFromConfig 根据全局配置创建提供商，并添加熔断、重试和备用提供商
+// 未知的 LLM_PROVIDER 按 OpenAI 兼容接口处理，与 config.GetLLMConfig 保持一致
+func NewProviderFromConfig() Provider {
+	provider := newBaseProviderFromConfig()
+	if config.IsMockProvider() && !config.GlobalConfig.LLMMockRecord {
+		// 离线回放不访问网络，无需熔断
+		return provider
+	}
+	return NewResilientProvider(provider, ResilienceOptionsFromConfig())
+}
+
+// newBaseProviderFromConfig 根据全局配置创建底层提供商
+func newBaseProviderFromConfig() Provider {
+	apiKey, baseURL, _ := config.GetLLMConfig()
+	if config.IsMockProvider() {
+		provider, err := NewProvider(ProviderConfig{
+			Provider:       ProviderMock,
+			APIKey:         apiKey,
+			BaseURL:        baseURL,
+			MockFixtureDir: config.GlobalConfig.LLMMockFixtureDir,
+			MockRecord:     config.GlobalConfig.LLMMockRecord,
+			MockUpstream:   config.GlobalConfig.LLMMockUpstream,
+		})
+		if err != nil {
+			logger.Warn("Mock 录制模式配置无效，仅使用夹具回放", zap.Error(err))
+			return NewMockProvider(config.GlobalConfig.LLMMockFixtureDir)
+		}
+		return provider
+	}
+	if config.IsOllamaProvider() {
+		return NewOllamaProvider(baseURL)
+	}
+	return NewOpenAIProvider(apiKey, baseURL)
+}
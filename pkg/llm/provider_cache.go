@@ -0,0 +1,241 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/LingByte/LingDialog/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// 响应缓存默认值
+const (
+	DefaultCacheTTL            = 24 * time.Hour
+	DefaultCacheMemorySize     = 1000
+	DefaultCacheMaxTemperature = 0.7
+)
+
+// cacheReplayRunes 命中缓存的流式请求每片回放的字符数
+const cacheReplayRunes = 16
+
+// CacheStore 响应缓存的持久化存储（第二级缓存）
+type CacheStore interface {
+	// Get 读取未过期的缓存，不存在或已过期时返回 nil
+	Get(ctx context.Context, key string) (*ChatResponse, error)
+	// Put 写入缓存，ttl 后过期
+	Put(ctx context.Context, key string, req ChatRequest, resp *ChatResponse, ttl time.Duration) error
+}
+
+// CacheOptions 响应缓存配置
+type CacheOptions struct {
+	TTL            time.Duration // 缓存有效期，<=0 时使用 DefaultCacheTTL
+	MemorySize     int           // 内存缓存条目数，<=0 时使用 DefaultCacheMemorySize
+	MaxTemperature float32       // 温度高于该值的请求不使用缓存
+	Store          CacheStore    // 持久化存储，可为空
+}
+
+// CacheStats 缓存命中统计
+type CacheStats struct {
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	Bypassed int64 `json:"bypassed"`
+}
+
+// CachedProvider 带响应缓存的提供商
+// 按提供商、模型、规范化后的消息和采样参数缓存响应，先查内存再查持久化存储；
+// 未指定温度或温度高于阈值的请求直接转发，命中时响应的 Cached 为 true
+type CachedProvider struct {
+	inner  Provider
+	opts   CacheOptions
+	memory *utils.ExpiredLRUCache[string, ChatResponse]
+
+	hits, misses, bypassed atomic.Int64
+}
+
+// NewCachedProvider 为提供商添加响应缓存
+func NewCachedProvider(inner Provider, opts CacheOptions) *CachedProvider {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultCacheTTL
+	}
+	if opts.MemorySize <= 0 {
+		opts.MemorySize = DefaultCacheMemorySize
+	}
+	return &CachedProvider{
+		inner:  inner,
+		opts:   opts,
+		memory: utils.NewExpiredLRUCache[string, ChatResponse](opts.MemorySize, opts.TTL),
+	}
+}
+
+// Unwrap 返回被包装的提供商
+func (p *CachedProvider) Unwrap() Provider {
+	return p.inner
+}
+
+// Stats 返回缓存命中统计
+func (p *CachedProvider) Stats() CacheStats {
+	return CacheStats{Hits: p.hits.Load(), Misses: p.misses.Load(), Bypassed: p.bypassed.Load()}
+}
+
+// Name 返回被包装提供商的名称
+func (p *CachedProvider) Name() string {
+	return p.inner.Name()
+}
+
+// SupportsJSONMode 与被包装的提供商一致
+func (p *CachedProvider) SupportsJSONMode() bool {
+	return supportsJSONMode(p.inner)
+}
+
+// SupportsTools 与被包装的提供商一致
+func (p *CachedProvider) SupportsTools() bool {
+	return SupportsTools(p.inner)
+}
+
+// ListModels 列出可用模型
+func (p *CachedProvider) ListModels(ctx context.Context) ([]string, error) {
+	return p.inner.ListModels(ctx)
+}
+
+// Chat 非流式对话
+func (p *CachedProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	if !p.cacheable(req) {
+		p.bypassed.Add(1)
+		return p.inner.Chat(ctx, req)
+	}
+
+	key := CacheKey(p.inner.Name(), req)
+	if cached := p.lookup(ctx, key, req); cached != nil {
+		return cached, nil
+	}
+
+	resp, err := p.inner.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	p.store(ctx, key, req, resp)
+	return resp, nil
+}
+
+// ChatStream 流式对话，命中缓存时按固定长度分片回放
+func (p *CachedProvider) ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*ChatResponse, error) {
+	if !p.cacheable(req) {
+		p.bypassed.Add(1)
+		return p.inner.ChatStream(ctx, req, callback)
+	}
+
+	key := CacheKey(p.inner.Name(), req)
+	if cached := p.lookup(ctx, key, req); cached != nil {
+		return replayCached(ctx, cached, callback)
+	}
+
+	resp, err := p.inner.ChatStream(ctx, req, callback)
+	if err != nil {
+		return resp, err
+	}
+	p.store(ctx, key, req, resp)
+	return resp, nil
+}
+
+// cacheable 判断请求是否可以使用缓存，带工具的请求结果依赖实时数据，不缓存
+func (p *CachedProvider) cacheable(req ChatRequest) bool {
+	return req.Temperature != nil && *req.Temperature <= p.opts.MaxTemperature && len(req.Tools) == 0
+}
+
+// lookup 依次查找内存和持久化缓存，持久化缓存命中时回填内存
+func (p *CachedProvider) lookup(ctx context.Context, key string, req ChatRequest) *ChatResponse {
+	if resp, ok := p.memory.Get(key); ok {
+		return p.hit(key, req, resp, "memory")
+	}
+
+	if p.opts.Store != nil {
+		resp, err := p.opts.Store.Get(ctx, key)
+		if err != nil {
+			logger.Warn("读取响应缓存失败", zap.String("key", key), zap.Error(err))
+		} else if resp != nil {
+			p.memory.Add(key, *resp)
+			return p.hit(key, req, *resp, "store")
+		}
+	}
+
+	p.misses.Add(1)
+	return nil
+}
+
+// hit 记录命中并返回标记为缓存的响应副本
+func (p *CachedProvider) hit(key string, req ChatRequest, resp ChatResponse, tier string) *ChatResponse {
+	p.hits.Add(1)
+	logger.Info("LLM 响应缓存命中",
+		zap.String("task", req.Task),
+		zap.String("model", req.Model),
+		zap.String("tier", tier),
+		zap.String("key", key[:16]))
+	resp.Cached = true
+	return &resp
+}
+
+// store 写入两级缓存，空响应不缓存，持久化失败只记录日志
+func (p *CachedProvider) store(ctx context.Context, key string, req ChatRequest, resp *ChatResponse) {
+	if resp == nil || strings.TrimSpace(resp.Content) == "" {
+		return
+	}
+	entry := *resp
+	entry.Cached = false
+	p.memory.Add(key, entry)
+
+	if p.opts.Store != nil {
+		if err := p.opts.Store.Put(ctx, key, req, &entry, p.opts.TTL); err != nil {
+			logger.Warn("写入响应缓存失败", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+// replayCached 将缓存的内容按流式回调分片发送
+func replayCached(ctx context.Context, resp *ChatResponse, callback StreamCallback) (*ChatResponse, error) {
+	if callback == nil {
+		return resp, nil
+	}
+	for _, chunk := range splitRunes(resp.Content, cacheReplayRunes) {
+		if err := ctx.Err(); err != nil {
+			return resp, err
+		}
+		if err := callback(chunk, false); err != nil {
+			return resp, err
+		}
+	}
+	return resp, callback("", true)
+}
+
+// cacheKeyPayload 参与缓存键计算的请求字段
+type cacheKeyPayload struct {
+	Provider    string      `json:"provider"`
+	Model       string      `json:"model"`
+	Messages    []Message   `json:"messages"`
+	Temperature *float32    `json:"temperature"`
+	MaxTokens   *int        `json:"maxTokens"`
+	Schema      *JSONSchema `json:"schema,omitempty"`
+}
+
+// CacheKey 计算请求的缓存键：消息内容去除首尾空白并合并连续空白，避免格式差异导致未命中
+func CacheKey(provider string, req ChatRequest) string {
+	payload := cacheKeyPayload{
+		Provider:    provider,
+		Model:       req.Model,
+		Messages:    make([]Message, len(req.Messages)),
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		Schema:      req.ResponseSchema,
+	}
+	for i, m := range req.Messages {
+		payload.Messages[i] = Message{Role: m.Role, Content: strings.Join(strings.Fields(m.Content), " ")}
+	}
+	data, _ := json.Marshal(payload)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryCacheStore 测试用的持久化缓存存储
+type memoryCacheStore struct {
+	entries map[string]ChatResponse
+}
+
+func (s *memoryCacheStore) Get(ctx context.Context, key string) (*ChatResponse, error) {
+	if resp, ok := s.entries[key]; ok {
+		return &resp, nil
+	}
+	return nil, nil
+}
+
+func (s *memoryCacheStore) Put(ctx context.Context, key string, req ChatRequest, resp *ChatResponse, ttl time.Duration) error {
+	s.entries[key] = *resp
+	return nil
+}
+
+func TestCachedProvider_HitAndBypass(t *testing.T) {
+	upstream := &fakeProvider{reply: "摘要"}
+	cached := NewCachedProvider(upstream, CacheOptions{MaxTemperature: 0.7})
+	req := ChatRequest{Model: "m", Task: PromptChapterSummary, Messages: []Message{{Role: "user", Content: "总结  这一章\n"}}, Temperature: Float32Ptr(0.5)}
+
+	first, err := cached.Chat(context.Background(), req)
+	if err != nil || first.Cached {
+		t.Fatalf("first call should miss: %+v, %v", first, err)
+	}
+
+	// 空白差异不影响命中
+	req.Messages = []Message{{Role: "user", Content: " 总结 这一章"}}
+	second, err := cached.Chat(context.Background(), req)
+	if err != nil || !second.Cached || second.Content != "摘要" || second.Usage.TotalTokens != 3 {
+		t.Fatalf("second call should hit: %+v, %v", second, err)
+	}
+
+	req.Temperature = Float32Ptr(0.9)
+	if resp, _ := cached.Chat(context.Background(), req); resp.Cached {
+		t.Error("high temperature requests should bypass the cache")
+	}
+	req.Temperature = nil
+	if resp, _ := cached.Chat(context.Background(), req); resp.Cached {
+		t.Error("requests without temperature should bypass the cache")
+	}
+
+	if len(upstream.requests) != 3 {
+		t.Errorf("expected 3 upstream calls, got %d", len(upstream.requests))
+	}
+	if stats := cached.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Bypassed != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCachedProvider_StoreTierAndStream(t *testing.T) {
+	store := &memoryCacheStore{entries: map[string]ChatResponse{}}
+	req := ChatRequest{Model: "m", Messages: []Message{{Role: "user", Content: "润色"}}, Temperature: Float32Ptr(0.3)}
+
+	upstream := &fakeProvider{reply: "润色后的一段比较长的文字内容，用于分片回放"}
+	if _, err := NewCachedProvider(upstream, CacheOptions{MaxTemperature: 0.7, Store: store}).Chat(context.Background(), req); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if len(store.entries) != 1 {
+		t.Fatalf("response should be persisted, got %d entries", len(store.entries))
+	}
+
+	// 新实例内存为空，从持久化存储命中并以流式回放
+	other := &fakeProvider{reply: "不应调用"}
+	var segments []string
+	resp, err := NewCachedProvider(other, CacheOptions{MaxTemperature: 0.7, Store: store}).ChatStream(context.Background(), req, func(segment string, isComplete bool) error {
+		if !isComplete {
+			segments = append(segments, segment)
+		}
+		return nil
+	})
+	if err != nil || !resp.Cached {
+		t.Fatalf("expected cached stream response: %+v, %v", resp, err)
+	}
+	if len(segments) < 2 || strings.Join(segments, "") != upstream.reply {
+		t.Errorf("unexpected replayed segments: %v", segments)
+	}
+	if len(other.requests) != 0 {
+		t.Error("cache hit should not call the provider")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	base := ChatRequest{Model: "m", Messages: []Message{{Role: "user", Content: "a"}}, Temperature: Float32Ptr(0.2)}
+	variants := []ChatRequest{
+		{Model: "n", Messages: base.Messages, Temperature: base.Temperature},
+		{Model: "m", Messages: []Message{{Role: "system", Content: "a"}}, Temperature: base.Temperature},
+		{Model: "m", Messages: base.Messages, Temperature: Float32Ptr(0.3)},
+		{Model: "m", Messages: base.Messages, Temperature: base.Temperature, MaxTokens: IntPtr(10)},
+	}
+	key := CacheKey("openai", base)
+	if key == CacheKey("ollama", base) {
+		t.Error("provider should be part of the key")
+	}
+	for i, v := range variants {
+		if CacheKey("openai", v) == key {
+			t.Errorf("variant %d should produce a different key", i)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ProviderError 提供商返回的 HTTP 错误
+type ProviderError struct {
+	Provider   string        // 提供商名称
+	StatusCode int           // HTTP 状态码
+	RetryAfter time.Duration // 服务端要求的重试等待时间（Retry-After），未提供时为 0
+	Err        error         // 原始错误
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransientError 判断错误是否为可重试的临时错误：429、5xx、超时和网络错误
+// 调用方取消（context.Canceled）和 4xx 请求错误不可重试
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if status := errorStatusCode(err); status != 0 {
+		return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RetryAfterOf 返回错误中携带的 Retry-After 等待时间
+func RetryAfterOf(err error) time.Duration {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.RetryAfter
+	}
+	return 0
+}
+
+// errorStatusCode 提取错误中的 HTTP 状态码，没有时返回 0
+func errorStatusCode(err error) int {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) && providerErr.StatusCode != 0 {
+		return providerErr.StatusCode
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
+
+// parseRetryAfter 解析 Retry-After 头（秒数或 HTTP 日期）
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// retryAfterKey 请求上下文中保存 Retry-After 的键
+type retryAfterKey struct{}
+
+// withRetryAfterSlot 在上下文中放置 Retry-After 记录位置，供 retryAfterTransport 写入
+func withRetryAfterSlot(ctx context.Context) (context.Context, *time.Duration) {
+	slot := new(time.Duration)
+	return context.WithValue(ctx, retryAfterKey{}, slot), slot
+}
+
+// retryAfterTransport 记录 429/503 响应的 Retry-After 头（go-openai 的错误中不包含响应头）
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if slot, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+			*slot = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+	}
+	return resp, err
+}
+
+// wrapOpenAIError 将带状态码的 go-openai 错误包装为 ProviderError，附带 Retry-After
+func wrapOpenAIError(err error, retryAfter time.Duration) error {
+	status := errorStatusCode(err)
+	if status == 0 {
+		return err
+	}
+	return &ProviderError{Provider: ProviderOpenAI, StatusCode: status, RetryAfter: retryAfter, Err: err}
+}
@@ -0,0 +1,355 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// 内置默认夹具，保证没有夹具目录时各生成器也能返回可解析的结果
+//
+//go:embed mockdata/*.json
+var mockDefaults embed.FS
+
+// mockDefaultTask 未匹配到任务夹具时使用的兜底夹具名称
+const mockDefaultTask = "default"
+
+// mockChunkRunes 未指定分片时，流式输出每片的字符数
+const mockChunkRunes = 8
+
+// MockResponse Mock 响应（夹具文件格式）
+type MockResponse struct {
+	Content string   `json:"content"`          // 完整回复内容
+	Chunks  []string `json:"chunks,omitempty"` // 流式分片，为空时按固定长度切分 Content
+	Model   string   `json:"model,omitempty"`  // 返回的模型名称，为空时使用请求中的模型
+	Usage   *Usage   `json:"usage,omitempty"`  // token 使用统计，为空时按字符数估算
+	Error   string   `json:"error,omitempty"`  // 非空时模拟调用失败
+
+	ToolCalls []openai.ToolCall `json:"toolCalls,omitempty"` // 模拟模型请求调用工具
+}
+
+// MockProvider 离线 Mock 提供商
+// 响应按以下顺序匹配：脚本（提示词哈希）→ 脚本（任务）→ 夹具 <dir>/<task>/<hash>.json →
+// 夹具 <dir>/<task>.json → 内置默认夹具。录制模式下转发到上游并保存为 <dir>/<task>/<hash>.json
+type MockProvider struct {
+	fixtureDir string
+	upstream   Provider
+
+	mu       sync.Mutex
+	scripts  map[string][]MockResponse
+	requests []ChatRequest
+}
+
+// NewMockProvider 创建 Mock 提供商，fixtureDir 为空时只使用脚本和内置默认夹具
+func NewMockProvider(fixtureDir string) *MockProvider {
+	return &MockProvider{
+		fixtureDir: fixtureDir,
+		scripts:    make(map[string][]MockResponse),
+	}
+}
+
+// WithRecorder 开启录制模式：所有调用转发到 upstream，并将真实响应保存为夹具
+func (p *MockProvider) WithRecorder(upstream Provider) *MockProvider {
+	p.upstream = upstream
+	return p
+}
+
+// Script 为任务标识或提示词哈希预设响应，多个响应按调用顺序依次返回，最后一个重复使用
+func (p *MockProvider) Script(key string, responses ...MockResponse) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scripts[key] = append(p.scripts[key], responses...)
+}
+
+// Requests 返回已收到的请求（用于测试断言）
+func (p *MockProvider) Requests() []ChatRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ChatRequest(nil), p.requests...)
+}
+
+// Name 返回提供商名称
+func (p *MockProvider) Name() string {
+	return ProviderMock
+}
+
+// Chat 非流式对话
+func (p *MockProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	p.record(req)
+
+	if p.upstream != nil {
+		resp, err := p.upstream.Chat(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		p.saveFixture(req, MockResponse{Content: resp.Content, Model: resp.Model, Usage: &resp.Usage, ToolCalls: resp.ToolCalls})
+		return resp, nil
+	}
+
+	mock, err := p.lookup(req)
+	if err != nil {
+		return nil, err
+	}
+	if mock.Error != "" {
+		return nil, errors.New(mock.Error)
+	}
+	return p.buildResponse(req, mock), nil
+}
+
+// ChatStream 流式对话
+func (p *MockProvider) ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*ChatResponse, error) {
+	p.record(req)
+
+	if p.upstream != nil {
+		var chunks []string
+		resp, err := p.upstream.ChatStream(ctx, req, func(segment string, isComplete bool) error {
+			if segment != "" {
+				chunks = append(chunks, segment)
+			}
+			if callback != nil {
+				return callback(segment, isComplete)
+			}
+			return nil
+		})
+		if err != nil {
+			return resp, err
+		}
+		p.saveFixture(req, MockResponse{Content: resp.Content, Chunks: chunks, Model: resp.Model, Usage: &resp.Usage, ToolCalls: resp.ToolCalls})
+		return resp, nil
+	}
+
+	mock, err := p.lookup(req)
+	if err != nil {
+		return nil, err
+	}
+	if mock.Error != "" {
+		return nil, errors.New(mock.Error)
+	}
+
+	result := p.buildResponse(req, mock)
+	chunks := mock.Chunks
+	if len(chunks) == 0 {
+		chunks = splitRunes(result.Content, mockChunkRunes)
+	}
+
+	var sent strings.Builder
+	for _, chunk := range chunks {
+		if err := ctx.Err(); err != nil {
+			result.Content = sent.String()
+			return result, err
+		}
+		sent.WriteString(chunk)
+		if callback != nil {
+			if err := callback(chunk, false); err != nil {
+				result.Content = sent.String()
+				return result, err
+			}
+		}
+	}
+
+	if callback != nil {
+		if err := callback("", true); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// ListModels 列出可用模型
+func (p *MockProvider) ListModels(ctx context.Context) ([]string, error) {
+	if p.upstream != nil {
+		return p.upstream.ListModels(ctx)
+	}
+	return []string{ProviderMock}, nil
+}
+
+// SupportsJSONMode 回放时总是支持，录制时与上游一致
+func (p *MockProvider) SupportsJSONMode() bool {
+	if p.upstream != nil {
+		return supportsJSONMode(p.upstream)
+	}
+	return true
+}
+
+// SupportsTools 回放时总是支持，录制时与上游一致
+func (p *MockProvider) SupportsTools() bool {
+	if p.upstream != nil {
+		return SupportsTools(p.upstream)
+	}
+	return true
+}
+
+// PromptHash 计算消息列表的哈希，用于精确匹配夹具
+func PromptHash(messages []Message) string {
+	h := sha256.New()
+	for _, m := range messages {
+		h.Write([]byte(m.Role))
+		h.Write([]byte{0})
+		h.Write([]byte(m.Content))
+		h.Write([]byte{0})
+		// 工具调用相关字段只在存在时参与计算，保持普通消息的哈希不变
+		for _, call := range m.ToolCalls {
+			h.Write([]byte(call.Function.Name + "(" + call.Function.Arguments + ")"))
+			h.Write([]byte{0})
+		}
+		if m.ToolCallID != "" {
+			h.Write([]byte(m.ToolCallID))
+			h.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// record 记录请求
+func (p *MockProvider) record(req ChatRequest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, req)
+}
+
+// lookup 查找匹配的响应
+func (p *MockProvider) lookup(req ChatRequest) (MockResponse, error) {
+	task := mockTask(req)
+	hash := PromptHash(req.Messages)
+
+	if mock, ok := p.nextScript(hash); ok {
+		return mock, nil
+	}
+	if mock, ok := p.nextScript(task); ok {
+		return mock, nil
+	}
+
+	if p.fixtureDir != "" {
+		for _, path := range []string{
+			filepath.Join(p.fixtureDir, task, hash+".json"),
+			filepath.Join(p.fixtureDir, task+".json"),
+		} {
+			data, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return MockResponse{}, fmt.Errorf("failed to read mock fixture %s: %w", path, err)
+			}
+			return parseMockResponse(path, data)
+		}
+	}
+
+	for _, name := range []string{task, mockDefaultTask} {
+		data, err := mockDefaults.ReadFile("mockdata/" + name + ".json")
+		if err == nil {
+			logger.Debug("使用内置 Mock 夹具", zap.String("task", task), zap.String("hash", hash), zap.String("fixture", name))
+			return parseMockResponse(name, data)
+		}
+	}
+	return MockResponse{}, fmt.Errorf("no mock fixture for task %s (hash %s)", task, hash)
+}
+
+// nextScript 取出预设响应，只剩一个时不再移除
+func (p *MockProvider) nextScript(key string) (MockResponse, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	queue := p.scripts[key]
+	if len(queue) == 0 {
+		return MockResponse{}, false
+	}
+	if len(queue) > 1 {
+		p.scripts[key] = queue[1:]
+	}
+	return queue[0], true
+}
+
+// saveFixture 录制模式下保存夹具，失败只记录日志
+func (p *MockProvider) saveFixture(req ChatRequest, mock MockResponse) {
+	if p.fixtureDir == "" {
+		return
+	}
+	dir := filepath.Join(p.fixtureDir, mockTask(req))
+	path := filepath.Join(dir, PromptHash(req.Messages)+".json")
+
+	data, err := json.MarshalIndent(mock, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		logger.Warn("保存 Mock 夹具失败", zap.String("path", path), zap.Error(err))
+		return
+	}
+	logger.Info("已录制 Mock 夹具", zap.String("path", path))
+}
+
+// buildResponse 组装响应，缺省的模型和用量按请求补全
+func (p *MockProvider) buildResponse(req ChatRequest, mock MockResponse) *ChatResponse {
+	content := mock.Content
+	if content == "" && len(mock.Chunks) > 0 {
+		content = strings.Join(mock.Chunks, "")
+	}
+
+	resp := &ChatResponse{Content: content, Model: mock.Model, Provider: p.Name(), ToolCalls: mock.ToolCalls}
+	if resp.Model == "" {
+		resp.Model = req.Model
+	}
+	if mock.Usage != nil {
+		resp.Usage = *mock.Usage
+	} else {
+		var prompt int
+		for _, m := range req.Messages {
+			prompt += estimateMockTokens(m.Content)
+		}
+		completion := estimateMockTokens(content)
+		resp.Usage = Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+	}
+	return resp
+}
+
+// mockTask 返回请求的任务标识
+func mockTask(req ChatRequest) string {
+	if req.Task == "" {
+		return mockDefaultTask
+	}
+	return req.Task
+}
+
+// parseMockResponse 解析夹具文件
+func parseMockResponse(name string, data []byte) (MockResponse, error) {
+	var mock MockResponse
+	if err := json.Unmarshal(data, &mock); err != nil {
+		return MockResponse{}, fmt.Errorf("invalid mock fixture %s: %w", name, err)
+	}
+	return mock, nil
+}
+
+// estimateMockTokens 按字符数估算 token（约两个字符一个 token）
+func estimateMockTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 1) / 2
+}
+
+// splitRunes 按字符数切分文本
+func splitRunes(text string, size int) []string {
+	runes := []rune(text)
+	chunks := make([]string, 0, len(runes)/size+1)
+	for start := 0; start < len(runes); start += size {
+		end := start + size
+		if end > len(runes) {
+			end = len(runes)
+		}
+		chunks = append(chunks, string(runes[start:end]))
+	}
+	return chunks
+}
@@ -0,0 +1,120 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMockProvider_DefaultFixtures(t *testing.T) {
+	mock := NewMockProvider("")
+
+	chapter, err := NewChapterGenerator(mock, "mock").Generate(context.Background(), ChapterGenerateRequest{Title: "第一章"})
+	if err != nil {
+		t.Fatalf("chapter Generate failed: %v", err)
+	}
+	if chapter.Title == "" || chapter.NextChapterHint == "" {
+		t.Errorf("unexpected chapter: %+v", chapter)
+	}
+
+	storylines, err := NewStorylineGenerator(mock, "mock").Generate(context.Background(), StorylineGenerateRequest{NovelTitle: "测试"})
+	if err != nil {
+		t.Fatalf("storyline Generate failed: %v", err)
+	}
+	if len(storylines.Storylines) == 0 || len(storylines.Storylines[0].Nodes) == 0 {
+		t.Errorf("unexpected storylines: %+v", storylines)
+	}
+
+	requests := mock.Requests()
+	if len(requests) != 2 || requests[0].Task != PromptChapterGenerate || requests[1].Task != PromptStorylineGenerate {
+		t.Errorf("unexpected recorded requests: %+v", requests)
+	}
+}
+
+func TestMockProvider_ScriptByTaskAndHash(t *testing.T) {
+	mock := NewMockProvider("")
+	messages := []Message{{Role: "user", Content: "你好"}}
+
+	mock.Script(TaskChat, MockResponse{Content: "第一次"}, MockResponse{Content: "之后"})
+	mock.Script(PromptHash(messages), MockResponse{Content: "精确匹配", Usage: &Usage{TotalTokens: 42}})
+
+	resp, err := mock.Chat(context.Background(), ChatRequest{Task: TaskChat, Messages: messages})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if resp.Content != "精确匹配" || resp.Usage.TotalTokens != 42 {
+		t.Errorf("expected hash match to win, got %+v", resp)
+	}
+
+	other := []Message{{Role: "user", Content: "别的问题"}}
+	for _, want := range []string{"第一次", "之后", "之后"} {
+		resp, err := mock.Chat(context.Background(), ChatRequest{Task: TaskChat, Messages: other})
+		if err != nil {
+			t.Fatalf("Chat failed: %v", err)
+		}
+		if resp.Content != want {
+			t.Errorf("expected %q, got %q", want, resp.Content)
+		}
+	}
+}
+
+func TestMockProvider_Stream(t *testing.T) {
+	mock := NewMockProvider("")
+	mock.Script(TaskChat, MockResponse{Chunks: []string{"你", "好", "！"}})
+
+	var segments []string
+	var completed bool
+	resp, err := mock.ChatStream(context.Background(), ChatRequest{Task: TaskChat, Model: "mock-model"}, func(segment string, isComplete bool) error {
+		if isComplete {
+			completed = true
+			return nil
+		}
+		segments = append(segments, segment)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	if strings.Join(segments, "|") != "你|好|！" || !completed {
+		t.Errorf("unexpected segments %v (completed=%v)", segments, completed)
+	}
+	if resp.Content != "你好！" || resp.Model != "mock-model" || resp.Usage.CompletionTokens == 0 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestMockProvider_RecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	upstream := &fakeProvider{reply: "真实回复"}
+	req := ChatRequest{Task: PromptChapterSummary, Messages: []Message{{Role: "user", Content: "总结"}}}
+
+	recorder := NewMockProvider(dir).WithRecorder(upstream)
+	if _, err := recorder.Chat(context.Background(), req); err != nil {
+		t.Fatalf("record Chat failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, PromptChapterSummary, PromptHash(req.Messages)+".json")); err != nil {
+		t.Fatalf("fixture not written: %v", err)
+	}
+
+	resp, err := NewMockProvider(dir).Chat(context.Background(), req)
+	if err != nil {
+		t.Fatalf("replay Chat failed: %v", err)
+	}
+	if resp.Content != "真实回复" {
+		t.Errorf("expected recorded reply, got %q", resp.Content)
+	}
+	if len(upstream.requests) != 1 {
+		t.Errorf("replay should not call upstream, got %d calls", len(upstream.requests))
+	}
+}
+
+func TestMockProvider_Error(t *testing.T) {
+	mock := NewMockProvider("")
+	mock.Script(TaskChat, MockResponse{Error: "rate limited"})
+
+	if _, err := mock.Chat(context.Background(), ChatRequest{Task: TaskChat}); err == nil || err.Error() != "rate limited" {
+		t.Errorf("expected scripted error, got %v", err)
+	}
+}
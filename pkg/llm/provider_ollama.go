@@ -0,0 +1,239 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// OllamaProvider 本地 Ollama 提供商
+type OllamaProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewOllamaProvider 创建 Ollama 提供商
+func NewOllamaProvider(baseURL string) *OllamaProvider {
+	return &OllamaProvider{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client: &http.Client{
+			Timeout: 5 * time.Minute,
+		},
+	}
+}
+
+// Name 返回提供商名称
+func (p *OllamaProvider) Name() string {
+	return ProviderOllama
+}
+
+// ollamaChatResponse Ollama /api/chat 响应（流式时为单个分片）
+type ollamaChatResponse struct {
+	Model   string `json:"model"`
+	Message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+// usage 转换为统一的 token 统计
+func (r *ollamaChatResponse) usage() Usage {
+	return Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+// post 发送 /api/chat 请求
+func (p *OllamaProvider) post(ctx context.Context, req ChatRequest, stream bool) (*http.Response, error) {
+	options := map[string]interface{}{}
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+	if req.MaxTokens != nil && *req.MaxTokens > 0 {
+		options["num_predict"] = *req.MaxTokens
+	}
+
+	requestBody := map[string]interface{}{
+		"model":    req.Model,
+		"messages": req.Messages,
+		"stream":   stream,
+		"options":  options,
+	}
+	if req.ResponseSchema != nil {
+		// Ollama 的 format 字段直接接受 JSON Schema
+		requestBody["format"] = req.ResponseSchema
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %v", err)
+	}
+
+	url := p.baseURL + "/api/chat"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	logger.Debug("发送Ollama请求",
+		zap.String("url", url),
+		zap.String("model", req.Model),
+		zap.Bool("stream", stream))
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &ProviderError{
+			Provider:   ProviderOllama,
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			Err:        fmt.Errorf("Ollama API错误 (状态码: %d): %s", resp.StatusCode, string(body)),
+		}
+	}
+	return resp, nil
+}
+
+// SupportsJSONMode 支持通过 format 字段约束输出结构
+func (p *OllamaProvider) SupportsJSONMode() bool {
+	return true
+}
+
+// Chat 非流式对话
+func (p *OllamaProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	resp, err := p.post(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response ollamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("Ollama错误: %s", response.Error)
+	}
+
+	return &ChatResponse{
+		Content:  response.Message.Content,
+		Model:    response.Model,
+		Provider: p.Name(),
+		Usage:    response.usage(),
+	}, nil
+}
+
+// ChatStream 流式对话（Ollama 以换行分隔的 JSON 返回分片）
+func (p *OllamaProvider) ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*ChatResponse, error) {
+	resp, err := p.post(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var fullResponse strings.Builder
+	result := &ChatResponse{Model: req.Model, Provider: p.Name()}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			result.Content = fullResponse.String()
+			return result, fmt.Errorf("解析响应失败: %v", err)
+		}
+		if chunk.Error != "" {
+			result.Content = fullResponse.String()
+			return result, fmt.Errorf("Ollama错误: %s", chunk.Error)
+		}
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+
+		if content := chunk.Message.Content; content != "" {
+			fullResponse.WriteString(content)
+			if callback != nil {
+				if err := callback(content, false); err != nil {
+					result.Content = fullResponse.String()
+					return result, err
+				}
+			}
+		}
+
+		if chunk.Done {
+			result.Usage = chunk.usage()
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		result.Content = fullResponse.String()
+		return result, err
+	}
+
+	result.Content = fullResponse.String()
+	if callback != nil {
+		if err := callback("", true); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// ListModels 列出本地已拉取的模型
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Ollama API错误 (状态码: %d): %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	models := make([]string, 0, len(response.Models))
+	for _, m := range response.Models {
+		models = append(models, m.Name)
+	}
+	return models, nil
+}
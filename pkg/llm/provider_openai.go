@@ -0,0 +1,288 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// OpenAIProvider OpenAI 兼容接口提供商
+type OpenAIProvider struct {
+	client *openai.Client
+}
+
+const (
+	openAIHeaderTimeout = 5 * time.Minute // 等待响应头的最长时间
+	openAIIdleTimeout   = 2 * time.Minute // 读取响应体时等待下一段数据的最长时间，流式响应中途停顿超过该时间时中断
+)
+
+// errStreamIdleTimeout 读取响应体时长时间没有收到数据
+var errStreamIdleTimeout = errors.New("timed out waiting for more response data")
+
+// NewOpenAIProvider 创建 OpenAI 兼容提供商
+func NewOpenAIProvider(apiKey, baseURL string) *OpenAIProvider {
+	return newOpenAIProvider(apiKey, baseURL, openAIIdleTimeout)
+}
+
+// newOpenAIProvider 创建 OpenAI 兼容提供商，idleTimeout 为读取响应体时等待数据的最长时间
+// 不设置 http.Client.Timeout，避免限制正常输出的长流式响应的总时长
+func newOpenAIProvider(apiKey, baseURL string, idleTimeout time.Duration) *OpenAIProvider {
+	cfg := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		cfg.BaseURL = baseURL
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = openAIHeaderTimeout
+	cfg.HTTPClient = &http.Client{Transport: &retryAfterTransport{base: &idleTimeoutTransport{base: transport, idle: idleTimeout}}}
+
+	return &OpenAIProvider{
+		client: openai.NewClientWithConfig(cfg),
+	}
+}
+
+// idleTimeoutTransport 读取响应体时超过 idle 没有数据则中断请求
+type idleTimeoutTransport struct {
+	base http.RoundTripper
+	idle time.Duration
+}
+
+func (t *idleTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	timer := time.AfterFunc(t.idle, func() { cancel(errStreamIdleTimeout) })
+	resp.Body = &idleTimeoutBody{ReadCloser: resp.Body, ctx: ctx, cancel: cancel, timer: timer, idle: t.idle}
+	return resp, nil
+}
+
+// idleTimeoutBody 每次读取时重新计时，读取返回后停止计时，不把调用方处理数据的时间计入
+type idleTimeoutBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	timer  *time.Timer
+	idle   time.Duration
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.idle)
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Stop()
+	if err != nil && errors.Is(context.Cause(b.ctx), errStreamIdleTimeout) {
+		return n, fmt.Errorf("%w: %w", errStreamIdleTimeout, context.DeadlineExceeded)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
+
+// Name 返回提供商名称
+func (p *OpenAIProvider) Name() string {
+	return ProviderOpenAI
+}
+
+// buildRequest 构建 OpenAI 请求
+func (p *OpenAIProvider) buildRequest(req ChatRequest) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = openai.ChatCompletionMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+		}
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Tools:    req.Tools,
+	}
+	if req.Temperature != nil {
+		request.Temperature = *req.Temperature
+	}
+	if req.MaxTokens != nil && *req.MaxTokens > 0 {
+		request.MaxTokens = *req.MaxTokens
+	}
+	// json_schema 在兼容接口中支持不一，统一使用 json_object，由调用方按 Schema 校验
+	if req.ResponseSchema != nil {
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		}
+	}
+	return request
+}
+
+// SupportsJSONMode 支持 response_format=json_object
+func (p *OpenAIProvider) SupportsJSONMode() bool {
+	return true
+}
+
+// SupportsTools 支持 tools 工具调用
+func (p *OpenAIProvider) SupportsTools() bool {
+	return true
+}
+
+// Chat 非流式对话
+func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	ctx, retryAfter := withRetryAfterSlot(ctx)
+	resp, err := p.client.CreateChatCompletion(ctx, p.buildRequest(req))
+	if err != nil {
+		return nil, wrapOpenAIError(err, *retryAfter)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from LLM")
+	}
+
+	return &ChatResponse{
+		Content:   resp.Choices[0].Message.Content,
+		Model:     resp.Model,
+		Provider:  p.Name(),
+		ToolCalls: resp.Choices[0].Message.ToolCalls,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+// ChatStream 流式对话
+func (p *OpenAIProvider) ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*ChatResponse, error) {
+	startTime := time.Now()
+
+	request := p.buildRequest(req)
+	request.Stream = true
+	request.StreamOptions = &openai.StreamOptions{
+		IncludeUsage: true,
+	}
+
+	streamID := fmt.Sprintf("stream-%s", uuid.New().String())
+	logger.Info("Starting chat stream", zap.String("streamID", streamID), zap.String("provider", p.Name()))
+
+	ctx, retryAfter := withRetryAfterSlot(ctx)
+	stream, err := p.client.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		logger.Error("Failed to create chat stream", zap.Error(err))
+		return nil, wrapOpenAIError(err, *retryAfter)
+	}
+	defer stream.Close()
+
+	var fullResponse strings.Builder
+	var toolCalls toolCallAccumulator
+	result := &ChatResponse{Model: req.Model, Provider: p.Name()}
+
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			result.Content = fullResponse.String()
+			return result, err
+		}
+
+		if response.Model != "" {
+			result.Model = response.Model
+		}
+
+		if len(response.Choices) > 0 {
+			toolCalls.add(response.Choices[0].Delta.ToolCalls)
+			content := response.Choices[0].Delta.Content
+			if content != "" {
+				fullResponse.WriteString(content)
+				if callback != nil {
+					if err := callback(content, false); err != nil {
+						logger.Error("Callback error", zap.Error(err))
+						result.Content = fullResponse.String()
+						return result, err
+					}
+				}
+			}
+		}
+
+		// 记录 token 使用情况
+		if response.Usage != nil {
+			result.Usage = Usage{
+				PromptTokens:     response.Usage.PromptTokens,
+				CompletionTokens: response.Usage.CompletionTokens,
+				TotalTokens:      response.Usage.TotalTokens,
+			}
+		}
+	}
+
+	result.Content = fullResponse.String()
+	result.ToolCalls = toolCalls.calls
+
+	logger.Info("Chat stream completed",
+		zap.String("streamID", streamID),
+		zap.Duration("duration", time.Since(startTime)),
+		zap.Int("totalTokens", result.Usage.TotalTokens))
+
+	if callback != nil {
+		if err := callback("", true); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// ListModels 列出可用模型
+func (p *OpenAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	list, err := p.client.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(list.Models))
+	for _, m := range list.Models {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// toolCallAccumulator 合并流式响应中按 Index 分片下发的工具调用
+type toolCallAccumulator struct {
+	calls []openai.ToolCall
+}
+
+// add 合并一个分片：首个分片带 ID 和函数名，后续分片追加参数；
+// 不带 Index 的分片有 ID 时作为新的调用，否则追加到最后一个调用
+func (a *toolCallAccumulator) add(deltas []openai.ToolCall) {
+	for _, delta := range deltas {
+		index := len(a.calls)
+		if delta.Index != nil {
+			index = *delta.Index
+		} else if delta.ID == "" && index > 0 {
+			index--
+		}
+		for len(a.calls) <= index {
+			a.calls = append(a.calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+		call := &a.calls[index]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+}
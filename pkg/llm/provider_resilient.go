@@ -0,0 +1,262 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/circuitbreaker"
+	"github.com/LingByte/LingDialog/pkg/config"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// BreakerRegistry LLM 调用熔断器注册表，按“llm:提供商:模型”命名，同一进程内的所有调用共享状态
+var BreakerRegistry = circuitbreaker.NewRegistry()
+
+// errFirstChunkTimeout 流式调用等待首个分片超时
+var errFirstChunkTimeout = errors.New("timed out waiting for the first stream chunk")
+
+// ResilienceOptions 熔断、重试与备用提供商配置
+type ResilienceOptions struct {
+	CallTimeout   time.Duration               // 单次调用超时，流式调用为等待首个分片的时间；<=0 不限制
+	Retry         *circuitbreaker.RetryConfig // 重试配置，为空时使用 DefaultLLMRetryConfig
+	MaxFailures   int64                       // 连续失败多少次后熔断
+	OpenTimeout   time.Duration               // 熔断后多久进入半开状态
+	Registry      *circuitbreaker.Registry    // 熔断器注册表，为空时使用 BreakerRegistry
+	Fallback      Provider                    // 主提供商熔断或重试耗尽时使用的备用提供商，可为空
+	FallbackModel string                      // 备用提供商使用的模型，为空时沿用请求中的模型
+}
+
+// DefaultLLMRetryConfig 默认重试配置：仅重试临时错误，优先使用服务端的 Retry-After
+func DefaultLLMRetryConfig() *circuitbreaker.RetryConfig {
+	return circuitbreaker.DefaultRetryConfig().
+		WithInitialInterval(500 * time.Millisecond).
+		WithMaxInterval(10 * time.Second).
+		WithRetryableErrors(IsTransientError).
+		WithRetryAfter(RetryAfterOf)
+}
+
+// ResilientProvider 为每次调用添加熔断、重试和备用提供商
+// 只有临时错误（429、5xx、超时、网络错误）会重试并计入熔断；流式调用已输出内容后不再重试或切换
+type ResilientProvider struct {
+	primary Provider
+	opts    ResilienceOptions
+}
+
+// NewResilientProvider 包装提供商
+func NewResilientProvider(primary Provider, opts ResilienceOptions) *ResilientProvider {
+	if opts.Retry == nil {
+		opts.Retry = DefaultLLMRetryConfig()
+	}
+	if opts.Registry == nil {
+		opts.Registry = BreakerRegistry
+	}
+	return &ResilientProvider{primary: primary, opts: opts}
+}
+
+// ResilienceOptionsFromConfig 根据全局配置生成熔断、重试和备用提供商设置
+func ResilienceOptionsFromConfig() ResilienceOptions {
+	cfg := config.GlobalConfig
+	opts := ResilienceOptions{
+		CallTimeout: time.Duration(cfg.LLMCallTimeout) * time.Second,
+		Retry:       DefaultLLMRetryConfig().WithMaxAttempts(cfg.LLMRetryMaxAttempts),
+		MaxFailures: int64(cfg.LLMBreakerMaxFailures),
+		OpenTimeout: time.Duration(cfg.LLMBreakerOpenTimeout) * time.Second,
+	}
+
+	if cfg.LLMFallbackProvider != "" {
+		baseURL, model := cfg.LLMFallbackBaseURL, cfg.LLMFallbackModel
+		if cfg.LLMFallbackProvider == ProviderOllama {
+			if baseURL == "" {
+				baseURL = cfg.OllamaBaseURL
+			}
+			if model == "" {
+				model = cfg.OllamaModel
+			}
+		}
+		fallback, err := NewProvider(ProviderConfig{
+			Provider: cfg.LLMFallbackProvider,
+			APIKey:   cfg.LLMFallbackAPIKey,
+			BaseURL:  baseURL,
+		})
+		if err != nil {
+			logger.Warn("备用 LLM 提供商配置无效，已忽略", zap.Error(err))
+		} else {
+			opts.Fallback, opts.FallbackModel = fallback, model
+		}
+	}
+	return opts
+}
+
+// Unwrap 返回主提供商
+func (p *ResilientProvider) Unwrap() Provider {
+	return p.primary
+}
+
+// Name 返回主提供商名称
+func (p *ResilientProvider) Name() string {
+	return p.primary.Name()
+}
+
+// SupportsJSONMode 与主提供商一致
+func (p *ResilientProvider) SupportsJSONMode() bool {
+	return supportsJSONMode(p.primary)
+}
+
+// SupportsTools 与主提供商一致
+func (p *ResilientProvider) SupportsTools() bool {
+	return SupportsTools(p.primary)
+}
+
+// ListModels 列出主提供商的可用模型
+func (p *ResilientProvider) ListModels(ctx context.Context) ([]string, error) {
+	return p.primary.ListModels(ctx)
+}
+
+// Chat 非流式对话
+func (p *ResilientProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	var resp *ChatResponse
+	err := p.run(ctx, req, func(ctx context.Context, target Provider, req ChatRequest) error {
+		attemptCtx, cancel := p.attemptContext(ctx)
+		defer cancel()
+
+		r, err := target.Chat(attemptCtx, req)
+		resp = r
+		return err
+	}, func() bool { return false })
+	return resp, err
+}
+
+// ChatStream 流式对话，首个分片到达前的失败可以重试或切换到备用提供商
+func (p *ResilientProvider) ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*ChatResponse, error) {
+	var resp *ChatResponse
+	emitted := false
+	err := p.run(ctx, req, func(ctx context.Context, target Provider, req ChatRequest) error {
+		attemptCtx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+
+		var timer *time.Timer
+		if p.opts.CallTimeout > 0 {
+			timer = time.AfterFunc(p.opts.CallTimeout, func() { cancel(errFirstChunkTimeout) })
+			defer timer.Stop()
+		}
+
+		r, err := target.ChatStream(attemptCtx, req, func(segment string, isComplete bool) error {
+			if segment != "" && !emitted {
+				emitted = true
+				if timer != nil {
+					timer.Stop()
+				}
+			}
+			if callback != nil {
+				return callback(segment, isComplete)
+			}
+			return nil
+		})
+		resp = r
+		if err != nil && errors.Is(context.Cause(attemptCtx), errFirstChunkTimeout) {
+			return fmt.Errorf("%w: %w", errFirstChunkTimeout, context.DeadlineExceeded)
+		}
+		return err
+	}, func() bool { return emitted })
+	return resp, err
+}
+
+// attemptContext 为单次非流式调用设置超时
+func (p *ResilientProvider) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.opts.CallTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.opts.CallTimeout)
+}
+
+// callFunc 对指定提供商发起一次调用
+type callFunc func(ctx context.Context, target Provider, req ChatRequest) error
+
+// run 通过主提供商的熔断器和重试执行调用，失败时按条件切换到备用提供商
+func (p *ResilientProvider) run(ctx context.Context, req ChatRequest, call callFunc, streamed func() bool) error {
+	return p.execute(ctx, p.primary, req, call, streamed, func(cause error) error {
+		if p.opts.Fallback == nil || streamed() || ctx.Err() != nil ||
+			!(errors.Is(cause, circuitbreaker.ErrCircuitOpen) || IsTransientError(cause)) {
+			return cause
+		}
+
+		fallbackReq := req
+		if p.opts.FallbackModel != "" {
+			fallbackReq.Model = p.opts.FallbackModel
+		}
+		logger.Warn("主 LLM 提供商不可用，切换到备用提供商",
+			zap.String("task", req.Task),
+			zap.String("primary", p.primary.Name()),
+			zap.String("fallback", p.opts.Fallback.Name()),
+			zap.String("model", fallbackReq.Model),
+			zap.Error(cause))
+
+		if err := p.execute(ctx, p.opts.Fallback, fallbackReq, call, streamed, nil); err != nil {
+			return fmt.Errorf("备用提供商调用失败: %w（主提供商: %v）", err, cause)
+		}
+		return nil
+	})
+}
+
+// execute 在熔断器保护下重试调用
+// 非临时错误和已输出内容后的错误直接返回，不重试、不计入熔断
+func (p *ResilientProvider) execute(ctx context.Context, target Provider, req ChatRequest, call callFunc, streamed func() bool, fallback func(error) error) error {
+	breaker := p.breaker(target.Name(), req.Model)
+
+	var permanent error
+	err := circuitbreaker.RetryWithCircuitBreakerContext(ctx, breaker, func() error {
+		permanent = nil
+		err := call(ctx, target, req)
+		if err != nil && (!IsTransientError(err) || streamed()) {
+			permanent = err
+			return nil
+		}
+		if err != nil {
+			logger.Warn("LLM 调用失败",
+				zap.String("breaker", breaker.Name()),
+				zap.String("task", req.Task),
+				zap.Duration("retryAfter", RetryAfterOf(err)),
+				zap.Error(err))
+		}
+		return err
+	}, p.opts.Retry, fallback)
+
+	if err == nil {
+		return permanent
+	}
+	if err == circuitbreaker.ErrCircuitOpen {
+		return fmt.Errorf("LLM 服务 %s 暂时不可用，请稍后重试: %w", breaker.Name(), err)
+	}
+	return err
+}
+
+// breaker 获取提供商和模型对应的熔断器
+func (p *ResilientProvider) breaker(provider, model string) *circuitbreaker.CircuitBreaker {
+	name := BreakerName(provider, model)
+	if cb := p.opts.Registry.Get(name); cb != nil {
+		return cb
+	}
+
+	cfg := circuitbreaker.DefaultConfig(name)
+	if p.opts.MaxFailures > 0 {
+		cfg.MaxFailures = p.opts.MaxFailures
+	}
+	if p.opts.OpenTimeout > 0 {
+		cfg.Timeout = p.opts.OpenTimeout
+	}
+	cfg.OnStateChange = func(name string, from, to circuitbreaker.State) {
+		logger.Warn("LLM 熔断器状态变化",
+			zap.String("breaker", name),
+			zap.String("from", from.String()),
+			zap.String("to", to.String()))
+	}
+	return p.opts.Registry.GetOrCreate(name, cfg)
+}
+
+// BreakerName 返回提供商和模型对应的熔断器名称
+func BreakerName(provider, model string) string {
+	return fmt.Sprintf("llm:%s:%s", provider, model)
+}
@@ -0,0 +1,186 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/circuitbreaker"
+)
+
+// flakyProvider 前 failures 次调用返回指定状态码的错误，之后返回 reply
+type flakyProvider struct {
+	fakeProvider
+	name     string
+	status   int
+	failures int
+	calls    int
+}
+
+func (p *flakyProvider) Name() string { return p.name }
+
+func (p *flakyProvider) fail() error {
+	p.calls++
+	if p.calls <= p.failures {
+		return &ProviderError{Provider: p.name, StatusCode: p.status, Err: fmt.Errorf("status %d", p.status)}
+	}
+	return nil
+}
+
+func (p *flakyProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	if err := p.fail(); err != nil {
+		return nil, err
+	}
+	return p.fakeProvider.Chat(ctx, req)
+}
+
+func (p *flakyProvider) ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*ChatResponse, error) {
+	if err := p.fail(); err != nil {
+		return nil, err
+	}
+	return p.fakeProvider.ChatStream(ctx, req, callback)
+}
+
+func testResilienceOptions() ResilienceOptions {
+	return ResilienceOptions{
+		Retry:       DefaultLLMRetryConfig().WithMaxAttempts(3).WithInitialInterval(time.Millisecond).WithMaxInterval(time.Millisecond),
+		MaxFailures: 3,
+		OpenTimeout: time.Minute,
+		Registry:    circuitbreaker.NewRegistry(),
+	}
+}
+
+func TestResilientProvider_RetriesTransientErrors(t *testing.T) {
+	primary := &flakyProvider{fakeProvider: fakeProvider{reply: "好"}, name: "primary", status: http.StatusServiceUnavailable, failures: 2}
+	opts := testResilienceOptions()
+	p := NewResilientProvider(primary, opts)
+
+	resp, err := p.Chat(context.Background(), ChatRequest{Model: "m"})
+	if err != nil || resp.Content != "好" || primary.calls != 3 {
+		t.Fatalf("expected success after 2 retries: %+v, %v, calls=%d", resp, err, primary.calls)
+	}
+	if cb := opts.Registry.Get(BreakerName("primary", "m")); cb == nil || !cb.IsClosed() {
+		t.Error("breaker should exist and stay closed")
+	}
+}
+
+func TestResilientProvider_PermanentErrorNotRetried(t *testing.T) {
+	primary := &flakyProvider{name: "primary", status: http.StatusBadRequest, failures: 10}
+	opts := testResilienceOptions()
+	p := NewResilientProvider(primary, opts)
+
+	for i := 0; i < 5; i++ {
+		_, err := p.Chat(context.Background(), ChatRequest{Model: "m"})
+		var providerErr *ProviderError
+		if !errors.As(err, &providerErr) || providerErr.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected the 400 error to be returned, got %v", err)
+		}
+	}
+	if primary.calls != 5 {
+		t.Errorf("400 should not be retried, calls=%d", primary.calls)
+	}
+	if cb := opts.Registry.Get(BreakerName("primary", "m")); !cb.IsClosed() {
+		t.Error("permanent errors should not open the breaker")
+	}
+}
+
+func TestResilientProvider_FallbackWhenOpen(t *testing.T) {
+	primary := &flakyProvider{name: "primary", status: http.StatusTooManyRequests, failures: 100}
+	fallback := &flakyProvider{fakeProvider: fakeProvider{reply: "本地"}, name: ProviderOllama}
+	opts := testResilienceOptions()
+	opts.Fallback, opts.FallbackModel = fallback, "qwen2:7b"
+	p := NewResilientProvider(primary, opts)
+
+	resp, err := p.Chat(context.Background(), ChatRequest{Model: "gpt-4o"})
+	if err != nil || resp.Content != "本地" {
+		t.Fatalf("expected fallback response: %+v, %v", resp, err)
+	}
+	if fallback.requests[0].Model != "qwen2:7b" {
+		t.Errorf("fallback should use its own model, got %s", fallback.requests[0].Model)
+	}
+	if cb := opts.Registry.Get(BreakerName("primary", "gpt-4o")); !cb.IsOpen() {
+		t.Fatal("primary breaker should be open after 3 transient failures")
+	}
+
+	// 熔断期间不再调用主提供商
+	calls := primary.calls
+	if _, err := p.Chat(context.Background(), ChatRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatalf("expected fallback response while open: %v", err)
+	}
+	if primary.calls != calls {
+		t.Errorf("primary should not be called while its breaker is open")
+	}
+}
+
+func TestResilientProvider_OpenWithoutFallback(t *testing.T) {
+	primary := &flakyProvider{name: "primary", status: http.StatusInternalServerError, failures: 100}
+	opts := testResilienceOptions()
+	p := NewResilientProvider(primary, opts)
+
+	p.Chat(context.Background(), ChatRequest{Model: "m"})
+	_, err := p.Chat(context.Background(), ChatRequest{Model: "m"})
+	if !errors.Is(err, circuitbreaker.ErrCircuitOpen) {
+		t.Fatalf("expected circuit open error, got %v", err)
+	}
+}
+
+// partialStreamProvider 输出部分内容后返回临时错误
+type partialStreamProvider struct {
+	fakeProvider
+	calls int
+}
+
+func (p *partialStreamProvider) ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*ChatResponse, error) {
+	p.calls++
+	callback("一半", false)
+	return nil, &ProviderError{Provider: "fake", StatusCode: http.StatusBadGateway, Err: errors.New("stream broken")}
+}
+
+func TestResilientProvider_StreamNotRetriedAfterOutput(t *testing.T) {
+	primary := &partialStreamProvider{}
+	fallback := &flakyProvider{fakeProvider: fakeProvider{reply: "备用"}, name: "fallback"}
+	opts := testResilienceOptions()
+	opts.Fallback = fallback
+	p := NewResilientProvider(primary, opts)
+
+	var received string
+	_, err := p.ChatStream(context.Background(), ChatRequest{Model: "m"}, func(segment string, isComplete bool) error {
+		received += segment
+		return nil
+	})
+	if err == nil || primary.calls != 1 || fallback.calls != 0 {
+		t.Fatalf("stream should fail without retry or fallback: err=%v calls=%d fallback=%d", err, primary.calls, fallback.calls)
+	}
+	if received != "一半" {
+		t.Errorf("unexpected output %q", received)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&ProviderError{StatusCode: 429}, true},
+		{&ProviderError{StatusCode: 503}, true},
+		{&ProviderError{StatusCode: 401}, false},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), true},
+		{context.Canceled, false},
+		{errors.New("bad json"), false},
+	}
+	for _, c := range cases {
+		if got := IsTransientError(c.err); got != c.want {
+			t.Errorf("IsTransientError(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+
+	if d := parseRetryAfter("3"); d != 3*time.Second {
+		t.Errorf("unexpected retry-after %v", d)
+	}
+	if d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); d <= 0 || d > time.Minute {
+		t.Errorf("unexpected retry-after for HTTP date %v", d)
+	}
+}
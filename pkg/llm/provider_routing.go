@@ -0,0 +1,234 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/LingByte/LingDialog/pkg/config"
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// RouteWildcard 匹配所有未单独配置的任务
+const RouteWildcard = "*"
+
+// ModelRoute 单个任务的模型路由，字段为空时沿用生成器的默认值
+type ModelRoute struct {
+	Provider    string   `json:"provider,omitempty"`    // 提供商（openai / ollama / mock），为空时使用默认提供商
+	Model       string   `json:"model,omitempty"`       // 模型名称
+	Temperature *float32 `json:"temperature,omitempty"` // 温度
+	MaxTokens   *int     `json:"maxTokens,omitempty"`   // 最大输出 token
+}
+
+// Validate 校验路由配置
+func (r ModelRoute) Validate() error {
+	switch r.Provider {
+	case "", ProviderOpenAI, ProviderOllama, ProviderMock:
+	default:
+		return fmt.Errorf("unsupported provider: %s", r.Provider)
+	}
+	if r.Provider != "" && r.Model == "" {
+		// 不同提供商的模型名称不通用，切换提供商时必须指定模型
+		return fmt.Errorf("model is required when provider is set")
+	}
+	if r.Temperature != nil && (*r.Temperature < 0 || *r.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if r.MaxTokens != nil && *r.MaxTokens <= 0 {
+		return fmt.Errorf("maxTokens must be positive")
+	}
+	return nil
+}
+
+// ModelRoutes 任务到模型路由的映射
+// 键为任务标识（如 chapter.summary）、任务分组（如 chapter）或通配符 *
+type ModelRoutes map[string]ModelRoute
+
+// Resolve 查找任务适用的路由：先精确匹配，再按点号逐级匹配分组，最后使用通配符
+func (routes ModelRoutes) Resolve(task string) (ModelRoute, bool) {
+	for key := task; key != ""; {
+		if route, ok := routes[key]; ok {
+			return route, true
+		}
+		dot := strings.LastIndexByte(key, '.')
+		if dot < 0 {
+			break
+		}
+		key = key[:dot]
+	}
+	route, ok := routes[RouteWildcard]
+	return route, ok
+}
+
+// Validate 校验所有路由
+func (routes ModelRoutes) Validate() error {
+	for task, route := range routes {
+		if strings.TrimSpace(task) == "" {
+			return fmt.Errorf("task name is required")
+		}
+		if err := route.Validate(); err != nil {
+			return fmt.Errorf("route %s: %w", task, err)
+		}
+	}
+	return nil
+}
+
+// RoutableTasks 返回可配置路由的任务标识（已排序），不含只作为系统提示词使用的模板
+func RoutableTasks() []string {
+	tasks := []string{
+		TaskChat,
+		TaskCharacterGenerate,
+		TaskCharacterEnhance,
+		TaskCharacterRelationships,
+		TaskPlotGenerate,
+		TaskPlotEnhance,
+		TaskText,
+	}
+	for _, name := range DefaultPromptNames() {
+		if strings.HasSuffix(name, ".system") || name == PromptStructuredRepair {
+			continue
+		}
+		tasks = append(tasks, name)
+	}
+	sort.Strings(tasks)
+	return tasks
+}
+
+// ProviderFactory 按名称创建提供商
+type ProviderFactory func(name string) (Provider, error)
+
+// RoutingProvider 按请求的任务标识改写模型和采样参数，并转发到路由指定的提供商
+// 路由表每次调用时通过 load 读取，修改后无需重启；其他提供商在首次使用时创建并复用
+type RoutingProvider struct {
+	primary Provider
+	load    func() ModelRoutes
+	factory ProviderFactory
+
+	mu        sync.Mutex
+	providers map[string]Provider
+}
+
+// NewRoutingProvider 包装默认提供商，load 返回当前路由表，factory 用于创建路由到的其他提供商
+func NewRoutingProvider(primary Provider, load func() ModelRoutes, factory ProviderFactory) *RoutingProvider {
+	return &RoutingProvider{
+		primary:   primary,
+		load:      load,
+		factory:   factory,
+		providers: make(map[string]Provider),
+	}
+}
+
+// Unwrap 返回默认提供商
+func (p *RoutingProvider) Unwrap() Provider {
+	return p.primary
+}
+
+// Name 返回默认提供商的名称
+func (p *RoutingProvider) Name() string {
+	return p.primary.Name()
+}
+
+// SupportsJSONMode 与默认提供商一致，路由到不支持的提供商时请求中的输出约束会被去掉
+func (p *RoutingProvider) SupportsJSONMode() bool {
+	return supportsJSONMode(p.primary)
+}
+
+// SupportsTools 与默认提供商一致，路由到不支持的提供商时请求中的工具会被去掉
+func (p *RoutingProvider) SupportsTools() bool {
+	return SupportsTools(p.primary)
+}
+
+// ListModels 列出默认提供商的可用模型
+func (p *RoutingProvider) ListModels(ctx context.Context) ([]string, error) {
+	return p.primary.ListModels(ctx)
+}
+
+// Chat 非流式对话
+func (p *RoutingProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	target, req := p.route(req)
+	return target.Chat(ctx, req)
+}
+
+// ChatStream 流式对话
+func (p *RoutingProvider) ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*ChatResponse, error) {
+	target, req := p.route(req)
+	return target.ChatStream(ctx, req, callback)
+}
+
+// route 根据路由表改写请求，返回处理该请求的提供商
+func (p *RoutingProvider) route(req ChatRequest) (Provider, ChatRequest) {
+	route, ok := p.load().Resolve(req.Task)
+	if !ok {
+		return p.primary, req
+	}
+
+	target := p.primary
+	if route.Provider != "" && route.Provider != p.primary.Name() {
+		provider, err := p.provider(route.Provider)
+		if err != nil {
+			logger.Warn("路由的 LLM 提供商不可用，使用默认提供商",
+				zap.String("task", req.Task),
+				zap.String("provider", route.Provider),
+				zap.Error(err))
+			return p.primary, req
+		}
+		target = provider
+	}
+
+	if route.Model != "" {
+		req.Model = route.Model
+	}
+	if route.Temperature != nil {
+		req.Temperature = Float32Ptr(*route.Temperature)
+	}
+	if route.MaxTokens != nil {
+		req.MaxTokens = IntPtr(*route.MaxTokens)
+	}
+	if req.ResponseSchema != nil && !supportsJSONMode(target) {
+		req.ResponseSchema = nil
+	}
+	if req.Tools != nil && !SupportsTools(target) {
+		req.Tools = nil
+	}
+	return target, req
+}
+
+// provider 获取路由到的提供商，首次使用时创建
+func (p *RoutingProvider) provider(name string) (Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if provider, ok := p.providers[name]; ok {
+		return provider, nil
+	}
+	if p.factory == nil {
+		return nil, fmt.Errorf("no provider factory configured")
+	}
+	provider, err := p.factory(name)
+	if err != nil {
+		return nil, err
+	}
+	p.providers[name] = provider
+	return provider, nil
+}
+
+// NewProviderByName 根据全局配置创建指定名称的提供商，用于模型路由
+// OpenAI 与 Ollama 使用各自的连接配置并添加熔断和重试，mock 使用配置的夹具目录
+func NewProviderByName(name string) (Provider, error) {
+	cfg := config.GlobalConfig
+	switch name {
+	case ProviderMock:
+		return NewMockProvider(cfg.LLMMockFixtureDir), nil
+	case ProviderOllama:
+		return NewResilientProvider(NewOllamaProvider(cfg.OllamaBaseURL), ResilienceOptionsFromConfig()), nil
+	case ProviderOpenAI:
+		if cfg.LLMApiKey == "" {
+			return nil, fmt.Errorf("LLM_API_KEY is not configured")
+		}
+		return NewResilientProvider(NewOpenAIProvider(cfg.LLMApiKey, cfg.LLMBaseURL), ResilienceOptionsFromConfig()), nil
+	default:
+		return nil, fmt.Errorf("unsupported llm provider: %s", name)
+	}
+}
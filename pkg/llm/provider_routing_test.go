@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestModelRoutes_Resolve(t *testing.T) {
+	routes := ModelRoutes{
+		"chapter":         {Model: "strong"},
+		"chapter.summary": {Model: "cheap"},
+		RouteWildcard:     {Model: "default"},
+	}
+	cases := map[string]string{
+		PromptChapterSummary:  "cheap",
+		PromptChapterGenerate: "strong",
+		PromptStyleAnalyze:    "default",
+		TaskChat:              "default",
+	}
+	for task, want := range cases {
+		route, ok := routes.Resolve(task)
+		if !ok || route.Model != want {
+			t.Errorf("%s: got %q (%v), want %q", task, route.Model, ok, want)
+		}
+	}
+
+	delete(routes, RouteWildcard)
+	if _, ok := routes.Resolve(TaskChat); ok {
+		t.Error("chat should not match without a wildcard route")
+	}
+}
+
+func TestModelRoutes_Validate(t *testing.T) {
+	invalid := []ModelRoute{
+		{Provider: "unknown", Model: "m"},
+		{Provider: ProviderOllama},
+		{Temperature: Float32Ptr(3)},
+		{MaxTokens: IntPtr(0)},
+	}
+	for _, route := range invalid {
+		if err := (ModelRoutes{"chat": route}).Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", route)
+		}
+	}
+	if err := (ModelRoutes{"chat": {Provider: ProviderOllama, Model: "qwen2", Temperature: Float32Ptr(0.2)}}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRoutingProvider(t *testing.T) {
+	primary := &fakeProvider{reply: "primary"}
+	routed := &fakeProvider{reply: "routed"}
+	routes := ModelRoutes{
+		PromptChapterSummary:  {Model: "cheap", Temperature: Float32Ptr(0.1), MaxTokens: IntPtr(200)},
+		PromptChapterGenerate: {Provider: ProviderOllama, Model: "qwen2"},
+	}
+	created := 0
+	provider := NewRoutingProvider(primary, func() ModelRoutes { return routes }, func(name string) (Provider, error) {
+		created++
+		return routed, nil
+	})
+	ctx := context.Background()
+
+	resp, err := provider.Chat(ctx, ChatRequest{Task: PromptChapterSummary, Model: "base", Temperature: Float32Ptr(0.5)})
+	if err != nil || resp.Content != "primary" {
+		t.Fatalf("summary should stay on the primary provider: %v, %v", resp, err)
+	}
+	req := primary.requests[0]
+	if req.Model != "cheap" || *req.Temperature != 0.1 || *req.MaxTokens != 200 {
+		t.Errorf("summary request not rewritten: %+v", req)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err = provider.ChatStream(ctx, ChatRequest{Task: PromptChapterGenerate, Model: "base"}, func(string, bool) error { return nil })
+		if err != nil || resp.Content != "routed" || resp.Model != "qwen2" {
+			t.Fatalf("generate should be routed: %v, %v", resp, err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("routed provider should be created once, got %d", created)
+	}
+
+	if _, err = provider.Chat(ctx, ChatRequest{Task: TaskChat, Model: "base"}); err != nil {
+		t.Fatal(err)
+	}
+	if last := primary.requests[len(primary.requests)-1]; last.Model != "base" || last.Temperature != nil {
+		t.Errorf("unrouted task should pass through unchanged: %+v", last)
+	}
+}
@@ -0,0 +1,278 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"go.uber.org/zap"
+)
+
+func init() {
+	if logger.Lg == nil {
+		logger.Lg = zap.NewNop()
+	}
+}
+
+// fakeProvider 用于测试的假提供商
+type fakeProvider struct {
+	reply    string
+	requests []ChatRequest
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	p.requests = append(p.requests, req)
+	return &ChatResponse{Content: p.reply, Model: req.Model, Usage: Usage{TotalTokens: 3}}, nil
+}
+
+func (p *fakeProvider) ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*ChatResponse, error) {
+	p.requests = append(p.requests, req)
+	for _, r := range p.reply {
+		if err := callback(string(r), false); err != nil {
+			return nil, err
+		}
+	}
+	if err := callback("", true); err != nil {
+		return nil, err
+	}
+	return &ChatResponse{Content: p.reply, Model: req.Model}, nil
+}
+
+func (p *fakeProvider) ListModels(ctx context.Context) ([]string, error) {
+	return []string{"fake-model"}, nil
+}
+
+func TestNewProvider(t *testing.T) {
+	p, err := NewProvider(ProviderConfig{Provider: ProviderOllama, BaseURL: "http://localhost:11434"})
+	if err != nil || p.Name() != ProviderOllama {
+		t.Fatalf("expected ollama provider, got %v, %v", p, err)
+	}
+
+	p, err = NewProvider(ProviderConfig{APIKey: "ak"})
+	if err != nil || p.Name() != ProviderOpenAI {
+		t.Fatalf("expected openai provider by default, got %v, %v", p, err)
+	}
+
+	if _, err := NewProvider(ProviderConfig{Provider: "unknown"}); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+}
+
+func TestOpenAIProvider_Chat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["model"] != "test-model" {
+			t.Errorf("unexpected model: %v", body["model"])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"model":"test-model","choices":[{"message":{"role":"assistant","content":"你好"}}],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`)
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("ak", server.URL)
+	resp, err := p.Chat(context.Background(), ChatRequest{
+		Model:    "test-model",
+		Messages: []Message{{Role: "user", Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if resp.Content != "你好" {
+		t.Errorf("unexpected content: %s", resp.Content)
+	}
+	if resp.Usage.TotalTokens != 7 || resp.Usage.PromptTokens != 5 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestOpenAIProvider_ChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"你\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"好\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":2,\"total_tokens\":5}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("ak", server.URL)
+	var segments []string
+	completed := false
+	resp, err := p.ChatStream(context.Background(), ChatRequest{Model: "m"}, func(segment string, isComplete bool) error {
+		if isComplete {
+			completed = true
+			return nil
+		}
+		segments = append(segments, segment)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	if resp.Content != "你好" || len(segments) != 2 || !completed {
+		t.Errorf("unexpected stream result: %q %v %v", resp.Content, segments, completed)
+	}
+	if resp.Usage.TotalTokens != 5 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestOpenAIProvider_ChatStreamToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// 部分兼容接口的分片不带 index，后续参数分片也不带 id
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"get_chapter\",\"arguments\":\"{\\\"chap\"}}]}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"function\":{\"arguments\":\"ter\\\":1}\"}}]}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"id\":\"call_2\",\"type\":\"function\",\"function\":{\"name\":\"list_characters\",\"arguments\":\"{}\"}}]}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("ak", server.URL)
+	resp, err := p.ChatStream(context.Background(), ChatRequest{Model: "m"}, nil)
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	if len(resp.ToolCalls) != 2 {
+		t.Fatalf("unexpected tool calls: %+v", resp.ToolCalls)
+	}
+	if call := resp.ToolCalls[0]; call.ID != "call_1" || call.Function.Name != "get_chapter" || call.Function.Arguments != `{"chapter":1}` {
+		t.Errorf("unexpected first call: %+v", call)
+	}
+	if call := resp.ToolCalls[1]; call.ID != "call_2" || call.Function.Name != "list_characters" {
+		t.Errorf("unexpected second call: %+v", call)
+	}
+}
+
+func TestOpenAIProvider_ChatStreamIdleTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"你\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		// 输出首个分片后停顿
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	p := newOpenAIProvider("ak", server.URL, 50*time.Millisecond)
+	var segments []string
+	resp, err := p.ChatStream(context.Background(), ChatRequest{Model: "m"}, func(segment string, isComplete bool) error {
+		segments = append(segments, segment)
+		return nil
+	})
+	if !errors.Is(err, errStreamIdleTimeout) || !IsTransientError(err) {
+		t.Fatalf("expected a transient idle timeout, got %v", err)
+	}
+	if resp == nil || resp.Content != "你" || len(segments) != 1 {
+		t.Errorf("partial content should be returned: %+v %v", resp, segments)
+	}
+}
+
+func TestOllamaProvider_Chat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		var body struct {
+			Model    string    `json:"model"`
+			Messages []Message `json:"messages"`
+			Stream   bool      `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Stream || len(body.Messages) != 2 || body.Messages[0].Role != "system" {
+			t.Errorf("unexpected request body: %+v", body)
+		}
+		fmt.Fprint(w, `{"model":"llama2","message":{"role":"assistant","content":"ok"},"done":true,"prompt_eval_count":4,"eval_count":1}`)
+	}))
+	defer server.Close()
+
+	p := NewOllamaProvider(server.URL + "/")
+	resp, err := p.Chat(context.Background(), ChatRequest{
+		Model: "llama2",
+		Messages: []Message{
+			{Role: "system", Content: "sys"},
+			{Role: "user", Content: "hi"},
+		},
+		Temperature: Float32Ptr(0.2),
+	})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if resp.Content != "ok" || resp.Usage.TotalTokens != 5 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestOllamaProvider_ChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"message":{"content":"a"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"content":"b"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"content":""},"done":true,"prompt_eval_count":2,"eval_count":2}`)
+	}))
+	defer server.Close()
+
+	p := NewOllamaProvider(server.URL)
+	var got strings.Builder
+	resp, err := p.ChatStream(context.Background(), ChatRequest{Model: "llama2"}, func(segment string, isComplete bool) error {
+		got.WriteString(segment)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	if resp.Content != "ab" || got.String() != "ab" || resp.Usage.TotalTokens != 4 {
+		t.Errorf("unexpected stream response: %+v", resp)
+	}
+}
+
+func TestOllamaProvider_ListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"models":[{"name":"llama2"},{"name":"qwen2"}]}`)
+	}))
+	defer server.Close()
+
+	models, err := NewOllamaProvider(server.URL).ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models) != 2 || models[1] != "qwen2" {
+		t.Errorf("unexpected models: %v", models)
+	}
+}
+
+func TestGenerator_UsesInjectedProvider(t *testing.T) {
+	fake := &fakeProvider{reply: `{"name":"李四","description":"增强后的描述","status":"unknown"}`}
+	g := NewCharacterGenerator(fake, "fake-model")
+
+	result, err := g.EnhanceDescription(context.Background(), CharacterProfile{Name: "张三", Description: "一个普通人"})
+	if err != nil {
+		t.Fatalf("EnhanceDescription failed: %v", err)
+	}
+	if result.Description != "增强后的描述" || result.Name != "张三" || result.Status != CharacterStatusAlive {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if len(fake.requests) != 1 || fake.requests[0].Model != "fake-model" {
+		t.Errorf("unexpected requests: %+v", fake.requests)
+	}
+}
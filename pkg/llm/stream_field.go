@@ -0,0 +1,199 @@
+package llm
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// fieldStreamer 从流式输出中提取正文转发给回调
+// 输出为 JSON 对象时只转发顶层指定字段的字符串值（已反转义），其余字段等流结束后统一解析；
+// 输出为纯文本时原样转发，开头的 markdown 代码块标记会被跳过
+type fieldStreamer struct {
+	field    string
+	callback StreamCallback
+
+	mode    int             // 输出格式：未确定 / 纯文本 / JSON
+	pending strings.Builder // 格式确定前缓存的开头部分
+
+	depth     int             // 当前嵌套层级
+	inString  bool            // 是否在字符串内
+	escape    bool            // 上一个字符是否为反斜杠
+	unicode   []byte          // \u 转义后收集的十六进制字符
+	surrogate rune            // 等待低位代理的高位代理
+	keyPos    bool            // 顶层下一个字符串是否为键
+	isKey     bool            // 当前字符串是否为顶层键
+	key       strings.Builder // 当前顶层键
+	lastKey   string          // 最近一个顶层键
+	streaming bool            // 当前字符串是否为需要转发的字段值
+}
+
+const (
+	streamModeUnknown = iota
+	streamModeText
+	streamModeJSON
+)
+
+// newFieldStreamer 包装流式回调，只转发 JSON 输出中 field 字段的文本，纯文本输出原样转发
+func newFieldStreamer(field string, callback StreamCallback) StreamCallback {
+	s := &fieldStreamer{field: field, callback: callback}
+	return s.write
+}
+
+// write 处理一个分片
+func (s *fieldStreamer) write(segment string, isComplete bool) error {
+	if s.mode == streamModeUnknown {
+		s.pending.WriteString(segment)
+		segment = s.detect(isComplete)
+	}
+
+	var out string
+	switch s.mode {
+	case streamModeText:
+		out = segment
+	case streamModeJSON:
+		out = s.scan(segment)
+	}
+	if out != "" {
+		if err := s.callback(out, false); err != nil {
+			return err
+		}
+	}
+	if isComplete {
+		return s.callback("", true)
+	}
+	return nil
+}
+
+// detect 根据开头内容判断输出格式，返回格式确定后待处理的内容
+func (s *fieldStreamer) detect(isComplete bool) string {
+	head := strings.TrimLeft(s.pending.String(), " \t\r\n")
+	if len(head) < 3 && strings.HasPrefix("```", head) && !isComplete {
+		// 可能是代码块标记的开头，等待更多内容
+		return ""
+	}
+	if strings.HasPrefix(head, "```") {
+		// 代码块标记所在行（如 ```json）整行跳过
+		newline := strings.IndexByte(head, '\n')
+		if newline < 0 {
+			if isComplete {
+				s.mode = streamModeText
+			}
+			return ""
+		}
+		head = strings.TrimLeft(head[newline+1:], " \t\r\n")
+	}
+	if head == "" {
+		if isComplete {
+			s.mode = streamModeText
+		}
+		return ""
+	}
+	if head[0] == '{' {
+		s.mode = streamModeJSON
+	} else {
+		s.mode = streamModeText
+	}
+	s.pending.Reset()
+	return head
+}
+
+// scan 扫描 JSON 片段，返回其中属于目标字段的文本
+func (s *fieldStreamer) scan(segment string) string {
+	var out strings.Builder
+	for i := 0; i < len(segment); i++ {
+		b := segment[i]
+		if !s.inString {
+			switch b {
+			case '{', '[':
+				s.depth++
+				s.keyPos = s.depth == 1 && b == '{'
+			case '}', ']':
+				s.depth--
+			case ',':
+				s.keyPos = s.depth == 1
+			case '"':
+				s.inString = true
+				s.isKey = s.depth == 1 && s.keyPos
+				s.streaming = s.depth == 1 && !s.keyPos && s.lastKey == s.field
+				if s.isKey {
+					s.key.Reset()
+				}
+			}
+			continue
+		}
+
+		switch {
+		case s.unicode != nil:
+			s.unicode = append(s.unicode, b)
+			if len(s.unicode) == 4 {
+				s.emitUnicode(&out)
+			}
+		case s.escape:
+			s.escape = false
+			if b == 'u' {
+				s.unicode = make([]byte, 0, 4)
+				continue
+			}
+			s.emit(&out, string(unescapeJSON(b)))
+		case b == '\\':
+			s.escape = true
+		case b == '"':
+			s.inString = false
+			if s.isKey {
+				s.lastKey = s.key.String()
+				s.keyPos = false
+			}
+			s.streaming = false
+		default:
+			s.emit(&out, segment[i:i+1])
+		}
+	}
+	return out.String()
+}
+
+// emit 输出字符串内的一段文本：键名记录下来，目标字段的值写入输出
+func (s *fieldStreamer) emit(out *strings.Builder, text string) {
+	if s.isKey {
+		s.key.WriteString(text)
+	} else if s.streaming {
+		out.WriteString(text)
+	}
+}
+
+// emitUnicode 解码 \uXXXX 转义，处理 UTF-16 代理对
+func (s *fieldStreamer) emitUnicode(out *strings.Builder) {
+	code, err := strconv.ParseUint(string(s.unicode), 16, 16)
+	s.unicode = nil
+	if err != nil {
+		return
+	}
+	r := rune(code)
+	switch {
+	case utf16.IsSurrogate(r) && r < 0xDC00:
+		s.surrogate = r
+		return
+	case utf16.IsSurrogate(r) && s.surrogate != 0:
+		r = utf16.DecodeRune(s.surrogate, r)
+	}
+	s.surrogate = 0
+	s.emit(out, string(r))
+}
+
+// unescapeJSON 返回单字符转义对应的字符
+func unescapeJSON(b byte) rune {
+	switch b {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	default: // " \ / 以及不合法的转义按原字符处理
+		return rune(b)
+	}
+}
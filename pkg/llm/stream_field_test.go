@@ -0,0 +1,55 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+// feedStreamer 按 size 字节切分输入逐片写入，返回转发出的文本
+func feedStreamer(t *testing.T, input string, size int) string {
+	t.Helper()
+	var out strings.Builder
+	completed := false
+	callback := newFieldStreamer("content", func(segment string, isComplete bool) error {
+		if isComplete {
+			completed = true
+		}
+		out.WriteString(segment)
+		return nil
+	})
+	for len(input) > 0 {
+		n := size
+		if n > len(input) {
+			n = len(input)
+		}
+		if err := callback(input[:n], false); err != nil {
+			t.Fatal(err)
+		}
+		input = input[n:]
+	}
+	if err := callback("", true); err != nil {
+		t.Fatal(err)
+	}
+	if !completed {
+		t.Error("completion should be forwarded")
+	}
+	return out.String()
+}
+
+func TestFieldStreamer_JSON(t *testing.T) {
+	input := "```json\n" + `{"title":"第一章","meta":{"content":"嵌套字段不输出"},"content":"他说：\"走吧。\"\n天亮了。\ud83d\ude00\u4e00","keyEvents":["content"],"summary":"摘要"}` + "\n```"
+	want := "他说：\"走吧。\"\n天亮了。😀一"
+	// 逐字节切分覆盖转义和多字节字符跨分片的情况
+	for _, size := range []int{1, 3, 7, len(input)} {
+		if got := feedStreamer(t, input, size); got != want {
+			t.Errorf("size %d: got %q, want %q", size, got, want)
+		}
+	}
+}
+
+func TestFieldStreamer_PlainText(t *testing.T) {
+	input := "\n  夜色渐深，{他}推开了门。"
+	if got := feedStreamer(t, input, 4); got != "夜色渐深，{他}推开了门。" {
+		t.Errorf("plain text should pass through, got %q", got)
+	}
+}
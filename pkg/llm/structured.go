@@ -0,0 +1,337 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// DefaultStructuredRepairs 结构化输出校验失败时默认的修复重试次数
+const DefaultStructuredRepairs = 2
+
+// maxReportedProblems 修复提示中最多列出的校验问题数
+const maxReportedProblems = 10
+
+// JSONSchema JSON Schema 子集，用于约束和校验结构化输出
+type JSONSchema struct {
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+}
+
+// JSONModeProvider 支持 JSON 输出模式的提供商
+type JSONModeProvider interface {
+	SupportsJSONMode() bool
+}
+
+// supportsJSONMode 判断提供商是否支持 JSON 输出模式
+func supportsJSONMode(provider Provider) bool {
+	p, ok := provider.(JSONModeProvider)
+	return ok && p.SupportsJSONMode()
+}
+
+// StructuredOutputError 多次修复后仍未通过校验
+type StructuredOutputError struct {
+	Attempts int      // 总调用次数
+	Problems []string // 最后一次的校验问题
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("structured output still invalid after %d attempts: %s", e.Attempts, strings.Join(e.Problems, "; "))
+}
+
+var schemaCache sync.Map // reflect.Type -> *JSONSchema
+
+// SchemaOf 根据结构体定义生成 JSON Schema
+// 字段名取 json 标签；带 omitempty、指针类型或 llm:"optional" 的字段为可选；llm:"-" 的字段不出现在 Schema 中
+func SchemaOf[T any]() *JSONSchema {
+	return schemaForType(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+func schemaForType(t reflect.Type) *JSONSchema {
+	if cached, ok := schemaCache.Load(t); ok {
+		return cached.(*JSONSchema)
+	}
+	schema := buildSchema(t)
+	schemaCache.Store(t, schema)
+	return schema
+}
+
+func buildSchema(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: buildSchema(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: buildSchema(t.Elem())}
+	case reflect.Struct:
+		schema := &JSONSchema{Type: "object", Properties: map[string]*JSONSchema{}}
+		addStructFields(schema, t)
+		return schema
+	default:
+		return &JSONSchema{}
+	}
+}
+
+// addStructFields 添加结构体字段，匿名嵌入的结构体字段展开到同一层
+func addStructFields(schema *JSONSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("llm") == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addStructFields(schema, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = buildSchema(field.Type)
+		optional := strings.Contains(opts, "omitempty") ||
+			field.Type.Kind() == reflect.Ptr ||
+			field.Tag.Get("llm") == "optional"
+		if !optional {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// Validate 校验已解析的 JSON 值，返回所有问题（为空表示通过）
+func (s *JSONSchema) Validate(value any) []string {
+	var problems []string
+	s.validate(value, "$", &problems)
+	return problems
+}
+
+func (s *JSONSchema) validate(value any, path string, problems *[]string) {
+	if value == nil {
+		*problems = append(*problems, fmt.Sprintf("%s 不能为 null，应为 %s", path, s.Type))
+		return
+	}
+
+	switch s.Type {
+	case "string":
+		if _, ok := value.(string); !ok {
+			*problems = append(*problems, typeProblem(path, s.Type, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			*problems = append(*problems, typeProblem(path, s.Type, value))
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			*problems = append(*problems, typeProblem(path, s.Type, value))
+		} else if _, err := n.Int64(); err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s 应为整数，实际为 %s", path, n))
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			*problems = append(*problems, typeProblem(path, s.Type, value))
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			*problems = append(*problems, typeProblem(path, s.Type, value))
+			return
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			*problems = append(*problems, typeProblem(path, s.Type, value))
+			return
+		}
+		for _, name := range s.Required {
+			if _, exists := obj[name]; !exists {
+				*problems = append(*problems, fmt.Sprintf("%s 缺少必填字段 %s", path, name))
+			}
+		}
+		for name, v := range obj {
+			if prop, ok := s.Properties[name]; ok {
+				if v == nil && !containsString(s.Required, name) {
+					continue
+				}
+				prop.validate(v, path+"."+name, problems)
+			} else if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(v, path+"."+name, problems)
+			}
+		}
+	}
+}
+
+// typeProblem 描述类型不匹配
+func typeProblem(path, want string, value any) string {
+	var got string
+	switch value.(type) {
+	case string:
+		got = "string"
+	case bool:
+		got = "boolean"
+	case json.Number:
+		got = "number"
+	case []any:
+		got = "array"
+	case map[string]any:
+		got = "object"
+	default:
+		got = fmt.Sprintf("%T", value)
+	}
+	return fmt.Sprintf("%s 应为 %s，实际为 %s", path, want, got)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeStructured 清理并校验模型输出，通过后解析为目标结构
+// 输出本身是合法 JSON 时不做字符替换，避免正文中的全角标点被改写
+func DecodeStructured[T any](raw string) (*T, []string) {
+	cleaned := ExtractJSON(strings.TrimSpace(raw))
+	value, err := decodeJSONValue(cleaned)
+	if err != nil {
+		cleaned = CleanAIResponse(raw)
+		if value, err = decodeJSONValue(cleaned); err != nil {
+			return nil, []string{"输出不是合法的 JSON: " + err.Error()}
+		}
+	}
+
+	if problems := SchemaOf[T]().Validate(value); len(problems) > 0 {
+		if len(problems) > maxReportedProblems {
+			problems = append(problems[:maxReportedProblems], fmt.Sprintf("另有 %d 个问题未列出", len(problems)-maxReportedProblems))
+		}
+		return nil, problems
+	}
+
+	var result T
+	if err := json.Unmarshal([]byte(cleaned), &result); err != nil {
+		return nil, []string{"解析失败: " + err.Error()}
+	}
+	return &result, nil
+}
+
+// decodeJSONValue 解析 JSON，数字保留为 json.Number 以便校验整数类型
+func decodeJSONValue(text string) (any, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	return value, err
+}
+
+// GenerateStructured 生成结构化结果：按目标结构生成 Schema，支持时开启 JSON 模式，校验失败时带上问题发送修复提示
+func GenerateStructured[T any](ctx context.Context, h *LLMHandler, prompt string, options QueryOptions) (*T, error) {
+	ctx = withCallTrace(ctx)
+	options.ResponseSchema = SchemaOf[T]()
+	messages := h.BuildMessages(prompt, options)
+
+	raw, err := h.queryMessages(ctx, messages, options)
+	if err != nil {
+		return nil, err
+	}
+	return repairStructured[T](ctx, h, messages, options, raw)
+}
+
+// GenerateStructuredStream 流式生成结构化结果，流结束后校验，修复阶段使用非流式调用
+func GenerateStructuredStream[T any](ctx context.Context, h *LLMHandler, prompt string, options QueryOptions, callback func(segment string, isComplete bool) error) (*T, error) {
+	ctx = withCallTrace(ctx)
+	options.ResponseSchema = SchemaOf[T]()
+	messages := h.BuildMessages(prompt, options)
+
+	raw, err := h.streamMessages(ctx, messages, options, callback)
+	if err != nil {
+		return nil, err
+	}
+	return repairStructured[T](ctx, h, messages, options, raw)
+}
+
+// repairStructured 校验输出，失败时追加修复提示重新生成，最多 MaxRepairs 次
+func repairStructured[T any](ctx context.Context, h *LLMHandler, messages []Message, options QueryOptions, raw string) (*T, error) {
+	maxRepairs := options.MaxRepairs
+	if maxRepairs == 0 {
+		maxRepairs = DefaultStructuredRepairs
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, problems := DecodeStructured[T](raw)
+		if trace := callTraceFrom(ctx); trace != nil {
+			trace.reportParse(ctx, problems)
+		}
+		if len(problems) == 0 {
+			return result, nil
+		}
+		if attempt > maxRepairs {
+			return nil, &StructuredOutputError{Attempts: attempt, Problems: problems}
+		}
+
+		logger.Warn("结构化输出校验失败，发送修复提示",
+			zap.String("task", options.task()),
+			zap.Int("attempt", attempt),
+			zap.Strings("problems", problems))
+
+		repairPrompt, _, err := RenderPrompt(PromptStructuredRepair, StructuredRepairPrompt{
+			Problems: problems,
+			Schema:   schemaText(options.ResponseSchema),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages,
+			Message{Role: "assistant", Content: raw},
+			Message{Role: "user", Content: repairPrompt})
+		raw, err = h.queryMessages(ctx, messages, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// schemaText 格式化 Schema 用于提示词
+func schemaText(schema *JSONSchema) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(schema); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(buf.String())
+}
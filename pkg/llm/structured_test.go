@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSchemaOf(t *testing.T) {
+	schema := SchemaOf[StorylineGenerateResponse]()
+
+	if _, ok := schema.Properties["promptVersion"]; ok {
+		t.Error(`fields tagged llm:"-" should be excluded`)
+	}
+	if !containsString(schema.Required, "storylines") {
+		t.Errorf("storylines should be required: %v", schema.Required)
+	}
+
+	node := schema.Properties["storylines"].Items.Properties["nodes"].Items
+	if node.Properties["orderIndex"].Type != "integer" {
+		t.Errorf("orderIndex should be integer, got %+v", node.Properties["orderIndex"])
+	}
+	if containsString(node.Required, "status") || !containsString(node.Required, "title") {
+		t.Errorf("unexpected required node fields: %v", node.Required)
+	}
+}
+
+func TestDecodeStructured(t *testing.T) {
+	result, problems := DecodeStructured[connectionsResponse]("```json\n{\"connections\":[{\"fromIndex\":0,\"toIndex\":1,\"connectionType\":\"cause\"}]}\n```")
+	if len(problems) > 0 {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+	if len(result.Connections) != 1 || result.Connections[0].ToIndex != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	_, problems = DecodeStructured[connectionsResponse](`{"connections":[{"fromIndex":"0","toIndex":1.5}]}`)
+	joined := strings.Join(problems, "\n")
+	for _, want := range []string{"$.connections[0].fromIndex 应为 integer", "$.connections[0].toIndex 应为整数", "缺少必填字段 connectionType"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected problem %q in:\n%s", want, joined)
+		}
+	}
+
+	if _, problems = DecodeStructured[connectionsResponse]("抱歉，我无法完成"); len(problems) != 1 {
+		t.Errorf("expected a single JSON syntax problem, got %v", problems)
+	}
+}
+
+func TestGenerateStructured_Repair(t *testing.T) {
+	mock := NewMockProvider("")
+	mock.Script(PromptStorylineConnections,
+		MockResponse{Content: `{"connections":[{"fromIndex":0}]}`},
+		MockResponse{Content: `{"connections":[{"fromIndex":0,"toIndex":1,"connectionType":"sequence"}]}`},
+	)
+
+	connections, err := NewStorylineGenerator(mock, "mock").SuggestConnections(context.Background(), []string{"开端", "发展"})
+	if err != nil {
+		t.Fatalf("SuggestConnections failed: %v", err)
+	}
+	if len(connections) != 1 || connections[0].ConnectionType != "sequence" {
+		t.Errorf("unexpected connections: %+v", connections)
+	}
+
+	requests := mock.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("expected one repair call, got %d requests", len(requests))
+	}
+	if requests[0].ResponseSchema == nil {
+		t.Error("JSON mode should be requested from providers that support it")
+	}
+	repair := requests[1].Messages
+	if repair[len(repair)-2].Role != "assistant" || !strings.Contains(repair[len(repair)-1].Content, "缺少必填字段 toIndex") {
+		t.Errorf("repair prompt should carry the previous output and problems: %+v", repair[len(repair)-2:])
+	}
+}
+
+func TestGenerateStructured_GivesUp(t *testing.T) {
+	fake := &fakeProvider{reply: "不是 JSON"}
+	h := NewLLMHandler(fake, "")
+
+	_, err := GenerateStructured[connectionsResponse](context.Background(), h, "指令", QueryOptions{MaxRepairs: 1})
+	var structuredErr *StructuredOutputError
+	if !errors.As(err, &structuredErr) || structuredErr.Attempts != 2 {
+		t.Fatalf("expected StructuredOutputError after 2 attempts, got %v", err)
+	}
+	if len(fake.requests) != 2 || fake.requests[0].ResponseSchema != nil {
+		t.Errorf("unexpected requests to provider without JSON mode: %+v", fake.requests)
+	}
+}
@@ -2,7 +2,6 @@ package llm
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"strings"
 )
@@ -17,15 +16,16 @@ type StyleAnalysisRequest struct {
 
 // StyleAnalysisResponse 风格分析响应
 type StyleAnalysisResponse struct {
-	WritingStyle     string   `json:"writingStyle"`     // 写作风格总结
-	KeyFeatures      []string `json:"keyFeatures"`      // 关键特征
-	DialogueStyle    string   `json:"dialogueStyle"`    // 对话风格
-	DescriptionStyle string   `json:"descriptionStyle"` // 描写风格
-	PacingStyle      string   `json:"pacingStyle"`      // 节奏风格
-	VocabularyLevel  string   `json:"vocabularyLevel"`  // 词汇水平
-	SentencePattern  string   `json:"sentencePattern"`  // 句式特点
-	Examples         []string `json:"examples"`         // 典型例句
-	StyleGuide       string   `json:"styleGuide"`       // 风格指南（用于生成时参考）
+	WritingStyle     string   `json:"writingStyle"`            // 写作风格总结
+	KeyFeatures      []string `json:"keyFeatures"`             // 关键特征
+	DialogueStyle    string   `json:"dialogueStyle"`           // 对话风格
+	DescriptionStyle string   `json:"descriptionStyle"`        // 描写风格
+	PacingStyle      string   `json:"pacingStyle"`             // 节奏风格
+	VocabularyLevel  string   `json:"vocabularyLevel"`         // 词汇水平
+	SentencePattern  string   `json:"sentencePattern"`         // 句式特点
+	Examples         []string `json:"examples" llm:"optional"` // 典型例句
+	StyleGuide       string   `json:"styleGuide"`              // 风格指南（用于生成时参考）
+	PromptVersion    string   `json:"promptVersion" llm:"-"`   // 分析所用的提示词模板版本
 }
 
 // NovelChunk 小说片段（用于分块处理）
@@ -43,25 +43,8 @@ type StyleAnalyzer struct {
 }
 
 // NewStyleAnalyzer 创建风格分析器
-func NewStyleAnalyzer(apiKey, baseURL, model string) *StyleAnalyzer {
-	systemPrompt := `你是一个专业的文学风格分析师，擅长分析小说的写作风格、叙事技巧和语言特点。
-
-你的任务是：
-1. 分析提供的小说片段，提取其写作风格特征
-2. 总结作者的叙事技巧和语言习惯
-3. 生成可用于 AI 写作的风格指南
-
-分析维度：
-- 写作风格：整体风格（简洁/华丽/写实/浪漫等）
-- 对话风格：对话的特点和处理方式
-- 描写风格：环境、人物、动作的描写方式
-- 节奏控制：情节推进的节奏和张弛
-- 词汇特点：常用词汇、句式结构
-- 叙事视角：第一人称/第三人称，全知/限知
-
-请以 JSON 格式返回分析结果。`
-
-	handler := NewLLMHandler(context.Background(), apiKey, baseURL, systemPrompt)
+func NewStyleAnalyzer(provider Provider, model string) *StyleAnalyzer {
+	handler := NewLLMHandler(provider, "").WithSystemTemplate(PromptStyleSystem)
 
 	if model == "" {
 		model = "gpt-3.5-turbo"
@@ -74,71 +57,28 @@ func NewStyleAnalyzer(apiKey, baseURL, model string) *StyleAnalyzer {
 }
 
 // AnalyzeStyle 分析小说风格
-func (a *StyleAnalyzer) AnalyzeStyle(req StyleAnalysisRequest) (*StyleAnalysisResponse, error) {
+func (a *StyleAnalyzer) AnalyzeStyle(ctx context.Context, req StyleAnalysisRequest) (*StyleAnalysisResponse, error) {
 	// 构建提示词
-	prompt := fmt.Sprintf("请分析以下小说的写作风格：\n\n")
-	prompt += fmt.Sprintf("小说：%s\n", req.NovelTitle)
-
-	if req.NovelGenre != "" {
-		prompt += fmt.Sprintf("类型：%s\n", req.NovelGenre)
-	}
-
-	prompt += fmt.Sprintf("\n【样本片段】\n")
-	for i, sample := range req.Samples {
-		prompt += fmt.Sprintf("\n--- 片段 %d ---\n%s\n", i+1, sample)
+	prompt, ref, err := RenderPrompt(PromptStyleAnalyze, req)
+	if err != nil {
+		return nil, err
 	}
 
-	prompt += `
-
-请从以下维度分析这部小说的写作风格：
-
-1. 整体写作风格（简洁/华丽/写实/浪漫等）
-2. 关键特征（列举3-5个最突出的特点）
-3. 对话风格（对话的处理方式和特点）
-4. 描写风格（环境、人物、动作的描写方式）
-5. 节奏控制（情节推进的节奏）
-6. 词汇水平（用词特点）
-7. 句式特点（句子结构和长度）
-8. 典型例句（从样本中提取2-3个最能体现风格的句子）
-9. 风格指南（总结成一段话，用于指导 AI 模仿这种风格写作）
-
-⚠️ 重要：请严格按照以下 JSON 格式返回，字段名必须使用英文：
-{
-  "writingStyle": "整体风格描述",
-  "keyFeatures": ["特征1", "特征2", "特征3"],
-  "dialogueStyle": "对话风格描述",
-  "descriptionStyle": "描写风格描述",
-  "pacingStyle": "节奏风格描述",
-  "vocabularyLevel": "词汇水平描述",
-  "sentencePattern": "句式特点描述",
-  "examples": ["例句1", "例句2"],
-  "styleGuide": "风格指南（一段完整的文字）"
-}
-
-不要使用中文字段名，不要包含任何 markdown 标记或其他文本，只返回纯 JSON。`
-
 	// 调用 LLM
 	options := QueryOptions{
 		Model:       a.model,
 		Temperature: Float32Ptr(0.5), // 较低温度以保持分析准确性
 		MaxTokens:   IntPtr(2000),
+		Prompt:      ref,
 	}
 
-	response, err := a.handler.QueryWithOptions(prompt, options)
+	result, err := GenerateStructured[StyleAnalysisResponse](ctx, a.handler, prompt, options)
 	if err != nil {
 		return nil, fmt.Errorf("failed to analyze style: %w", err)
 	}
 
-	// 清理响应
-	cleanedResponse := CleanAIResponse(response)
-
-	// 解析响应
-	var result StyleAnalysisResponse
-	if err := json.Unmarshal([]byte(cleanedResponse), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w (response: %s)", err, cleanedResponse)
-	}
-
-	return &result, nil
+	result.PromptVersion = ref.String()
+	return result, nil
 }
 
 // ChunkNovel 将长篇小说分块（智能采样）
@@ -251,35 +191,22 @@ func (a *StyleAnalyzer) GenerateStyleGuide(analysis *StyleAnalysisResponse) stri
 }
 
 // CompareStyles 比较两个小说的风格差异
-func (a *StyleAnalyzer) CompareStyles(style1, style2 *StyleAnalysisResponse) (string, error) {
-	prompt := fmt.Sprintf(`请比较以下两种写作风格的异同：
-
-风格 A：
-- 整体风格：%s
-- 对话风格：%s
-- 描写风格：%s
-
-风格 B：
-- 整体风格：%s
-- 对话风格：%s
-- 描写风格：%s
-
-请分析：
-1. 主要相似点
-2. 主要差异点
-3. 各自的优势
-4. 适合的场景
-
-返回简洁的分析（300字以内）。`,
-		style1.WritingStyle, style1.DialogueStyle, style1.DescriptionStyle,
-		style2.WritingStyle, style2.DialogueStyle, style2.DescriptionStyle)
+func (a *StyleAnalyzer) CompareStyles(ctx context.Context, style1, style2 *StyleAnalysisResponse) (string, error) {
+	prompt, ref, err := RenderPrompt(PromptStyleCompare, StyleComparePrompt{
+		StyleA: style1,
+		StyleB: style2,
+	})
+	if err != nil {
+		return "", err
+	}
 
 	options := QueryOptions{
 		Model:       a.model,
 		Temperature: Float32Ptr(0.5),
+		Prompt:      ref,
 	}
 
-	response, err := a.handler.QueryWithOptions(prompt, options)
+	response, err := a.handler.QueryWithOptions(ctx, prompt, options)
 	if err != nil {
 		return "", fmt.Errorf("failed to compare styles: %w", err)
 	}
@@ -288,27 +215,22 @@ func (a *StyleAnalyzer) CompareStyles(style1, style2 *StyleAnalysisResponse) (st
 }
 
 // SuggestStyleImprovements 建议风格改进
-func (a *StyleAnalyzer) SuggestStyleImprovements(currentStyle *StyleAnalysisResponse, targetGenre string) (string, error) {
-	prompt := fmt.Sprintf(`当前写作风格：
-%s
-
-目标类型：%s
-
-请针对目标类型，建议如何改进当前的写作风格，包括：
-1. 需要保留的优点
-2. 需要改进的方面
-3. 具体的改进建议
-4. 参考的优秀作品
-
-返回简洁的建议（400字以内）。`,
-		a.GenerateStyleGuide(currentStyle), targetGenre)
+func (a *StyleAnalyzer) SuggestStyleImprovements(ctx context.Context, currentStyle *StyleAnalysisResponse, targetGenre string) (string, error) {
+	prompt, ref, err := RenderPrompt(PromptStyleImprove, StyleImprovePrompt{
+		StyleGuide:  a.GenerateStyleGuide(currentStyle),
+		TargetGenre: targetGenre,
+	})
+	if err != nil {
+		return "", err
+	}
 
 	options := QueryOptions{
 		Model:       a.model,
 		Temperature: Float32Ptr(0.7),
+		Prompt:      ref,
 	}
 
-	response, err := a.handler.QueryWithOptions(prompt, options)
+	response, err := a.handler.QueryWithOptions(ctx, prompt, options)
 	if err != nil {
 		return "", fmt.Errorf("failed to suggest improvements: %w", err)
 	}
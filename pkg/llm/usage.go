@@ -0,0 +1,199 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LingByte/LingDialog/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// cancelledCalls 因上下文取消或超时而中止的调用次数（进程级累计）
+var cancelledCalls atomic.Int64
+
+// CancelledCalls 返回进程启动以来因上下文取消或超时而中止的 LLM 调用次数
+func CancelledCalls() int64 {
+	return cancelledCalls.Load()
+}
+
+// UsageSummary 一次请求内 LLM 调用的用量汇总
+type UsageSummary struct {
+	Calls        int    // 调用次数（含命中缓存的调用）
+	Usage               // 实际消耗的 token，命中缓存的调用不计入
+	CacheHits    int    // 命中缓存的调用次数
+	CachedTokens int    // 命中缓存节省的 token
+	Estimated    bool   // 是否有调用未返回用量、按字符数估算
+	Model        string // 最近一次调用使用的模型
+}
+
+// UsageScope 累计同一请求内所有 LLM 调用的用量，可并发使用
+type UsageScope struct {
+	mu      sync.Mutex
+	summary UsageSummary
+}
+
+// usageScopeKey 上下文中保存 UsageScope 的键
+type usageScopeKey struct{}
+
+// WithUsageScope 在上下文中创建用量统计范围，通过 MeteredProvider 发起的调用会计入其中
+func WithUsageScope(ctx context.Context) (context.Context, *UsageScope) {
+	scope := &UsageScope{}
+	return context.WithValue(ctx, usageScopeKey{}, scope), scope
+}
+
+// UsageScopeFrom 返回上下文中的用量统计范围，不存在时返回 nil
+func UsageScopeFrom(ctx context.Context) *UsageScope {
+	scope, _ := ctx.Value(usageScopeKey{}).(*UsageScope)
+	return scope
+}
+
+// Add 计入一次调用的响应
+func (s *UsageScope) Add(resp *ChatResponse, estimated bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.summary.Calls++
+	if resp.Model != "" {
+		s.summary.Model = resp.Model
+	}
+	if resp.Cached {
+		s.summary.CacheHits++
+		s.summary.CachedTokens += resp.Usage.TotalTokens
+		return
+	}
+	s.summary.PromptTokens += resp.Usage.PromptTokens
+	s.summary.CompletionTokens += resp.Usage.CompletionTokens
+	s.summary.TotalTokens += resp.Usage.TotalTokens
+	s.summary.Estimated = s.summary.Estimated || estimated
+}
+
+// Summary 返回当前累计的用量
+func (s *UsageScope) Summary() UsageSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.summary
+}
+
+// MeteredProvider 将每次调用的用量计入上下文中的 UsageScope
+// 提供商未返回用量时（部分兼容接口的流式响应）按模型估算，保证配额不会被绕过
+// 因上下文取消而中止的调用会记录日志并计数，已输出部分的用量照常计入；
+// 设置了 CallRecorder 时每次调用（包括失败和取消的调用）写入一条审计记录
+type MeteredProvider struct {
+	inner Provider
+}
+
+// NewMeteredProvider 为提供商添加用量统计
+func NewMeteredProvider(inner Provider) *MeteredProvider {
+	return &MeteredProvider{inner: inner}
+}
+
+// Unwrap 返回被包装的提供商
+func (p *MeteredProvider) Unwrap() Provider {
+	return p.inner
+}
+
+// Name 返回被包装提供商的名称
+func (p *MeteredProvider) Name() string {
+	return p.inner.Name()
+}
+
+// SupportsJSONMode 与被包装的提供商一致
+func (p *MeteredProvider) SupportsJSONMode() bool {
+	return supportsJSONMode(p.inner)
+}
+
+// SupportsTools 与被包装的提供商一致
+func (p *MeteredProvider) SupportsTools() bool {
+	return SupportsTools(p.inner)
+}
+
+// ListModels 列出可用模型
+func (p *MeteredProvider) ListModels(ctx context.Context) ([]string, error) {
+	return p.inner.ListModels(ctx)
+}
+
+// Chat 非流式对话
+func (p *MeteredProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	start := time.Now()
+	resp, err := p.inner.Chat(ctx, req)
+	p.record(ctx, req, resp, err, false, time.Since(start))
+	return resp, err
+}
+
+// ChatStream 流式对话，中途失败时已输出部分的用量同样计入
+func (p *MeteredProvider) ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*ChatResponse, error) {
+	start := time.Now()
+	resp, err := p.inner.ChatStream(ctx, req, callback)
+	p.record(ctx, req, resp, err, true, time.Since(start))
+	return resp, err
+}
+
+// record 将响应用量计入上下文中的统计范围，统计被取消的调用，并写入审计记录
+func (p *MeteredProvider) record(ctx context.Context, req ChatRequest, resp *ChatResponse, err error, stream bool, latency time.Duration) {
+	cancelled := err != nil && ctx.Err() != nil
+	if cancelled {
+		partial := 0
+		if resp != nil {
+			partial = len([]rune(resp.Content))
+		}
+		logger.Warn("LLM 调用已取消",
+			zap.String("provider", p.inner.Name()),
+			zap.String("model", req.Model),
+			zap.Int("partialChars", partial),
+			zap.NamedError("cause", context.Cause(ctx)),
+			zap.Int64("cancelledTotal", cancelledCalls.Add(1)))
+	}
+
+	estimated := false
+	if resp != nil && resp.Usage.TotalTokens == 0 && resp.Content != "" && !resp.Cached {
+		count := TokenCounterFor(req.Model)
+		prompt, completion := CountMessageTokens(count, req.Messages), count(resp.Content)
+		resp.Usage = Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+		estimated = true
+	}
+	if scope := UsageScopeFrom(ctx); scope != nil && resp != nil {
+		scope.Add(resp, estimated)
+	}
+
+	recorder := getCallRecorder()
+	if recorder == nil {
+		return
+	}
+	record := &CallRecord{
+		Task:          req.Task,
+		Provider:      p.inner.Name(),
+		Model:         req.Model,
+		PromptVersion: req.PromptRef.String(),
+		Stream:        stream,
+		Temperature:   req.Temperature,
+		MaxTokens:     req.MaxTokens,
+		Messages:      req.Messages,
+		Estimated:     estimated,
+		Latency:       latency,
+		Err:           err,
+		Cancelled:     cancelled,
+	}
+	if info := CallInfoFrom(ctx); info != nil {
+		record.Info = *info
+	}
+	if resp != nil {
+		if resp.Model != "" {
+			record.Model = resp.Model
+		}
+		if resp.Provider != "" {
+			// 备用提供商接管时记录实际提供回复的提供商
+			record.Provider = resp.Provider
+		}
+		record.Response = resp.Content
+		record.ToolCalls = resp.ToolCalls
+		record.Usage = resp.Usage
+		record.Cached = resp.Cached
+	}
+	// 请求已取消时同样保存，便于排查中断的生成
+	recorder.RecordCall(context.WithoutCancel(ctx), record)
+	if trace := callTraceFrom(ctx); trace != nil {
+		trace.setLast(record)
+	}
+}
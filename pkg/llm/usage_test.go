@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// recordingRecorder 保存审计记录，用于检查记录的字段
+type recordingRecorder struct {
+	records []*CallRecord
+}
+
+func (r *recordingRecorder) RecordCall(ctx context.Context, record *CallRecord) {
+	r.records = append(r.records, record)
+}
+
+func (r *recordingRecorder) RecordParse(ctx context.Context, record *CallRecord, problems []string) {}
+
+func TestMeteredProvider_RecordsIntoScope(t *testing.T) {
+	upstream := &fakeProvider{reply: "好的"}
+	metered := NewMeteredProvider(NewCachedProvider(upstream, CacheOptions{MaxTemperature: 0.7}))
+	req := ChatRequest{Model: "gpt-4", Messages: []Message{{Role: "user", Content: "你好"}}, Temperature: Float32Ptr(0.2)}
+
+	// 没有统计范围时直接转发
+	if _, err := metered.Chat(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, scope := WithUsageScope(context.Background())
+	if _, err := metered.Chat(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	// 流式响应未返回用量时按字符数估算
+	resp, err := metered.ChatStream(ctx, ChatRequest{Model: "gpt-4", Messages: req.Messages}, func(string, bool) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Usage.TotalTokens == 0 {
+		t.Error("stream usage should be estimated")
+	}
+
+	summary := scope.Summary()
+	if summary.Calls != 2 || summary.CacheHits != 1 || summary.CachedTokens != 3 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if summary.TotalTokens != resp.Usage.TotalTokens || !summary.Estimated {
+		t.Errorf("only the uncached stream call should consume tokens: %+v", summary)
+	}
+}
+
+func TestMeteredProvider_CancelledStream(t *testing.T) {
+	metered := NewMeteredProvider(&fakeProvider{reply: "很长的一段回复"})
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, scope := WithUsageScope(ctx)
+	before := CancelledCalls()
+
+	// 输出两个分片后客户端断开
+	received := 0
+	_, err := metered.ChatStream(ctx, ChatRequest{Model: "gpt-4"}, func(segment string, isComplete bool) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if received++; received == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	if got := CancelledCalls() - before; got != 1 {
+		t.Errorf("expected 1 cancelled call, got %d", got)
+	}
+	if scope.Summary().Calls != 0 {
+		t.Error("a cancelled call without a response should not be recorded")
+	}
+}
+
+func TestMeteredProvider_RecordsServingProvider(t *testing.T) {
+	recorder := &recordingRecorder{}
+	SetCallRecorder(recorder)
+	t.Cleanup(func() { SetCallRecorder(nil) })
+
+	// 主提供商熔断后由备用提供商回复，审计记录使用实际回复的提供商
+	primary := &flakyProvider{name: ProviderOpenAI, status: http.StatusServiceUnavailable, failures: 100}
+	opts := testResilienceOptions()
+	opts.Fallback, opts.FallbackModel = NewMockProvider(""), "mock-model"
+	metered := NewMeteredProvider(NewResilientProvider(primary, opts))
+	if _, err := metered.Chat(context.Background(), ChatRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.records) != 1 || recorder.records[0].Provider != ProviderMock {
+		t.Fatalf("expected the fallback provider to be recorded: %+v", recorder.records)
+	}
+
+	// 没有响应时使用包装的提供商名称
+	opts.Fallback = nil
+	metered = NewMeteredProvider(NewResilientProvider(primary, opts))
+	metered.Chat(context.Background(), ChatRequest{Model: "gpt-4"})
+	if len(recorder.records) != 2 || recorder.records[1].Provider != ProviderOpenAI {
+		t.Fatalf("expected the wrapped provider to be recorded: %+v", recorder.records)
+	}
+}
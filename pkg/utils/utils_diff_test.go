@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     []string
+		expected []DiffLine
+	}{
+		{
+			name:     "both empty",
+			expected: []DiffLine{},
+		},
+		{
+			name: "identical",
+			a:    []string{"a", "b"},
+			b:    []string{"a", "b"},
+			expected: []DiffLine{
+				{Op: DiffEqual, Text: "a"},
+				{Op: DiffEqual, Text: "b"},
+			},
+		},
+		{
+			name: "insert in middle",
+			a:    []string{"a", "c"},
+			b:    []string{"a", "b", "c"},
+			expected: []DiffLine{
+				{Op: DiffEqual, Text: "a"},
+				{Op: DiffInsert, Text: "b"},
+				{Op: DiffEqual, Text: "c"},
+			},
+		},
+		{
+			name: "replace line",
+			a:    []string{"a", "b", "c"},
+			b:    []string{"a", "x", "c"},
+			expected: []DiffLine{
+				{Op: DiffEqual, Text: "a"},
+				{Op: DiffDelete, Text: "b"},
+				{Op: DiffInsert, Text: "x"},
+				{Op: DiffEqual, Text: "c"},
+			},
+		},
+		{
+			name: "moved line",
+			a:    []string{"a", "b", "c", "d"},
+			b:    []string{"b", "c", "a", "d"},
+			expected: []DiffLine{
+				{Op: DiffDelete, Text: "a"},
+				{Op: DiffEqual, Text: "b"},
+				{Op: DiffEqual, Text: "c"},
+				{Op: DiffInsert, Text: "a"},
+				{Op: DiffEqual, Text: "d"},
+			},
+		},
+		{
+			name: "all removed",
+			a:    []string{"a", "b"},
+			expected: []DiffLine{
+				{Op: DiffDelete, Text: "a"},
+				{Op: DiffDelete, Text: "b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DiffLines(tt.a, tt.b))
+		})
+	}
+}
+
+func TestSplitParagraphs(t *testing.T) {
+	assert.Nil(t, SplitParagraphs(""))
+	assert.Equal(t, []string{"第一段", "第二段"}, SplitParagraphs("  第一段\r\n\r\n　第二段  \n"))
+	assert.Equal(t, []string{"a", "", "b"}, SplitLines("a\n\nb"))
+}